@@ -2,13 +2,20 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/jointwt/twtxt"
 	"github.com/jointwt/twtxt/types"
@@ -24,10 +31,48 @@ var (
 	// ErrUnauthorized ...
 	ErrUnauthorized = errors.New("error: authorization failed")
 
+	// ErrForbidden ...
+	ErrForbidden = errors.New("error: forbidden")
+
+	// ErrNotFound ...
+	ErrNotFound = errors.New("error: not found")
+
 	// ErrServerError
 	ErrServerError = errors.New("error: server error")
 )
 
+// Error is an error response from the API, it matches (with errors.Is) the
+// ErrXXX error of its status code
+type Error struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("error: %s", e.Status)
+	}
+	return fmt.Sprintf("error: %s: %s", e.Status, e.Message)
+}
+
+// Is ...
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrServerError:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
 // Client ...
 type Client struct {
 	BaseURL   *url.URL
@@ -62,10 +107,7 @@ func NewClient(options ...Option) (*Client, error) {
 	return cli, nil
 }
 
-func (c *Client) newRequest(method, path string, body interface{}) (*http.Request, error) {
-	path = strings.TrimPrefix(path, "/")
-	rel := &url.URL{Path: path}
-	u := c.BaseURL.ResolveReference(rel)
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Request, error) {
 	var buf io.ReadWriter
 	if body != nil {
 		buf = new(bytes.Buffer)
@@ -74,12 +116,25 @@ func (c *Client) newRequest(method, path string, body interface{}) (*http.Reques
 			return nil, err
 		}
 	}
-	req, err := http.NewRequest(method, u.String(), buf)
+
+	contentType := ""
+	if body != nil {
+		contentType = "application/json"
+	}
+
+	return c.newRawRequest(ctx, method, path, query, contentType, buf)
+}
+
+func (c *Client) newRawRequest(ctx context.Context, method, path string, query url.Values, contentType string, body io.Reader) (*http.Request, error) {
+	path = strings.TrimPrefix(path, "/")
+	rel := &url.URL{Path: path, RawQuery: query.Encode()}
+	u := c.BaseURL.ResolveReference(rel)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
 	if err != nil {
 		return nil, err
 	}
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
 	}
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("User-Agent", c.UserAgent)
@@ -89,6 +144,8 @@ func (c *Client) newRequest(method, path string, body interface{}) (*http.Reques
 	return req, nil
 }
 
+// do sends the request and decodes the response into v (if not nil), non-2xx
+// responses are returned as an *Error
 func (c *Client) do(req *http.Request, v interface{}) error {
 	res, err := c.httpClient.Do(req)
 	if err != nil {
@@ -96,23 +153,48 @@ func (c *Client) do(req *http.Request, v interface{}) error {
 	}
 	defer res.Body.Close()
 
-	switch res.StatusCode {
-	case http.StatusUnauthorized:
-		return ErrUnauthorized
-	case http.StatusBadRequest:
-		return ErrBadRequest
-	case http.StatusInternalServerError:
-		return ErrServerError
+	if res.StatusCode/100 != 2 {
+		data, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+		return &Error{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Message:    strings.TrimSpace(string(data)),
+		}
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	// Some endpoints (e.g: register) have no response body
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil && err != io.EOF {
+		return err
 	}
 
-	err = json.NewDecoder(res.Body).Decode(v)
+	return nil
+}
+
+// Ping ...
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := c.newRequest(ctx, "GET", "/ping", nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
 
-	return err
+// Register ...
+func (c *Client) Register(ctx context.Context, username, password, email string) error {
+	req, err := c.newRequest(ctx, "POST", "/register", nil, types.RegisterRequest{Username: username, Password: password, Email: email})
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
 }
 
 // Login ...
-func (c *Client) Login(username, password string) (res types.AuthResponse, err error) {
-	req, err := c.newRequest("POST", "/auth", types.AuthRequest{Username: username, Password: password})
+func (c *Client) Login(ctx context.Context, username, password string) (res types.AuthResponse, err error) {
+	req, err := c.newRequest(ctx, "POST", "/auth", nil, types.AuthRequest{Username: username, Password: password})
 	if err != nil {
 		return types.AuthResponse{}, err
 	}
@@ -120,22 +202,433 @@ func (c *Client) Login(username, password string) (res types.AuthResponse, err e
 	return
 }
 
+// PodConfig ...
+func (c *Client) PodConfig(ctx context.Context) (res types.PodConfigResponse, err error) {
+	req, err := c.newRequest(ctx, "POST", "/config", nil, nil)
+	if err != nil {
+		return types.PodConfigResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
 // Post ...
-func (c *Client) Post(text string) (res types.AuthResponse, err error) {
-	req, err := c.newRequest("POST", "/post", types.PostRequest{Text: text})
+func (c *Client) Post(ctx context.Context, text string) error {
+	return c.post(ctx, types.PostRequest{Text: text})
+}
+
+// PostAs posts a twt to one of the user's feeds
+func (c *Client) PostAs(ctx context.Context, feed, text string) error {
+	return c.post(ctx, types.PostRequest{PostAs: feed, Text: text})
+}
+
+// Edit replaces the twt with the given hash with text
+func (c *Client) Edit(ctx context.Context, hash, text string) error {
+	return c.post(ctx, types.PostRequest{Hash: hash, Text: text})
+}
+
+func (c *Client) post(ctx context.Context, body types.PostRequest) error {
+	req, err := c.newRequest(ctx, "POST", "/post", nil, body)
 	if err != nil {
-		return types.AuthResponse{}, err
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// Delete ...
+func (c *Client) Delete(ctx context.Context, hash string) error {
+	req, err := c.newRequest(ctx, "DELETE", "/post", nil, types.DeleteRequest{Hash: hash})
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// Schedule ...
+func (c *Client) Schedule(ctx context.Context, text string, postAt time.Time) (res types.ScheduledTwt, err error) {
+	req, err := c.newRequest(ctx, "POST", "/post", nil, types.PostRequest{Text: text, PostAt: &postAt})
+	if err != nil {
+		return types.ScheduledTwt{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// Scheduled lists the pending twts of the user and their feeds, or only those
+// of feed if not empty
+func (c *Client) Scheduled(ctx context.Context, feed string) (res types.ScheduledTwtsResponse, err error) {
+	query := url.Values{}
+	if feed != "" {
+		query.Set("feed", feed)
+	}
+	req, err := c.newRequest(ctx, "GET", "/scheduled", query, nil)
+	if err != nil {
+		return types.ScheduledTwtsResponse{}, err
 	}
 	err = c.do(req, &res)
 	return
 }
 
+// UpdateScheduled ...
+func (c *Client) UpdateScheduled(ctx context.Context, id, text string, postAt time.Time) (res types.ScheduledTwt, err error) {
+	req, err := c.newRequest(ctx, "POST", "/scheduled/"+id, nil, types.UpdateScheduledTwtRequest{Text: text, PostAt: postAt})
+	if err != nil {
+		return types.ScheduledTwt{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// CancelScheduled ...
+func (c *Client) CancelScheduled(ctx context.Context, id string) error {
+	req, err := c.newRequest(ctx, "DELETE", "/scheduled/"+id, nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// UploadMedia uploads the image, audio or video read from r, its type is
+// guessed from the extension of filename (or its content)
+func (c *Client) UploadMedia(ctx context.Context, filename string, r io.Reader) (res types.UploadMediaResponse, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return types.UploadMediaResponse{}, err
+	}
+
+	ctype := mime.TypeByExtension(filepath.Ext(filename))
+	if ctype == "" {
+		ctype = http.DetectContentType(data)
+	}
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="media_file"; filename=%q`, filepath.Base(filename)))
+	header.Set("Content-Type", ctype)
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return types.UploadMediaResponse{}, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return types.UploadMediaResponse{}, err
+	}
+	if err := mw.Close(); err != nil {
+		return types.UploadMediaResponse{}, err
+	}
+
+	req, err := c.newRawRequest(ctx, "POST", "/upload", nil, mw.FormDataContentType(), body)
+	if err != nil {
+		return types.UploadMediaResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// Task returns the state of the task processing uploaded media, uri is the
+// Path of the response of UploadMedia
+func (c *Client) Task(ctx context.Context, uri string) (res types.TaskResponse, err error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return types.TaskResponse{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL.ResolveReference(u).String(), nil)
+	if err != nil {
+		return types.TaskResponse{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+	err = c.do(req, &res)
+	return
+}
+
+// Settings ...
+func (c *Client) Settings(ctx context.Context) (res types.SettingsResponse, err error) {
+	req, err := c.newRequest(ctx, "GET", "/settings", nil, nil)
+	if err != nil {
+		return types.SettingsResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// UpdateSettings updates the user's settings and, if avatar is not nil, their
+// avatar
+func (c *Client) UpdateSettings(ctx context.Context, settings types.SettingsRequest, avatar io.Reader) error {
+	checkbox := func(b bool) string {
+		if b {
+			return "on"
+		}
+		return ""
+	}
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+
+	fields := [][2]string{
+		{"email", settings.Email},
+		{"tagline", settings.Tagline},
+		{"password", settings.Password},
+		{"isFollowersPubliclyVisible", checkbox(settings.IsFollowersPubliclyVisible)},
+		{"isFollowingPubliclyVisible", checkbox(settings.IsFollowingPubliclyVisible)},
+	}
+	for _, field := range fields {
+		if err := mw.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+
+	if avatar != nil {
+		part, err := mw.CreateFormFile("avatar_file", "avatar")
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, avatar); err != nil {
+			return err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	req, err := c.newRawRequest(ctx, "POST", "/settings", nil, mw.FormDataContentType(), body)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// Tokens returns the user's API tokens (without their values)
+func (c *Client) Tokens(ctx context.Context) (res types.TokensResponse, err error) {
+	req, err := c.newRequest(ctx, "GET", "/tokens", nil, nil)
+	if err != nil {
+		return types.TokensResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// CreateToken creates a personal access token, its value is only ever
+// returned here
+func (c *Client) CreateToken(ctx context.Context, token types.TokenRequest) (res types.Token, err error) {
+	req, err := c.newRequest(ctx, "POST", "/tokens", nil, token)
+	if err != nil {
+		return types.Token{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// DeleteToken revokes the user's token with the given signature
+func (c *Client) DeleteToken(ctx context.Context, signature string) error {
+	req, err := c.newRequest(ctx, "DELETE", "/tokens/"+signature, nil, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// Follow ...
+func (c *Client) Follow(ctx context.Context, nick, url string) error {
+	req, err := c.newRequest(ctx, "POST", "/follow", nil, types.FollowRequest{Nick: nick, URL: url})
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// Unfollow ...
+func (c *Client) Unfollow(ctx context.Context, nick string) error {
+	req, err := c.newRequest(ctx, "POST", "/unfollow", nil, types.UnfollowRequest{Nick: nick})
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// Mute ...
+func (c *Client) Mute(ctx context.Context, nick, url string) error {
+	req, err := c.newRequest(ctx, "POST", "/mute", nil, types.MuteRequest{Nick: nick, URL: url})
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// Unmute ...
+func (c *Client) Unmute(ctx context.Context, nick string) error {
+	req, err := c.newRequest(ctx, "POST", "/unmute", nil, types.UnmuteRequest{Nick: nick})
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
 // Timeline ...
-func (c *Client) Timeline(page int) (res types.PagedResponse, err error) {
-	req, err := c.newRequest("POST", "/timeline", types.PagedRequest{Page: page})
+func (c *Client) Timeline(ctx context.Context, page int) (res types.PagedResponse, err error) {
+	req, err := c.newRequest(ctx, "POST", "/timeline", nil, types.PagedRequest{Page: page})
+	if err != nil {
+		return types.PagedResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// Discover ...
+func (c *Client) Discover(ctx context.Context, page int) (res types.PagedResponse, err error) {
+	req, err := c.newRequest(ctx, "POST", "/discover", nil, types.PagedRequest{Page: page})
+	if err != nil {
+		return types.PagedResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// Mentions ...
+func (c *Client) Mentions(ctx context.Context, page int) (res types.PagedResponse, err error) {
+	req, err := c.newRequest(ctx, "POST", "/mentions", nil, types.PagedRequest{Page: page})
+	if err != nil {
+		return types.PagedResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// Profile ...
+func (c *Client) Profile(ctx context.Context, nick string, page int) (res types.ProfileResponse, err error) {
+	query := url.Values{}
+	if page > 0 {
+		query.Set("p", fmt.Sprintf("%d", page))
+	}
+	req, err := c.newRequest(ctx, "GET", "/profile/"+nick, query, nil)
+	if err != nil {
+		return types.ProfileResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// ExternalProfile ...
+func (c *Client) ExternalProfile(ctx context.Context, nick, url string) (res types.ProfileResponse, err error) {
+	req, err := c.newRequest(ctx, "POST", "/external", nil, types.ExternalProfileRequest{Nick: nick, URL: url})
+	if err != nil {
+		return types.ProfileResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// FetchTwts ...
+func (c *Client) FetchTwts(ctx context.Context, nick, url string, page int) (res types.PagedResponse, err error) {
+	req, err := c.newRequest(ctx, "POST", "/fetch-twts", nil, types.FetchTwtsRequest{Nick: nick, URL: url, Page: page})
 	if err != nil {
 		return types.PagedResponse{}, err
 	}
 	err = c.do(req, &res)
 	return
 }
+
+// Conversation ...
+func (c *Client) Conversation(ctx context.Context, hash string, page int) (res types.ConversationResponse, err error) {
+	req, err := c.newRequest(ctx, "POST", "/conv", nil, types.ConversationRequest{Hash: hash, Page: page})
+	if err != nil {
+		return types.ConversationResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// Thread ...
+func (c *Client) Thread(ctx context.Context, hash string) (res types.ThreadResponse, err error) {
+	req, err := c.newRequest(ctx, "POST", "/thread", nil, types.ThreadRequest{Hash: hash})
+	if err != nil {
+		return types.ThreadResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// Search ...
+func (c *Client) Search(ctx context.Context, query string, page int) (res types.PagedResponse, err error) {
+	req, err := c.newRequest(ctx, "POST", "/search", nil, types.SearchRequest{Query: query, Page: page})
+	if err != nil {
+		return types.PagedResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// Notifications ...
+func (c *Client) Notifications(ctx context.Context) (res types.NotificationsResponse, err error) {
+	req, err := c.newRequest(ctx, "GET", "/notifications", nil, nil)
+	if err != nil {
+		return types.NotificationsResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// ReadNotifications marks the notifications with the given ids, or all of
+// them if none are given, as read
+func (c *Client) ReadNotifications(ctx context.Context, ids ...string) error {
+	req, err := c.newRequest(ctx, "POST", "/notifications/read", nil, types.ReadNotificationsRequest{IDs: ids})
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// ManageFeeds lists the fetch health of unhealthy remote feeds, or of all
+// remote feeds if all is true (requires an admin token)
+func (c *Client) ManageFeeds(ctx context.Context, all bool) (res types.FeedHealthResponse, err error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "true")
+	}
+	req, err := c.newRequest(ctx, "GET", "/manage/feeds", query, nil)
+	if err != nil {
+		return types.FeedHealthResponse{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// RefreshFeed ...
+func (c *Client) RefreshFeed(ctx context.Context, url string) (res types.FeedHealth, err error) {
+	req, err := c.newRequest(ctx, "POST", "/manage/feeds/refresh", nil, types.ManageFeedRequest{URL: url})
+	if err != nil {
+		return types.FeedHealth{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// DisableFeed ...
+func (c *Client) DisableFeed(ctx context.Context, url string, disabled bool) (res types.FeedHealth, err error) {
+	req, err := c.newRequest(ctx, "POST", "/manage/feeds/disable", nil, types.ManageFeedRequest{URL: url, Disabled: disabled})
+	if err != nil {
+		return types.FeedHealth{}, err
+	}
+	err = c.do(req, &res)
+	return
+}
+
+// Support ...
+func (c *Client) Support(ctx context.Context, support types.SupportRequest) error {
+	req, err := c.newRequest(ctx, "POST", "/support", nil, support)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// Report ...
+func (c *Client) Report(ctx context.Context, report types.ReportRequest) error {
+	req, err := c.newRequest(ctx, "POST", "/report", nil, report)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
@@ -0,0 +1,222 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/lextwt"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cli, err := NewClient(WithURI(server.URL+"/api/v1"), WithToken("secret"))
+	require.NoError(t, err)
+	return cli
+}
+
+func TestClientRequests(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+
+	var (
+		method string
+		path   string
+		query  string
+		token  string
+		body   map[string]interface{}
+	)
+
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		method, path, query = r.Method, r.URL.Path, r.URL.RawQuery
+		token = r.Header.Get("Token")
+
+		body = nil
+		// Handlers run on the server's goroutine where require cannot stop
+		// the test, so failures are only reported
+		if r.Header.Get("Content-Type") == "application/json" {
+			assert.NoError(json.NewDecoder(r.Body).Decode(&body))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	})
+
+	require.NoError(cli.PostAs(ctx, "news", "Hello World!"))
+	assert.Equal("POST", method)
+	assert.Equal("/api/v1/post", path)
+	assert.Equal("secret", token)
+	assert.Equal("news", body["post_as"])
+	assert.Equal("Hello World!", body["text"])
+
+	require.NoError(cli.Delete(ctx, "abcdefg"))
+	assert.Equal("DELETE", method)
+	assert.Equal("abcdefg", body["hash"])
+
+	require.NoError(cli.Follow(ctx, "prologic", "https://twtxt.net/user/prologic/twtxt.txt"))
+	assert.Equal("/api/v1/follow", path)
+	assert.Equal("prologic", body["nick"])
+
+	require.NoError(cli.ReadNotifications(ctx, "1", "2"))
+	assert.Equal("/api/v1/notifications/read", path)
+	assert.Equal([]interface{}{"1", "2"}, body["ids"])
+
+	_, err := cli.Scheduled(ctx, "news")
+	require.NoError(err)
+	assert.Equal("GET", method)
+	assert.Equal("feed=news", query)
+
+	_, err = cli.ManageFeeds(ctx, true)
+	require.NoError(err)
+	assert.Equal("/api/v1/manage/feeds", path)
+	assert.Equal("all=true", query)
+
+	require.NoError(cli.CancelScheduled(ctx, "1234"))
+	assert.Equal("DELETE", method)
+	assert.Equal("/api/v1/scheduled/1234", path)
+
+	_, err = cli.CreateToken(ctx, types.TokenRequest{Name: "bot", Scopes: []string{"read", "post"}})
+	require.NoError(err)
+	assert.Equal("POST", method)
+	assert.Equal("/api/v1/tokens", path)
+	assert.Equal("bot", body["name"])
+	assert.Equal([]interface{}{"read", "post"}, body["scopes"])
+
+	require.NoError(cli.DeleteToken(ctx, "abcdefg"))
+	assert.Equal("DELETE", method)
+	assert.Equal("/api/v1/tokens/abcdefg", path)
+}
+
+func TestClientResponses(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lextwt.DefaultTwtManager()
+
+	ctx := context.Background()
+
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/register":
+			// No response body
+		case "/api/v1/timeline":
+			twter := types.Twter{Nick: "prologic", URL: "https://twtxt.net/user/prologic/twtxt.txt"}
+			twt := lextwt.NewTwt(twter, lextwt.NewDateTime(time.Date(2020, 12, 25, 9, 0, 0, 0, time.UTC), ""), lextwt.NewText("Hello World!"))
+			data, err := json.Marshal(types.PagedResponse{
+				Twts:  types.Twts{twt},
+				Pager: types.PagerResponse{Current: 1, MaxPages: 1, TotalTwts: 1},
+			})
+			assert.NoError(err)
+			_, _ = w.Write(data)
+		case "/api/v1/profile/prologic":
+			assert.Equal("2", r.URL.Query().Get("p"))
+			_, _ = w.Write([]byte(`{"profile":{"Username":"prologic"},"twts":[]}`))
+		default:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		}
+	})
+
+	require.NoError(cli.Register(ctx, "prologic", "secret", "prologic@twtxt.net"))
+
+	timeline, err := cli.Timeline(ctx, 1)
+	require.NoError(err)
+	require.Len(timeline.Twts, 1)
+	assert.Equal("prologic", timeline.Twts[0].Twter().Nick)
+	assert.Equal(1, timeline.Pager.TotalTwts)
+
+	profile, err := cli.Profile(ctx, "prologic", 2)
+	require.NoError(err)
+	assert.Equal("prologic", profile.Profile.Username)
+}
+
+func TestClientErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	status := http.StatusUnauthorized
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(status), status)
+	})
+
+	err := cli.Post(ctx, "Hello World!")
+	assert.True(errors.Is(err, ErrUnauthorized))
+
+	var apiErr *Error
+	if assert.True(errors.As(err, &apiErr)) {
+		assert.Equal(http.StatusUnauthorized, apiErr.StatusCode)
+		assert.Equal("Unauthorized", apiErr.Message)
+	}
+
+	status = http.StatusNotFound
+	_, err = cli.Profile(ctx, "unknown", 0)
+	assert.True(errors.Is(err, ErrNotFound))
+	assert.False(errors.Is(err, ErrBadRequest))
+
+	status = http.StatusBadGateway
+	assert.True(errors.Is(cli.Ping(ctx), ErrServerError))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.True(errors.Is(cli.Ping(cancelled), context.Canceled))
+}
+
+func TestClientUploads(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+
+	form := make(map[string]string)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(r.ParseMultipartForm(1 << 20))
+
+		for k, v := range r.MultipartForm.Value {
+			form[k] = v[0]
+		}
+		for k, v := range r.MultipartForm.File {
+			f, err := v[0].Open()
+			require.NoError(err)
+			data, err := ioutil.ReadAll(f)
+			require.NoError(err)
+			form[k] = string(data)
+			form[k+".type"] = v[0].Header.Get("Content-Type")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/v1/upload" {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"Type":"taskURI","Path":"https://twtxt.net/task/1234"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	})
+
+	res, err := cli.UploadMedia(ctx, "photo.png", strings.NewReader("not really a png"))
+	require.NoError(err)
+	assert.Equal("taskURI", res.Type)
+	assert.Equal("https://twtxt.net/task/1234", res.Path)
+	assert.Equal("not really a png", form["media_file"])
+	assert.Equal("image/png", form["media_file.type"])
+
+	err = cli.UpdateSettings(ctx, types.SettingsRequest{Tagline: "Hi!", IsFollowersPubliclyVisible: true}, strings.NewReader("avatar"))
+	require.NoError(err)
+	assert.Equal("Hi!", form["tagline"])
+	assert.Equal("on", form["isFollowersPubliclyVisible"])
+	assert.Equal("", form["isFollowingPubliclyVisible"])
+	assert.Equal("avatar", form["avatar_file"])
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jointwt/twtxt/client"
+)
+
+// convCmd represents the conv command
+var convCmd = &cobra.Command{
+	Use:     "conv [flags] <hash>",
+	Aliases: []string{"thread"},
+	Short:   "Display the conversation a twt is part of",
+	Long:    `...`,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conv(NewClient(), args[0])
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(convCmd)
+}
+
+func conv(cli *client.Client, hash string) {
+	res, err := cli.Thread(context.Background(), hash)
+	if err != nil {
+		log.WithError(err).Errorf("error retrieving conversation of %s", hash)
+		os.Exit(1)
+	}
+
+	if JSONOutput() {
+		PrintJSON(res)
+		return
+	}
+
+	PrintThread(res.Thread, 0)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jointwt/twtxt/client"
+)
+
+// discoverCmd represents the discover command
+var discoverCmd = &cobra.Command{
+	Use:   "discover [flags]",
+	Short: "Display the twts of everyone on the pod",
+	Long:  `...`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		page, err := cmd.Flags().GetInt("page")
+		if err != nil {
+			log.WithError(err).Error("error getting page flag")
+			os.Exit(1)
+		}
+
+		discover(NewClient(), page)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(discoverCmd)
+
+	discoverCmd.Flags().Int("page", 1, "page of twts to display")
+}
+
+func discover(cli *client.Client, page int) {
+	res, err := cli.Discover(context.Background(), page)
+	if err != nil {
+		log.WithError(err).Error("error retrieving discover")
+		os.Exit(1)
+	}
+
+	PrintPagedResponse(res)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jointwt/twtxt/client"
+)
+
+// followCmd represents the follow command
+var followCmd = &cobra.Command{
+	Use:         "follow [flags] <nick> <url> | <nick@domain>",
+	Short:       "Follow a feed by its nick and url or by its nick@domain handle",
+	Long:        `...`,
+	Args:        cobra.RangeArgs(1, 2),
+	Annotations: offlineCommand,
+	Run: func(cmd *cobra.Command, args []string) {
+		if Offline() {
+			followLocal(NewLocal(), args)
+			return
+		}
+
+		follow(NewClient(), args)
+	},
+}
+
+// unfollowCmd represents the unfollow command
+var unfollowCmd = &cobra.Command{
+	Use:         "unfollow [flags] <nick>",
+	Short:       "Unfollow a feed you follow",
+	Long:        `...`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: offlineCommand,
+	Run: func(cmd *cobra.Command, args []string) {
+		if Offline() {
+			unfollowLocal(NewLocal(), args[0])
+			return
+		}
+
+		unfollow(NewClient(), args[0])
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(followCmd)
+	RootCmd.AddCommand(unfollowCmd)
+}
+
+func follow(cli *client.Client, args []string) {
+	var nick, url string
+	if len(args) == 1 {
+		// A nick@domain handle the pod resolves to its feed
+		url = args[0]
+	} else {
+		nick, url = args[0], args[1]
+	}
+
+	if err := cli.Follow(context.Background(), nick, url); err != nil {
+		log.WithError(err).Errorf("error following %s", args[0])
+		os.Exit(1)
+	}
+
+	PrintOK(fmt.Sprintf("followed %s", args[0]))
+}
+
+func unfollow(cli *client.Client, nick string) {
+	if err := cli.Unfollow(context.Background(), nick); err != nil {
+		log.WithError(err).Errorf("error unfollowing %s", nick)
+		os.Exit(1)
+	}
+
+	PrintOK(fmt.Sprintf("unfollowed %s", nick))
+}
+
+func followLocal(local *Local, args []string) {
+	if len(args) != 2 {
+		log.Error("handles cannot be resolved in offline mode, follow a feed by its nick and url")
+		os.Exit(1)
+	}
+
+	if err := local.Follow(args[0], args[1]); err != nil {
+		log.WithError(err).Errorf("error following %s", args[0])
+		os.Exit(1)
+	}
+
+	PrintOK(fmt.Sprintf("followed %s", args[0]))
+}
+
+func unfollowLocal(local *Local, nick string) {
+	if err := local.Unfollow(nick); err != nil {
+		log.WithError(err).Errorf("error unfollowing %s", nick)
+		os.Exit(1)
+	}
+
+	PrintOK(fmt.Sprintf("unfollowed %s", nick))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jointwt/twtxt/client"
+)
+
+// followingCmd represents the following command
+var followingCmd = &cobra.Command{
+	Use:         "following [flags]",
+	Short:       "List the feeds you follow",
+	Long:        `...`,
+	Args:        cobra.NoArgs,
+	Annotations: offlineCommand,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			following map[string]string
+			err       error
+		)
+
+		if Offline() {
+			following, err = NewLocal().Following()
+		} else {
+			following, err = getFollowing(NewClient())
+		}
+		if err != nil {
+			log.WithError(err).Error("error retrieving followed feeds")
+			os.Exit(1)
+		}
+
+		printFollowing(following)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(followingCmd)
+}
+
+func getFollowing(cli *client.Client) (map[string]string, error) {
+	settings, err := cli.Settings(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return settings.Following, nil
+}
+
+func printFollowing(following map[string]string) {
+	if JSONOutput() {
+		PrintJSON(following)
+		return
+	}
+
+	var nicks []string
+	for nick := range following {
+		nicks = append(nicks, nick)
+	}
+	sort.Strings(nicks)
+
+	for _, nick := range nicks {
+		PrintFollowee(nick, following[nick])
+		fmt.Println()
+	}
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/prologic/go-gopher"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/jointwt/twtxt"
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// followingFile is the file (in the data directory) of the feeds followed
+	// in offline mode, one "<nick> <url>" per line
+	followingFile = "following.txt"
+
+	// cacheDir is the directory (in the data directory) followed feeds are
+	// cached in
+	cacheDir = "cache"
+
+	// cacheIndexFile records the validators of the cached feeds used to only
+	// fetch feeds that changed
+	cacheIndexFile = "cache.json"
+
+	// maxFetchers is the maximum number of feeds fetched concurrently
+	maxFetchers = 10
+
+	// twtsPerPage is the number of twts per page of the offline timeline
+	twtsPerPage = 20
+
+	// maxFeedSize is the largest feed fetched (like the pod's default
+	// MaxFetchLimit) so that a misbehaving feed cannot exhaust memory
+	maxFeedSize = 1 << 21
+)
+
+// offlineCommand annotates the commands that work in offline mode
+var offlineCommand = map[string]string{"offline": "true"}
+
+// Offline returns true if the client works against the local twtxt.txt
+// feed and follow list (--offline) instead of a pod
+func Offline() bool {
+	return viper.GetBool("offline")
+}
+
+// cachedFeed is the index entry of a cached feed
+type cachedFeed struct {
+	Nick         string    `json:"nick"`
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"last_modified"`
+	LastFetched  time.Time `json:"last_fetched"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// Local is the local twtxt.txt feed, the feeds it follows and the cache of
+// those feeds used in offline mode, just like the original twtxt client
+type Local struct {
+	Nick    string
+	URL     string
+	Twtfile string
+
+	path   string
+	client *http.Client
+}
+
+// NewLocal returns the local feed configured by the nick, twturl, twtfile and
+// data settings (flags, the environment or the config file)
+func NewLocal() *Local {
+	twtfile, err := homedir.Expand(viper.GetString("twtfile"))
+	if err != nil {
+		log.WithError(err).Error("error expanding twtfile path")
+		os.Exit(1)
+	}
+
+	path, err := homedir.Expand(viper.GetString("data"))
+	if err != nil {
+		log.WithError(err).Error("error expanding data path")
+		os.Exit(1)
+	}
+
+	nick := viper.GetString("nick")
+	if nick == "" {
+		nick = os.Getenv("USER")
+	}
+
+	// Without a public url twts are hashed with the url of the file
+	uri := viper.GetString("twturl")
+	if uri == "" {
+		uri = (&url.URL{Scheme: "file", Path: twtfile}).String()
+	}
+
+	return &Local{
+		Nick:    nick,
+		URL:     uri,
+		Twtfile: twtfile,
+
+		path:   path,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Twter ...
+func (l *Local) Twter() types.Twter {
+	return types.Twter{Nick: l.Nick, URL: l.URL}
+}
+
+// Following returns the followed feeds by nick
+func (l *Local) Following() (map[string]string, error) {
+	following := make(map[string]string)
+
+	f, err := os.Open(filepath.Join(l.path, followingFile))
+	if os.IsNotExist(err) {
+		return following, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			log.Warnf("ignoring invalid line in %s: %q", followingFile, line)
+			continue
+		}
+		following[fields[0]] = fields[1]
+	}
+
+	return following, scanner.Err()
+}
+
+func (l *Local) saveFollowing(following map[string]string) error {
+	if err := os.MkdirAll(l.path, 0755); err != nil {
+		return err
+	}
+
+	var nicks []string
+	for nick := range following {
+		nicks = append(nicks, nick)
+	}
+	sort.Strings(nicks)
+
+	var b strings.Builder
+	for _, nick := range nicks {
+		fmt.Fprintf(&b, "%s %s\n", nick, following[nick])
+	}
+
+	return writeFile(filepath.Join(l.path, followingFile), []byte(b.String()))
+}
+
+// Follow adds the feed url to the follow list as nick
+func (l *Local) Follow(nick, uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" {
+		return fmt.Errorf("error: invalid url %q", uri)
+	}
+
+	following, err := l.Following()
+	if err != nil {
+		return err
+	}
+
+	following[nick] = uri
+	return l.saveFollowing(following)
+}
+
+// Unfollow removes the feed nick from the follow list
+func (l *Local) Unfollow(nick string) error {
+	following, err := l.Following()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := following[nick]; !ok {
+		return fmt.Errorf("error: not following %s", nick)
+	}
+
+	delete(following, nick)
+	return l.saveFollowing(following)
+}
+
+// Post appends a twt to the local twtxt.txt, @mentions of followed feeds are
+// expanded to @<nick url>
+func (l *Local) Post(text string) (types.Twt, error) {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "\n", " ")
+	if text == "" {
+		return types.NilTwt, fmt.Errorf("cowardly refusing to twt empty text, or only spaces")
+	}
+
+	following, err := l.Following()
+	if err != nil {
+		return types.NilTwt, err
+	}
+
+	twt := types.MakeTwt(l.Twter(), time.Now(), text)
+	twt.ExpandLinks(nil, types.FeedLookupFn(func(nick string) *types.Twter {
+		if uri, ok := following[nick]; ok {
+			return &types.Twter{Nick: nick, URL: uri}
+		}
+		if nick == l.Nick {
+			return &types.Twter{Nick: l.Nick, URL: l.URL}
+		}
+		return &types.Twter{Nick: nick}
+	}))
+
+	f, err := os.OpenFile(l.Twtfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return types.NilTwt, err
+	}
+	defer f.Close()
+
+	if _, err = fmt.Fprintf(f, "%+l\n", twt); err != nil {
+		return types.NilTwt, err
+	}
+
+	return twt, nil
+}
+
+// Twts returns the twts of the local twtxt.txt
+func (l *Local) Twts() (types.Twts, error) {
+	f, err := os.Open(l.Twtfile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseFeed(f, l.Twter())
+}
+
+func (l *Local) cacheFile(uri string) string {
+	sum := sha256.Sum256([]byte(uri))
+	return filepath.Join(l.path, cacheDir, hex.EncodeToString(sum[:12]))
+}
+
+func (l *Local) loadIndex() (map[string]*cachedFeed, error) {
+	index := make(map[string]*cachedFeed)
+
+	data, err := ioutil.ReadFile(filepath.Join(l.path, cacheIndexFile))
+	if os.IsNotExist(err) {
+		return index, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func (l *Local) saveIndex(index map[string]*cachedFeed) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(l.path, cacheIndexFile), data)
+}
+
+// Fetch fetches the followed feeds (only those that changed since they were
+// last fetched) into the cache
+func (l *Local) Fetch(ctx context.Context) error {
+	following, err := l.Following()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(l.path, cacheDir), 0755); err != nil {
+		return err
+	}
+
+	index, err := l.loadIndex()
+	if err != nil {
+		log.WithError(err).Warn("error loading cache index, fetching all feeds")
+		index = make(map[string]*cachedFeed)
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, maxFetchers)
+	)
+
+	fetched := make(map[string]*cachedFeed)
+	for nick, uri := range following {
+		cached, ok := index[uri]
+		if !ok {
+			cached = &cachedFeed{}
+		}
+		cached.Nick = nick
+
+		wg.Add(1)
+		go func(uri string, cached *cachedFeed) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := l.fetch(ctx, uri, cached); err != nil {
+				log.WithError(err).Warnf("error fetching %s (%s)", cached.Nick, uri)
+				cached.LastError = err.Error()
+			} else {
+				cached.LastError = ""
+			}
+
+			mu.Lock()
+			fetched[uri] = cached
+			mu.Unlock()
+		}(uri, cached)
+	}
+	wg.Wait()
+
+	// Feeds no longer followed are dropped from the cache
+	for uri := range index {
+		if _, ok := fetched[uri]; !ok {
+			if err := os.Remove(l.cacheFile(uri)); err != nil && !os.IsNotExist(err) {
+				log.WithError(err).Warnf("error removing cached feed %s", uri)
+			}
+		}
+	}
+
+	return l.saveIndex(fetched)
+}
+
+func (l *Local) fetch(ctx context.Context, uri string, cached *cachedFeed) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+
+	var body io.ReadCloser
+
+	switch u.Scheme {
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", fmt.Sprintf("twt/%s (+%s; @%s)", twtxt.FullVersion(), l.URL, l.Nick))
+
+		// Only fetch feeds that changed if the cached copy is still there
+		if _, err := os.Stat(l.cacheFile(uri)); err == nil {
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
+
+		res, err := l.client.Do(req)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case res.StatusCode == http.StatusNotModified:
+			res.Body.Close()
+			log.Debugf("feed %s not modified", uri)
+			cached.LastFetched = time.Now()
+			return nil
+		case res.StatusCode/100 != 2:
+			res.Body.Close()
+			return fmt.Errorf("unexpected status: %s", res.Status)
+		}
+
+		cached.ETag = res.Header.Get("ETag")
+		cached.LastModified = res.Header.Get("Last-Modified")
+		body = res.Body
+	default:
+		body, err = l.openFeed(uri)
+		if err != nil {
+			return err
+		}
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxFeedSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxFeedSize {
+		return fmt.Errorf("feed is larger than %d bytes", maxFeedSize)
+	}
+
+	if err := writeFile(l.cacheFile(uri), data); err != nil {
+		return err
+	}
+
+	cached.LastFetched = time.Now()
+	return nil
+}
+
+// Get fetches the twts of the feed uri without caching it (for feeds that
+// are not followed)
+func (l *Local) Get(nick, uri string) (types.Twts, error) {
+	body, err := l.openFeed(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return parseFeed(io.LimitReader(body, maxFeedSize), types.Twter{Nick: nick, URL: uri})
+}
+
+// CachedTwts returns the twts of the followed feed nick from the cache
+func (l *Local) CachedTwts(nick, uri string) (types.Twts, error) {
+	f, err := os.Open(l.cacheFile(uri))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseFeed(f, types.Twter{Nick: nick, URL: uri})
+}
+
+// Timeline returns the twts of the local feed and of the cached followed feeds
+// merged newest first
+func (l *Local) Timeline() (types.Twts, error) {
+	twts, err := l.Twts()
+	if err != nil {
+		return nil, err
+	}
+
+	following, err := l.Following()
+	if err != nil {
+		return nil, err
+	}
+
+	for nick, uri := range following {
+		feedTwts, err := l.CachedTwts(nick, uri)
+		if err != nil {
+			log.WithError(err).Warnf("error parsing cached feed %s (%s)", nick, uri)
+			continue
+		}
+		twts = append(twts, feedTwts...)
+	}
+
+	sort.Sort(twts)
+
+	return twts, nil
+}
+
+// Page returns the page (starting at 1) of twts as a response like the API's
+func Page(twts types.Twts, page int) types.PagedResponse {
+	maxPages := (len(twts) + twtsPerPage - 1) / twtsPerPage
+	if page < 1 {
+		page = 1
+	}
+
+	start := (page - 1) * twtsPerPage
+	if start > len(twts) {
+		start = len(twts)
+	}
+	end := start + twtsPerPage
+	if end > len(twts) {
+		end = len(twts)
+	}
+
+	return types.PagedResponse{
+		Twts: twts[start:end],
+		Pager: types.PagerResponse{
+			Current:   page,
+			MaxPages:  maxPages,
+			TotalTwts: len(twts),
+		},
+	}
+}
+
+// parseFeed parses a feed dropping twts that were since edited or deleted
+func parseFeed(r io.Reader, twter types.Twter) (types.Twts, error) {
+	tf, err := types.ParseFile(r, twter)
+	if err != nil {
+		return nil, err
+	}
+
+	edited := make(map[string]bool)
+	for _, edit := range tf.Info().Edits() {
+		edited[edit.Hash] = true
+	}
+
+	var twts types.Twts
+	for _, twt := range tf.Twts() {
+		if !edited[twt.Hash()] {
+			twts = append(twts, twt)
+		}
+	}
+
+	return twts, nil
+}
+
+// openFeed opens the feed uri, a http(s), gopher or file url or a path
+func (l *Local) openFeed(uri string) (io.ReadCloser, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "", "file":
+		return os.Open(u.Path)
+	case "http", "https":
+		res, err := l.client.Get(u.String())
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode/100 != 2 {
+			res.Body.Close()
+			return nil, fmt.Errorf("unexpected status: %s", res.Status)
+		}
+		return res.Body, nil
+	case "gopher":
+		res, err := gopher.Get(u.String())
+		if err != nil {
+			return nil, err
+		}
+		return res.Body, nil
+	default:
+		return nil, fmt.Errorf("unsupported url scheme: %s", u.Scheme)
+	}
+}
+
+// writeFile atomically replaces the file fn with data
+func writeFile(fn string, data []byte) error {
+	tmp := fmt.Sprintf("%s.tmp", fn)
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/lextwt"
+)
+
+func newTestLocal(t *testing.T) *Local {
+	dir := t.TempDir()
+	twtfile := filepath.Join(dir, "twtxt.txt")
+
+	return &Local{
+		Nick:    "alice",
+		URL:     "https://example.com/alice/twtxt.txt",
+		Twtfile: twtfile,
+
+		path:   filepath.Join(dir, "data"),
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func TestPage(t *testing.T) {
+	lextwt.DefaultTwtManager()
+
+	twter := types.Twter{Nick: "alice", URL: "https://example.com/alice/twtxt.txt"}
+	now := time.Now()
+
+	var twts types.Twts
+	for i := 0; i < 45; i++ {
+		twts = append(twts, types.MakeTwt(twter, now.Add(-time.Duration(i)*time.Minute), fmt.Sprintf("twt %d", i)))
+	}
+
+	tests := []struct {
+		name     string
+		twts     types.Twts
+		page     int
+		current  int
+		maxPages int
+		first    int
+		len      int
+	}{
+		{name: "empty", twts: nil, page: 1, current: 1, maxPages: 0, len: 0},
+		{name: "first", twts: twts, page: 1, current: 1, maxPages: 3, first: 0, len: twtsPerPage},
+		{name: "middle", twts: twts, page: 2, current: 2, maxPages: 3, first: twtsPerPage, len: twtsPerPage},
+		{name: "last", twts: twts, page: 3, current: 3, maxPages: 3, first: 2 * twtsPerPage, len: 5},
+		{name: "before first", twts: twts, page: 0, current: 1, maxPages: 3, first: 0, len: twtsPerPage},
+		{name: "after last", twts: twts, page: 10, current: 10, maxPages: 3, len: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Page(tt.twts, tt.page)
+			assert.Equal(t, tt.current, res.Pager.Current)
+			assert.Equal(t, tt.maxPages, res.Pager.MaxPages)
+			assert.Equal(t, len(tt.twts), res.Pager.TotalTwts)
+			require.Len(t, res.Twts, tt.len)
+			if tt.len > 0 {
+				assert.Equal(t, tt.twts[tt.first].Hash(), res.Twts[0].Hash())
+			}
+		})
+	}
+}
+
+func TestParseFeed(t *testing.T) {
+	lextwt.DefaultTwtManager()
+
+	twter := types.Twter{Nick: "bob", URL: "https://example.org/bob/twtxt.txt"}
+
+	lines := []string{
+		"2020-12-01T10:00:00Z\tHello World\n",
+		"2020-12-02T10:00:00Z\tHello Mars\n",
+		"2020-12-03T10:00:00Z\tHello Venus\n",
+	}
+
+	all, err := parseFeed(strings.NewReader(strings.Join(lines, "")), twter)
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+
+	hashes := make(map[string]string)
+	for _, twt := range all {
+		hashes[fmt.Sprintf("%t", twt)] = twt.Hash()
+	}
+
+	tests := []struct {
+		name     string
+		comments string
+		expected []string
+	}{
+		{
+			name:     "no edits",
+			expected: []string{"Hello World", "Hello Mars", "Hello Venus"},
+		},
+		{
+			name:     "edited",
+			comments: fmt.Sprintf("# edit = %s %s\n", hashes["Hello World"], hashes["Hello Venus"]),
+			expected: []string{"Hello Mars", "Hello Venus"},
+		},
+		{
+			name:     "deleted",
+			comments: fmt.Sprintf("# delete = %s\n", hashes["Hello Mars"]),
+			expected: []string{"Hello World", "Hello Venus"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			twts, err := parseFeed(strings.NewReader(tt.comments+strings.Join(lines, "")), twter)
+			require.NoError(t, err)
+
+			var texts []string
+			for _, twt := range twts {
+				texts = append(texts, fmt.Sprintf("%t", twt))
+			}
+			assert.ElementsMatch(t, tt.expected, texts)
+		})
+	}
+}
+
+func TestLocalPost(t *testing.T) {
+	lextwt.DefaultTwtManager()
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{
+			name:     "followed",
+			text:     "@bob hello",
+			expected: "@<bob https://example.org/bob/twtxt.txt> hello",
+		},
+		{
+			name:     "self",
+			text:     "@alice note to self",
+			expected: "@<alice https://example.com/alice/twtxt.txt> note to self",
+		},
+		{
+			name:     "unknown",
+			text:     "@carol hi",
+			expected: "@carol hi",
+		},
+		{
+			name:     "already expanded",
+			text:     "@<dave https://example.net/dave.txt> hey",
+			expected: "@<dave https://example.net/dave.txt> hey",
+		},
+		{
+			name:     "multiline",
+			text:     "@bob hello\nworld",
+			expected: "@<bob https://example.org/bob/twtxt.txt> hello\u2028world",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLocal(t)
+			require.NoError(t, l.Follow("bob", "https://example.org/bob/twtxt.txt"))
+
+			twt, err := l.Post(tt.text)
+			require.NoError(t, err)
+
+			data, err := ioutil.ReadFile(l.Twtfile)
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("%s\t%s\n", twt.Created().Format(time.RFC3339), tt.expected), string(data))
+		})
+	}
+
+	_, err := newTestLocal(t).Post("  ")
+	assert.Error(t, err)
+}
+
+func TestLocalFetch(t *testing.T) {
+	lextwt.DefaultTwtManager()
+
+	var (
+		mu          sync.Mutex
+		content     = "2020-12-01T10:00:00Z\tHello World\n"
+		notModified int
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/bob.txt":
+			etag := fmt.Sprintf(`"%d"`, len(content))
+			if r.Header.Get("If-None-Match") == etag {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			_, _ = w.Write([]byte(content))
+		case "/large.txt":
+			_, _ = w.Write([]byte(strings.Repeat("x", maxFeedSize+1)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	setContent := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		content = s
+		notModified = 0
+	}
+
+	bob := ts.URL + "/bob.txt"
+	large := ts.URL + "/large.txt"
+
+	l := newTestLocal(t)
+	require.NoError(t, l.Follow("bob", bob))
+	require.NoError(t, l.Follow("large", large))
+
+	// Feeds are fetched into the cache, feeds too large are not
+	require.NoError(t, l.Fetch(context.Background()))
+	twts, err := l.CachedTwts("bob", bob)
+	require.NoError(t, err)
+	require.Len(t, twts, 1)
+
+	index, err := l.loadIndex()
+	require.NoError(t, err)
+	require.Contains(t, index, bob)
+	assert.NotEmpty(t, index[bob].ETag)
+	assert.Empty(t, index[bob].LastError)
+	require.Contains(t, index, large)
+	assert.NotEmpty(t, index[large].LastError)
+	_, err = os.Stat(l.cacheFile(large))
+	assert.True(t, os.IsNotExist(err))
+
+	// Unchanged feeds are not modified (304) and remain cached
+	lastFetched := index[bob].LastFetched
+	setContent("2020-12-01T10:00:00Z\tHello World\n")
+	require.NoError(t, l.Fetch(context.Background()))
+	assert.Equal(t, 1, notModified)
+	twts, err = l.CachedTwts("bob", bob)
+	require.NoError(t, err)
+	require.Len(t, twts, 1)
+
+	index, err = l.loadIndex()
+	require.NoError(t, err)
+	assert.True(t, index[bob].LastFetched.After(lastFetched))
+
+	// Changed feeds are fetched again
+	setContent("2020-12-01T10:00:00Z\tHello World\n2020-12-02T10:00:00Z\tHello Mars\n")
+	require.NoError(t, l.Fetch(context.Background()))
+	twts, err = l.CachedTwts("bob", bob)
+	require.NoError(t, err)
+	assert.Len(t, twts, 2)
+
+	timeline, err := l.Timeline()
+	require.NoError(t, err)
+	assert.Len(t, timeline, 2)
+
+	// Feeds no longer followed are pruned from the cache
+	require.NoError(t, l.Unfollow("bob"))
+	require.NoError(t, l.Fetch(context.Background()))
+	_, err = os.Stat(l.cacheFile(bob))
+	assert.True(t, os.IsNotExist(err))
+
+	index, err = l.loadIndex()
+	require.NoError(t, err)
+	assert.NotContains(t, index, bob)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -67,14 +68,12 @@ func login(cli *client.Client) {
 		os.Exit(1)
 	}
 
-	res, err := cli.Login(username, password)
+	res, err := cli.Login(context.Background(), username, password)
 	if err != nil {
 		log.WithError(err).Error("error making login request")
 		os.Exit(1)
 	}
 
-	log.Info("login successful")
-
 	// Find home directory.
 	home, err := homedir.Dir()
 	if err != nil {
@@ -87,4 +86,6 @@ func login(cli *client.Client) {
 		log.WithError(err).Error("error saving config")
 		os.Exit(1)
 	}
+
+	PrintOK("login successful")
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jointwt/twtxt/client"
+	"github.com/jointwt/twtxt/types"
+)
+
+// mentionsCmd represents the mentions command
+var mentionsCmd = &cobra.Command{
+	Use:         "mentions [flags]",
+	Short:       "Display twts mentioning you",
+	Long:        `...`,
+	Args:        cobra.NoArgs,
+	Annotations: offlineCommand,
+	Run: func(cmd *cobra.Command, args []string) {
+		page, err := cmd.Flags().GetInt("page")
+		if err != nil {
+			log.WithError(err).Error("error getting page flag")
+			os.Exit(1)
+		}
+
+		if Offline() {
+			cached, err := cmd.Flags().GetBool("cache")
+			if err != nil {
+				log.WithError(err).Error("error getting cache flag")
+				os.Exit(1)
+			}
+
+			mentionsLocal(NewLocal(), page, cached)
+			return
+		}
+
+		mentions(NewClient(), page)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(mentionsCmd)
+
+	mentionsCmd.Flags().Int("page", 1, "page of mentions to display")
+	mentionsCmd.Flags().Bool("cache", false, "only display cached twts without fetching feeds (offline mode)")
+}
+
+func mentions(cli *client.Client, page int) {
+	res, err := cli.Mentions(context.Background(), page)
+	if err != nil {
+		log.WithError(err).Error("error retrieving mentions")
+		os.Exit(1)
+	}
+
+	PrintPagedResponse(res)
+}
+
+func mentionsLocal(local *Local, page int, cached bool) {
+	if !cached {
+		if err := local.Fetch(context.Background()); err != nil {
+			log.WithError(err).Error("error fetching feeds")
+			os.Exit(1)
+		}
+	}
+
+	twts, err := local.Timeline()
+	if err != nil {
+		log.WithError(err).Error("error loading timeline")
+		os.Exit(1)
+	}
+
+	var mentions types.Twts
+	for _, twt := range twts {
+		for _, m := range twt.Mentions() {
+			if twter := m.Twter(); twter.URL == local.URL || twter.Nick == local.Nick {
+				mentions = append(mentions, twt)
+				break
+			}
+		}
+	}
+
+	PrintPagedResponse(Page(mentions, page))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jointwt/twtxt/client"
+)
+
+// muteCmd represents the mute command
+var muteCmd = &cobra.Command{
+	Use:   "mute [flags] <nick> <url>",
+	Short: "Mute a feed so its twts are hidden from your timeline",
+	Long:  `...`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		mute(NewClient(), args[0], args[1])
+	},
+}
+
+// unmuteCmd represents the unmute command
+var unmuteCmd = &cobra.Command{
+	Use:   "unmute [flags] <nick>",
+	Short: "Unmute a feed you muted",
+	Long:  `...`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		unmute(NewClient(), args[0])
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(muteCmd)
+	RootCmd.AddCommand(unmuteCmd)
+}
+
+func mute(cli *client.Client, nick, url string) {
+	if err := cli.Mute(context.Background(), nick, url); err != nil {
+		log.WithError(err).Errorf("error muting %s", nick)
+		os.Exit(1)
+	}
+
+	PrintOK(fmt.Sprintf("muted %s", nick))
+}
+
+func unmute(cli *client.Client, nick string) {
+	if err := cli.Unmute(context.Background(), nick); err != nil {
+		log.WithError(err).Errorf("error unmuting %s", nick)
+		os.Exit(1)
+	}
+
+	PrintOK(fmt.Sprintf("unmuted %s", nick))
+}
@@ -1,13 +1,12 @@
 package main
 
 import (
-	"io/ioutil"
+	"context"
 	"os"
-	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 
 	"github.com/jointwt/twtxt/client"
 )
@@ -19,50 +18,95 @@ var postCmd = &cobra.Command{
 	Short:   "Post a Twt to a Twtxt Pod",
 	Long:    `...`,
 	//Args:    cobra.NArgs(0),
+	Annotations: offlineCommand,
 	Run: func(cmd *cobra.Command, args []string) {
-		uri := viper.GetString("uri")
-		token := viper.GetString("token")
-		cli, err := client.NewClient(
-			client.WithURI(uri),
-			client.WithToken(token),
-		)
+		at, err := cmd.Flags().GetString("at")
 		if err != nil {
-			log.WithError(err).Error("error creating client")
+			log.WithError(err).Error("error getting at flag")
 			os.Exit(1)
 		}
 
-		post(cli, args)
+		if Offline() {
+			if at != "" {
+				log.Error("twts cannot be scheduled in offline mode")
+				os.Exit(1)
+			}
+			postLocal(NewLocal(), args)
+			return
+		}
+
+		post(NewClient(), at, args)
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(postCmd)
-}
 
-func post(cli *client.Client, args []string) {
-	text := strings.Join(args, " ")
+	postCmd.Flags().String(
+		"at", "",
+		"schedule the twt to be posted later at a time (e.g: 2020-12-25T09:00, 2020-12-25 09:00 or 2h30m from now)",
+	)
+}
 
+func post(cli *client.Client, at string, args []string) {
+	text := ReadText(args)
 	if text == "" {
-		data, err := ioutil.ReadAll(os.Stdin)
+		log.Error("no text provided")
+		os.Exit(1)
+	}
+
+	if at != "" {
+		postAt, err := ParsePostAt(at, time.Now())
 		if err != nil {
-			log.WithError(err).Error("error reading text from stdin")
+			log.WithError(err).Errorf("error parsing time %q", at)
 			os.Exit(1)
 		}
-		text = string(data)
+
+		log.Infof("scheduling twt for %s ...", postAt.Format(time.RFC1123))
+
+		res, err := cli.Schedule(context.Background(), text, postAt)
+		if err != nil {
+			log.WithError(err).Error("error scheduling post")
+			os.Exit(1)
+		}
+
+		if JSONOutput() {
+			PrintJSON(res)
+			return
+		}
+
+		log.Infof("post scheduled (id: %s)", res.ID)
+		return
+	}
+
+	log.Info("posting twt...")
+
+	err := cli.Post(context.Background(), text)
+	if err != nil {
+		log.WithError(err).Error("error making post")
+		os.Exit(1)
 	}
 
+	PrintOK("post successful")
+}
+
+func postLocal(local *Local, args []string) {
+	text := ReadText(args)
 	if text == "" {
 		log.Error("no text provided")
 		os.Exit(1)
 	}
 
-	log.Info("posting twt...")
-
-	_, err := cli.Post(text)
+	twt, err := local.Post(text)
 	if err != nil {
 		log.WithError(err).Error("error making post")
 		os.Exit(1)
 	}
 
-	log.Info("post successful")
+	if JSONOutput() {
+		PrintJSON(twt)
+		return
+	}
+
+	log.Infof("post successful (hash: %s)", twt.Hash())
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jointwt/twtxt/client"
+	"github.com/jointwt/twtxt/types"
+)
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile [flags] <nick> [url]",
+	Short: "Display the profile and twts of a user or feed",
+	Long: `Display the profile and twts of a local user or feed given by its nick,
+or of an external feed given by its nick and url.`,
+	Args:        cobra.RangeArgs(1, 2),
+	Annotations: offlineCommand,
+	Run: func(cmd *cobra.Command, args []string) {
+		page, err := cmd.Flags().GetInt("page")
+		if err != nil {
+			log.WithError(err).Error("error getting page flag")
+			os.Exit(1)
+		}
+
+		if Offline() {
+			profileLocal(NewLocal(), args, page)
+			return
+		}
+
+		profile(NewClient(), args, page)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(profileCmd)
+
+	profileCmd.Flags().Int("page", 1, "page of twts to display")
+}
+
+func profile(cli *client.Client, args []string, page int) {
+	var (
+		res types.ProfileResponse
+		err error
+	)
+
+	if len(args) == 1 {
+		res, err = cli.Profile(context.Background(), args[0], page)
+	} else {
+		res, err = externalProfile(cli, args[0], args[1], page)
+	}
+	if err != nil {
+		log.WithError(err).Errorf("error retrieving profile of %s", args[0])
+		os.Exit(1)
+	}
+
+	printProfileResponse(res)
+}
+
+func printProfileResponse(res types.ProfileResponse) {
+	if JSONOutput() {
+		PrintJSON(res)
+		return
+	}
+
+	PrintProfile(res.Profile)
+	PrintTwts(res.Twts)
+	PrintPager(res.Pager)
+}
+
+// profileLocal displays the local feed, a followed feed or the feed given
+// by its nick and url
+func profileLocal(local *Local, args []string, page int) {
+	following, err := local.Following()
+	if err != nil {
+		log.WithError(err).Error("error loading followed feeds")
+		os.Exit(1)
+	}
+
+	nick, uri := args[0], ""
+	if len(args) == 2 {
+		uri = args[1]
+	} else if followed, ok := following[nick]; ok {
+		uri = followed
+	} else if nick != local.Nick {
+		log.Errorf("not following %s, give the url of their feed", nick)
+		os.Exit(1)
+	}
+
+	var twts types.Twts
+	if uri == "" {
+		uri = local.URL
+		twts, err = local.Twts()
+	} else {
+		twts, err = local.Get(nick, uri)
+	}
+	if err != nil {
+		log.WithError(err).Errorf("error retrieving feed %s", uri)
+		os.Exit(1)
+	}
+
+	sort.Sort(twts)
+	paged := Page(twts, page)
+
+	_, follows := following[nick]
+	printProfileResponse(types.ProfileResponse{
+		Profile: types.Profile{
+			Type:     "External",
+			Username: nick,
+			URL:      uri,
+			Follows:  follows,
+		},
+		Twter: types.Twter{Nick: nick, URL: uri},
+		Twts:  paged.Twts,
+		Pager: paged.Pager,
+	})
+}
+
+// externalProfile returns the profile of an external feed along with the
+// requested page of its twts
+func externalProfile(cli *client.Client, nick, url string, page int) (types.ProfileResponse, error) {
+	ctx := context.Background()
+
+	res, err := cli.ExternalProfile(ctx, nick, url)
+	if err != nil {
+		return types.ProfileResponse{}, err
+	}
+
+	twts, err := cli.FetchTwts(ctx, nick, url, page)
+	if err != nil {
+		return types.ProfileResponse{}, err
+	}
+
+	res.Twts = twts.Twts
+	res.Pager = twts.Pager
+
+	return res, nil
+}
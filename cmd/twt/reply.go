@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jointwt/twtxt/client"
+	"github.com/jointwt/twtxt/types"
+)
+
+// replyCmd represents the reply command
+var replyCmd = &cobra.Command{
+	Use:   "reply [flags] <hash> [text]",
+	Short: "Reply to a twt",
+	Long: `Reply to the twt with the given hash, mentioning its author and the
+feeds it mentions. The text is read from stdin if not given.`,
+	Args:        cobra.MinimumNArgs(1),
+	Annotations: offlineCommand,
+	Run: func(cmd *cobra.Command, args []string) {
+		if Offline() {
+			replyLocal(NewLocal(), args[0], args[1:])
+			return
+		}
+
+		reply(NewClient(), args[0], args[1:])
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(replyCmd)
+}
+
+func reply(cli *client.Client, hash string, args []string) {
+	ctx := context.Background()
+
+	text := ReadText(args)
+	if text == "" {
+		log.Error("no text provided")
+		os.Exit(1)
+	}
+
+	res, err := cli.Thread(ctx, hash)
+	if err != nil {
+		log.WithError(err).Errorf("error retrieving twt %s", hash)
+		os.Exit(1)
+	}
+
+	var twt types.Twt
+	for _, t := range res.Thread.Twts() {
+		if t.Hash() == hash {
+			twt = t
+			break
+		}
+	}
+	if twt == nil {
+		log.Errorf("twt %s not found", hash)
+		os.Exit(1)
+	}
+
+	settings, err := cli.Settings(ctx)
+	if err != nil {
+		log.WithError(err).Error("error retrieving settings")
+		os.Exit(1)
+	}
+
+	if err := cli.Post(ctx, FormatReply(twt, settings.Username, text)); err != nil {
+		log.WithError(err).Error("error posting reply")
+		os.Exit(1)
+	}
+
+	PrintOK("reply successful")
+}
+
+// replyLocal replies to a twt of the (cached) offline timeline
+func replyLocal(local *Local, hash string, args []string) {
+	text := ReadText(args)
+	if text == "" {
+		log.Error("no text provided")
+		os.Exit(1)
+	}
+
+	twts, err := local.Timeline()
+	if err != nil {
+		log.WithError(err).Error("error loading timeline")
+		os.Exit(1)
+	}
+
+	var twt types.Twt
+	for _, t := range twts {
+		if t.Hash() == hash {
+			twt = t
+			break
+		}
+	}
+	if twt == nil {
+		log.Errorf("twt %s not found in timeline", hash)
+		os.Exit(1)
+	}
+
+	if _, err := local.Post(FormatReply(twt, local.Nick, text)); err != nil {
+		log.WithError(err).Error("error posting reply")
+		os.Exit(1)
+	}
+
+	PrintOK("reply successful")
+}
+
+// FormatReply returns text as a reply to twt (in the same conversation),
+// mentioning its author and the feeds it mentions other than username
+func FormatReply(twt types.Twt, username, text string) string {
+	author := twt.Twter()
+	mentions := []string{fmt.Sprintf("@<%s %s>", author.Nick, author.URL)}
+
+	seen := map[string]bool{author.URL: true}
+	for _, m := range twt.Mentions() {
+		twter := m.Twter()
+		if seen[twter.URL] || twter.Nick == username {
+			continue
+		}
+		seen[twter.URL] = true
+		mentions = append(mentions, fmt.Sprintf("@<%s %s>", twter.Nick, twter.URL))
+	}
+
+	mentions = append(mentions, twt.Subject().String())
+
+	return fmt.Sprintf("%s %s", strings.Join(mentions, " "), text)
+}
@@ -31,6 +31,18 @@ var RootCmd = &cobra.Command{
 		} else {
 			log.SetLevel(log.InfoLevel)
 		}
+
+		switch output := viper.GetString("output"); output {
+		case "text", "json":
+		default:
+			log.Errorf("unknown output format: %s", output)
+			os.Exit(1)
+		}
+
+		if Offline() && cmd.Runnable() && cmd.Annotations["offline"] == "" {
+			log.Errorf("%s is not supported in offline mode", cmd.CommandPath())
+			os.Exit(1)
+		}
 	},
 }
 
@@ -72,6 +84,21 @@ func init() {
 		"twt API token to use to authenticate to endpoints",
 	)
 
+	RootCmd.PersistentFlags().StringP(
+		"output", "o", "text",
+		"Set output format [text, json]",
+	)
+
+	RootCmd.PersistentFlags().Bool(
+		"offline", false,
+		"Work against a local twtxt.txt and follow list without a pod",
+	)
+
+	RootCmd.PersistentFlags().String(
+		"twtfile", "~/twtxt.txt",
+		"Local twtxt.txt to post to in offline mode",
+	)
+
 	viper.BindPFlag("uri", RootCmd.PersistentFlags().Lookup("uri"))
 	viper.SetDefault("uri", client.DefaultURI)
 
@@ -81,6 +108,20 @@ func init() {
 	viper.BindPFlag("debug", RootCmd.PersistentFlags().Lookup("debug"))
 	viper.SetDefault("debug", false)
 
+	viper.BindPFlag("output", RootCmd.PersistentFlags().Lookup("output"))
+	viper.SetDefault("output", "text")
+
+	viper.BindPFlag("offline", RootCmd.PersistentFlags().Lookup("offline"))
+	viper.SetDefault("offline", false)
+
+	viper.BindPFlag("twtfile", RootCmd.PersistentFlags().Lookup("twtfile"))
+	viper.SetDefault("twtfile", "~/twtxt.txt")
+
+	// Offline mode settings only set in the config file or environment
+	viper.SetDefault("nick", "")
+	viper.SetDefault("twturl", "")
+	viper.SetDefault("data", "~/.twt")
+
 	// I have no idea how to work with cobra :)
 	// put this someplace to run on startup.
 	switch *parser {
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jointwt/twtxt/client"
+)
+
+// searchCmd represents the search command
+var searchCmd = &cobra.Command{
+	Use:   "search [flags] <query>",
+	Short: "Search twts",
+	Long:  `...`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		page, err := cmd.Flags().GetInt("page")
+		if err != nil {
+			log.WithError(err).Error("error getting page flag")
+			os.Exit(1)
+		}
+
+		search(NewClient(), strings.Join(args, " "), page)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(searchCmd)
+
+	searchCmd.Flags().Int("page", 1, "page of results to display")
+}
+
+func search(cli *client.Client, query string, page int) {
+	res, err := cli.Search(context.Background(), query, page)
+	if err != nil {
+		log.WithError(err).Errorf("error searching for %q", query)
+		os.Exit(1)
+	}
+
+	PrintPagedResponse(res)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/jointwt/twtxt/client"
+	"github.com/jointwt/twtxt/types"
+)
+
+// settingsCmd represents the settings command
+var settingsCmd = &cobra.Command{
+	Use:   "settings",
+	Short: "Display or update your settings",
+	Long:  `...`,
+}
+
+// settingsGetCmd represents the settings get command
+var settingsGetCmd = &cobra.Command{
+	Use:   "get [flags]",
+	Short: "Display your settings",
+	Long:  `...`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		getSettings(NewClient())
+	},
+}
+
+// settingsSetCmd represents the settings set command
+var settingsSetCmd = &cobra.Command{
+	Use:   "set [flags]",
+	Short: "Update your settings",
+	Long: `Update your settings, only the settings given by flags are changed and
+the others are kept as they are.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		setSettings(NewClient(), cmd)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(settingsCmd)
+	settingsCmd.AddCommand(settingsGetCmd)
+	settingsCmd.AddCommand(settingsSetCmd)
+
+	settingsSetCmd.Flags().String("tagline", "", "set your tagline")
+	settingsSetCmd.Flags().String("email", "", "set your (recovery) email address")
+	settingsSetCmd.Flags().String("avatar", "", "set your avatar to an image file")
+	settingsSetCmd.Flags().Bool("password", false, "prompt for and set a new password")
+	settingsSetCmd.Flags().Bool("followers-visible", true, "show your followers publicly")
+	settingsSetCmd.Flags().Bool("following-visible", true, "show who you follow publicly")
+}
+
+func getSettings(cli *client.Client) {
+	settings, err := cli.Settings(context.Background())
+	if err != nil {
+		log.WithError(err).Error("error retrieving settings")
+		os.Exit(1)
+	}
+
+	if JSONOutput() {
+		PrintJSON(settings)
+		return
+	}
+
+	fmt.Printf("username: %s\n", settings.Username)
+	fmt.Printf("url: %s\n", settings.URL)
+	fmt.Printf("tagline: %s\n", settings.Tagline)
+	fmt.Printf("feeds: %v\n", settings.Feeds)
+	fmt.Printf("followers visible: %t\n", settings.IsFollowersPubliclyVisible)
+	fmt.Printf("following visible: %t\n", settings.IsFollowingPubliclyVisible)
+	fmt.Printf("following: %d\n", len(settings.Following))
+	fmt.Printf("followers: %d\n", len(settings.Followers))
+	fmt.Printf("muted: %d\n", len(settings.Muted))
+}
+
+func setSettings(cli *client.Client, cmd *cobra.Command) {
+	ctx := context.Background()
+	flags := cmd.Flags()
+
+	// Settings not given as flags are sent as they currently are
+	current, err := cli.Settings(ctx)
+	if err != nil {
+		log.WithError(err).Error("error retrieving settings")
+		os.Exit(1)
+	}
+
+	settings := types.SettingsRequest{
+		Tagline:                    current.Tagline,
+		IsFollowersPubliclyVisible: current.IsFollowersPubliclyVisible,
+		IsFollowingPubliclyVisible: current.IsFollowingPubliclyVisible,
+	}
+
+	if flags.Changed("tagline") {
+		settings.Tagline, _ = flags.GetString("tagline")
+	}
+	if flags.Changed("email") {
+		settings.Email, _ = flags.GetString("email")
+	}
+	if flags.Changed("followers-visible") {
+		settings.IsFollowersPubliclyVisible, _ = flags.GetBool("followers-visible")
+	}
+	if flags.Changed("following-visible") {
+		settings.IsFollowingPubliclyVisible, _ = flags.GetBool("following-visible")
+	}
+
+	if prompt, _ := flags.GetBool("password"); prompt {
+		fmt.Print("New Password: ")
+		data, err := terminal.ReadPassword(int(syscall.Stdin))
+		fmt.Println()
+		if err != nil {
+			log.WithError(err).Error("error reading password")
+			os.Exit(1)
+		}
+		settings.Password = string(data)
+	}
+
+	var avatar io.Reader
+	if fn, _ := flags.GetString("avatar"); fn != "" {
+		f, err := os.Open(fn)
+		if err != nil {
+			log.WithError(err).Errorf("error opening %s", fn)
+			os.Exit(1)
+		}
+		defer f.Close()
+		avatar = f
+	}
+
+	if err := cli.UpdateSettings(ctx, settings, avatar); err != nil {
+		log.WithError(err).Error("error updating settings")
+		os.Exit(1)
+	}
+
+	PrintOK("settings updated")
+}
@@ -3,13 +3,10 @@ package main
 import (
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"sort"
 	"strings"
 
-	"github.com/prologic/go-gopher"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
@@ -19,11 +16,13 @@ import (
 
 // statsCmd represents the stats command
 var statsCmd = &cobra.Command{
-	Use:     "stats [flags] <url|file>",
+	Use:     "stats [flags] [url|file]",
 	Aliases: []string{},
 	Short:   "Parses and performs statistical analytis on a Twtxt feed given a URL or local file",
-	Long:    `...`,
-	Args:    cobra.ExactArgs(1),
+	Long: `Parses and performs statistical analytis on a Twtxt feed given a URL or
+local file, or your local twtxt.txt (--twtfile) if none is given.`,
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: offlineCommand,
 	Run: func(cmd *cobra.Command, args []string) {
 		runStats(args)
 	},
@@ -34,43 +33,23 @@ func init() {
 }
 
 func runStats(args []string) {
-	url, err := url.Parse(args[0])
-	if err != nil {
-		log.WithError(err).Error("error parsing url")
-		os.Exit(2)
-	}
-
-	log.Debugf("Reading: %s", url)
+	local := NewLocal()
 
-	switch url.Scheme {
-	case "", "file":
-		f, err := os.Open(url.Path)
-		if err != nil {
-			log.WithError(err).Error("error reading file feed")
-			os.Exit(2)
-		}
-		defer f.Close()
-
-		doStats(f)
-	case "http", "https":
-		f, err := http.Get(url.String())
-		if err != nil {
-			log.WithError(err).Error("error reading HTTP feed")
-			os.Exit(2)
-		}
-		defer f.Body.Close()
+	uri := local.Twtfile
+	if len(args) > 0 {
+		uri = args[0]
+	}
 
-		doStats(f.Body)
-	case "gopher":
-		res, err := gopher.Get(url.String())
-		if err != nil {
-			log.WithError(err).Error("error reading Gopher feed")
-			os.Exit(2)
-		}
-		defer res.Body.Close()
+	log.Debugf("Reading: %s", uri)
 
-		doStats(res.Body)
+	f, err := local.openFeed(uri)
+	if err != nil {
+		log.WithError(err).Errorf("error reading feed %s", uri)
+		os.Exit(2)
 	}
+	defer f.Close()
+
+	doStats(f)
 }
 
 func doStats(r io.Reader) {
@@ -83,6 +62,11 @@ func doStats(r io.Reader) {
 	}
 	log.Debug("Complete!")
 
+	if JSONOutput() {
+		PrintJSON(newFeedStats(twt))
+		return
+	}
+
 	fmt.Println(twt.Info())
 
 	twter := twt.Twter()
@@ -124,6 +108,49 @@ func doStats(r io.Reader) {
 	fmt.Println(links)
 }
 
+// feedStats is the statistical analysis of a feed (for --output json)
+type feedStats struct {
+	Twter     string              `json:"twter"`
+	URL       string              `json:"url"`
+	Metadata  map[string][]string `json:"metadata"`
+	Followers map[string]string   `json:"followers"`
+	Twts      int                 `json:"twts"`
+
+	DaysOfWeek map[string]int `json:"days_of_week"`
+	Tags       map[string]int `json:"tags"`
+	Mentions   map[string]int `json:"mentions"`
+	Subjects   map[string]int `json:"subjects"`
+	Links      map[string]int `json:"links"`
+}
+
+func newFeedStats(twt types.TwtFile) feedStats {
+	twter := twt.Twter()
+	m := lextwt.NewMention(twter.Nick, twter.URL)
+
+	s := feedStats{
+		Twter:     fmt.Sprintf("%s@%s", m.Name(), m.Domain()),
+		URL:       m.URL().String(),
+		Metadata:  make(map[string][]string),
+		Followers: make(map[string]string),
+		Twts:      len(twt.Twts()),
+
+		DaysOfWeek: daysOfWeek(twt.Twts()).Map(),
+		Tags:       getTags(twt.Twts().Tags()).Map(),
+		Mentions:   getMentions(twt.Twts(), twt.Info().Followers()).Map(),
+		Subjects:   twt.Twts().SubjectCount(),
+		Links:      twt.Twts().LinkCount(),
+	}
+
+	for _, c := range twt.Info().GetAll("") {
+		s.Metadata[c.Key()] = append(s.Metadata[c.Key()], c.Value())
+	}
+	for _, c := range twt.Info().Followers() {
+		s.Followers[c.Nick] = c.URL
+	}
+
+	return s
+}
+
 func daysOfWeek(twts types.Twts) stats {
 	s := make(map[string]int)
 
@@ -199,3 +226,12 @@ func (s stats) String() string {
 	}
 	return b.String()
 }
+
+// Map returns the counts of the stats by their text
+func (s stats) Map() map[string]int {
+	m := make(map[string]int, len(s))
+	for _, stat := range s {
+		m[stat.text] = stat.count
+	}
+	return m
+}
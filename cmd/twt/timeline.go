@@ -1,14 +1,11 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"os"
-	"sort"
-	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 
 	"github.com/jointwt/twtxt/client"
 )
@@ -20,38 +17,59 @@ var timelineCmd = &cobra.Command{
 	Short:   "Display your timeline",
 	Long:    `...`,
 	//Args:    cobra.NArgs(0),
+	Annotations: offlineCommand,
 	Run: func(cmd *cobra.Command, args []string) {
-		uri := viper.GetString("uri")
-		token := viper.GetString("token")
-		cli, err := client.NewClient(
-			client.WithURI(uri),
-			client.WithToken(token),
-		)
+		page, err := cmd.Flags().GetInt("page")
 		if err != nil {
-			log.WithError(err).Error("error creating client")
+			log.WithError(err).Error("error getting page flag")
 			os.Exit(1)
 		}
 
-		timeline(cli, args)
+		if Offline() {
+			cached, err := cmd.Flags().GetBool("cache")
+			if err != nil {
+				log.WithError(err).Error("error getting cache flag")
+				os.Exit(1)
+			}
+
+			timelineLocal(NewLocal(), page, cached)
+			return
+		}
+
+		timeline(NewClient(), page)
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(timelineCmd)
+
+	timelineCmd.Flags().Int("page", 1, "page of the timeline to display")
+	timelineCmd.Flags().Bool("cache", false, "only display cached twts without fetching feeds (offline mode)")
 }
 
-func timeline(cli *client.Client, args []string) {
-	// TODO: How do we get more pages?
-	res, err := cli.Timeline(0)
+func timeline(cli *client.Client, page int) {
+	res, err := cli.Timeline(context.Background(), page)
 	if err != nil {
 		log.WithError(err).Error("error retrieving timeline")
 		os.Exit(1)
 	}
 
-	sort.Sort(sort.Reverse(res.Twts))
+	PrintPagedResponse(res)
+}
+
+func timelineLocal(local *Local, page int, cached bool) {
+	if !cached {
+		if err := local.Fetch(context.Background()); err != nil {
+			log.WithError(err).Error("error fetching feeds")
+			os.Exit(1)
+		}
+	}
 
-	for _, twt := range res.Twts {
-		PrintTwt(twt, time.Now())
-		fmt.Println()
+	twts, err := local.Timeline()
+	if err != nil {
+		log.WithError(err).Error("error loading timeline")
+		os.Exit(1)
 	}
+
+	PrintPagedResponse(Page(twts, page))
 }
@@ -0,0 +1,934 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jointwt/twtxt/client"
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	timelineView = iota
+	mentionsView
+	conversationView
+)
+
+const (
+	// tuiRequestTimeout is how long requests to the pod may take
+	tuiRequestTimeout = 30 * time.Second
+
+	// tuiMaxDepth is the deepest replies in a conversation are indented
+	tuiMaxDepth = 8
+)
+
+var viewNames = []string{"Timeline", "Mentions", "Conversation"}
+
+// tuiCmd represents the tui command
+var tuiCmd = &cobra.Command{
+	Use:   "tui [flags]",
+	Short: "Interactive terminal client",
+	Long: `Run a full-screen terminal client showing your timeline and mentions,
+refreshed periodically, where you can read conversations and compose and
+reply to twts.
+
+Keys:
+  tab, 1, 2, 3    switch between the timeline, mentions and conversation
+  up/down, j/k    select a twt (pgup/pgdn, g/G to jump)
+  enter           open the conversation of the selected twt
+  esc             close the conversation
+  c               compose a new twt
+  r               reply to the selected twt
+  R               refresh now
+  q, ctrl+c       quit
+
+While composing tab completes the @mention or #tag before the cursor, enter
+posts the twt and esc cancels it.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		refresh, err := cmd.Flags().GetDuration("refresh")
+		if err != nil {
+			log.WithError(err).Error("error getting refresh flag")
+			os.Exit(1)
+		}
+
+		if err := runTUI(NewClient(), refresh); err != nil {
+			log.WithError(err).Error("error running terminal ui")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(tuiCmd)
+
+	tuiCmd.Flags().Duration("refresh", time.Minute, "interval to refresh the timeline and mentions at")
+}
+
+// tuiUpdate is applied to the tui by its event loop, background requests to
+// the pod post their results as updates so the tui is only ever touched by
+// one goroutine
+type tuiUpdate func(t *tui)
+
+// tuiItem is a twt displayed in a view, replies in a conversation are
+// indented by their depth
+type tuiItem struct {
+	twt   types.Twt
+	depth int
+}
+
+// tuiView is a scrolling list of twts, newest first
+type tuiView struct {
+	items    []tuiItem
+	selected int
+	offset   int
+
+	page     int
+	maxPages int
+	loading  bool
+	unread   int
+}
+
+func (v *tuiView) Selected() types.Twt {
+	if v.selected < len(v.items) {
+		return v.items[v.selected].twt
+	}
+	return nil
+}
+
+// merge adds the twts of a page to the view, new twts of the first page are
+// added at the top keeping the same twt selected
+func (v *tuiView) merge(twts types.Twts, page int) int {
+	seen := make(map[string]bool, len(v.items))
+	for _, item := range v.items {
+		seen[item.twt.Hash()] = true
+	}
+
+	var items []tuiItem
+	for _, twt := range twts {
+		if !seen[twt.Hash()] {
+			items = append(items, tuiItem{twt: twt})
+		}
+	}
+
+	if page == 1 {
+		v.items = append(items, v.items...)
+		if v.selected > 0 || v.offset > 0 {
+			v.selected += len(items)
+		}
+	} else {
+		v.items = append(v.items, items...)
+	}
+
+	return len(items)
+}
+
+// tuiCompose is the compose box and its @mention / #tag completion
+type tuiCompose struct {
+	active  bool
+	posting bool
+	replyTo types.Twt
+	text    []rune
+	cursor  int
+
+	// completions of the word starting at start, the last one inserted is
+	// completions[index]
+	completions []string
+	start       int
+	index       int
+}
+
+func (c *tuiCompose) insert(s string) {
+	rs := []rune(s)
+	text := make([]rune, 0, len(c.text)+len(rs))
+	text = append(text, c.text[:c.cursor]...)
+	text = append(text, rs...)
+	c.text = append(text, c.text[c.cursor:]...)
+	c.cursor += len(rs)
+}
+
+func (c *tuiCompose) remove(from, to int) {
+	c.text = append(c.text[:from], c.text[to:]...)
+	c.cursor = from
+}
+
+// word returns the start of the word before the cursor and the word
+func (c *tuiCompose) word() (int, string) {
+	start := c.cursor
+	for start > 0 && c.text[start-1] != ' ' {
+		start--
+	}
+	return start, string(c.text[start:c.cursor])
+}
+
+type tui struct {
+	ctx    context.Context
+	cli    *client.Client
+	screen tcell.Screen
+
+	username string
+	twters   map[string]string
+	tags     map[string]bool
+
+	views    []*tuiView
+	current  int
+	previous int
+	compose  tuiCompose
+
+	status    string
+	statusErr bool
+	refreshed time.Time
+}
+
+func runTUI(cli *client.Client, refresh time.Duration) error {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	if err := screen.Init(); err != nil {
+		return err
+	}
+	defer screen.Fini()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t := &tui{
+		ctx:     ctx,
+		cli:     cli,
+		screen:  screen,
+		twters:  make(map[string]string),
+		tags:    make(map[string]bool),
+		views:   []*tuiView{{}, {}, {}},
+		current: timelineView,
+	}
+
+	t.loadSettings()
+	t.refresh()
+
+	if refresh > 0 {
+		go func() {
+			ticker := time.NewTicker(refresh)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					t.post(func(t *tui) { t.refresh() })
+				}
+			}
+		}()
+	}
+
+	for {
+		t.draw()
+
+		switch ev := screen.PollEvent().(type) {
+		case nil:
+			return nil
+		case *tcell.EventResize:
+			screen.Sync()
+		case *tcell.EventInterrupt:
+			if update, ok := ev.Data().(tuiUpdate); ok {
+				update(t)
+			}
+		case *tcell.EventKey:
+			if ev.Key() == tcell.KeyCtrlC {
+				return nil
+			}
+			if t.compose.active {
+				t.composeKey(ev)
+			} else if quit := t.key(ev); quit {
+				return nil
+			}
+		}
+	}
+}
+
+// post hands update to the event loop
+func (t *tui) post(update tuiUpdate) {
+	ev := tcell.NewEventInterrupt(update)
+	for t.screen.PostEvent(ev) != nil {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// async runs fn in the background and applies the update it returns
+func (t *tui) async(fn func(ctx context.Context) tuiUpdate) {
+	go func() {
+		ctx, cancel := context.WithTimeout(t.ctx, tuiRequestTimeout)
+		defer cancel()
+
+		t.post(fn(ctx))
+	}()
+}
+
+func (t *tui) setStatus(format string, args ...interface{}) {
+	t.status = fmt.Sprintf(format, args...)
+	t.statusErr = false
+}
+
+func (t *tui) setError(err error, format string, args ...interface{}) {
+	t.status = fmt.Sprintf("%s: %s", fmt.Sprintf(format, args...), err)
+	t.statusErr = true
+}
+
+// learn remembers the nicks and tags of twts for completion
+func (t *tui) learn(twts types.Twts) {
+	addTwter := func(twter types.Twter) {
+		if _, ok := t.twters[twter.Nick]; !ok && twter.Nick != "" && twter.URL != "" {
+			t.twters[twter.Nick] = twter.URL
+		}
+	}
+
+	for _, twt := range twts {
+		addTwter(twt.Twter())
+		for _, m := range twt.Mentions() {
+			addTwter(m.Twter())
+		}
+		for _, tag := range twt.Tags() {
+			if tag.Text() != "" {
+				t.tags[tag.Text()] = true
+			}
+		}
+	}
+}
+
+func (t *tui) loadSettings() {
+	t.async(func(ctx context.Context) tuiUpdate {
+		res, err := t.cli.Settings(ctx)
+		return func(t *tui) {
+			if err != nil {
+				t.setError(err, "error retrieving settings")
+				return
+			}
+
+			t.username = res.Username
+			for nick, url := range res.Following {
+				t.twters[nick] = url
+			}
+		}
+	})
+}
+
+func (t *tui) refresh() {
+	t.load(timelineView, 1)
+	t.load(mentionsView, 1)
+}
+
+// load loads a page of the timeline or mentions
+func (t *tui) load(view, page int) {
+	v := t.views[view]
+	if v.loading {
+		return
+	}
+	v.loading = true
+
+	t.async(func(ctx context.Context) tuiUpdate {
+		var (
+			res types.PagedResponse
+			err error
+		)
+		if view == mentionsView {
+			res, err = t.cli.Mentions(ctx, page)
+		} else {
+			res, err = t.cli.Timeline(ctx, page)
+		}
+
+		return func(t *tui) {
+			v.loading = false
+			if err != nil {
+				t.setError(err, "error loading %s", strings.ToLower(viewNames[view]))
+				return
+			}
+
+			sort.Sort(res.Twts)
+			t.learn(res.Twts)
+
+			first := len(v.items) == 0
+			n := v.merge(res.Twts, page)
+			if page == 1 {
+				t.refreshed = time.Now()
+				if !first && view != t.current {
+					v.unread += n
+				}
+			}
+			if page > v.page || first {
+				v.page = page
+			}
+			if res.Pager.MaxPages > 0 {
+				v.maxPages = res.Pager.MaxPages
+			}
+		}
+	})
+}
+
+// openConversation loads the thread twt is part of into the conversation
+// view
+func (t *tui) openConversation(twt types.Twt) {
+	hash := twt.Hash()
+	t.setStatus("loading conversation of %s…", hash)
+
+	t.async(func(ctx context.Context) tuiUpdate {
+		res, err := t.cli.Thread(ctx, hash)
+		return func(t *tui) {
+			if err != nil {
+				t.setError(err, "error loading conversation of %s", hash)
+				return
+			}
+
+			v := &tuiView{}
+			flattenThread(res.Thread, 0, &v.items)
+			for i, item := range v.items {
+				t.learn(types.Twts{item.twt})
+				if item.twt.Hash() == hash {
+					v.selected = i
+				}
+			}
+
+			t.views[conversationView] = v
+			t.switchView(conversationView)
+			t.setStatus("")
+		}
+	})
+}
+
+func flattenThread(thread *types.Thread, depth int, items *[]tuiItem) {
+	if thread == nil {
+		return
+	}
+
+	*items = append(*items, tuiItem{twt: thread.Twt, depth: depth})
+	for _, reply := range thread.Replies {
+		flattenThread(reply, depth+1, items)
+	}
+}
+
+func (t *tui) switchView(view int) {
+	if view == conversationView && len(t.views[conversationView].items) == 0 {
+		return
+	}
+	if t.current != conversationView {
+		t.previous = t.current
+	}
+	t.current = view
+	t.views[view].unread = 0
+}
+
+// move moves the selection of the current view by n twts loading the next
+// page when the last twt is selected
+func (t *tui) move(n int) {
+	v := t.views[t.current]
+
+	v.selected += n
+	if v.selected >= len(v.items) {
+		v.selected = len(v.items) - 1
+	}
+	if v.selected < 0 {
+		v.selected = 0
+	}
+
+	if t.current != conversationView && v.selected == len(v.items)-1 && v.page < v.maxPages {
+		t.load(t.current, v.page+1)
+	}
+}
+
+// key handles keys while browsing, it returns true to quit
+func (t *tui) key(ev *tcell.EventKey) bool {
+	v := t.views[t.current]
+
+	switch ev.Key() {
+	case tcell.KeyUp:
+		t.move(-1)
+	case tcell.KeyDown:
+		t.move(1)
+	case tcell.KeyPgUp:
+		t.move(-5)
+	case tcell.KeyPgDn:
+		t.move(5)
+	case tcell.KeyHome:
+		t.move(-len(v.items))
+	case tcell.KeyEnd:
+		t.move(len(v.items))
+	case tcell.KeyTab, tcell.KeyBacktab:
+		views := 2
+		if len(t.views[conversationView].items) > 0 {
+			views = 3
+		}
+		step := 1
+		if ev.Key() == tcell.KeyBacktab {
+			step = views - 1
+		}
+		t.switchView((t.current + step) % views)
+	case tcell.KeyEnter:
+		if twt := v.Selected(); twt != nil {
+			t.openConversation(twt)
+		}
+	case tcell.KeyEscape:
+		if t.current == conversationView {
+			t.switchView(t.previous)
+		}
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'q':
+			return true
+		case 'k':
+			t.move(-1)
+		case 'j':
+			t.move(1)
+		case 'g':
+			t.move(-len(v.items))
+		case 'G':
+			t.move(len(v.items))
+		case '1':
+			t.switchView(timelineView)
+		case '2':
+			t.switchView(mentionsView)
+		case '3':
+			t.switchView(conversationView)
+		case 'c':
+			t.startCompose(nil)
+		case 'r':
+			if twt := v.Selected(); twt != nil {
+				t.startCompose(twt)
+			}
+		case 'R':
+			t.refresh()
+		}
+	}
+
+	return false
+}
+
+// startCompose opens the compose box, replies start with the mentions and
+// subject of the twt replied to
+func (t *tui) startCompose(replyTo types.Twt) {
+	t.compose = tuiCompose{active: true, replyTo: replyTo}
+	if replyTo != nil {
+		t.compose.insert(FormatReply(replyTo, t.username, ""))
+	}
+}
+
+// composeKey handles keys while composing
+func (t *tui) composeKey(ev *tcell.EventKey) {
+	c := &t.compose
+	if ev.Key() != tcell.KeyTab {
+		c.completions = nil
+	}
+
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		t.compose = tuiCompose{}
+	case tcell.KeyEnter:
+		t.postCompose()
+	case tcell.KeyTab:
+		t.complete()
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if c.cursor > 0 {
+			c.remove(c.cursor-1, c.cursor)
+		}
+	case tcell.KeyDelete, tcell.KeyCtrlD:
+		if c.cursor < len(c.text) {
+			c.cursor++
+			c.remove(c.cursor-1, c.cursor)
+		}
+	case tcell.KeyLeft, tcell.KeyCtrlB:
+		if c.cursor > 0 {
+			c.cursor--
+		}
+	case tcell.KeyRight, tcell.KeyCtrlF:
+		if c.cursor < len(c.text) {
+			c.cursor++
+		}
+	case tcell.KeyHome, tcell.KeyCtrlA:
+		c.cursor = 0
+	case tcell.KeyEnd, tcell.KeyCtrlE:
+		c.cursor = len(c.text)
+	case tcell.KeyCtrlU:
+		c.remove(0, c.cursor)
+	case tcell.KeyCtrlW:
+		start, _ := c.word()
+		if start == c.cursor && start > 0 {
+			start--
+		}
+		c.remove(start, c.cursor)
+	case tcell.KeyRune:
+		c.insert(string(ev.Rune()))
+	}
+}
+
+// suggestions returns the completions of the @mention or #tag before the
+// cursor
+func (t *tui) suggestions(word string) []string {
+	if len(word) < 1 {
+		return nil
+	}
+
+	var completions []string
+	prefix := strings.ToLower(word[1:])
+	switch word[0] {
+	case '@':
+		for nick, url := range t.twters {
+			if strings.HasPrefix(strings.ToLower(nick), prefix) {
+				completions = append(completions, fmt.Sprintf("@<%s %s>", nick, url))
+			}
+		}
+	case '#':
+		for tag := range t.tags {
+			if strings.HasPrefix(strings.ToLower(tag), prefix) {
+				completions = append(completions, "#"+tag)
+			}
+		}
+	}
+	sort.Strings(completions)
+
+	return completions
+}
+
+// complete replaces the word before the cursor by its first completion, or
+// the next one when completing again
+func (t *tui) complete() {
+	c := &t.compose
+
+	if c.completions == nil {
+		start, word := c.word()
+		completions := t.suggestions(word)
+		if len(completions) == 0 {
+			return
+		}
+		c.completions, c.start, c.index = completions, start, 0
+	} else {
+		c.index = (c.index + 1) % len(c.completions)
+	}
+
+	c.remove(c.start, c.cursor)
+	c.insert(c.completions[c.index] + " ")
+}
+
+func (t *tui) postCompose() {
+	c := &t.compose
+
+	text := strings.TrimSpace(string(c.text))
+	if c.posting || text == "" {
+		return
+	}
+	c.posting = true
+	t.setStatus("posting…")
+
+	t.async(func(ctx context.Context) tuiUpdate {
+		err := t.cli.Post(ctx, text)
+		return func(t *tui) {
+			t.compose.posting = false
+			if err != nil {
+				t.setError(err, "error posting twt")
+				return
+			}
+
+			t.compose = tuiCompose{}
+			t.setStatus("posted")
+			t.load(timelineView, 1)
+		}
+	})
+}
+
+// tuiRune is a rune of a twt rendered by FprintTwt with the style of its
+// colour
+type tuiRune struct {
+	r     rune
+	style tcell.Style
+}
+
+// renderTwt renders twt as FprintTwt prints it wrapped to width
+func renderTwt(twt types.Twt, width int) [][]tuiRune {
+	var buf bytes.Buffer
+	FprintTwt(&buf, twt, "")
+
+	var lines [][]tuiRune
+	for _, line := range parseANSI(buf.String()) {
+		lines = append(lines, wrapRunes(line, width)...)
+	}
+
+	return append(lines, nil)
+}
+
+// parseANSI splits text coloured with ANSI escape codes (see red, green, ...)
+// into lines of styled runes
+func parseANSI(text string) [][]tuiRune {
+	var (
+		lines [][]tuiRune
+		line  []tuiRune
+		style = tcell.StyleDefault
+	)
+
+	rs := []rune(strings.TrimSuffix(text, "\n"))
+	for i := 0; i < len(rs); i++ {
+		switch r := rs[i]; {
+		case r == '\033' && i+1 < len(rs) && rs[i+1] == '[':
+			j := i + 2
+			for j < len(rs) && rs[j] != 'm' {
+				j++
+			}
+			style = sgrStyle(style, string(rs[i+2:j]))
+			i = j
+		case r == '\n':
+			lines = append(lines, line)
+			line = nil
+		default:
+			line = append(line, tuiRune{r, style})
+		}
+	}
+
+	return append(lines, line)
+}
+
+func sgrStyle(style tcell.Style, params string) tcell.Style {
+	for _, param := range strings.Split(params, ";") {
+		switch n, _ := strconv.Atoi(param); {
+		case n == 0:
+			style = tcell.StyleDefault
+		case n == 1:
+			style = style.Bold(true)
+		case n >= 30 && n <= 37:
+			style = style.Foreground(tcell.PaletteColor(n - 30))
+		}
+	}
+	return style
+}
+
+// wrapRunes wraps line to width preferably at spaces
+func wrapRunes(line []tuiRune, width int) [][]tuiRune {
+	if width < 1 {
+		width = 1
+	}
+
+	var lines [][]tuiRune
+	for {
+		i, w := 0, 0
+		for i < len(line) && w+runewidth.RuneWidth(line[i].r) <= width {
+			w += runewidth.RuneWidth(line[i].r)
+			i++
+		}
+		if i == len(line) {
+			return append(lines, line)
+		}
+		if i == 0 {
+			i = 1
+		}
+
+		for j := i; j > 0; j-- {
+			if line[j-1].r == ' ' {
+				i = j
+				break
+			}
+		}
+
+		lines = append(lines, line[:i])
+		line = line[i:]
+	}
+}
+
+// drawText draws s at x, y clipped to width and returns the x it ends at
+func (t *tui) drawText(x, y, width int, s string, style tcell.Style) int {
+	for _, r := range s {
+		w := runewidth.RuneWidth(r)
+		if x+w > width {
+			break
+		}
+		t.screen.SetContent(x, y, r, nil, style)
+		x += w
+	}
+	return x
+}
+
+func (t *tui) draw() {
+	t.screen.Clear()
+	width, height := t.screen.Size()
+	if height < 4 {
+		t.screen.Show()
+		return
+	}
+
+	t.drawTabs(width)
+	t.drawView(t.views[t.current], 1, height-3, width)
+	t.drawStatus(height-2, width)
+	t.drawCompose(height-1, width)
+
+	t.screen.Show()
+}
+
+func (t *tui) drawTabs(width int) {
+	x := 0
+	for i, name := range viewNames {
+		v := t.views[i]
+		if i == conversationView && len(v.items) == 0 {
+			continue
+		}
+
+		label := fmt.Sprintf(" %d %s ", i+1, name)
+		if v.unread > 0 {
+			label = fmt.Sprintf(" %d %s (%d) ", i+1, name, v.unread)
+		}
+
+		style := tcell.StyleDefault
+		if i == t.current {
+			style = style.Reverse(true)
+		}
+		x = t.drawText(x, 0, width, label, style) + 1
+	}
+
+	if t.username != "" {
+		user := "@" + t.username
+		t.drawText(width-runewidth.StringWidth(user)-1, 0, width, user, tcell.StyleDefault.Foreground(tcell.ColorGreen))
+	}
+}
+
+func (t *tui) drawView(v *tuiView, top, height, width int) {
+	if len(v.items) == 0 {
+		msg := "No twts"
+		if v.loading {
+			msg = "Loading…"
+		}
+		t.drawText(2, top, width, msg, tcell.StyleDefault)
+		return
+	}
+
+	indent := func(item tuiItem) int {
+		depth := item.depth
+		if depth > tuiMaxDepth {
+			depth = tuiMaxDepth
+		}
+		return 2 + depth*2
+	}
+
+	rendered := make(map[int][][]tuiRune)
+	lines := func(i int) [][]tuiRune {
+		if _, ok := rendered[i]; !ok {
+			rendered[i] = renderTwt(v.items[i].twt, width-indent(v.items[i]))
+		}
+		return rendered[i]
+	}
+
+	// Keep the selected twt in view
+	if v.selected < v.offset {
+		v.offset = v.selected
+	}
+	for v.offset < v.selected {
+		h := 0
+		for i := v.offset; i <= v.selected; i++ {
+			h += len(lines(i))
+		}
+		if h <= height {
+			break
+		}
+		v.offset++
+	}
+
+	y := top
+	for i := v.offset; i < len(v.items) && y < top+height; i++ {
+		for _, line := range lines(i) {
+			if y >= top+height {
+				break
+			}
+			if i == v.selected && len(line) > 0 {
+				t.screen.SetContent(0, y, '▌', nil, tcell.StyleDefault.Foreground(tcell.ColorYellow))
+			}
+			x := indent(v.items[i])
+			for _, r := range line {
+				t.screen.SetContent(x, y, r.r, nil, r.style)
+				x += runewidth.RuneWidth(r.r)
+			}
+			y++
+		}
+	}
+}
+
+func (t *tui) drawStatus(y, width int) {
+	c := &t.compose
+	if c.active && !c.posting {
+		completions := c.completions
+		if completions == nil {
+			_, word := c.word()
+			completions = t.suggestions(word)
+		}
+
+		x := 0
+		for i, completion := range completions {
+			style := tcell.StyleDefault.Foreground(tcell.ColorBlue)
+			if c.completions != nil && i == c.index {
+				style = style.Reverse(true)
+			}
+			x = t.drawText(x, y, width, FormatTwt(completion), style) + 1
+		}
+		if len(completions) > 0 {
+			return
+		}
+	}
+
+	style := tcell.StyleDefault
+	if t.statusErr {
+		style = style.Foreground(tcell.ColorRed)
+	}
+	t.drawText(0, y, width, t.status, style)
+
+	if !t.refreshed.IsZero() && !t.statusErr {
+		refreshed := fmt.Sprintf("refreshed %s", t.refreshed.Format("15:04"))
+		t.drawText(width-runewidth.StringWidth(refreshed)-1, y, width, refreshed, tcell.StyleDefault.Dim(true))
+	}
+}
+
+func (t *tui) drawCompose(y, width int) {
+	c := &t.compose
+	if !c.active {
+		t.screen.HideCursor()
+		help := "c compose  r reply  enter conversation  tab switch  R refresh  q quit"
+		t.drawText(0, y, width, help, tcell.StyleDefault.Dim(true))
+		return
+	}
+
+	prompt := "twt> "
+	if c.replyTo != nil {
+		prompt = "reply> "
+	}
+	x := t.drawText(0, y, width, prompt, tcell.StyleDefault.Bold(true))
+
+	// Scroll the text horizontally to keep the cursor in view
+	room := width - x - 1
+	start := 0
+	for runewidth.StringWidth(string(c.text[start:c.cursor])) > room {
+		start++
+	}
+
+	cursor := x
+	for i, r := range c.text[start:] {
+		if start+i == c.cursor {
+			cursor = x
+		}
+		w := runewidth.RuneWidth(r)
+		if x+w > width {
+			break
+		}
+		t.screen.SetContent(x, y, r, nil, tcell.StyleDefault)
+		x += w
+	}
+	if c.cursor == len(c.text) {
+		cursor = x
+	}
+	t.screen.ShowCursor(cursor, y)
+}
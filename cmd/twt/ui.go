@@ -1,10 +1,18 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/dustin/go-humanize"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
 	"github.com/jointwt/twtxt/types"
 )
 
@@ -36,6 +44,12 @@ func PrintFolloweeRaw(nick, url string) {
 }
 
 func PrintTwt(twt types.Twt, now time.Time) {
+	FprintTwt(os.Stdout, twt, "")
+}
+
+// FprintTwt writes twt to w as PrintTwt prints it with every line prefixed
+// by indent
+func FprintTwt(w io.Writer, twt types.Twt, indent string) {
 	text := FormatTwt(fmt.Sprintf("%t", twt))
 	time := humanize.Time(twt.Created())
 	nick := green(twt.Twter().Nick)
@@ -46,9 +60,10 @@ func PrintTwt(twt types.Twt, now time.Time) {
 	//	nick = boldgreen(twt.Twter.Nick)
 	//}
 
-	fmt.Printf(
-		"> %s (%s) [%s]\n%s\n",
-		nick, time, hash, text,
+	fmt.Fprintf(
+		w, "%s> %s (%s) [%s]\n%s%s\n",
+		indent, nick, time, hash,
+		indent, strings.ReplaceAll(text, "\n", "\n"+indent),
 	)
 }
 
@@ -60,3 +75,101 @@ func PrintTwtRaw(twt types.Twt) {
 		twt,
 	)
 }
+
+// JSONOutput returns true if the output format is json (--output json)
+func JSONOutput() bool {
+	return viper.GetString("output") == "json"
+}
+
+// PrintJSON prints v as indented JSON
+func PrintJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.WithError(err).Error("error encoding output")
+		os.Exit(1)
+	}
+}
+
+// PrintOK reports the success of a command that has no result, as an empty
+// object with --output json
+func PrintOK(msg string) {
+	if JSONOutput() {
+		PrintJSON(struct{}{})
+		return
+	}
+	log.Info(msg)
+}
+
+// PrintTwts prints twts oldest first so the newest twt is the closest to the
+// prompt
+func PrintTwts(twts types.Twts) {
+	sort.Sort(sort.Reverse(twts))
+
+	now := time.Now()
+	for _, twt := range twts {
+		PrintTwt(twt, now)
+		fmt.Println()
+	}
+}
+
+// PrintPagedResponse prints the twts of the page and which page it is
+func PrintPagedResponse(res types.PagedResponse) {
+	if JSONOutput() {
+		PrintJSON(res)
+		return
+	}
+
+	PrintTwts(res.Twts)
+	PrintPager(res.Pager)
+}
+
+// PrintPager ...
+func PrintPager(pager types.PagerResponse) {
+	if pager.MaxPages > 1 {
+		fmt.Printf("page %d of %d (%d twts)\n", pager.Current, pager.MaxPages, pager.TotalTwts)
+	}
+}
+
+// PrintThread prints the thread with its replies indented below each twt
+func PrintThread(thread *types.Thread, depth int) {
+	if thread == nil {
+		return
+	}
+
+	FprintTwt(os.Stdout, thread.Twt, strings.Repeat("  ", depth))
+	fmt.Println()
+
+	for _, reply := range thread.Replies {
+		PrintThread(reply, depth+1)
+	}
+}
+
+// PrintProfile ...
+func PrintProfile(profile types.Profile) {
+	fmt.Printf("%s @ %s\n", yellow(profile.Username), profile.URL)
+	if profile.Tagline != "" {
+		fmt.Println(profile.Tagline)
+	}
+
+	var details []string
+	if profile.ShowFollowing {
+		details = append(details, fmt.Sprintf("following: %d", len(profile.Following)))
+	}
+	if profile.ShowFollowers {
+		details = append(details, fmt.Sprintf("followers: %d", len(profile.Followers)))
+	}
+	if profile.Follows {
+		details = append(details, "followed")
+	}
+	if profile.FollowedBy {
+		details = append(details, "follows you")
+	}
+	if profile.Muted {
+		details = append(details, red("muted"))
+	}
+	if len(details) > 0 {
+		fmt.Println(strings.Join(details, " "))
+	}
+	fmt.Println()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jointwt/twtxt/client"
+	"github.com/jointwt/twtxt/types"
+)
+
+// uploadCmd represents the upload command
+var uploadCmd = &cobra.Command{
+	Use:   "upload [flags] <file>",
+	Short: "Upload an image, audio or video to include in a twt",
+	Long: `Upload an image, audio or video and wait for the pod to process it,
+the url of the media to include in a twt is printed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		upload(NewClient(), args[0])
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(uploadCmd)
+}
+
+func upload(cli *client.Client, fn string) {
+	ctx := context.Background()
+
+	f, err := os.Open(fn)
+	if err != nil {
+		log.WithError(err).Errorf("error opening %s", fn)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	res, err := cli.UploadMedia(ctx, fn, f)
+	if err != nil {
+		log.WithError(err).Errorf("error uploading %s", fn)
+		os.Exit(1)
+	}
+
+	if res.Type != "taskURI" {
+		if JSONOutput() {
+			PrintJSON(res)
+			return
+		}
+		fmt.Println(res.Path)
+		return
+	}
+
+	log.Info("processing media...")
+
+	var task types.TaskResponse
+	for {
+		task, err = cli.Task(ctx, res.Path)
+		if err != nil {
+			log.WithError(err).Error("error retrieving media processing task")
+			os.Exit(1)
+		}
+		if task.State == "complete" || task.State == "failed" {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+
+	if task.State == "failed" {
+		log.Errorf("error processing %s: %s", fn, task.Error)
+		os.Exit(1)
+	}
+
+	if JSONOutput() {
+		PrintJSON(task)
+		return
+	}
+	fmt.Println(task.Data["mediaURI"])
+}
@@ -2,13 +2,50 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/goware/urlx"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/jointwt/twtxt/client"
 )
 
+// NewClient returns a new API client for the uri and token given by flags,
+// the environment or the config file
+func NewClient() *client.Client {
+	cli, err := client.NewClient(
+		client.WithURI(viper.GetString("uri")),
+		client.WithToken(viper.GetString("token")),
+	)
+	if err != nil {
+		log.WithError(err).Error("error creating client")
+		os.Exit(1)
+	}
+	return cli
+}
+
+// ReadText returns the text given as arguments or, if there are none, read
+// from stdin
+func ReadText(args []string) string {
+	text := strings.Join(args, " ")
+
+	if text == "" {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.WithError(err).Error("error reading text from stdin")
+			os.Exit(1)
+		}
+		text = string(data)
+	}
+
+	return strings.TrimSpace(text)
+}
+
 // FormatTwt ...
 func FormatTwt(text string) string {
 	re := regexp.MustCompile(`(@|#)<([^ ]+) *([^>]+)>`)
@@ -50,3 +87,26 @@ func NormalizeURL(url string) string {
 	}
 	return norm
 }
+
+// ParsePostAt parses the time a twt is to be posted at either as an absolute
+// time in RFC3339 or local time (2006-01-02T15:04 or 2006-01-02 15:04) or a
+// duration relative to now (e.g: 2h30m).
+func ParsePostAt(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(d), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time: %s", s)
+}
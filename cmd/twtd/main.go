@@ -49,6 +49,8 @@ var (
 	maxTwtLength  int
 	maxUploadSize int64
 	maxFetchLimit int64
+	maxFeedSize   int64
+	maxFeedAge    time.Duration
 	maxCacheTTL   time.Duration
 	maxCacheItems int
 
@@ -126,6 +128,14 @@ func init() {
 		&maxFetchLimit, "max-fetch-limit", "F", internal.DefaultMaxFetchLimit,
 		"maximum feed fetch limit in bytes",
 	)
+	flag.Int64Var(
+		&maxFeedSize, "max-feed-size", internal.DefaultMaxFeedSize,
+		"maximum size in bytes of local feeds before older twts are archived (0 to disable)",
+	)
+	flag.DurationVar(
+		&maxFeedAge, "max-feed-age", internal.DefaultMaxFeedAge,
+		"maximum age of twts in local feeds before they are archived (0 to disable)",
+	)
 	flag.DurationVarP(
 		&maxCacheTTL, "max-cache-ttl", "C", internal.DefaultMaxCacheTTL,
 		"maximum cache ttl (time-to-live) of cached twts in memory",
@@ -224,6 +234,10 @@ func extraServiceInfoFactory(svr *internal.Server) profiler.ExtraServiceInfoRetr
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(migrate(os.Args[2:]))
+	}
+
 	parseArgs()
 
 	if version {
@@ -274,6 +288,8 @@ func main() {
 		internal.WithMaxTwtLength(maxTwtLength),
 		internal.WithMaxUploadSize(maxUploadSize),
 		internal.WithMaxFetchLimit(maxFetchLimit),
+		internal.WithMaxFeedSize(maxFeedSize),
+		internal.WithMaxFeedAge(maxFeedAge),
 		internal.WithMaxCacheTTL(maxCacheTTL),
 		internal.WithMaxCacheItems(maxCacheItems),
 
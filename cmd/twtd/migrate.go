@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	flag "github.com/spf13/pflag"
+
+	"github.com/jointwt/twtxt/internal"
+)
+
+// migrate implements the `twtd migrate` command which copies all data from
+// one store to another, e.g: bitcask://twtxt.db to sqlite://twtxt.sqlite
+func migrate(args []string) int {
+	var from, to string
+
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.StringVarP(&from, "from", "f", internal.DefaultStore, "store to migrate from")
+	fs.StringVarP(&to, "to", "t", "", "store to migrate to")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s migrate --from <store> --to <store>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if to == "" || to == from {
+		fs.Usage()
+		return 2
+	}
+
+	src, err := internal.NewStore(from)
+	if err != nil {
+		log.WithError(err).Errorf("error opening store %s", from)
+		return 1
+	}
+	defer src.Close()
+
+	dst, err := internal.NewStore(to)
+	if err != nil {
+		log.WithError(err).Errorf("error opening store %s", to)
+		return 1
+	}
+	defer dst.Close()
+
+	log.Infof("migrating %s to %s ...", from, to)
+	if err := internal.MigrateStore(src, dst); err != nil {
+		log.WithError(err).Error("error migrating store (re-run to resume)")
+		return 1
+	}
+	log.Info("migration complete")
+
+	return 0
+}
@@ -9,6 +9,7 @@ require (
 	github.com/NYTimes/gziphandler v1.1.1
 	github.com/PuerkitoBio/goquery v1.6.0
 	github.com/andreadipersio/securecookie v0.0.0-20131119095127-e3c3b33544ec
+	github.com/andybalholm/brotli v1.0.2
 	github.com/andybalholm/cascadia v1.2.0 // indirect
 	github.com/andyleap/microformats v0.0.0-20150523144534-25ae286f528b
 	github.com/audiolion/ipip v1.0.0
@@ -25,6 +26,7 @@ require (
 	github.com/emersion/go-message v0.14.0
 	github.com/fsnotify/fsnotify v1.4.9 // indirect
 	github.com/gabstv/merger v1.0.1
+	github.com/gdamore/tcell/v2 v2.2.0
 	github.com/go-mail/mail v2.3.1+incompatible
 	github.com/goccy/go-yaml v1.8.4
 	github.com/gomarkdown/markdown v0.0.0-20201113031856-722100d81a8e
@@ -46,6 +48,8 @@ require (
 	github.com/marksalpeter/sugar v0.0.0-20160713164314-a69afe358ea8 // indirect
 	github.com/marksalpeter/token/v2 v2.0.0
 	github.com/matryer/is v1.4.0
+	github.com/mattn/go-runewidth v0.0.10
+	github.com/mattn/go-sqlite3 v1.14.3
 	github.com/mgutz/ansi v0.0.0-20170206155736-9520e82c474b // indirect
 	github.com/microcosm-cc/bluemonday v1.0.4
 	github.com/mitchellh/copystructure v1.0.0 // indirect
@@ -67,6 +71,7 @@ require (
 	github.com/rainycape/unidecode v0.0.0-20150907023854-cb7f23ec59be // indirect
 	github.com/renstrom/shortuuid v3.0.0+incompatible
 	github.com/rickb777/accept v0.0.0-20170318132422-d5183c44530d
+	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/robfig/cron v1.2.0
 	github.com/securisec/go-keywords v0.0.0-20200619134240-769e7273f2ed
 	github.com/sirupsen/logrus v1.7.0
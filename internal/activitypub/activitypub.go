@@ -0,0 +1,178 @@
+// Package activitypub implements the parts of ActivityPub (and the WebFinger
+// and HTTP Signatures it relies on) needed to federate twtxt users with the
+// fediverse (e.g: Mastodon): actor documents, signed delivery of activities
+// to inboxes and verification of signed activities delivered to us.
+package activitypub
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	// ContentType is the media type of ActivityPub documents
+	ContentType = "application/activity+json"
+
+	// LDContentType is the alternative media type of ActivityPub documents
+	LDContentType = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+
+	// Public is the special collection addressing activities to everyone
+	Public = "https://www.w3.org/ns/activitystreams#Public"
+
+	activityStreamsContext = "https://www.w3.org/ns/activitystreams"
+	securityContext        = "https://w3id.org/security/v1"
+)
+
+var (
+	// ErrInvalidObject is returned when the object of an activity is not
+	// the expected object (e.g: a Note in a Create activity)
+	ErrInvalidObject = errors.New("error: invalid activity object")
+)
+
+// Context is the JSON-LD context of the documents we publish
+var Context = []string{activityStreamsContext, securityContext}
+
+// PublicKey is the public key of an actor used to verify its signatures
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// Image ...
+type Image struct {
+	Type      string `json:"type"`
+	MediaType string `json:"mediaType,omitempty"`
+	URL       string `json:"url"`
+}
+
+// Endpoints ...
+type Endpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+// Actor is an ActivityPub actor (e.g: a Person)
+type Actor struct {
+	Context           interface{} `json:"@context,omitempty"`
+	ID                string      `json:"id"`
+	Type              string      `json:"type"`
+	PreferredUsername string      `json:"preferredUsername"`
+	Name              string      `json:"name,omitempty"`
+	Summary           string      `json:"summary,omitempty"`
+	URL               string      `json:"url,omitempty"`
+	Icon              *Image      `json:"icon,omitempty"`
+
+	Inbox     string     `json:"inbox"`
+	Outbox    string     `json:"outbox,omitempty"`
+	Followers string     `json:"followers,omitempty"`
+	Following string     `json:"following,omitempty"`
+	Endpoints *Endpoints `json:"endpoints,omitempty"`
+
+	PublicKey PublicKey `json:"publicKey"`
+}
+
+// SharedInbox returns the actor's shared inbox if it has one, otherwise
+// its own inbox
+func (a *Actor) SharedInbox() string {
+	if a.Endpoints != nil && a.Endpoints.SharedInbox != "" {
+		return a.Endpoints.SharedInbox
+	}
+	return a.Inbox
+}
+
+// Tag is a mention (or hashtag) of a note
+type Tag struct {
+	Type string `json:"type"`
+	Href string `json:"href,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// Note is a short post, the object of Create activities twts are sent as
+type Note struct {
+	Context      interface{} `json:"@context,omitempty"`
+	ID           string      `json:"id"`
+	Type         string      `json:"type"`
+	AttributedTo string      `json:"attributedTo"`
+	Content      string      `json:"content"`
+	URL          string      `json:"url,omitempty"`
+	InReplyTo    string      `json:"inReplyTo,omitempty"`
+	Published    time.Time   `json:"published"`
+	To           []string    `json:"to,omitempty"`
+	Cc           []string    `json:"cc,omitempty"`
+	Tag          []Tag       `json:"tag,omitempty"`
+}
+
+// Activity is an ActivityPub activity, its object is either the id of the
+// object or the object itself (e.g: a Note or another Activity)
+type Activity struct {
+	Context   interface{}     `json:"@context,omitempty"`
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Actor     string          `json:"actor"`
+	Object    json.RawMessage `json:"object"`
+	Published *time.Time      `json:"published,omitempty"`
+	To        []string        `json:"to,omitempty"`
+	Cc        []string        `json:"cc,omitempty"`
+}
+
+// NewActivity returns a new activity of the given type by actor of object,
+// which is either the id of an object or an object
+func NewActivity(typ, id, actor string, object interface{}) (*Activity, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Activity{
+		Context: activityStreamsContext,
+		ID:      id,
+		Type:    typ,
+		Actor:   actor,
+		Object:  data,
+	}, nil
+}
+
+// ObjectID returns the id of the activity's object
+func (a *Activity) ObjectID() string {
+	var id string
+	if err := json.Unmarshal(a.Object, &id); err == nil {
+		return id
+	}
+
+	var object struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(a.Object, &object); err != nil {
+		return ""
+	}
+	return object.ID
+}
+
+// Note returns the activity's object as a Note
+func (a *Activity) Note() (*Note, error) {
+	note := &Note{}
+	if err := json.Unmarshal(a.Object, note); err != nil || note.Type != "Note" {
+		return nil, ErrInvalidObject
+	}
+	return note, nil
+}
+
+// Activity returns the activity's object as an Activity (e.g: the Follow of
+// an Undo or Accept activity)
+func (a *Activity) Activity() (*Activity, error) {
+	activity := &Activity{}
+	if err := json.Unmarshal(a.Object, activity); err != nil || activity.Type == "" {
+		return nil, ErrInvalidObject
+	}
+	return activity, nil
+}
+
+// OrderedCollection ...
+type OrderedCollection struct {
+	Context      interface{} `json:"@context,omitempty"`
+	ID           string      `json:"id"`
+	Type         string      `json:"type"`
+	TotalItems   int         `json:"totalItems"`
+	OrderedItems interface{} `json:"orderedItems,omitempty"`
+}
@@ -0,0 +1,237 @@
+package activitypub
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// standIn is a minimal stand-in ActivityPub server with a single actor whose
+// inbox verifies and records the activities delivered to it
+type standIn struct {
+	*httptest.Server
+
+	client *Client
+	actor  *Actor
+	signer *Signer
+	inbox  chan *Activity
+}
+
+func newStandIn(t *testing.T, nick string) *standIn {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	pem, err := EncodePublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	s := &standIn{inbox: make(chan *Activity, 10)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(WebFingerPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("resource") != "acct:"+nick+"@"+s.Listener.Addr().String() {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", WebFingerContentType)
+		_ = json.NewEncoder(w).Encode(Resource{
+			Subject: r.URL.Query().Get("resource"),
+			Links: []Link{
+				{Rel: "self", Type: ContentType, Href: s.actor.ID},
+				{Rel: "self", Type: FeedContentType, Href: s.actor.ID + "/twtxt.txt"},
+				{Rel: AvatarRel, Type: "image/png", Href: s.actor.ID + "/avatar"},
+			},
+		})
+	})
+	mux.HandleFunc("/users/"+nick, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_ = json.NewEncoder(w).Encode(s.actor)
+	})
+	mux.HandleFunc("/users/"+nick+"/inbox", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		owner, err := Verify(r, body, s.client.PublicKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		activity := &Activity{}
+		if err := json.Unmarshal(body, activity); err != nil || activity.Actor != owner {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		s.inbox <- activity
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	s.Server = httptest.NewTLSServer(mux)
+	t.Cleanup(s.Close)
+
+	s.client = NewClient("stand-in")
+	s.client.HTTP = s.Client()
+
+	s.actor = &Actor{
+		Context:           Context,
+		ID:                s.URL + "/users/" + nick,
+		Type:              "Person",
+		PreferredUsername: nick,
+		Inbox:             s.URL + "/users/" + nick + "/inbox",
+		PublicKey: PublicKey{
+			ID:           s.URL + "/users/" + nick + "#main-key",
+			Owner:        s.URL + "/users/" + nick,
+			PublicKeyPem: pem,
+		},
+	}
+	s.signer = &Signer{KeyID: s.actor.PublicKey.ID, Key: key}
+
+	return s
+}
+
+func TestDelivery(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	alice := newStandIn(t, "alice")
+	bob := newStandIn(t, "bob")
+
+	// All stand-ins share the same test certificate
+	client := NewClient("test")
+	client.HTTP = alice.Client()
+
+	handle := "@bob@" + bob.Listener.Addr().String()
+	assert.True(IsHandle(handle))
+	assert.False(IsHandle("https://example.com/bob"))
+
+	actor, err := client.LookupActor(handle)
+	require.NoError(err)
+	assert.Equal(bob.actor.ID, actor.ID)
+	assert.Equal(bob.actor.Inbox, actor.SharedInbox())
+
+	feed, err := client.LookupFeed(handle)
+	require.NoError(err)
+	assert.Equal(bob.actor.ID+"/twtxt.txt", feed)
+
+	_, err = client.LookupFeed("@carol@" + bob.Listener.Addr().String())
+	assert.Error(err)
+
+	follow, err := NewActivity("Follow", alice.actor.ID+"#follow", alice.actor.ID, actor.ID)
+	require.NoError(err)
+
+	require.NoError(client.Post(actor.Inbox, follow, alice.signer))
+
+	received := <-bob.inbox
+	assert.Equal("Follow", received.Type)
+	assert.Equal(alice.actor.ID, received.Actor)
+	assert.Equal(bob.actor.ID, received.ObjectID())
+
+	// Activities signed with another actor's key are rejected
+	forged, err := NewActivity("Follow", bob.actor.ID+"#follow", bob.actor.ID, actor.ID)
+	require.NoError(err)
+	assert.Error(client.Post(actor.Inbox, forged, alice.signer))
+
+	// Deliveries are made in the background
+	note := Note{
+		ID:           alice.actor.ID + "/notes/1",
+		Type:         "Note",
+		AttributedTo: alice.actor.ID,
+		Content:      "<p>Hello World!</p>",
+		Published:    time.Now().UTC(),
+		To:           []string{Public},
+	}
+	create, err := NewActivity("Create", note.ID+"#create", alice.actor.ID, note)
+	require.NoError(err)
+
+	require.NoError(NewDeliverer(client, 1).Deliver(actor.Inbox, create, alice.signer))
+
+	select {
+	case received := <-bob.inbox:
+		assert.Equal("Create", received.Type)
+		delivered, err := received.Note()
+		require.NoError(err)
+		assert.Equal(note.Content, delivered.Content)
+		assert.Equal(note.ID, received.ObjectID())
+	case <-time.After(10 * time.Second):
+		t.Fatal("activity not delivered")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key, err := GenerateKey()
+	require.NoError(err)
+	signer := &Signer{KeyID: "https://example.com/users/alice#main-key", Key: key}
+
+	keyFunc := func(keyID string) (*rsa.PublicKey, string, error) {
+		return &key.PublicKey, "https://example.com/users/alice", nil
+	}
+
+	body := []byte(`{"type":"Follow"}`)
+	req, err := http.NewRequest(http.MethodPost, "https://example.org/users/bob/inbox", bytes.NewReader(body))
+	require.NoError(err)
+	require.NoError(signer.Sign(req, body))
+
+	// Requests as received by the server
+	received := func(body []byte) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/users/bob/inbox", bytes.NewReader(body))
+		r.Host = "example.org"
+		r.Header = req.Header.Clone()
+		return r
+	}
+
+	owner, err := Verify(received(body), body, keyFunc)
+	require.NoError(err)
+	assert.Equal("https://example.com/users/alice", owner)
+
+	tampered := []byte(`{"type":"Undo"}`)
+	_, err = Verify(received(tampered), tampered, keyFunc)
+	assert.Equal(ErrInvalidDigest, err)
+
+	r := received(body)
+	r.Header.Del("Signature")
+	_, err = Verify(r, body, keyFunc)
+	assert.Equal(ErrMissingSignature, err)
+
+	r = received(body)
+	r.URL, _ = url.Parse("/users/carol/inbox")
+	_, err = Verify(r, body, keyFunc)
+	assert.Equal(ErrInvalidSignature, err)
+
+	r = received(body)
+	r.Header.Set("Date", time.Now().Add(-2*MaxClockSkew).UTC().Format(http.TimeFormat))
+	_, err = Verify(r, body, keyFunc)
+	assert.Equal(ErrInvalidSignature, err)
+
+	assert.True(strings.HasPrefix(req.Header.Get("Digest"), "SHA-256="))
+}
+
+func TestKeyStore(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+
+	key, err := NewKeyStore(dir).Key("alice")
+	require.NoError(err)
+
+	// Keys are persisted
+	ks := NewKeyStore(dir)
+	loaded, err := ks.Key("alice")
+	require.NoError(err)
+	assert.True(key.Equal(loaded))
+
+	require.NoError(ks.Delete("alice"))
+	regenerated, err := ks.Key("alice")
+	require.NoError(err)
+	assert.False(key.Equal(regenerated))
+}
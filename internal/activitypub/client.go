@@ -0,0 +1,226 @@
+package activitypub
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxDocumentSize is the maximum size of documents fetched
+	maxDocumentSize = 1 << 20
+
+	// actorCacheTTL is how long fetched actors (and their keys) are cached
+	actorCacheTTL = 1 * time.Hour
+)
+
+type cachedActor struct {
+	actor   *Actor
+	expires time.Time
+}
+
+// Client fetches actors and delivers activities to other servers
+type Client struct {
+	HTTP      *http.Client
+	UserAgent string
+
+	mu     sync.RWMutex
+	actors map[string]cachedActor
+}
+
+// NewClient ...
+func NewClient(userAgent string) *Client {
+	return &Client{
+		HTTP:      &http.Client{Timeout: 30 * time.Second},
+		UserAgent: userAgent,
+		actors:    make(map[string]cachedActor),
+	}
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		res.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s from %s", res.Status, req.URL)
+	}
+	return res, nil
+}
+
+// get fetches the JSON document at url of the given media type into v
+func (c *Client) get(url, accept string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", accept)
+
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return json.NewDecoder(io.LimitReader(res.Body, maxDocumentSize)).Decode(v)
+}
+
+// FetchActor fetches the actor identified by id, actors are cached for a while
+func (c *Client) FetchActor(id string) (*Actor, error) {
+	c.mu.RLock()
+	cached, ok := c.actors[id]
+	c.mu.RUnlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.actor, nil
+	}
+
+	actor := &Actor{}
+	if err := c.get(id, ContentType, actor); err != nil {
+		return nil, err
+	}
+	if actor.ID != id || actor.Inbox == "" {
+		return nil, fmt.Errorf("error: invalid actor %s", id)
+	}
+
+	c.mu.Lock()
+	c.actors[id] = cachedActor{actor: actor, expires: time.Now().Add(actorCacheTTL)}
+	c.mu.Unlock()
+
+	return actor, nil
+}
+
+// PublicKey returns the public key identified by keyID and the id of the actor
+// owning it, it is the KeyFunc to verify activities delivered to us with
+func (c *Client) PublicKey(keyID string) (*rsa.PublicKey, string, error) {
+	actor, err := c.FetchActor(strings.SplitN(keyID, "#", 2)[0])
+	if err != nil {
+		return nil, "", err
+	}
+	if actor.PublicKey.ID != keyID || actor.PublicKey.Owner != actor.ID {
+		return nil, "", fmt.Errorf("error: key %s not found for actor %s", keyID, actor.ID)
+	}
+
+	key, err := DecodePublicKey(actor.PublicKey.PublicKeyPem)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, actor.ID, nil
+}
+
+// Post delivers the activity to inbox, signed by signer
+func (c *Client) Post(inbox string, activity interface{}, signer *Signer) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	return c.post(inbox, body, signer)
+}
+
+func (c *Client) post(inbox string, body []byte, signer *Signer) error {
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	if err := signer.Sign(req, body); err != nil {
+		return err
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	return nil
+}
+
+const (
+	// maxDeliveryAttempts is how many times delivering an activity is tried
+	maxDeliveryAttempts = 5
+
+	// deliveryQueueSize is how many deliveries can be queued
+	deliveryQueueSize = 1000
+)
+
+type delivery struct {
+	inbox    string
+	body     []byte
+	signer   *Signer
+	attempts int
+}
+
+// Deliverer delivers activities to inboxes in the background, retrying failed
+// deliveries with an increasing delay
+type Deliverer struct {
+	client *Client
+	queue  chan *delivery
+}
+
+// NewDeliverer returns a new deliverer delivering with client using the given
+// number of workers
+func NewDeliverer(client *Client, workers int) *Deliverer {
+	d := &Deliverer{
+		client: client,
+		queue:  make(chan *delivery, deliveryQueueSize),
+	}
+	for i := 0; i < workers; i++ {
+		go d.worker()
+	}
+	return d
+}
+
+// Deliver queues the delivery of the activity to inbox, signed by signer
+func (d *Deliverer) Deliver(inbox string, activity interface{}, signer *Signer) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	d.enqueue(&delivery{inbox: inbox, body: body, signer: signer})
+	return nil
+}
+
+func (d *Deliverer) enqueue(job *delivery) {
+	select {
+	case d.queue <- job:
+	default:
+		log.Warnf("activitypub delivery queue full, dropping delivery to %s", job.inbox)
+	}
+}
+
+func (d *Deliverer) worker() {
+	for job := range d.queue {
+		job.attempts++
+		err := d.client.post(job.inbox, job.body, job.signer)
+		if err == nil {
+			log.Debugf("delivered activity to %s", job.inbox)
+			continue
+		}
+
+		if job.attempts >= maxDeliveryAttempts {
+			log.WithError(err).Errorf("giving up delivering activity to %s", job.inbox)
+			continue
+		}
+
+		delay := time.Duration(job.attempts*job.attempts) * time.Minute
+		log.WithError(err).Warnf("error delivering activity to %s (retrying in %s)", job.inbox, delay)
+		retry := job
+		time.AfterFunc(delay, func() { d.enqueue(retry) })
+	}
+}
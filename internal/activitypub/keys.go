@@ -0,0 +1,76 @@
+package activitypub
+
+import (
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// KeyStore stores the keys of local actors as PEM files in a directory,
+// generating them when first needed
+type KeyStore struct {
+	mu   sync.Mutex
+	path string
+	keys map[string]*rsa.PrivateKey
+}
+
+// NewKeyStore returns a key store storing keys in path
+func NewKeyStore(path string) *KeyStore {
+	return &KeyStore{path: path, keys: make(map[string]*rsa.PrivateKey)}
+}
+
+// Key returns the key of the actor name, generating it if it has none yet
+func (ks *KeyStore) Key(name string) (*rsa.PrivateKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if key, ok := ks.keys[name]; ok {
+		return key, nil
+	}
+
+	fn := filepath.Join(ks.path, filepath.Base(name)+".pem")
+
+	data, err := ioutil.ReadFile(fn)
+	switch {
+	case err == nil:
+		key, err := DecodePrivateKey(data)
+		if err != nil {
+			return nil, err
+		}
+		ks.keys[name] = key
+		return key, nil
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	key, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(ks.path, 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(fn, EncodePrivateKey(key), 0600); err != nil {
+		return nil, err
+	}
+
+	ks.keys[name] = key
+	return key, nil
+}
+
+// Delete deletes the key of the actor name (if any)
+func (ks *KeyStore) Delete(name string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	delete(ks.keys, name)
+
+	err := os.Remove(filepath.Join(ks.path, filepath.Base(name)+".pem"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package activitypub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultKeySize is the size in bits of the RSA keys actors sign with
+	DefaultKeySize = 2048
+
+	// MaxClockSkew is how far the Date of a signed request may be from now
+	MaxClockSkew = 12 * time.Hour
+)
+
+var (
+	// ErrMissingSignature is returned when verifying an unsigned request
+	ErrMissingSignature = errors.New("error: missing signature")
+
+	// ErrInvalidSignature is returned when a request's signature does not
+	// verify, is malformed or does not cover the required headers
+	ErrInvalidSignature = errors.New("error: invalid signature")
+
+	// ErrInvalidDigest is returned when a request's body does not match
+	// its Digest header
+	ErrInvalidDigest = errors.New("error: invalid digest")
+
+	// ErrInvalidKey is returned when a PEM encoded key cannot be decoded
+	ErrInvalidKey = errors.New("error: invalid key")
+)
+
+// Signer signs requests (draft-cavage-http-signatures) on behalf of the
+// actor owning the key identified by KeyID
+type Signer struct {
+	KeyID string
+	Key   *rsa.PrivateKey
+}
+
+// Sign signs the request whose body (if any) is body, setting its Date,
+// Digest (if it has a body) and Signature headers
+func (s *Signer) Sign(req *http.Request, body []byte) error {
+	if req.Header.Get("Date") == "" {
+		req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		req.Header.Set("Digest", digest(body))
+		headers = append(headers, "digest")
+	}
+
+	hashed := sha256.Sum256([]byte(signingString(req, headers)))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		s.KeyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(sig),
+	))
+
+	return nil
+}
+
+// KeyFunc returns the public key identified by keyID (e.g: by fetching the
+// actor owning it) and the id of the actor owning it
+type KeyFunc func(keyID string) (key *rsa.PublicKey, owner string, err error)
+
+// Verify verifies the signature of the request whose body is body and returns
+// the id of the actor who signed it. Requests with a body must have signed
+// their Digest.
+func Verify(req *http.Request, body []byte, keyFunc KeyFunc) (string, error) {
+	header := req.Header.Get("Signature")
+	if header == "" {
+		return "", ErrMissingSignature
+	}
+
+	params := parseSignature(header)
+	keyID, sig := params["keyId"], params["signature"]
+	if keyID == "" || sig == "" {
+		return "", ErrInvalidSignature
+	}
+	if alg := params["algorithm"]; alg != "" && alg != "rsa-sha256" && alg != "hs2019" {
+		return "", ErrInvalidSignature
+	}
+
+	headers := []string{"date"}
+	if h := params["headers"]; h != "" {
+		headers = strings.Fields(strings.ToLower(h))
+	}
+
+	signed := make(map[string]bool)
+	for _, h := range headers {
+		signed[h] = true
+	}
+	if !signed["(request-target)"] || !signed["date"] {
+		return "", ErrInvalidSignature
+	}
+
+	date, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	if skew := time.Since(date); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return "", ErrInvalidSignature
+	}
+
+	if len(body) > 0 {
+		if !signed["digest"] {
+			return "", ErrInvalidSignature
+		}
+		if req.Header.Get("Digest") != digest(body) {
+			return "", ErrInvalidDigest
+		}
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	key, owner, err := keyFunc(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	hashed := sha256.Sum256([]byte(signingString(req, headers)))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], decoded); err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	return owner, nil
+}
+
+// digest returns the value of the Digest header for body
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// signingString returns the string signed for the given headers of req
+func signingString(req *http.Request, headers []string) string {
+	lines := make([]string, 0, len(headers))
+	for _, h := range headers {
+		var value string
+		switch h {
+		case "(request-target)":
+			value = fmt.Sprintf("%s %s", strings.ToLower(req.Method), req.URL.RequestURI())
+		case "host":
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		default:
+			value = strings.Join(req.Header.Values(h), ", ")
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", h, value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseSignature parses the key="value" parameters of a Signature header
+func parseSignature(header string) map[string]string {
+	params := make(map[string]string)
+	for _, param := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[kv[0]] = strings.Trim(kv[1], `"`)
+	}
+	return params
+}
+
+// GenerateKey generates a new RSA key for an actor to sign with
+func GenerateKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, DefaultKeySize)
+}
+
+// EncodePrivateKey PEM encodes a private key
+func EncodePrivateKey(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+}
+
+// DecodePrivateKey decodes a PEM encoded private key
+func DecodePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// EncodePublicKey PEM encodes a public key as published in actor documents
+func EncodePublicKey(key *rsa.PublicKey) (string, error) {
+	data, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: data})), nil
+}
+
+// DecodePublicKey decodes a PEM encoded public key
+func DecodePublicKey(data string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		return rsaKey, nil
+	}
+}
@@ -0,0 +1,151 @@
+package activitypub
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// WebFingerPath is the well-known path WebFinger is served at
+	WebFingerPath = "/.well-known/webfinger"
+
+	// WebFingerContentType is the media type of WebFinger (JRD) documents
+	WebFingerContentType = "application/jrd+json"
+
+	// ProfilePageRel is the WebFinger relation of an account's profile page
+	ProfilePageRel = "http://webfinger.net/rel/profile-page"
+
+	// AvatarRel is the WebFinger relation of an account's avatar
+	AvatarRel = "http://webfinger.net/rel/avatar"
+
+	// FeedContentType is the media type of twtxt feeds, pods advertise the
+	// twtxt.txt feed of an account as a self link of this type
+	FeedContentType = "text/plain"
+)
+
+var (
+	// ErrInvalidHandle is returned for handles not of the form nick@domain
+	ErrInvalidHandle = errors.New("error: invalid handle")
+
+	// ErrActorNotFound is returned when a WebFinger resource has no actor
+	ErrActorNotFound = errors.New("error: actor not found")
+
+	// ErrFeedNotFound is returned when a WebFinger resource has no feed
+	ErrFeedNotFound = errors.New("error: feed not found")
+
+	handleRe = regexp.MustCompile(`^@?([^@\s/]+)@([^@\s/]+)$`)
+)
+
+// Link ...
+type Link struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href,omitempty"`
+}
+
+// Resource is a WebFinger resource (JRD) describing an account
+type Resource struct {
+	Subject string   `json:"subject"`
+	Aliases []string `json:"aliases,omitempty"`
+	Links   []Link   `json:"links"`
+}
+
+// Actor returns the id of the resource's ActivityPub actor (its self link)
+func (r *Resource) Actor() string {
+	for _, link := range r.Links {
+		if link.Rel != "self" {
+			continue
+		}
+		if link.Type == ContentType || strings.HasPrefix(link.Type, "application/ld+json") {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// Feed returns the url of the resource's twtxt feed (its text/plain self link)
+func (r *Resource) Feed() string {
+	for _, link := range r.Links {
+		if link.Rel == "self" && strings.HasPrefix(link.Type, FeedContentType) {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// Avatar returns the url of the resource's avatar
+func (r *Resource) Avatar() string {
+	for _, link := range r.Links {
+		if link.Rel == AvatarRel {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// ParseHandle parses a handle of the form (@)nick@domain
+func ParseHandle(handle string) (nick, domain string, err error) {
+	match := handleRe.FindStringSubmatch(strings.TrimSpace(handle))
+	if match == nil {
+		return "", "", ErrInvalidHandle
+	}
+	return match[1], strings.ToLower(match[2]), nil
+}
+
+// IsHandle returns true if s is a handle of the form (@)nick@domain
+func IsHandle(s string) bool {
+	_, _, err := ParseHandle(s)
+	return err == nil
+}
+
+// WebFinger looks up the WebFinger resource of a handle of the form
+// (@)nick@domain
+func (c *Client) WebFinger(handle string) (*Resource, error) {
+	nick, domain, err := ParseHandle(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf(
+		"https://%s%s?resource=%s",
+		domain, WebFingerPath, url.QueryEscape(fmt.Sprintf("acct:%s@%s", nick, domain)),
+	)
+
+	res := &Resource{}
+	if err := c.get(u, WebFingerContentType, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// LookupActor resolves a handle of the form (@)nick@domain to its actor
+func (c *Client) LookupActor(handle string) (*Actor, error) {
+	res, err := c.WebFinger(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	id := res.Actor()
+	if id == "" {
+		return nil, ErrActorNotFound
+	}
+	return c.FetchActor(id)
+}
+
+// LookupFeed resolves a handle of the form (@)nick@domain to the url of its
+// twtxt feed
+func (c *Client) LookupFeed(handle string) (string, error) {
+	res, err := c.WebFinger(handle)
+	if err != nil {
+		return "", err
+	}
+
+	feed := res.Feed()
+	if feed == "" {
+		return "", ErrFeedNotFound
+	}
+	return feed, nil
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/internal/activitypub"
+)
+
+// maxActivitySize is the maximum size of activities delivered to inboxes
+const maxActivitySize = 1 << 20
+
+// writeActivityJSON writes v as an ActivityPub document of the given type
+func writeActivityJSON(w http.ResponseWriter, contentType string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(data)
+}
+
+// ActorHandler serves the ActivityPub actor of a user
+func (s *Server) ActorHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user, err := s.db.GetUser(NormalizeUsername(p.ByName("nick")))
+		if err != nil {
+			http.Error(w, "Actor Not Found", http.StatusNotFound)
+			return
+		}
+
+		actor, err := federation.Actor(user)
+		if err != nil {
+			log.WithError(err).Errorf("error creating actor for %s", user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		writeActivityJSON(w, activitypub.ContentType, actor)
+	}
+}
+
+// OutboxHandler serves the latest twts of a user as Create activities
+func (s *Server) OutboxHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user, err := s.db.GetUser(NormalizeUsername(p.ByName("nick")))
+		if err != nil {
+			http.Error(w, "Actor Not Found", http.StatusNotFound)
+			return
+		}
+
+		twts := s.cache.GetByURL(user.URL)
+
+		var activities []*activitypub.Activity
+		for _, twt := range twts {
+			if len(activities) >= s.config.TwtsPerPage {
+				break
+			}
+
+			note := federation.Note(user, twt, nil)
+			create, err := activitypub.NewActivity("Create", note.ID+"#create", note.AttributedTo, note)
+			if err != nil {
+				log.WithError(err).Errorf("error creating activity for twt %s", twt.Hash())
+				continue
+			}
+			create.To = note.To
+			activities = append(activities, create)
+		}
+
+		writeActivityJSON(w, activitypub.ContentType, activitypub.OrderedCollection{
+			Context:      activitypub.Context,
+			ID:           URLForOutbox(s.config.BaseURL, user.Username),
+			Type:         "OrderedCollection",
+			TotalItems:   len(twts),
+			OrderedItems: activities,
+		})
+	}
+}
+
+// InboxHandler receives the activities delivered to a user, only activities
+// signed by their actor are accepted
+func (s *Server) InboxHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user, err := s.db.GetUser(NormalizeUsername(p.ByName("nick")))
+		if err != nil {
+			http.Error(w, "Actor Not Found", http.StatusNotFound)
+			return
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxActivitySize))
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		actor, err := activitypub.Verify(r, body, federation.Client().PublicKey)
+		if err != nil {
+			log.WithError(err).Warnf("rejected activity delivered to %s", user.Username)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		activity := &activitypub.Activity{}
+		if err := json.Unmarshal(body, activity); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if err := federation.Receive(s.db, s.cache, s.archive, user, actor, activity); err != nil {
+			log.WithError(err).Warnf("error processing %s activity from %s", activity.Type, actor)
+			if err == ErrInvalidActivity {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/vcraescu/go-paginator/adapter"
 
 	"github.com/jointwt/twtxt"
+	"github.com/jointwt/twtxt/internal/activitypub"
 	"github.com/jointwt/twtxt/internal/passwords"
 	"github.com/jointwt/twtxt/types"
 )
@@ -49,11 +50,12 @@ type API struct {
 	db      Store
 	pm      passwords.Passwords
 	tasks   *Dispatcher
+	codes   *AuthCodes
 }
 
 // NewAPI ...
 func NewAPI(router *Router, config *Config, cache *Cache, archive Archiver, db Store, pm passwords.Passwords, tasks *Dispatcher) *API {
-	api := &API{router, config, cache, archive, db, pm, tasks}
+	api := &API{router, config, cache, archive, db, pm, tasks, NewAuthCodes()}
 
 	api.initRoutes()
 
@@ -68,60 +70,67 @@ func (a *API) initRoutes() {
 	router.POST("/register", a.RegisterEndpoint())
 	router.POST("/config", a.PodConfigEndpoint())
 
-	router.POST("/post", a.isAuthorized(a.PostEndpoint()))
-	router.POST("/upload", a.isAuthorized(a.UploadMediaEndpoint()))
+	router.POST("/post", a.isAuthorized(ScopePost, a.PostEndpoint()))
+	router.DELETE("/post", a.isAuthorized(ScopePost, a.DeleteEndpoint()))
 
-	router.GET("/settings", a.isAuthorized(a.SettingsEndpoint()))
-	router.POST("/settings", a.isAuthorized(a.SettingsEndpoint()))
+	router.GET("/scheduled", a.isAuthorized(ScopeRead, a.ScheduledEndpoint()))
+	router.POST("/scheduled/:id", a.isAuthorized(ScopePost, a.UpdateScheduledEndpoint()))
+	router.DELETE("/scheduled/:id", a.isAuthorized(ScopePost, a.CancelScheduledEndpoint()))
+	router.POST("/upload", a.isAuthorized(ScopePost, a.UploadMediaEndpoint()))
 
-	router.POST("/follow", a.isAuthorized(a.FollowEndpoint()))
-	router.POST("/unfollow", a.isAuthorized(a.UnfollowEndpoint()))
+	router.GET("/settings", a.isAuthorized(ScopeRead, a.SettingsEndpoint()))
+	router.POST("/settings", a.isAuthorized(ScopeAdmin, a.SettingsEndpoint()))
 
-	router.POST("/mute", a.isAuthorized(a.MuteEndpoint()))
-	router.POST("/unmute", a.isAuthorized(a.UnmuteEndpoint()))
+	router.POST("/follow", a.isAuthorized(ScopeFollow, a.FollowEndpoint()))
+	router.POST("/unfollow", a.isAuthorized(ScopeFollow, a.UnfollowEndpoint()))
 
-	router.POST("/timeline", a.isAuthorized(a.TimelineEndpoint()))
+	router.POST("/mute", a.isAuthorized(ScopeFollow, a.MuteEndpoint()))
+	router.POST("/unmute", a.isAuthorized(ScopeFollow, a.UnmuteEndpoint()))
+
+	router.POST("/timeline", a.isAuthorized(ScopeRead, a.TimelineEndpoint()))
 	router.POST("/discover", a.DiscoverEndpoint())
 
 	router.GET("/profile/:nick", a.ProfileEndpoint())
 	router.POST("/fetch-twts", a.FetchTwtsEndpoint())
 	router.POST("/conv", a.ConversationEndpoint())
+	router.POST("/thread", a.ThreadEndpoint())
+	router.POST("/search", a.SearchEndpoint())
 
 	router.POST("/external", a.ExternalProfileEndpoint())
 
-	router.POST("/mentions", a.isAuthorized(a.MentionsEndpoint()))
+	router.POST("/mentions", a.isAuthorized(ScopeRead, a.MentionsEndpoint()))
+
+	router.GET("/notifications", a.isAuthorized(ScopeRead, a.NotificationsEndpoint()))
+	router.POST("/notifications/read", a.isAuthorized(ScopePost, a.ReadNotificationsEndpoint()))
+
+	// Pod management endpoints
+	router.GET("/manage/feeds", a.isAuthorized(ScopeAdmin, a.ManageFeedsEndpoint()))
+	router.POST("/manage/feeds/refresh", a.isAuthorized(ScopeAdmin, a.RefreshFeedEndpoint()))
+	router.POST("/manage/feeds/disable", a.isAuthorized(ScopeAdmin, a.DisableFeedEndpoint()))
+
+	// Token management endpoints
+	router.GET("/tokens", a.isAuthorized(ScopeAdmin, a.TokensEndpoint()))
+	router.POST("/tokens", a.isAuthorized(ScopeAdmin, a.CreateTokenEndpoint()))
+	router.DELETE("/tokens/:signature", a.isAuthorized(ScopeAdmin, a.DeleteTokenEndpoint()))
+
+	// OAuth2 token endpoint (see Server.AuthorizeHandler)
+	router.POST("/oauth/token", a.OAuthTokenEndpoint())
 
 	// Support / Report endpoints
-	router.POST("/support", a.isAuthorized(a.SupportEndpoint()))
-	router.POST("/report", a.isAuthorized(a.ReportEndpoint()))
+	router.POST("/support", a.isAuthorized(ScopePost, a.SupportEndpoint()))
+	router.POST("/report", a.isAuthorized(ScopePost, a.ReportEndpoint()))
 }
 
-// CreateToken ...
+// CreateToken creates a token with every scope for a user logging in with
+// their password
 func (a *API) CreateToken(user *User, r *http.Request) (*Token, error) {
-	claims := jwt.MapClaims{}
-	claims["username"] = user.Username
-	createdAt := time.Now()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(a.config.APISigningKey))
-	if err != nil {
-		log.WithError(err).Error("error creating signed token")
-		return nil, err
-	}
-
-	signedToken, err := jwt.Parse(tokenString, a.jwtKeyFunc)
+	token, err := NewToken(a.config, user, Scopes, time.Time{})
 	if err != nil {
-		log.WithError(err).Error("error creating signed token")
 		return nil, err
 	}
+	token.UserAgent = r.UserAgent()
 
-	tkn := &Token{
-		Signature: signedToken.Signature,
-		Value:     tokenString,
-		UserAgent: r.UserAgent(),
-		CreatedAt: createdAt,
-	}
-
-	return tkn, nil
+	return token, nil
 }
 
 func (a *API) jwtKeyFunc(token *jwt.Token) (interface{}, error) {
@@ -131,79 +140,107 @@ func (a *API) jwtKeyFunc(token *jwt.Token) (interface{}, error) {
 	return []byte(a.config.APISigningKey), nil
 }
 
-func (a *API) getLoggedInUser(r *http.Request) *User {
-	token, err := jwt.Parse(r.Header.Get("Token"), a.jwtKeyFunc)
+// tokenFromRequest returns the token given in the Token header or as an
+// OAuth2 bearer token in the Authorization header
+func tokenFromRequest(r *http.Request) string {
+	if token := r.Header.Get("Token"); token != "" {
+		return token
+	}
+
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+
+	return ""
+}
+
+// authenticate returns the user and token the request is authorized by,
+// tokens that were revoked or have expired are invalid
+func (a *API) authenticate(r *http.Request) (*User, *Token, error) {
+	token, err := jwt.Parse(tokenFromRequest(r), a.jwtKeyFunc)
 	if err != nil {
-		return nil
+		return nil, nil, err
 	}
 
 	if !token.Valid {
-		return nil
+		return nil, nil, ErrInvalidToken
 	}
 
 	claims := token.Claims.(jwt.MapClaims)
 
-	username := claims["username"].(string)
+	username, ok := claims["username"].(string)
+	if !ok {
+		return nil, nil, ErrInvalidToken
+	}
+
+	tkn, err := a.db.GetToken(token.Signature)
+	if err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if (tkn.Username != "" && tkn.Username != username) || tkn.Expired(now) {
+		return nil, nil, ErrInvalidToken
+	}
 
 	user, err := a.db.GetUser(username)
 	if err != nil {
 		log.WithError(err).Error("error loading user object")
-		return nil
+		return nil, nil, err
+	}
+
+	if !user.HasToken(tkn.Signature) {
+		return nil, nil, ErrInvalidToken
 	}
 
+	TouchToken(a.db, tkn, now)
+
 	// Every registered new user follows themselves
 	// TODO: Make  this configurable server behaviour?
 	if user.Following == nil {
 		user.Following = make(map[string]string)
 	}
-
 	user.Following[user.Username] = user.URL
 
-	return user
+	return user, tkn, nil
+}
+
+func (a *API) getLoggedInUser(r *http.Request) *User {
+	user, token, err := a.authenticate(r)
+	if err != nil || !token.HasScope(ScopeRead) {
+		return nil
+	}
 
+	return user
 }
 
-func (a *API) isAuthorized(endpoint httprouter.Handle) httprouter.Handle {
+// isAuthorized only allows requests with a valid token that was granted
+// scope to the endpoint
+func (a *API) isAuthorized(scope string, endpoint httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		if r.Header.Get("Token") == "" {
+		if tokenFromRequest(r) == "" {
 			http.Error(w, "No Token Provided", http.StatusUnauthorized)
 			return
 		}
 
-		token, err := jwt.Parse(r.Header.Get("Token"), a.jwtKeyFunc)
+		user, token, err := a.authenticate(r)
 		if err != nil {
-			log.WithError(err).Error("error parsing token")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			log.WithError(err).Warn("error authenticating token")
+			http.Error(w, "Invalid Token", http.StatusUnauthorized)
 			return
 		}
 
-		if token.Valid {
-			claims := token.Claims.(jwt.MapClaims)
-
-			username := claims["username"].(string)
-
-			user, err := a.db.GetUser(username)
-			if err != nil {
-				log.WithError(err).Error("error loading user object")
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return
-			}
-
-			// Every registered new user follows themselves
-			// TODO: Make  this configurable server behaviour?
-			if user.Following == nil {
-				user.Following = make(map[string]string)
-			}
-			user.Following[user.Username] = user.URL
-
-			ctx := context.WithValue(r.Context(), TokenContextKey, token)
-			ctx = context.WithValue(ctx, UserContextKey, user)
-
-			endpoint(w, r.WithContext(ctx), p)
-		} else {
-			http.Error(w, "Invalid Token", http.StatusUnauthorized)
+		if !token.HasScope(scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+			http.Error(w, "Insufficient Scope", http.StatusForbidden)
 			return
 		}
+
+		ctx := context.WithValue(r.Context(), TokenContextKey, token)
+		ctx = context.WithValue(ctx, UserContextKey, user)
+
+		endpoint(w, r.WithContext(ctx), p)
 	}
 }
 
@@ -341,14 +378,7 @@ func (a *API) AuthEndpoint() httprouter.Handle {
 			return
 		}
 
-		user.AddToken(token)
-		if err := a.db.SetToken(token.Signature, token); err != nil {
-			log.WithError(err).Error("error saving token object")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-		if err := a.db.SetUser(user.Username, user); err != nil {
-			log.WithError(err).Error("error saving user object")
+		if err := SaveToken(a.db, user, token); err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
@@ -386,9 +416,24 @@ func (a *API) PostEndpoint() httprouter.Handle {
 			return
 		}
 
-		switch req.PostAs {
-		case "", me:
-			_, err = AppendTwt(a.config, a.db, user, text)
+		if req.PostAt != nil && !req.PostAt.IsZero() {
+			a.scheduleTwt(w, user, req, text)
+			return
+		}
+
+		source := user.Source()
+
+		var twt types.Twt = types.NilTwt
+
+		switch {
+		case req.Hash != "":
+			var feed *User
+			if feed, err = a.twtFeed(user, req.Hash); err == nil {
+				source = feed.Source()
+				_, err = EditTwt(a.config, a.db, feed, req.Hash, text)
+			}
+		case req.PostAs == "" || req.PostAs == me:
+			twt, err = AppendTwt(a.config, a.db, user, text)
 		default:
 			if user.OwnsFeed(req.PostAs) {
 				_, err = AppendSpecial(a.config, a.db, req.PostAs, text)
@@ -399,16 +444,213 @@ func (a *API) PostEndpoint() httprouter.Handle {
 
 		if err != nil {
 			log.WithError(err).Error("error posting twt")
-			if err == ErrFeedImposter {
+			switch err {
+			case ErrFeedImposter:
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			} else {
+			case ErrTwtNotFound:
+				http.Error(w, "Twt Not Found", http.StatusNotFound)
+			default:
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			}
 			return
 		}
 
 		// Update user's own timeline with their own new post.
-		a.cache.FetchTwts(a.config, a.archive, user.Source(), nil)
+		a.cache.FetchTwts(a.config, a.archive, source, nil)
+
+		// Re-populate/Warm cache with local twts for this pod
+		a.cache.GetByPrefix(a.config.BaseURL, true)
+
+		// Deliver the user's new twt to their followers on the fediverse
+		federation.Federate(a.cache, user, twt)
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+// scheduleTwt queues a twt posted with a `post_at` time to be posted later
+func (a *API) scheduleTwt(w http.ResponseWriter, user *User, req types.PostRequest, text string) {
+	// Edits are applied immediately, only new twts can be scheduled
+	if req.Hash != "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	feed := req.PostAs
+	if feed == me {
+		feed = ""
+	}
+
+	st, err := ScheduleTwt(a.db, user, feed, text, *req.PostAt)
+	if err != nil {
+		log.WithError(err).Error("error scheduling twt")
+		switch err {
+		case ErrFeedImposter:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		case ErrInvalidPostAt:
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	data, err := json.Marshal(st.Response())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// ScheduledEndpoint lists the pending twts of the user and the feeds they
+// own, optionally only those of the feed given by ?feed=
+func (a *API) ScheduledEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		feed := NormalizeFeedName(r.FormValue("feed"))
+		if feed != "" && !user.CanPostAs(feed) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		sts, err := GetScheduledTwts(a.db, user, feed)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := types.ScheduledTwtsResponse{ScheduledTwts: []types.ScheduledTwt{}}
+		for _, st := range sts {
+			res.ScheduledTwts = append(res.ScheduledTwts, st.Response())
+		}
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// UpdateScheduledEndpoint replaces the text and time of a pending twt
+func (a *API) UpdateScheduledEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewUpdateScheduledTwtRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing update scheduled twt request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		text := CleanTwt(req.Text)
+		if text == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		st, err := UpdateScheduledTwt(a.db, user, p.ByName("id"), text, req.PostAt)
+		if err != nil {
+			log.WithError(err).Error("error updating scheduled twt")
+			switch err {
+			case ErrScheduledTwtNotFound:
+				http.Error(w, "Scheduled Twt Not Found", http.StatusNotFound)
+			case ErrInvalidPostAt:
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+			default:
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		data, err := json.Marshal(st.Response())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// CancelScheduledEndpoint cancels a pending twt
+func (a *API) CancelScheduledEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		if err := CancelScheduledTwt(a.db, user, p.ByName("id")); err != nil {
+			log.WithError(err).Error("error cancelling scheduled twt")
+			if err == ErrScheduledTwtNotFound {
+				http.Error(w, "Scheduled Twt Not Found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+// twtFeed returns the feed the twt identified by hash was posted to if it
+// was posted by user or one of the feeds they own.
+func (a *API) twtFeed(user *User, hash string) (*User, error) {
+	twt, ok := a.cache.Lookup(hash)
+	if !ok && a.archive.Has(hash) {
+		twt, _ = a.archive.Get(hash)
+	}
+	if twt.IsZero() {
+		return nil, ErrTwtNotFound
+	}
+
+	return TwtFeed(a.config, user, twt)
+}
+
+// DeleteEndpoint ...
+func (a *API) DeleteEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewDeleteRequest(r.Body)
+		if err != nil || req.Hash == "" {
+			log.WithError(err).Error("error parsing delete request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		feed, err := a.twtFeed(user, req.Hash)
+		if err == nil {
+			err = DeleteTwt(a.config, feed, req.Hash)
+		}
+
+		if err != nil {
+			log.WithError(err).Errorf("error deleting twt %s", req.Hash)
+			switch err {
+			case ErrFeedImposter:
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			case ErrTwtNotFound:
+				http.Error(w, "Twt Not Found", http.StatusNotFound)
+			default:
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// Update the feed's cached twts with the deletion.
+		a.cache.FetchTwts(a.config, a.archive, feed.Source(), nil)
 
 		// Re-populate/Warm cache with local twts for this pod
 		a.cache.GetByPrefix(a.config.BaseURL, true)
@@ -564,6 +806,61 @@ func (a *API) MentionsEndpoint() httprouter.Handle {
 	}
 }
 
+// NotificationsEndpoint lists the user's notifications, newest first
+func (a *API) NotificationsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		ns, err := GetNotifications(a.db, user.Username)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := types.NotificationsResponse{Notifications: []types.Notification{}}
+		for _, n := range ns {
+			res.Notifications = append(res.Notifications, n.Response())
+			if !n.Read {
+				res.Unread++
+			}
+		}
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// ReadNotificationsEndpoint marks the user's notifications given (or all of
+// their notifications if none are given) as read
+func (a *API) ReadNotificationsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewReadNotificationsRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing read notifications request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if err := ReadNotifications(a.db, user.Username, req.IDs...); err != nil {
+			log.WithError(err).Errorf("error marking notifications of %s as read", user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
 // FollowEndpoint ...
 func (a *API) FollowEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -579,6 +876,20 @@ func (a *API) FollowEndpoint() httprouter.Handle {
 		nick := strings.TrimSpace(req.Nick)
 		url := NormalizeURL(req.URL)
 
+		// Handles (nick@domain) are resolved to their twtxt feed
+		if handle := strings.TrimSpace(req.URL); activitypub.IsHandle(handle) {
+			handleNick, feed, err := ResolveHandleFallback(a.config, handle)
+			if err != nil {
+				log.WithError(err).Errorf("error resolving handle %s", handle)
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			url = feed
+			if nick == "" {
+				nick = handleNick
+			}
+		}
+
 		if nick == "" || url == "" {
 			log.Warn("no nick or url provided")
 			http.Error(w, "Bad Request", http.StatusBadRequest)
@@ -754,7 +1065,7 @@ func (a *API) SettingsEndpoint() httprouter.Handle {
 		user := r.Context().Value(UserContextKey).(*User)
 
 		if r.Method == http.MethodGet {
-			data, err := json.Marshal(user)
+			data, err := json.Marshal(user.Settings())
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -809,9 +1120,11 @@ func (a *API) SettingsEndpoint() httprouter.Handle {
 			}
 		}
 
-		recoveryHash := fmt.Sprintf("email:%s", FastHash(email))
-
-		user.Recovery = recoveryHash
+		// Only replace the recovery email if a new one is given so clients can
+		// update other settings without knowing it
+		if email != "" {
+			user.Recovery = fmt.Sprintf("email:%s", FastHash(email))
+		}
 		user.Tagline = tagline
 
 		// XXX: Commented out as these are more specific to the Web App currently.
@@ -1067,6 +1380,24 @@ func (a *API) ProfileEndpoint() httprouter.Handle {
 			URL:    URLForUser(a.config.BaseURL, profile.Username),
 		}
 
+		var pagedTwts types.Twts
+
+		pager := paginator.New(NewFeedHistoryAdapter(a.cache, a.archive, profile.URL), a.config.TwtsPerPage)
+		pager.SetPage(SafeParseInt(r.FormValue("p"), 1))
+
+		if err := pager.Results(&pagedTwts); err != nil {
+			log.WithError(err).Error("error loading twts")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		profileResponse.Twts = FilterTwts(loggedInUser, pagedTwts)
+		profileResponse.Pager = types.PagerResponse{
+			Current:   pager.Page(),
+			MaxPages:  pager.PageNums(),
+			TotalTwts: pager.Nums(),
+		}
+
 		data, err := json.Marshal(profileResponse)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -1097,6 +1428,15 @@ func (a *API) ConversationEndpoint() httprouter.Handle {
 			return
 		}
 
+		// Follow edited twts to their latest version
+		if latest, deleted, ok := a.cache.Redirect(hash); ok {
+			if deleted {
+				http.Error(w, "Twt Deleted", http.StatusGone)
+				return
+			}
+			hash = latest
+		}
+
 		twt, ok := a.cache.Lookup(hash)
 		if !ok {
 			// If the twt is not in the cache look for it in the archive
@@ -1115,24 +1455,11 @@ func (a *API) ConversationEndpoint() httprouter.Handle {
 			return
 		}
 
-		getTweetsByHash := func(hash string, replyTo types.Twt) types.Twts {
-			var result types.Twts
-			seen := make(map[string]bool)
-			// TODO: Improve this by making this an O(1) lookup on the tag
-			for _, twt := range a.cache.GetAll() {
-				var lis types.TagList = twt.Tags()
-				if HasString(UniqStrings(lis.Tags()), hash) && !seen[twt.Hash()] {
-					result = append(result, twt)
-					seen[twt.Hash()] = true
-				}
-			}
-			if !seen[replyTo.Hash()] {
-				result = append(result, replyTo)
-			}
-			return result
-		}
+		// The complete thread including replies to previous versions of an
+		// edited twt and replies that have since been archived
+		thread := FilterThread(loggedInUser, GetThread(a.cache, a.archive, twt))
 
-		twts := getTweetsByHash(hash, twt)
+		twts := thread.Twts()
 		sort.Sort(sort.Reverse(twts))
 
 		var pagedTwts types.Twts
@@ -1146,8 +1473,9 @@ func (a *API) ConversationEndpoint() httprouter.Handle {
 			return
 		}
 
-		res := types.PagedResponse{
-			Twts: FilterTwts(loggedInUser, pagedTwts),
+		res := types.ConversationResponse{
+			Twts:   pagedTwts,
+			Thread: thread,
 			Pager: types.PagerResponse{
 				Current:   pager.Page(),
 				MaxPages:  pager.PageNums(),
@@ -1166,14 +1494,129 @@ func (a *API) ConversationEndpoint() httprouter.Handle {
 	}
 }
 
-// FetchTwtsEndpoint ...
-func (a *API) FetchTwtsEndpoint() httprouter.Handle {
+// ThreadEndpoint returns the complete thread of a conversation as a tree
+func (a *API) ThreadEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		loggedInUser := a.getLoggedInUser(r)
 
-		req, err := types.NewFetchTwtsRequest(r.Body)
+		req, err := types.NewThreadRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing fetch twts request")
+			log.WithError(err).Error("error parsing thread request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		hash := req.Hash
+
+		if hash == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		// Follow edited twts to their latest version
+		if latest, deleted, ok := a.cache.Redirect(hash); ok {
+			if deleted {
+				http.Error(w, "Twt Deleted", http.StatusGone)
+				return
+			}
+			hash = latest
+		}
+
+		twt, ok := a.cache.Lookup(hash)
+		if !ok {
+			// If the twt is not in the cache look for it in the archive
+			if a.archive.Has(hash) {
+				twt, err = a.archive.Get(hash)
+				if err != nil {
+					log.WithError(err).Errorf("error fetching twt %s from archive", hash)
+					http.Error(w, "Bad Request", http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		if twt.IsZero() {
+			http.Error(w, "Thread Not Found", http.StatusNotFound)
+			return
+		}
+
+		thread := FilterThread(loggedInUser, GetThread(a.cache, a.archive, twt))
+
+		res := types.ThreadResponse{
+			Thread: thread,
+			Count:  thread.Len(),
+		}
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// SearchEndpoint ...
+func (a *API) SearchEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		loggedInUser := a.getLoggedInUser(r)
+
+		req, err := types.NewSearchRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing search request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		query := ParseSearchQuery(req.Query)
+		if query.IsZero() {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		twts := a.cache.Search(a.archive, query)
+
+		var pagedTwts types.Twts
+
+		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config.TwtsPerPage)
+		pager.SetPage(req.Page)
+
+		if err = pager.Results(&pagedTwts); err != nil {
+			log.WithError(err).Error("error loading search results")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := types.PagedResponse{
+			Twts: FilterTwts(loggedInUser, pagedTwts),
+			Pager: types.PagerResponse{
+				Current:   pager.Page(),
+				MaxPages:  pager.PageNums(),
+				TotalTwts: pager.Nums(),
+			},
+		}
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// FetchTwtsEndpoint ...
+func (a *API) FetchTwtsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		loggedInUser := a.getLoggedInUser(r)
+
+		req, err := types.NewFetchTwtsRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing fetch twts request")
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
@@ -1185,7 +1628,7 @@ func (a *API) FetchTwtsEndpoint() httprouter.Handle {
 		}
 
 		var profile types.Profile
-		var twts types.Twts
+		var url string
 
 		if a.db.HasUser(nick) {
 			user, err := a.db.GetUser(nick)
@@ -1195,7 +1638,7 @@ func (a *API) FetchTwtsEndpoint() httprouter.Handle {
 				return
 			}
 			profile = user.Profile(a.config.BaseURL, loggedInUser)
-			twts = a.cache.GetByURL(profile.URL)
+			url = profile.URL
 		} else if a.db.HasFeed(nick) {
 			feed, err := a.db.GetFeed(nick)
 			if err != nil {
@@ -1204,8 +1647,7 @@ func (a *API) FetchTwtsEndpoint() httprouter.Handle {
 				return
 			}
 			profile = feed.Profile(a.config.BaseURL, loggedInUser)
-
-			twts = a.cache.GetByURL(profile.URL)
+			url = profile.URL
 		} else if req.URL != "" {
 			if !a.cache.IsCached(req.URL) {
 				sources := make(types.Feeds)
@@ -1213,7 +1655,7 @@ func (a *API) FetchTwtsEndpoint() httprouter.Handle {
 				a.cache.FetchTwts(a.config, a.archive, sources, nil)
 			}
 
-			twts = a.cache.GetByURL(req.URL)
+			url = req.URL
 		} else {
 			http.Error(w, "User/Feed not found", http.StatusNotFound)
 			return
@@ -1221,7 +1663,7 @@ func (a *API) FetchTwtsEndpoint() httprouter.Handle {
 
 		var pagedTwts types.Twts
 
-		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config.TwtsPerPage)
+		pager := paginator.New(NewFeedHistoryAdapter(a.cache, a.archive, url), a.config.TwtsPerPage)
 		pager.SetPage(req.Page)
 
 		if err = pager.Results(&pagedTwts); err != nil {
@@ -1274,12 +1716,17 @@ func (a *API) ExternalProfileEndpoint() httprouter.Handle {
 			nick = "unknown"
 		}
 
+		// Metadata declared by the feed
+		twter, _ := a.cache.GetTwter(url)
+
 		profileResponse := types.ProfileResponse{}
 
 		profileResponse.Profile = types.Profile{
 			Username: nick,
+			Tagline:  twter.Tagline,
 			TwtURL:   url,
 			URL:      url,
+			Links:    twter.Links,
 
 			Follows:    loggedInUser.Follows(url),
 			FollowedBy: loggedInUser.FollowedBy(url),
@@ -1287,9 +1734,10 @@ func (a *API) ExternalProfileEndpoint() httprouter.Handle {
 		}
 
 		profileResponse.Twter = types.Twter{
-			Nick:   nick,
-			Avatar: URLForExternalAvatar(a.config, url),
-			URL:    URLForExternalProfile(a.config, nick, url),
+			Nick:    nick,
+			Avatar:  URLForExternalAvatar(a.config, url),
+			URL:     URLForExternalProfile(a.config, nick, url),
+			Tagline: twter.Tagline,
 		}
 
 		data, err := json.Marshal(profileResponse)
@@ -1452,3 +1900,285 @@ func (a *API) PodConfigEndpoint() httprouter.Handle {
 		_, _ = w.Write(data)
 	}
 }
+
+// ManageFeedsEndpoint lists the fetch health of unhealthy remote feeds, or
+// all remote feeds with ?all=true
+func (a *API) ManageFeedsEndpoint() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(a.config)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		if !isAdminUser(user) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		res := types.FeedHealthResponse{Feeds: []types.FeedHealth{}}
+		for _, health := range a.cache.GetFeedHealth(r.FormValue("all") == "") {
+			res.Feeds = append(res.Feeds, health.Response())
+		}
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// RefreshFeedEndpoint clears the backoff of a remote feed and fetches it
+func (a *API) RefreshFeedEndpoint() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(a.config)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		if !isAdminUser(user) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		req, err := types.NewManageFeedRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing manage feed request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		health, ok := a.cache.LookupFeedHealth(req.URL)
+		if !ok {
+			http.Error(w, "Feed Not Found", http.StatusNotFound)
+			return
+		}
+
+		if health.Disabled {
+			http.Error(w, "Feed Disabled", http.StatusConflict)
+			return
+		}
+
+		a.cache.ResetFeedBackoff(req.URL)
+		a.cache.FetchTwts(a.config, a.archive, types.Feeds{types.Feed{Nick: health.Nick, URL: req.URL}: true}, nil)
+
+		health, _ = a.cache.LookupFeedHealth(req.URL)
+
+		data, err := json.Marshal(health.Response())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// DisableFeedEndpoint stops (or resumes) fetching a remote feed
+func (a *API) DisableFeedEndpoint() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(a.config)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		if !isAdminUser(user) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		req, err := types.NewManageFeedRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing manage feed request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if !a.cache.DisableFeed(req.URL, req.Disabled) {
+			http.Error(w, "Feed Not Found", http.StatusNotFound)
+			return
+		}
+
+		health, _ := a.cache.LookupFeedHealth(req.URL)
+
+		data, err := json.Marshal(health.Response())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// TokensEndpoint lists the user's tokens
+func (a *API) TokensEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		tokens, err := a.db.GetUserTokens(user)
+		if err != nil {
+			log.WithError(err).Errorf("error loading tokens for %s", user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := types.TokensResponse{Tokens: []types.Token{}}
+		for _, token := range tokens {
+			res.Tokens = append(res.Tokens, token.Response())
+		}
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// CreateTokenEndpoint creates a personal access token, its value is only
+// ever returned in the response
+func (a *API) CreateTokenEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		req, err := types.NewTokenRequest(r.Body)
+		if err != nil {
+			log.WithError(err).Error("error parsing token request")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		name := strings.TrimSpace(req.Name)
+		if name == "" || (!req.ExpiresAt.IsZero() && req.ExpiresAt.Before(time.Now())) {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		token, err := NewToken(a.config, user, req.Scopes, req.ExpiresAt)
+		if err != nil {
+			log.WithError(err).Error("error creating token")
+			if errors.Is(err, ErrInvalidScope) {
+				http.Error(w, "Invalid Scope", http.StatusBadRequest)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+		token.Name = name
+		token.UserAgent = r.UserAgent()
+
+		if err := SaveToken(a.db, user, token); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := token.Response()
+		res.Value = token.Value
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// DeleteTokenEndpoint revokes one of the user's tokens
+func (a *API) DeleteTokenEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		if err := RevokeToken(a.db, user, p.ByName("signature")); err != nil {
+			if err == ErrTokenNotFound {
+				http.Error(w, "Token Not Found", http.StatusNotFound)
+				return
+			}
+			log.WithError(err).Error("error deleting token")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+// OAuthTokenEndpoint exchanges an authorization code granted to an app (see
+// Server.AuthorizeHandler) for a token limited to the scopes the user
+// approved (RFC 6749 section 4.1.3)
+func (a *API) OAuthTokenEndpoint() httprouter.Handle {
+	writeJSON := func(w http.ResponseWriter, status int, res interface{}) {
+		data, err := json.Marshal(res)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_, _ = w.Write(data)
+	}
+
+	writeError := func(w http.ResponseWriter, err OAuthError) {
+		writeJSON(w, http.StatusBadRequest, types.OAuthErrorResponse{Error: string(err)})
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if r.FormValue("grant_type") != "authorization_code" {
+			writeError(w, ErrOAuthUnsupportedGrantType)
+			return
+		}
+
+		req, username, err := a.codes.Exchange(
+			r.FormValue("code"),
+			r.FormValue("client_id"),
+			r.FormValue("redirect_uri"),
+			r.FormValue("code_verifier"),
+		)
+		if err != nil {
+			log.WithError(err).Warnf("invalid authorization code from %s", r.FormValue("client_id"))
+			writeError(w, ErrOAuthInvalidGrant)
+			return
+		}
+
+		user, err := a.db.GetUser(username)
+		if err != nil {
+			log.WithError(err).Error("error loading user object")
+			writeError(w, ErrOAuthInvalidGrant)
+			return
+		}
+
+		token, err := NewToken(a.config, user, req.Scopes, time.Time{})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		token.Name = req.ClientName()
+		token.ClientID = req.ClientID
+		token.UserAgent = r.UserAgent()
+
+		if err := SaveToken(a.db, user, token); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Infof("granted %s a token for %s with scopes %v", req.ClientID, user.Username, req.Scopes)
+
+		writeJSON(w, http.StatusOK, types.OAuthTokenResponse{
+			AccessToken: token.Value,
+			TokenType:   "Bearer",
+			Scope:       strings.Join(req.Scopes, " "),
+		})
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -34,6 +36,25 @@ type Archiver interface {
 	Get(hash string) (types.Twt, error)
 	Archive(twt types.Twt) error
 	Count() (int, error)
+
+	// GetByURL returns the archived twts of the feed identified by url
+	// created within [after, before), newest first. Zero times are unbounded.
+	GetByURL(url string, after, before time.Time) (types.Twts, error)
+
+	// IterByURL returns an iterator over the archived twts of the feed
+	// identified by url created before `before`, newest first. A zero time
+	// iterates over the feed's entire history.
+	IterByURL(url string, before time.Time) (*ArchiveIterator, error)
+
+	// Replies returns the hashes of the archived twts that reply to the twt
+	// identified by hash, i.e: have it as their subject
+	Replies(hash string) ([]string, error)
+
+	// Search returns the archived twts matching the query's terms, tags,
+	// mentions and authors, see SearchIndex.Search
+	Search(q SearchQuery) (types.Twts, error)
+
+	Close() error
 }
 
 // NullArchiver implements Archiver using dummy implementation stubs
@@ -48,10 +69,87 @@ func (a *NullArchiver) Has(hash string) bool               { return false }
 func (a *NullArchiver) Get(hash string) (types.Twt, error) { return types.NilTwt, nil }
 func (a *NullArchiver) Archive(twt types.Twt) error        { return nil }
 func (a *NullArchiver) Count() (int, error)                { return 0, nil }
+func (a *NullArchiver) Close() error                       { return nil }
+
+func (a *NullArchiver) GetByURL(url string, after, before time.Time) (types.Twts, error) {
+	return nil, nil
+}
+
+func (a *NullArchiver) IterByURL(url string, before time.Time) (*ArchiveIterator, error) {
+	return NewArchiveIterator(a, nil), nil
+}
+
+func (a *NullArchiver) Replies(hash string) ([]string, error) {
+	return nil, nil
+}
+
+func (a *NullArchiver) Search(q SearchQuery) (types.Twts, error) {
+	return nil, nil
+}
+
+// ArchiveEntry identifies a twt in an archive along with its creation time
+// so that entries can be ordered without reading the twt itself.
+type ArchiveEntry struct {
+	Created time.Time
+	Hash    string
+}
+
+// ArchiveIterator iterates over a set of archived twts newest first. Twts
+// are only read from the archive as they are visited so iterating over
+// a small window of a feed's history is cheap regardless of its length.
+type ArchiveIterator struct {
+	archive Archiver
+	entries []ArchiveEntry
+	pos     int
+}
+
+// NewArchiveIterator returns an iterator over the given entries of archive
+func NewArchiveIterator(archive Archiver, entries []ArchiveEntry) *ArchiveIterator {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Created.After(entries[j].Created)
+	})
+	return &ArchiveIterator{archive: archive, entries: entries}
+}
+
+// Len returns the total number of twts the iterator covers
+func (it *ArchiveIterator) Len() int {
+	return len(it.entries)
+}
+
+// Seek positions the iterator at the nth twt (zero based)
+func (it *ArchiveIterator) Seek(n int) {
+	if n < 0 {
+		n = 0
+	}
+	if n > len(it.entries) {
+		n = len(it.entries)
+	}
+	it.pos = n
+}
+
+// Next returns the next twt, the second return value is false once the
+// iterator is exhausted. Twts that can no longer be read are skipped.
+func (it *ArchiveIterator) Next() (types.Twt, bool) {
+	for it.pos < len(it.entries) {
+		entry := it.entries[it.pos]
+		it.pos++
+
+		twt, err := it.archive.Get(entry.Hash)
+		if err != nil {
+			log.WithError(err).Warnf("error reading archived twt %s", entry.Hash)
+			continue
+		}
+		return twt, true
+	}
+	return types.NilTwt, false
+}
 
 // DiskArchiver implements Archiver using an on-disk hash layout directory
 // structure with one directory per 2-letter hash sequence with a single
 // JSON encoded file per twt.
+//
+// DEPRECATED: In favor of IndexedArchiver, Count() and GetByURL() have to
+// walk the entire archive.
 type DiskArchiver struct {
 	path string
 }
@@ -193,3 +291,97 @@ func (a *DiskArchiver) Count() (int, error) {
 
 	return count, err
 }
+
+// walk calls fn for every twt in the archive
+func (a *DiskArchiver) walk(fn func(twt types.Twt) error) error {
+	return filepath.Walk(a.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.WithError(err).Error("error walking archive directory")
+			return err
+		}
+
+		if info.IsDir() || filepath.Ext(info.Name()) != ".json" {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.WithError(err).Errorf("error reading archived twt %s", path)
+			return err
+		}
+
+		twt, err := types.DecodeJSON(data)
+		if err != nil {
+			log.WithError(err).Warnf("error decoding archived twt %s", path)
+			return nil
+		}
+
+		return fn(twt)
+	})
+}
+
+func (a *DiskArchiver) GetByURL(url string, after, before time.Time) (types.Twts, error) {
+	var twts types.Twts
+
+	err := a.walk(func(twt types.Twt) error {
+		created := twt.Created()
+		if twt.Twter().URL != url {
+			return nil
+		}
+		if !after.IsZero() && created.Before(after) {
+			return nil
+		}
+		if !before.IsZero() && !created.Before(before) {
+			return nil
+		}
+		twts = append(twts, twt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(twts)
+
+	return twts, nil
+}
+
+func (a *DiskArchiver) IterByURL(url string, before time.Time) (*ArchiveIterator, error) {
+	twts, err := a.GetByURL(url, time.Time{}, before)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ArchiveEntry, len(twts))
+	for i, twt := range twts {
+		entries[i] = ArchiveEntry{Created: twt.Created(), Hash: twt.Hash()}
+	}
+
+	return NewArchiveIterator(a, entries), nil
+}
+
+func (a *DiskArchiver) Replies(hash string) ([]string, error) {
+	var replies []string
+
+	err := a.walk(func(twt types.Twt) error {
+		if threadSubject(twt) == hash {
+			replies = append(replies, twt.Hash())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return replies, nil
+}
+
+// Search is not supported by legacy archives which are only imported into
+// an IndexedArchiver (see ImportDiskArchive)
+func (a *DiskArchiver) Search(q SearchQuery) (types.Twts, error) {
+	return nil, nil
+}
+
+func (a *DiskArchiver) Close() error {
+	return nil
+}
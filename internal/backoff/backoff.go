@@ -0,0 +1,22 @@
+package backoff
+
+import "time"
+
+// Exponential returns how long to back off for after the given number of
+// consecutive failures, doubling from min after the first failure up to max.
+// No failures means no backoff.
+func Exponential(failures int, min, max time.Duration) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+
+	backoff := min
+	for i := 1; i < failures && backoff < max; i++ {
+		backoff *= 2
+	}
+
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
@@ -8,6 +8,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/jointwt/twtxt/internal/session"
+	"github.com/jointwt/twtxt/internal/websub"
 )
 
 const (
@@ -15,6 +16,10 @@ const (
 	sessionsKeyPrefix = "/sessions"
 	usersKeyPrefix    = "/users"
 	tokensKeyPrefix   = "/tokens"
+
+	scheduledTwtsKeyPrefix = "/scheduled"
+	subscriptionsKeyPrefix = "/subscriptions"
+	notificationsKeyPrefix = "/notifications"
 )
 
 // BitcaskStore ...
@@ -344,6 +349,29 @@ func (bs *BitcaskStore) GetToken(signature string) (*Token, error) {
 	return tkn, nil
 }
 
+func (bs *BitcaskStore) GetAllTokens() ([]*Token, error) {
+	var tokens []*Token
+
+	err := bs.db.Scan([]byte(tokensKeyPrefix), func(key []byte) error {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return err
+		}
+
+		tkn, err := LoadToken(data)
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, tkn)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
 func (bs *BitcaskStore) SetToken(signature string, tkn *Token) error {
 	data, err := tkn.Bytes()
 	if err != nil {
@@ -374,3 +402,190 @@ func (bs *BitcaskStore) LenTokens() int64 {
 
 	return count
 }
+
+func (bs *BitcaskStore) DelScheduledTwt(id string) error {
+	key := []byte(fmt.Sprintf("%s/%s", scheduledTwtsKeyPrefix, id))
+	return bs.db.Delete(key)
+}
+
+func (bs *BitcaskStore) GetScheduledTwt(id string) (*ScheduledTwt, error) {
+	key := []byte(fmt.Sprintf("%s/%s", scheduledTwtsKeyPrefix, id))
+	data, err := bs.db.Get(key)
+	if err == bitcask.ErrKeyNotFound {
+		return nil, ErrScheduledTwtNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return LoadScheduledTwt(data)
+}
+
+func (bs *BitcaskStore) SetScheduledTwt(id string, st *ScheduledTwt) error {
+	data, err := st.Bytes()
+	if err != nil {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("%s/%s", scheduledTwtsKeyPrefix, id))
+	return bs.db.Put(key, data)
+}
+
+func (bs *BitcaskStore) LenScheduledTwts() int64 {
+	var count int64
+
+	if err := bs.db.Scan([]byte(scheduledTwtsKeyPrefix), func(_ []byte) error {
+		count++
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("error scanning")
+	}
+
+	return count
+}
+
+func (bs *BitcaskStore) GetAllScheduledTwts() ([]*ScheduledTwt, error) {
+	var sts []*ScheduledTwt
+
+	err := bs.db.Scan([]byte(scheduledTwtsKeyPrefix), func(key []byte) error {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return err
+		}
+
+		st, err := LoadScheduledTwt(data)
+		if err != nil {
+			return err
+		}
+		sts = append(sts, st)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sts, nil
+}
+
+func (bs *BitcaskStore) DelSubscription(id string) error {
+	key := []byte(fmt.Sprintf("%s/%s", subscriptionsKeyPrefix, id))
+	return bs.db.Delete(key)
+}
+
+func (bs *BitcaskStore) SetSubscription(id string, sub *websub.Subscription) error {
+	data, err := sub.Bytes()
+	if err != nil {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("%s/%s", subscriptionsKeyPrefix, id))
+	return bs.db.Put(key, data)
+}
+
+func (bs *BitcaskStore) LenSubscriptions() int64 {
+	var count int64
+
+	if err := bs.db.Scan([]byte(subscriptionsKeyPrefix), func(_ []byte) error {
+		count++
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("error scanning")
+	}
+
+	return count
+}
+
+func (bs *BitcaskStore) GetAllSubscriptions() ([]*websub.Subscription, error) {
+	var subs []*websub.Subscription
+
+	err := bs.db.Scan([]byte(subscriptionsKeyPrefix), func(key []byte) error {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return err
+		}
+
+		sub, err := websub.LoadSubscription(data)
+		if err != nil {
+			return err
+		}
+		subs = append(subs, sub)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+// notificationKey returns the key of a notification, notifications are keyed
+// by user so that a user's notifications can be scanned by prefix
+func notificationKey(username, id string) []byte {
+	return []byte(fmt.Sprintf("%s/%s/%s", notificationsKeyPrefix, username, id))
+}
+
+func (bs *BitcaskStore) DelNotification(username, id string) error {
+	return bs.db.Delete(notificationKey(username, id))
+}
+
+func (bs *BitcaskStore) GetNotification(username, id string) (*Notification, error) {
+	key := notificationKey(username, id)
+	data, err := bs.db.Get(key)
+	if err == bitcask.ErrKeyNotFound {
+		return nil, ErrNotificationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return LoadNotification(data)
+}
+
+func (bs *BitcaskStore) SetNotification(id string, n *Notification) error {
+	data, err := n.Bytes()
+	if err != nil {
+		return err
+	}
+
+	return bs.db.Put(notificationKey(n.Username, id), data)
+}
+
+func (bs *BitcaskStore) LenNotifications() int64 {
+	var count int64
+
+	if err := bs.db.Scan([]byte(notificationsKeyPrefix), func(_ []byte) error {
+		count++
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("error scanning")
+	}
+
+	return count
+}
+
+func (bs *BitcaskStore) GetUserNotifications(username string) ([]*Notification, error) {
+	return bs.scanNotifications(fmt.Sprintf("%s/%s/", notificationsKeyPrefix, username))
+}
+
+func (bs *BitcaskStore) GetAllNotifications() ([]*Notification, error) {
+	return bs.scanNotifications(notificationsKeyPrefix)
+}
+
+func (bs *BitcaskStore) scanNotifications(prefix string) ([]*Notification, error) {
+	var ns []*Notification
+
+	err := bs.db.Scan([]byte(prefix), func(key []byte) error {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return err
+		}
+
+		n, err := LoadNotification(data)
+		if err != nil {
+			return err
+		}
+		ns = append(ns, n)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ns, nil
+}
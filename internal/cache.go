@@ -23,6 +23,11 @@ import (
 const (
 	feedCacheFile    = "cache"
 	feedCacheVersion = 1 // increase this if breaking changes occur to cache file.
+
+	// feedTailSize is how many of the last bytes of a feed are kept and
+	// re-requested when fetching only the content appended to a feed, if
+	// they no longer match the feed was rewritten and is fetched in full
+	feedTailSize = 512
 )
 
 // Cached ...
@@ -31,6 +36,94 @@ type Cached struct {
 	cache        types.TwtMap
 	Twts         types.Twts
 	Lastmodified string
+
+	// ETag, Length and Tail (last bytes) of the feed as last fetched in full
+	// or appended to, used to only fetch content appended since. Twter is
+	// the feed's twter (after any nick/url overrides) parsed from the feed.
+	ETag   string
+	Length int64
+	Tail   []byte
+	Twter  types.Twter
+
+	// Avatar is the avatar declared by the feed (`# avatar = <url>`) last
+	// downloaded and Prev the latest archived feed (`# prev = <hash> <url>`)
+	// followed, the feed's older twts having been archived.
+	Avatar string
+	Prev   string
+
+	// Synthetic feeds are not fetched, their twts are pushed to us (e.g:
+	// the notes of followed ActivityPub actors) and added with PushTwts
+	Synthetic bool
+}
+
+// rangeStart returns the offset to fetch the feed from so as to only fetch
+// the content appended to it (overlapping the known tail), or -1 if the
+// feed cannot be fetched incrementally.
+func (cached *Cached) rangeStart() int64 {
+	if cached.Length == 0 || len(cached.Tail) == 0 || cached.Tail[len(cached.Tail)-1] != '\n' {
+		return -1
+	}
+	return cached.Length - int64(len(cached.Tail))
+}
+
+// ifRange returns the validator of the feed as last fetched to send as
+// If-Range with a Range request so that a changed feed is sent in full, its
+// ETag unless it is weak (which If-Range does not allow) or its Last-Modified.
+func (cached *Cached) ifRange() string {
+	if cached.ETag != "" && !strings.HasPrefix(cached.ETag, "W/") {
+		return cached.ETag
+	}
+	return cached.Lastmodified
+}
+
+// resumes reads the overlapping tail of a 206 Partial Content response and
+// returns true if it matches the known tail, that is content was only
+// appended to the feed. The rest of the body is the appended content.
+func (cached *Cached) resumes(res *http.Response) bool {
+	var start int64
+	if _, err := fmt.Sscanf(res.Header.Get("Content-Range"), "bytes %d-", &start); err != nil {
+		return false
+	}
+	if start != cached.rangeStart() {
+		return false
+	}
+
+	buf := make([]byte, len(cached.Tail))
+	if _, err := io.ReadFull(res.Body, buf); err != nil {
+		return false
+	}
+
+	return bytes.Equal(buf, cached.Tail)
+}
+
+// feedTail is an io.Writer that counts the bytes of a feed written to it
+// and keeps the last feedTailSize bytes
+type feedTail struct {
+	n   int64
+	buf []byte
+}
+
+func (t *feedTail) Write(p []byte) (int, error) {
+	t.n += int64(len(p))
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > feedTailSize {
+		t.buf = append([]byte(nil), t.buf[len(t.buf)-feedTailSize:]...)
+	}
+	return len(p), nil
+}
+
+// appendTwts returns twts with more appended skipping twts already in twts
+func appendTwts(twts types.Twts, more types.Twts) types.Twts {
+	seen := make(map[string]bool)
+	res := make(types.Twts, 0, len(twts)+len(more))
+	for _, twt := range append(append(types.Twts{}, twts...), more...) {
+		if seen[twt.Hash()] {
+			continue
+		}
+		seen[twt.Hash()] = true
+		res = append(res, twt)
+	}
+	return res
 }
 
 // Lookup ...
@@ -65,6 +158,20 @@ type Cache struct {
 	mu      sync.RWMutex
 	Version int
 	Twts    map[string]*Cached
+
+	// Edits maps the hashes of edited twts to the hash of the new version
+	// and the hashes of deleted twts to "" (tombstones)
+	Edits map[string]string
+
+	// prev maps the hashes of edited twts' new versions to the hashes of the
+	// versions they replaced (the reverse of Edits) and is not persisted
+	prev map[string][]string
+
+	// Health records the fetch health of remote feeds keyed by url
+	Health map[string]*FeedHealth
+
+	index   *SearchIndex
+	threads *ThreadIndex
 }
 
 // Store ...
@@ -99,7 +206,12 @@ func (cache *Cache) Store(path string) error {
 // LoadCache ...
 func LoadCache(path string) (*Cache, error) {
 	cache := &Cache{
-		Twts: make(map[string]*Cached),
+		Twts:    make(map[string]*Cached),
+		Edits:   make(map[string]string),
+		prev:    make(map[string][]string),
+		Health:  make(map[string]*FeedHealth),
+		index:   NewSearchIndex(),
+		threads: NewThreadIndex(),
 	}
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
@@ -157,12 +269,32 @@ func LoadCache(path string) (*Cache, error) {
 		cache.Twts = make(map[string]*Cached)
 	}
 
+	if cache.Edits == nil {
+		cache.Edits = make(map[string]string)
+	}
+	for old, replacement := range cache.Edits {
+		if replacement != "" {
+			cache.prev[replacement] = append(cache.prev[replacement], old)
+		}
+	}
+
+	if cache.Health == nil {
+		cache.Health = make(map[string]*FeedHealth)
+	}
+
+	for _, cached := range cache.Twts {
+		cache.index.Index(cached.Twts...)
+		cache.threads.Index(cached.Twts...)
+	}
+
 	return cache, nil
 }
 
 const maxfetchers = 50
 
-// FetchTwts ...
+// FetchTwts fetches and caches the twts of feeds. The health of each remote
+// feed is recorded and feeds that are disabled or failing and backing off
+// are skipped.
 func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds, publicFollowers map[types.Feed][]string) {
 	stime := time.Now()
 	defer func() {
@@ -195,6 +327,36 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 				wg.Done()
 			}()
 
+			cache.mu.RLock()
+			cached := cache.Twts[feed.URL]
+			cache.mu.RUnlock()
+
+			if cached != nil && cached.Synthetic {
+				twtsch <- cached.Twts
+				return
+			}
+
+			var (
+				source   = feed.URL
+				status   int
+				size     int64
+				fetchErr error
+			)
+
+			// Health is only tracked for remote feeds, local feeds are
+			// always fetched (e.g: after posting)
+			if !strings.HasPrefix(feed.URL, conf.BaseURL) {
+				if !cache.shouldFetch(source, time.Now()) {
+					log.Debugf("skipping disabled or backed off feed %s", feed)
+					twtsch <- nil
+					return
+				}
+
+				defer func() {
+					cache.recordFetch(source, feed.Nick, status, size, fetchErr)
+				}()
+			}
+
 			headers := make(http.Header)
 
 			if publicFollowers != nil {
@@ -222,22 +384,48 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 				}
 			}
 
-			cache.mu.RLock()
-			if cached, ok := cache.Twts[feed.URL]; ok {
+			start := int64(-1)
+			if cached != nil {
 				if cached.Lastmodified != "" {
 					headers.Set("If-Modified-Since", cached.Lastmodified)
 				}
+				if cached.ETag != "" {
+					headers.Set("If-None-Match", cached.ETag)
+				}
+				// Only fetch what was appended since (if anything)
+				if start = cached.rangeStart(); start >= 0 {
+					headers.Set("Range", fmt.Sprintf("bytes=%d-", start))
+					if validator := cached.ifRange(); validator != "" {
+						headers.Set("If-Range", validator)
+					}
+				}
 			}
-			cache.mu.RUnlock()
 
 			res, err := Request(conf, http.MethodGet, feed.URL, headers)
+			if err == nil && start >= 0 {
+				switch {
+				case res.StatusCode == http.StatusRequestedRangeNotSatisfiable,
+					res.StatusCode == http.StatusPartialContent && !cached.resumes(res):
+					// The feed was truncated or rewritten, fetch it in full
+					log.Debugf("feed %s was rewritten, fetching in full", feed)
+					res.Body.Close()
+					headers.Del("Range")
+					headers.Del("If-Range")
+					headers.Del("If-None-Match")
+					headers.Del("If-Modified-Since")
+					res, err = Request(conf, http.MethodGet, feed.URL, headers)
+				}
+			}
 			if err != nil {
 				log.WithError(err).Errorf("error fetching feed %s", feed)
+				fetchErr = err
 				twtsch <- nil
 				return
 			}
 			defer res.Body.Close()
 
+			status = res.StatusCode
+
 			actualurl := res.Request.URL.String()
 			if actualurl != feed.URL {
 				log.WithError(err).Warnf("feed for %s changed from %s to %s", feed.Nick, feed.URL, actualurl)
@@ -251,35 +439,65 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 
 			if feed.URL == "" {
 				log.WithField("feed", feed).Warn("empty url")
+				fetchErr = fmt.Errorf("empty url")
 				twtsch <- nil
 				return
 			}
 
+			// Subscribe to the feed's hub (if any) to be pushed its updates
+			if !strings.HasPrefix(feed.URL, conf.BaseURL) && res.StatusCode < http.StatusBadRequest {
+				websubs.Discovered(feed.URL, res.Header)
+			}
+
 			var twts types.Twts
 
 			switch res.StatusCode {
-			case http.StatusOK: // 200
+			case http.StatusOK, http.StatusPartialContent: // 200, 206
 				limitedReader := &io.LimitedReader{R: res.Body, N: conf.MaxFetchLimit}
 
+				// A 206 Partial Content response (validated above) is only
+				// the content appended since the feed was last fetched
+				partial := res.StatusCode == http.StatusPartialContent
+
+				tail := &feedTail{}
+				if partial {
+					tail = &feedTail{n: cached.Length, buf: cached.Tail}
+				}
+
 				twter := types.Twter{Nick: feed.Nick}
 				if strings.HasPrefix(feed.URL, conf.BaseURL) {
 					twter.URL = URLForUser(conf.BaseURL, feed.Nick)
 					twter.Avatar = URLForAvatar(conf.BaseURL, feed.Nick)
 				} else {
+					// The avatar declared by the feed is downloaded below
 					twter.URL = feed.URL
-					avatar := GetExternalAvatar(conf, feed.Nick, feed.URL)
-					if avatar != "" {
+					if HasExternalAvatar(conf, feed.URL) {
 						twter.Avatar = URLForExternalAvatar(conf, feed.URL)
 					}
 				}
+				// Only the urls actually fetched, never the url a feed
+				// declares itself (# url / # twturl), own its twts
+				owners := []string{source, feed.URL, twter.URL}
+
+				if partial && cached.Twter.URL != "" {
+					// Appended content has no nick/url overrides of its own
+					twter = cached.Twter
+				}
+
 				log.Debugf("cache: parsing %s for %s", feed.URL, twter)
-				twtFile, err := types.ParseFile(limitedReader, twter)
+				twtFile, err := types.ParseFile(io.TeeReader(limitedReader, tail), twter)
+				size = conf.MaxFetchLimit - limitedReader.N
 				if err != nil {
 					log.WithError(err).Errorf("error parsing feed %s", feed)
+					fetchErr = fmt.Errorf("error parsing feed: %w", err)
 					twtsch <- nil
 					return
 				}
-				twts, old := types.SplitTwts(twtFile.Twts(), conf.MaxCacheTTL, conf.MaxCacheItems)
+				fetched := twtFile.Twts()
+				if partial {
+					fetched = appendTwts(cached.Twts, fetched)
+				}
+				twts, old := types.SplitTwts(fetched, conf.MaxCacheTTL, conf.MaxCacheItems)
 
 				// If N == 0 we possibly exceeded conf.MaxFetchLimit when
 				// reading this feed. Log it and bump a cache_limited counter
@@ -292,6 +510,27 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 					metrics.Counter("cache", "limited").Inc()
 				}
 
+				// Apply any edit/delete records before archiving
+				if info := twtFile.Info(); info != nil {
+					cache.applyEdits(archive, owners, info.Edits())
+				}
+
+				// Feed metadata is only in the feed's header
+				var avatar, prev string
+				if cached != nil {
+					avatar, prev = cached.Avatar, cached.Prev
+				}
+				refetch := false
+				if info := twtFile.Info(); info != nil && !partial {
+					if !strings.HasPrefix(feed.URL, conf.BaseURL) {
+						avatar = externalAvatar(conf, feed.URL, info, avatar)
+						// Twts parsed before the feed's avatar was downloaded
+						// have no avatar, fetch the feed in full next time
+						refetch = twter.Avatar == "" && HasExternalAvatar(conf, feed.URL)
+					}
+					prev = cache.fetchArchivedFeeds(conf, archive, feed.URL, twtFile.Twter(), info, prev)
+				}
+
 				// Archive twts (opportunistically)
 				archiveTwts := func(twts []types.Twt) {
 					for _, twt := range twts {
@@ -308,13 +547,41 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 				archiveTwts(old)
 				archiveTwts(twts)
 
+				// Only cached twts are indexed in memory, twts no longer
+				// cached are searched and threaded through the archive
+				var prevTwts types.Twts
+				if cached != nil {
+					prevTwts = cached.Twts
+				}
+				cache.unindex(twts, prevTwts, old)
+				cache.index.Index(twts...)
+				cache.threads.Index(twts...)
+
 				lastmodified := res.Header.Get("Last-Modified")
-				cache.mu.Lock()
-				cache.Twts[feed.URL] = &Cached{
+				updated := &Cached{
 					cache:        make(map[string]types.Twt),
 					Twts:         twts,
 					Lastmodified: lastmodified,
+					ETag:         res.Header.Get("ETag"),
+					Twter:        twtFile.Twter(),
+					Avatar:       avatar,
+					Prev:         prev,
+				}
+				if partial {
+					updated.Twter = twter
+				}
+				// Only resume feeds we have seen in their entirety
+				if limitedReader.N > 0 {
+					updated.Length = tail.n
+					updated.Tail = tail.buf
+				}
+				if refetch {
+					updated.Lastmodified, updated.ETag = "", ""
+					updated.Length, updated.Tail = 0, nil
 				}
+
+				cache.mu.Lock()
+				cache.Twts[feed.URL] = updated
 				cache.mu.Unlock()
 			case http.StatusNotModified: // 304
 				cache.mu.RLock()
@@ -322,6 +589,9 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 					twts = cache.Twts[feed.URL].Twts
 				}
 				cache.mu.RUnlock()
+			default:
+				log.Warnf("unexpected status %s fetching feed %s", res.Status, feed)
+				fetchErr = fmt.Errorf("unexpected status: %s", res.Status)
 			}
 
 			twtsch <- twts
@@ -347,6 +617,112 @@ func (cache *Cache) FetchTwts(conf *Config, archive Archiver, feeds types.Feeds,
 	metrics.Gauge("cache", "twts").Set(float64(count))
 }
 
+// applyEdits records the edit/delete records of a feed. Records are only
+// accepted for twts known to have been posted by the feed (one of the urls
+// it was fetched from) so that a feed cannot redirect or delete other feeds'
+// twts. Deleted twts are also removed from the archive.
+func (cache *Cache) applyEdits(archive Archiver, urls []string, edits []types.Edit) {
+	for _, edit := range edits {
+		cache.mu.RLock()
+		_, seen := cache.Edits[edit.Hash]
+		cache.mu.RUnlock()
+		if seen {
+			continue
+		}
+
+		twt, ok := cache.Lookup(edit.Hash)
+		if !ok && archive.Has(edit.Hash) {
+			if archived, err := archive.Get(edit.Hash); err == nil {
+				twt, ok = archived, true
+			}
+		}
+		if !ok || !HasString(urls, twt.Twter().URL) {
+			log.Debugf("ignoring edit of unknown or foreign twt %s", edit.Hash)
+			continue
+		}
+
+		if edit.IsDelete() {
+			if err := archive.Del(edit.Hash); err != nil {
+				log.WithError(err).Errorf("error deleting twt %s from archive", edit.Hash)
+			}
+		}
+		// Only the latest version of a twt is searchable
+		cache.index.Remove(edit.Hash)
+
+		cache.mu.Lock()
+		cache.recordEdit(edit.Hash, edit.Replacement)
+		cache.mu.Unlock()
+	}
+}
+
+// recordEdit records that the twt identified by hash was replaced by the
+// twt identified by replacement, or deleted if replacement is empty. The
+// caller must hold cache.mu.
+func (cache *Cache) recordEdit(hash, replacement string) {
+	if cache.Edits == nil {
+		cache.Edits = make(map[string]string)
+	}
+	cache.Edits[hash] = replacement
+
+	if replacement != "" {
+		if cache.prev == nil {
+			cache.prev = make(map[string][]string)
+		}
+		cache.prev[replacement] = append(cache.prev[replacement], hash)
+	}
+}
+
+// Redirect follows the edit records of the twt identified by hash and
+// returns the hash of its latest version, deleted is true if the twt (or a
+// later version of it) was deleted. ok is false if the twt was never edited
+// or deleted.
+func (cache *Cache) Redirect(hash string) (latest string, deleted, ok bool) {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	latest = hash
+	// Bounded by the number of records to guard against cycles
+	for i := 0; i <= len(cache.Edits); i++ {
+		next, found := cache.Edits[latest]
+		if !found {
+			break
+		}
+		ok = true
+		if next == "" {
+			return latest, true, true
+		}
+		latest = next
+	}
+
+	return latest, false, ok
+}
+
+// Versions returns the hashes of all previous versions of the twt identified
+// by hash (if it was edited) including hash itself. Only the latest version
+// of a twt has previous versions.
+func (cache *Cache) Versions(hash string) []string {
+	versions := []string{hash}
+
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	if _, edited := cache.Edits[hash]; edited {
+		return versions
+	}
+
+	seen := map[string]bool{hash: true}
+	for i := 0; i < len(versions); i++ {
+		for _, old := range cache.prev[versions[i]] {
+			if !seen[old] {
+				seen[old] = true
+				versions = append(versions, old)
+			}
+		}
+	}
+
+	return versions
+}
+
 // Lookup ...
 func (cache *Cache) Lookup(hash string) (types.Twt, bool) {
 	cache.mu.RLock()
@@ -386,6 +762,47 @@ func (cache *Cache) GetAll() types.Twts {
 	return alltwts
 }
 
+// Index returns the search index for twts seen by the cache
+func (cache *Cache) Index() *SearchIndex {
+	return cache.index
+}
+
+// Threads returns the thread index of replies seen by the cache
+func (cache *Cache) Threads() *ThreadIndex {
+	return cache.threads
+}
+
+// Search returns the twts matching the query, the cached twts first followed
+// by the archived twts that are neither cached nor were since edited or
+// deleted
+func (cache *Cache) Search(archive Archiver, q SearchQuery) types.Twts {
+	twts := cache.index.Search(q)
+
+	archived, err := archive.Search(q)
+	if err != nil {
+		log.WithError(err).Warn("error searching archive")
+		return twts
+	}
+
+	seen := make(map[string]bool, len(twts))
+	for _, twt := range twts {
+		seen[twt.Hash()] = true
+	}
+	for _, twt := range archived {
+		hash := twt.Hash()
+		if seen[hash] {
+			continue
+		}
+		if _, _, edited := cache.Redirect(hash); edited {
+			continue
+		}
+		seen[hash] = true
+		twts = append(twts, twt)
+	}
+
+	return twts
+}
+
 // GetMentions ...
 func (cache *Cache) GetMentions(u *User) (twts types.Twts) {
 	cache.mu.RLock()
@@ -455,12 +872,124 @@ func (cache *Cache) GetByURL(url string) types.Twts {
 	return types.Twts{}
 }
 
+// GetTwter returns the twter of the feed identified by url with the
+// metadata declared by the feed (e.g: its description and links)
+func (cache *Cache) GetTwter(url string) (types.Twter, bool) {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	if cached, ok := cache.Twts[url]; ok && !cached.Twter.IsZero() {
+		return cached.Twter, true
+	}
+	return types.Twter{}, false
+}
+
+// AddSyntheticFeed adds the synthetic feed url of twter to the cache (unless
+// already cached) so that it is not fetched
+func (cache *Cache) AddSyntheticFeed(url string, twter types.Twter) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cached, ok := cache.Twts[url]; ok && cached.Synthetic {
+		return
+	}
+
+	cache.Twts[url] = &Cached{
+		cache:     make(map[string]types.Twt),
+		Twter:     twter,
+		Synthetic: true,
+	}
+}
+
+// IsSynthetic returns true if the feed url is a synthetic feed
+func (cache *Cache) IsSynthetic(url string) bool {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	cached, ok := cache.Twts[url]
+	return ok && cached.Synthetic
+}
+
+// PushTwts adds twts pushed to us to the synthetic feed url (adding the feed
+// if needed). Pushed twts are archived straight away so twts past the cache's
+// limits are simply dropped from the feed.
+func (cache *Cache) PushTwts(conf *Config, archive Archiver, url string, twts ...types.Twt) {
+	cache.mu.Lock()
+
+	twter := types.Twter{}
+	if len(twts) > 0 {
+		twter = twts[0].Twter()
+	}
+
+	var pushed types.Twts
+	if cached, ok := cache.Twts[url]; ok && cached.Synthetic {
+		pushed = cached.Twts
+		twter = cached.Twter
+	}
+	prevTwts := pushed
+	pushed, dropped := types.SplitTwts(appendTwts(pushed, twts), conf.MaxCacheTTL, conf.MaxCacheItems)
+
+	cache.Twts[url] = &Cached{
+		cache:     make(map[string]types.Twt),
+		Twts:      pushed,
+		Twter:     twter,
+		Synthetic: true,
+	}
+
+	cache.mu.Unlock()
+
+	for _, twt := range twts {
+		if archive.Has(twt.Hash()) {
+			continue
+		}
+		if err := archive.Archive(twt); err != nil {
+			log.WithError(err).Errorf("error archiving twt %s", twt.Hash())
+			metrics.Counter("archive", "error").Inc()
+		} else {
+			metrics.Counter("archive", "size").Inc()
+		}
+	}
+
+	cache.unindex(pushed, prevTwts, dropped)
+	cache.index.Index(pushed...)
+	cache.threads.Index(pushed...)
+}
+
 // Delete ...
 func (cache *Cache) Delete(feeds types.Feeds) {
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
 
 	for feed := range feeds {
+		if cached, ok := cache.Twts[feed.URL]; ok {
+			cache.unindex(nil, cached.Twts)
+		}
 		delete(cache.Twts, feed.URL)
 	}
 }
+
+// unindex removes the twts of each of evicted that are not among cached (the
+// twts still cached) from the search and thread indexes
+func (cache *Cache) unindex(cached types.Twts, evicted ...types.Twts) {
+	keep := make(map[string]bool, len(cached))
+	for _, twt := range cached {
+		keep[twt.Hash()] = true
+	}
+
+	var (
+		twts   types.Twts
+		hashes []string
+	)
+	for _, list := range evicted {
+		for _, twt := range list {
+			if hash := twt.Hash(); !keep[hash] {
+				keep[hash] = true
+				twts = append(twts, twt)
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+
+	cache.index.Remove(hashes...)
+	cache.threads.Remove(twts...)
+}
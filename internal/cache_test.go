@@ -0,0 +1,297 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/lextwt"
+)
+
+func TestFetchTwtsIncremental(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lextwt.DefaultTwtManager()
+
+	var (
+		mu      sync.Mutex
+		content string
+		ranges  []string
+		ifRange []string
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/twtxt.txt" {
+			http.NotFound(w, r)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		ranges = append(ranges, r.Header.Get("Range"))
+		ifRange = append(ifRange, r.Header.Get("If-Range"))
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(content))))
+		http.ServeContent(w, r, "twtxt.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer ts.Close()
+
+	serve := func(lines ...string) {
+		mu.Lock()
+		defer mu.Unlock()
+		content = strings.Join(lines, "")
+		ranges, ifRange = nil, nil
+	}
+
+	line := func(ago time.Duration, text string) string {
+		return fmt.Sprintf("%s\t%s\n", time.Now().Add(-ago).UTC().Format(time.RFC3339), text)
+	}
+
+	conf := &Config{
+		Data:          t.TempDir(),
+		BaseURL:       "http://0.0.0.0:8000",
+		MaxFetchLimit: 1 << 20,
+		MaxCacheTTL:   24 * time.Hour,
+		MaxCacheItems: 100,
+	}
+
+	cache, err := LoadCache(conf.Data)
+	require.NoError(err)
+	archive, err := NewNullArchiver()
+	require.NoError(err)
+
+	url := ts.URL + "/twtxt.txt"
+	feeds := types.Feeds{types.Feed{Nick: "bob", URL: url}: true}
+
+	one, two, three := line(3*time.Hour, "one"), line(2*time.Hour, "two"), line(time.Hour, "three")
+
+	// Initial fetch is a full fetch
+	serve("# nick = bob\n", one, two)
+	cache.FetchTwts(conf, archive, feeds, nil)
+	assert.Equal([]string{""}, ranges)
+	require.Len(cache.GetByURL(url), 2)
+
+	// Appended content is fetched with a Range request
+	serve("# nick = bob\n", one, two, three)
+	cache.FetchTwts(conf, archive, feeds, nil)
+	require.Len(ranges, 1)
+	assert.NotEmpty(ranges[0])
+	require.Len(cache.GetByURL(url), 3)
+	appended := cache.GetByURL(url)[0]
+	assert.Equal("three", fmt.Sprintf("%t", appended))
+
+	// An unchanged feed is not fetched again
+	serve("# nick = bob\n", one, two, three)
+	cache.FetchTwts(conf, archive, feeds, nil)
+	require.Len(cache.GetByURL(url), 3)
+
+	// A rewritten feed is fetched in full
+	serve("# nick = bob\n", two, three)
+	cache.FetchTwts(conf, archive, feeds, nil)
+	require.Len(ranges, 2)
+	assert.NotEmpty(ranges[0])
+	assert.Empty(ranges[1])
+	require.Len(cache.GetByURL(url), 2)
+
+	// Appended twts hash the same as when fetched in full
+	assert.Equal(appended.Hash(), cache.GetByURL(url)[0].Hash())
+
+	// A feed changed before its tail (same size) is sent in full in response
+	// to the Range request as it no longer matches the If-Range
+	long := line(time.Minute, strings.Repeat("four ", feedTailSize/5))
+	serve("# nick = bob\n", two, three, long)
+	cache.FetchTwts(conf, archive, feeds, nil)
+	require.Len(cache.GetByURL(url), 3)
+
+	owt := strings.Replace(two, "two", "owt", 1)
+	serve("# nick = bob\n", owt, three, long)
+	cache.FetchTwts(conf, archive, feeds, nil)
+	require.Len(ranges, 1)
+	assert.NotEmpty(ranges[0])
+	assert.NotEmpty(ifRange[0])
+	twts := cache.GetByURL(url)
+	require.Len(twts, 3)
+	assert.Equal("owt", fmt.Sprintf("%t", twts[2]))
+}
+
+func TestFetchTwtsArchivedFeeds(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lextwt.DefaultTwtManager()
+
+	var (
+		mu      sync.Mutex
+		files   = make(map[string]string)
+		fetched []string
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fetched = append(fetched, r.URL.Path)
+		http.ServeContent(w, r, "twtxt.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer ts.Close()
+
+	serve := func(path string, lines ...string) {
+		mu.Lock()
+		defer mu.Unlock()
+		files[path] = strings.Join(lines, "")
+		fetched = nil
+	}
+
+	line := func(ago time.Duration, text string) string {
+		return fmt.Sprintf("%s\t%s\n", time.Now().Add(-ago).UTC().Format(time.RFC3339), text)
+	}
+
+	conf := &Config{
+		Data:          t.TempDir(),
+		BaseURL:       "http://0.0.0.0:8000",
+		MaxFetchLimit: 1 << 20,
+		MaxCacheTTL:   24 * time.Hour,
+		MaxCacheItems: 100,
+	}
+
+	cache, err := LoadCache(conf.Data)
+	require.NoError(err)
+	archive, err := NewDiskArchiver(filepath.Join(conf.Data, archiveDir))
+	require.NoError(err)
+
+	url := ts.URL + "/twtxt.txt"
+	feeds := types.Feeds{types.Feed{Nick: "bob", URL: url}: true}
+	twter := types.Twter{Nick: "bob", URL: url}
+
+	one, two, three := line(72*time.Hour, "one"), line(48*time.Hour, "two"), line(time.Hour, "three")
+
+	// Archived feeds are followed and their twts archived
+	serve("/archive/0.txt", one)
+	serve("/archive/1.txt", "# prev = h0 0.txt\n\n", two)
+	serve("/twtxt.txt",
+		"# nick = bob\n",
+		"# description = Archiving twts\n",
+		"# link = My Website https://example.com/\n",
+		"# prev = h1 archive/1.txt\n\n",
+		three,
+	)
+	cache.FetchTwts(conf, archive, feeds, nil)
+	assert.Contains(fetched, "/archive/1.txt")
+	assert.Contains(fetched, "/archive/0.txt")
+	require.Len(cache.GetByURL(url), 1)
+
+	for _, text := range []string{one, two} {
+		twt, err := lextwt.ParseLine(strings.TrimSpace(text), twter)
+		require.NoError(err)
+		assert.True(archive.Has(twt.Hash()))
+	}
+
+	// Metadata declared by the feed
+	declared, ok := cache.GetTwter(url)
+	require.True(ok)
+	assert.Equal("Archiving twts", declared.Tagline)
+	assert.Equal(types.Links{{Title: "My Website", Href: "https://example.com/"}}, declared.Links)
+
+	// Archived feeds already followed are not fetched again
+	serve("/twtxt.txt",
+		"# nick = bob\n",
+		"# prev = h2 archive/2.txt\n\n",
+		three,
+	)
+	serve("/archive/2.txt", "# prev = h1 1.txt\n\n", two)
+	cache.FetchTwts(conf, archive, feeds, nil)
+	assert.Contains(fetched, "/archive/2.txt")
+	assert.NotContains(fetched, "/archive/1.txt")
+	assert.NotContains(fetched, "/archive/0.txt")
+}
+
+func TestFetchTwtsSpoofedEdits(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lextwt.DefaultTwtManager()
+
+	var (
+		mu    sync.Mutex
+		files = make(map[string]string)
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "twtxt.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer ts.Close()
+
+	serve := func(path string, lines ...string) {
+		mu.Lock()
+		defer mu.Unlock()
+		files[path] = strings.Join(lines, "")
+	}
+
+	line := func(ago time.Duration, text string) string {
+		return fmt.Sprintf("%s\t%s\n", time.Now().Add(-ago).UTC().Format(time.RFC3339), text)
+	}
+
+	conf := &Config{
+		Data:          t.TempDir(),
+		BaseURL:       "http://0.0.0.0:8000",
+		MaxFetchLimit: 1 << 20,
+		MaxCacheTTL:   24 * time.Hour,
+		MaxCacheItems: 100,
+	}
+
+	cache, err := LoadCache(conf.Data)
+	require.NoError(err)
+	archive, err := NewNullArchiver()
+	require.NoError(err)
+
+	alice := ts.URL + "/alice.txt"
+	mallory := ts.URL + "/mallory.txt"
+
+	hello := line(time.Hour, "Hello World!")
+	serve("/alice.txt", "# nick = alice\n", hello)
+	cache.FetchTwts(conf, archive, types.Feeds{types.Feed{Nick: "alice", URL: alice}: true}, nil)
+	require.Len(cache.GetByURL(alice), 1)
+	hash := cache.GetByURL(alice)[0].Hash()
+
+	// A feed claiming to be alice's cannot delete her twts
+	serve("/mallory.txt",
+		"# nick = mallory\n",
+		fmt.Sprintf("# url = %s\n", alice),
+		fmt.Sprintf("# delete = %s\n\n", hash),
+		line(time.Hour, "Gotcha!"),
+	)
+	cache.FetchTwts(conf, archive, types.Feeds{types.Feed{Nick: "mallory", URL: mallory}: true}, nil)
+	_, _, ok := cache.Redirect(hash)
+	assert.False(ok)
+
+	// But alice can
+	serve("/alice.txt", "# nick = alice\n", fmt.Sprintf("# delete = %s\n\n", hash), hello)
+	cache.FetchTwts(conf, archive, types.Feeds{types.Feed{Nick: "alice", URL: alice}: true}, nil)
+	_, deleted, ok := cache.Redirect(hash)
+	assert.True(ok)
+	assert.True(deleted)
+}
@@ -78,6 +78,9 @@ type Config struct {
 
 	MaxFetchLimit int64
 
+	MaxFeedSize int64
+	MaxFeedAge  time.Duration
+
 	APISessionTime time.Duration
 	APISigningKey  string
 
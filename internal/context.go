@@ -12,6 +12,7 @@ import (
 
 	"github.com/jointwt/twtxt"
 	"github.com/jointwt/twtxt/internal/session"
+	"github.com/jointwt/twtxt/internal/webmention"
 	"github.com/jointwt/twtxt/types"
 	"github.com/justinas/nosurf"
 	"github.com/theplant-retired/timezones"
@@ -72,14 +73,33 @@ type Context struct {
 	Messages    Messages
 	NewMessages int
 
+	Notifications    []*Notification
+	NewNotifications int
+
 	Twter       types.Twter
 	Twts        types.Twts
+	Thread      *types.Thread
 	BlogPost    *BlogPost
 	BlogPosts   BlogPosts
 	Feeds       []*Feed
 	FeedSources FeedSourceMap
 	Pager       *paginator.Paginator
 
+	// Feed Health
+	FeedHealth   []FeedHealth
+	ShowAllFeeds bool
+
+	// WebMentions
+	WebMentions []*webmention.Mention
+
+	// Scheduled Twts
+	ScheduledFeed string
+	ScheduledTwt  *ScheduledTwt
+	ScheduledTwts []*ScheduledTwt
+
+	// Search
+	SearchQuery string
+
 	// Report abuse
 	ReportNick string
 	ReportURL  string
@@ -87,6 +107,13 @@ type Context struct {
 	// Reset Password Token
 	PasswordResetToken string
 
+	// Where to go after logging in
+	Next string
+
+	// API Tokens
+	Scopes      []string
+	AuthRequest *AuthRequest
+
 	// CSRF Token
 	CSRFToken string
 }
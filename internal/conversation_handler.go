@@ -3,7 +3,6 @@ package internal
 import (
 	"fmt"
 	"net/http"
-	"sort"
 	"strings"
 	"time"
 
@@ -30,6 +29,18 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 			return
 		}
 
+		// Redirect edited twts to their latest version or show a tombstone
+		if latest, deleted, ok := s.cache.Redirect(hash); ok {
+			if deleted {
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorTwtDeleted")
+				s.render("error", w, ctx)
+				return
+			}
+			http.Redirect(w, r, URLForConv(s.config.BaseURL, latest), http.StatusMovedPermanently)
+			return
+		}
+
 		var err error
 
 		twt, ok := s.cache.Lookup(hash)
@@ -93,33 +104,18 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 			)
 		}
 
-		getTweetsByHash := func(hash string, replyTo types.Twt) types.Twts {
-			var result types.Twts
-			seen := make(map[string]bool)
-			// TODO: Improve this by making this an O(1) lookup on the tag
-			for _, twt := range s.cache.GetAll() {
-				var tags types.TagList = twt.Tags()
-				if HasString(UniqStrings(tags.Tags()), hash) && !seen[twt.Hash()] {
-					result = append(result, twt)
-					seen[twt.Hash()] = true
-				}
-			}
-			if !seen[replyTo.Hash()] {
-				result = append(result, replyTo)
-			}
-			return result
-		}
-
-		twts := getTweetsByHash(hash, twt)
-		sort.Sort(sort.Reverse(twts))
+		// The complete thread including replies to previous versions of an
+		// edited twt and replies that have since been archived, paged by its
+		// top-level replies so sub-threads are never split across pages
+		thread := FilterThread(ctx.User, GetThread(s.cache, s.archive, twt))
 
-		var pagedTwts types.Twts
+		var pagedReplies []*types.Thread
 
 		page := SafeParseInt(r.FormValue("p"), 1)
-		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
+		pager := paginator.New(adapter.NewSliceAdapter(thread.Replies), s.config.TwtsPerPage)
 		pager.SetPage(page)
 
-		if err := pager.Results(&pagedTwts); err != nil {
+		if err := pager.Results(&pagedReplies); err != nil {
 			ctx.Error = true
 			ctx.Message = "An error occurred while loading search results"
 			s.render("error", w, ctx)
@@ -176,7 +172,8 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 		}
 
 		ctx.Reply = fmt.Sprintf("#%s", twt.Hash())
-		ctx.Twts = FilterTwts(ctx.User, pagedTwts)
+		ctx.Thread = &types.Thread{Twt: thread.Twt, Replies: pagedReplies}
+		ctx.Twts = ctx.Thread.Twts()
 		ctx.Pager = &pager
 		s.render("conversation", w, ctx)
 	}
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/jointwt/twtxt"
+	"github.com/jointwt/twtxt/internal/activitypub"
+)
+
+const (
+	// nodeInfoPath is the well-known path of the NodeInfo discovery document
+	nodeInfoPath = "/.well-known/nodeinfo"
+
+	// nodeInfoSchema is the prefix of the NodeInfo schema (relations)
+	nodeInfoSchema = "http://nodeinfo.diaspora.software/ns/schema/"
+)
+
+// nodeInfoVersions are the versions of NodeInfo served
+var nodeInfoVersions = []string{"2.0", "2.1"}
+
+// NodeInfoSoftware ...
+type NodeInfoSoftware struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Repository string `json:"repository,omitempty"`
+}
+
+// NodeInfoUsage ...
+type NodeInfoUsage struct {
+	Users struct {
+		Total int `json:"total"`
+	} `json:"users"`
+	LocalPosts int `json:"localPosts"`
+}
+
+// NodeInfo is a NodeInfo 2.x document describing the pod
+type NodeInfo struct {
+	Version           string                 `json:"version"`
+	Software          NodeInfoSoftware       `json:"software"`
+	Protocols         []string               `json:"protocols"`
+	Services          map[string][]string    `json:"services"`
+	OpenRegistrations bool                   `json:"openRegistrations"`
+	Usage             NodeInfoUsage          `json:"usage"`
+	Metadata          map[string]interface{} `json:"metadata"`
+}
+
+// WebFingerHandler resolves the handles (acct:nick@domain) of the users and
+// feeds on the pod to their twtxt.txt feed, avatar, profile and (for users)
+// ActivityPub actor
+func (s *Server) WebFingerHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		resource := r.URL.Query().Get("resource")
+		if resource == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		nick, domain, err := activitypub.ParseHandle(strings.TrimPrefix(resource, "acct:"))
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		local := s.config.LocalURL()
+		if domain != strings.ToLower(local.Host) && domain != strings.ToLower(local.Hostname()) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		var links []activitypub.Link
+
+		if user, err := s.db.GetUser(NormalizeUsername(nick)); err == nil {
+			nick = user.Username
+			if federation != nil {
+				links = append(links, activitypub.Link{
+					Rel: "self", Type: activitypub.ContentType,
+					Href: URLForActor(s.config.BaseURL, nick),
+				})
+			}
+		} else if feed, err := s.db.GetFeed(NormalizeFeedName(nick)); err == nil {
+			nick = feed.Name
+		} else {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		feed := URLForUser(s.config.BaseURL, nick)
+		profile := UserURL(feed)
+
+		writeActivityJSON(w, activitypub.WebFingerContentType, activitypub.Resource{
+			Subject: resource,
+			Aliases: []string{profile, feed},
+			Links: append(
+				links,
+				activitypub.Link{Rel: "self", Type: activitypub.FeedContentType, Href: feed},
+				activitypub.Link{Rel: activitypub.ProfilePageRel, Type: "text/html", Href: profile},
+				activitypub.Link{Rel: activitypub.AvatarRel, Href: URLForAvatar(s.config.BaseURL, nick)},
+			),
+		})
+	}
+}
+
+// NodeInfoDiscoveryHandler links to the NodeInfo documents of the pod
+func (s *Server) NodeInfoDiscoveryHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		var links []activitypub.Link
+		for _, version := range nodeInfoVersions {
+			links = append(links, activitypub.Link{
+				Rel:  nodeInfoSchema + version,
+				Href: fmt.Sprintf("%s/nodeinfo/%s", strings.TrimSuffix(s.config.BaseURL, "/"), version),
+			})
+		}
+
+		writeActivityJSON(w, "application/json", map[string]interface{}{"links": links})
+	}
+}
+
+// NodeInfoHandler serves the NodeInfo document of the pod with the user and
+// twt counts of the pod's stats
+func (s *Server) NodeInfoHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		version := p.ByName("version")
+		if !HasString(nodeInfoVersions, version) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		software := NodeInfoSoftware{
+			Name:    "twtxt",
+			Version: twtxt.Version,
+		}
+		if version != "2.0" {
+			software.Repository = "https://github.com/jointwt/twtxt"
+		}
+
+		info := NodeInfo{
+			Version:           version,
+			Software:          software,
+			Protocols:         []string{"activitypub"},
+			Services:          map[string][]string{"inbound": {}, "outbound": {"atom1.0"}},
+			OpenRegistrations: s.config.OpenRegistrations,
+			Metadata: map[string]interface{}{
+				"nodeName":        s.config.Name,
+				"nodeDescription": s.config.Description,
+			},
+		}
+		info.Usage.Users.Total = getStat("users")
+		info.Usage.LocalPosts = getStat("twts")
+
+		writeActivityJSON(
+			w, fmt.Sprintf(`application/json; profile="%s%s#"`, nodeInfoSchema, version), info,
+		)
+	}
+}
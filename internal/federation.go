@@ -0,0 +1,451 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/jointwt/twtxt"
+	"github.com/jointwt/twtxt/internal/activitypub"
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// activityPubKeysDir is where the keys of users' actors are stored
+	activityPubKeysDir = "keys"
+
+	// activityPubWorkers is the number of workers delivering activities
+	activityPubWorkers = 4
+)
+
+var (
+	ErrInvalidActivity = errors.New("error: invalid activity")
+
+	noteSpaceRe = regexp.MustCompile(`[ \t\r\n]+`)
+)
+
+// Federation federates the users of the pod with the fediverse over
+// ActivityPub. Every user has an actor derived from their profile, twts they
+// post are delivered as Notes to their followers and the Notes of actors they
+// follow are pushed to synthetic feeds in the cache.
+type Federation struct {
+	conf      *Config
+	client    *activitypub.Client
+	keys      *activitypub.KeyStore
+	deliverer *activitypub.Deliverer
+}
+
+// NewFederation ...
+func NewFederation(conf *Config) *Federation {
+	client := activitypub.NewClient(fmt.Sprintf(
+		"twtxt/%s (Pod: %s Support: %s)",
+		twtxt.FullVersion(), conf.Name, URLForPage(conf.BaseURL, "support"),
+	))
+
+	return &Federation{
+		conf:      conf,
+		client:    client,
+		keys:      activitypub.NewKeyStore(filepath.Join(conf.Data, activityPubKeysDir)),
+		deliverer: activitypub.NewDeliverer(client, activityPubWorkers),
+	}
+}
+
+// Client ...
+func (f *Federation) Client() *activitypub.Client {
+	return f.client
+}
+
+// Signer returns the signer of the actor of the user username
+func (f *Federation) Signer(username string) (*activitypub.Signer, error) {
+	key, err := f.keys.Key(username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &activitypub.Signer{
+		KeyID: URLForActor(f.conf.BaseURL, username) + "#main-key",
+		Key:   key,
+	}, nil
+}
+
+// DeleteKey removes the key of the actor of the user username, e.g: when
+// their account is deleted
+func (f *Federation) DeleteKey(username string) {
+	if f == nil {
+		return
+	}
+
+	if err := f.keys.Delete(username); err != nil {
+		log.WithError(err).Warnf("error removing key of %s", username)
+	}
+}
+
+// Actor returns the actor of the user derived from their profile
+func (f *Federation) Actor(user *User) (*activitypub.Actor, error) {
+	key, err := f.keys.Key(user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := activitypub.EncodePublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := user.Profile(f.conf.BaseURL, nil)
+	id := URLForActor(f.conf.BaseURL, user.Username)
+
+	return &activitypub.Actor{
+		Context:           activitypub.Context,
+		ID:                id,
+		Type:              "Person",
+		PreferredUsername: profile.Username,
+		Name:              profile.Username,
+		Summary:           html.EscapeString(profile.Tagline),
+		URL:               UserURL(profile.URL),
+		Icon:              &activitypub.Image{Type: "Image", URL: profile.AvatarURL},
+		Inbox:             URLForInbox(f.conf.BaseURL, user.Username),
+		Outbox:            URLForOutbox(f.conf.BaseURL, user.Username),
+		PublicKey: activitypub.PublicKey{
+			ID:           id + "#main-key",
+			Owner:        id,
+			PublicKeyPem: publicKey,
+		},
+	}, nil
+}
+
+// Note returns the Note of a twt the user posted, mentioning the actors in
+// mentioned (the urls of synthetic feeds of mentioned actors)
+func (f *Federation) Note(user *User, twt types.Twt, mentioned []string) activitypub.Note {
+	id := URLForTwt(f.conf.BaseURL, twt.Hash())
+
+	note := activitypub.Note{
+		ID:           id,
+		Type:         "Note",
+		AttributedTo: URLForActor(f.conf.BaseURL, user.Username),
+		Content:      twt.FormatText(types.HTMLFmt, f.conf),
+		URL:          id,
+		Published:    twt.Created().UTC(),
+		To:           []string{activitypub.Public},
+	}
+
+	for _, m := range twt.Mentions() {
+		twter := m.Twter()
+		for _, actor := range mentioned {
+			if twter.URL == actor {
+				note.Cc = append(note.Cc, actor)
+				note.Tag = append(note.Tag, activitypub.Tag{Type: "Mention", Href: actor, Name: "@" + twter.Nick})
+			}
+		}
+	}
+
+	return note
+}
+
+// Federate delivers a twt the user posted as a Note to the inboxes of their
+// followers on the fediverse and of the actors it mentions
+func (f *Federation) Federate(cache *Cache, user *User, twt types.Twt) {
+	if f == nil || twt.IsZero() {
+		return
+	}
+
+	var inboxes, mentioned []string
+	for _, inbox := range user.Inboxes {
+		inboxes = append(inboxes, inbox)
+	}
+	for _, m := range twt.Mentions() {
+		if twter := m.Twter(); cache.IsSynthetic(twter.URL) {
+			actor, err := f.client.FetchActor(twter.URL)
+			if err != nil {
+				log.WithError(err).Warnf("error fetching mentioned actor %s", twter.URL)
+				continue
+			}
+			mentioned = append(mentioned, actor.ID)
+			inboxes = append(inboxes, actor.SharedInbox())
+		}
+	}
+	if len(inboxes) == 0 {
+		return
+	}
+
+	signer, err := f.Signer(user.Username)
+	if err != nil {
+		log.WithError(err).Errorf("error loading key of %s", user.Username)
+		return
+	}
+
+	note := f.Note(user, twt, mentioned)
+	create, err := activitypub.NewActivity("Create", note.ID+"#create", note.AttributedTo, note)
+	if err != nil {
+		log.WithError(err).Errorf("error creating activity for twt %s", twt.Hash())
+		return
+	}
+	create.To, create.Cc = note.To, note.Cc
+
+	for _, inbox := range UniqStrings(inboxes) {
+		if err := f.deliverer.Deliver(inbox, create, signer); err != nil {
+			log.WithError(err).Warnf("error delivering twt %s to %s", twt.Hash(), inbox)
+		}
+	}
+}
+
+// followActivity returns the Follow activity of the user following actor, its
+// id is stable so that the follow can later be undone
+func (f *Federation) followActivity(user *User, actor string) (*activitypub.Activity, error) {
+	id := URLForActor(f.conf.BaseURL, user.Username)
+	return activitypub.NewActivity("Follow", fmt.Sprintf("%s#follows/%s", id, FastHash(actor)), id, actor)
+}
+
+// Follow follows the fediverse account of the given handle (nick@domain) on
+// behalf of the user and returns the nick the user follows it as. The notes
+// of the account are pushed to a synthetic feed in the cache.
+func (f *Federation) Follow(cache *Cache, user *User, handle string) (string, error) {
+	actor, err := f.client.LookupActor(handle)
+	if err != nil {
+		return "", err
+	}
+
+	if user.Follows(actor.ID) {
+		return "", ErrAlreadyFollows
+	}
+
+	signer, err := f.Signer(user.Username)
+	if err != nil {
+		return "", err
+	}
+
+	follow, err := f.followActivity(user, actor.ID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := f.deliverer.Deliver(actor.Inbox, follow, signer); err != nil {
+		return "", err
+	}
+
+	twter := actorTwter(actor)
+	user.Follow(twter.Nick, actor.ID)
+	cache.AddSyntheticFeed(actor.ID, twter)
+
+	return twter.Nick, nil
+}
+
+// Unfollow undoes the user following the actor url
+func (f *Federation) Unfollow(user *User, url string) error {
+	actor, err := f.client.FetchActor(url)
+	if err != nil {
+		return err
+	}
+
+	signer, err := f.Signer(user.Username)
+	if err != nil {
+		return err
+	}
+
+	follow, err := f.followActivity(user, actor.ID)
+	if err != nil {
+		return err
+	}
+
+	undo, err := activitypub.NewActivity("Undo", follow.ID+"/undo", follow.Actor, follow)
+	if err != nil {
+		return err
+	}
+
+	return f.deliverer.Deliver(actor.Inbox, undo, signer)
+}
+
+// Receive processes an activity delivered to the inbox of the user and
+// signed by the actor (the id of the actor)
+func (f *Federation) Receive(db Store, cache *Cache, archive Archiver, user *User, actorID string, activity *activitypub.Activity) error {
+	if activity.Actor != actorID {
+		return ErrInvalidActivity
+	}
+
+	actor, err := f.client.FetchActor(actorID)
+	if err != nil {
+		return err
+	}
+
+	id := URLForActor(f.conf.BaseURL, user.Username)
+
+	switch activity.Type {
+	case "Follow":
+		if activity.ObjectID() != id {
+			return ErrInvalidActivity
+		}
+
+		user.AddFollower(actorTwter(actor).Nick, actor.ID)
+		user.Inboxes[actor.ID] = actor.SharedInbox()
+		if err := db.SetUser(user.Username, user); err != nil {
+			return err
+		}
+
+		signer, err := f.Signer(user.Username)
+		if err != nil {
+			return err
+		}
+
+		accept, err := activitypub.NewActivity(
+			"Accept", fmt.Sprintf("%s#accepts/%s", id, FastHash(activity.ID)), id, activity,
+		)
+		if err != nil {
+			return err
+		}
+
+		log.Infof("%s followed by %s", user.Username, actor.ID)
+		return f.deliverer.Deliver(actor.Inbox, accept, signer)
+	case "Undo":
+		follow, err := activity.Activity()
+		if err != nil || follow.Type != "Follow" {
+			log.Debugf("ignoring undo of %s by %s", activity.ObjectID(), actor.ID)
+			return nil
+		}
+		if follow.Actor != actor.ID || follow.ObjectID() != id {
+			return ErrInvalidActivity
+		}
+
+		delete(user.Followers, actorTwter(actor).Nick)
+		delete(user.Inboxes, actor.ID)
+		log.Infof("%s unfollowed by %s", user.Username, actor.ID)
+		return db.SetUser(user.Username, user)
+	case "Accept":
+		log.Infof("%s accepted follow by %s", actor.ID, user.Username)
+		return nil
+	case "Create":
+		note, err := activity.Note()
+		if err != nil {
+			log.Debugf("ignoring create of %s by %s", activity.ObjectID(), actor.ID)
+			return nil
+		}
+		if note.AttributedTo != actor.ID {
+			return ErrInvalidActivity
+		}
+
+		if !user.Follows(actor.ID) {
+			log.Debugf("ignoring note %s from %s not followed by %s", note.ID, actor.ID, user.Username)
+			return nil
+		}
+
+		twt := f.noteTwt(db, actor, note)
+		if twt.IsZero() {
+			return ErrInvalidActivity
+		}
+		cache.PushTwts(f.conf, archive, actor.ID, twt)
+		return nil
+	default:
+		log.Debugf("ignoring %s activity from %s", activity.Type, actor.ID)
+		return nil
+	}
+}
+
+// noteTwt returns the twt of a note by actor, replies to twts on the pod are
+// replies to them (twts) in turn and mentions of local users mentions of them
+func (f *Federation) noteTwt(db Store, actor *activitypub.Actor, note *activitypub.Note) types.Twt {
+	text := noteText(note.Content, func(href string) string {
+		prefix := URLForActor(f.conf.BaseURL, "")
+		if !strings.HasPrefix(href, prefix) {
+			prefix = UserURL(URLForUser(f.conf.BaseURL, ""))
+		}
+		if !strings.HasPrefix(href, prefix) {
+			return ""
+		}
+
+		username := NormalizeUsername(strings.Split(strings.TrimPrefix(href, prefix), "/")[0])
+		if !db.HasUser(username) {
+			return ""
+		}
+		return fmt.Sprintf("@<%s %s>", username, URLForUser(f.conf.BaseURL, username))
+	})
+
+	if prefix := URLForTwt(f.conf.BaseURL, ""); strings.HasPrefix(note.InReplyTo, prefix) {
+		text = fmt.Sprintf("(#%s) %s", strings.TrimPrefix(note.InReplyTo, prefix), text)
+	}
+
+	return types.MakeTwt(actorTwter(actor), note.Published, text)
+}
+
+// actorTwter returns the twter of an actor, its nick is the actor's handle
+func actorTwter(actor *activitypub.Actor) types.Twter {
+	nick := actor.PreferredUsername
+	if u, err := url.Parse(actor.ID); err == nil {
+		nick = fmt.Sprintf("%s@%s", nick, u.Host)
+	}
+
+	twter := types.Twter{Nick: nick, URL: actor.ID}
+	if actor.Icon != nil {
+		twter.Avatar = actor.Icon.URL
+	}
+	return twter
+}
+
+// noteText converts the HTML content of a note to the text of a twt, line
+// breaks and paragraphs become line separators (U+2028) and links their url.
+// Links to mentioned accounts are replaced by mention(href) unless empty.
+func noteText(content string, mention func(href string) string) string {
+	nodes, err := xhtml.ParseFragment(
+		strings.NewReader(content),
+		&xhtml.Node{Type: xhtml.ElementNode, Data: "div", DataAtom: atom.Div},
+	)
+	if err != nil {
+		return ""
+	}
+
+	attr := func(node *xhtml.Node, name string) string {
+		for _, a := range node.Attr {
+			if a.Key == name {
+				return a.Val
+			}
+		}
+		return ""
+	}
+
+	var b strings.Builder
+
+	var walk func(node *xhtml.Node)
+	walk = func(node *xhtml.Node) {
+		switch {
+		case node.Type == xhtml.TextNode:
+			b.WriteString(noteSpaceRe.ReplaceAllString(node.Data, " "))
+			return
+		case node.DataAtom == atom.Br:
+			b.WriteString("\u2028")
+			return
+		case node.DataAtom == atom.A:
+			href, class := attr(node, "href"), strings.Fields(attr(node, "class"))
+			switch {
+			case HasString(class, "hashtag"):
+			case HasString(class, "mention"):
+				if m := mention(href); m != "" {
+					b.WriteString(m)
+					return
+				}
+			case href != "":
+				b.WriteString(href)
+				return
+			}
+		}
+
+		if node.DataAtom == atom.P && b.Len() > 0 {
+			b.WriteString("\u2028\u2028")
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+
+	for _, node := range nodes {
+		walk(node)
+	}
+
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jointwt/twtxt/internal/activitypub"
+)
+
+func TestNoteText(t *testing.T) {
+	mention := func(href string) string {
+		if href == "https://example.com/user/alice" {
+			return "@<alice https://example.com/user/alice/twtxt.txt>"
+		}
+		return ""
+	}
+
+	testCases := []struct {
+		content  string
+		expected string
+	}{
+		{
+			content:  `<p>Hello World!</p>`,
+			expected: "Hello World!",
+		},
+		{
+			content:  "<p>Hello\n  World!</p><p>Second<br>line</p>",
+			expected: "Hello World!  Second line",
+		},
+		{
+			content:  `<p>See <a href="https://example.org/some/page" rel="nofollow"><span class="invisible">https://</span>example.org/some/page</a></p>`,
+			expected: "See https://example.org/some/page",
+		},
+		{
+			content:  `<p><a href="https://mastodon.social/tags/twtxt" class="mention hashtag" rel="tag">#<span>twtxt</span></a> rocks</p>`,
+			expected: "#twtxt rocks",
+		},
+		{
+			content:  `<p><span class="h-card"><a href="https://example.com/user/alice" class="u-url mention">@<span>alice</span></a></span> hi</p>`,
+			expected: "@<alice https://example.com/user/alice/twtxt.txt> hi",
+		},
+		{
+			content:  `<p><span class="h-card"><a href="https://mastodon.social/@bob" class="u-url mention">@<span>bob</span></a></span> hi</p>`,
+			expected: "@bob hi",
+		},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, noteText(testCase.content, mention))
+	}
+}
+
+func TestActorTwter(t *testing.T) {
+	actor := &activitypub.Actor{
+		ID:                "https://mastodon.social/users/bob",
+		PreferredUsername: "bob",
+		Icon:              &activitypub.Image{Type: "Image", URL: "https://mastodon.social/avatars/bob.png"},
+	}
+
+	twter := actorTwter(actor)
+	assert.Equal(t, "bob@mastodon.social", twter.Nick)
+	assert.Equal(t, actor.ID, twter.URL)
+	assert.Equal(t, actor.Icon.URL, twter.Avatar)
+}
@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jointwt/twtxt/internal/backoff"
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// feedBackoffMin is the delay before re-fetching a feed after its first
+	// consecutive failure, doubling with each further failure
+	feedBackoffMin = 5 * time.Minute
+
+	// feedBackoffMax is the longest a failing feed is backed off for
+	feedBackoffMax = 24 * time.Hour
+)
+
+// FeedHealth records the outcome of fetching a remote feed so that failing
+// feeds can be backed off exponentially and reported to the pod operator.
+type FeedHealth struct {
+	URL  string
+	Nick string
+
+	LastFetch   time.Time
+	LastSuccess time.Time
+	LastError   string
+	LastStatus  int
+	Bytes       int64
+
+	// Failures is the number of consecutive failed fetches
+	Failures int
+
+	// NextFetch is when the feed will next be fetched if it is failing
+	NextFetch time.Time
+
+	// Disabled feeds are never fetched
+	Disabled bool
+}
+
+// Healthy returns true if the feed is enabled and its last fetch succeeded
+func (h *FeedHealth) Healthy() bool {
+	return !h.Disabled && h.Failures == 0
+}
+
+// feedBackoff returns how long to wait before re-fetching a feed that has
+// failed the given number of consecutive times
+func feedBackoff(failures int) time.Duration {
+	return backoff.Exponential(failures, feedBackoffMin, feedBackoffMax)
+}
+
+// shouldFetch returns false if the feed identified by url is disabled or
+// is failing and still backing off
+func (cache *Cache) shouldFetch(url string, now time.Time) bool {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	h, ok := cache.Health[url]
+	if !ok {
+		return true
+	}
+
+	return !h.Disabled && !now.Before(h.NextFetch)
+}
+
+// fetchedSince returns true if the feed identified by url was last fetched
+// successfully after t
+func (cache *Cache) fetchedSince(url string, t time.Time) bool {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	h, ok := cache.Health[url]
+	return ok && h.LastSuccess.After(t)
+}
+
+// recordFetch records the outcome of fetching the feed identified by url,
+// a non-nil err is a failure and backs the feed off further.
+func (cache *Cache) recordFetch(url, nick string, status int, n int64, err error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	h, ok := cache.Health[url]
+	if !ok {
+		h = &FeedHealth{URL: url}
+		cache.Health[url] = h
+	}
+
+	now := time.Now()
+
+	h.Nick = nick
+	h.LastFetch = now
+	h.LastStatus = status
+
+	if err != nil {
+		h.Failures++
+		h.LastError = err.Error()
+		h.NextFetch = now.Add(feedBackoff(h.Failures))
+		return
+	}
+
+	h.Failures = 0
+	h.LastError = ""
+	h.LastSuccess = now
+	h.NextFetch = time.Time{}
+	if n > 0 {
+		h.Bytes = n
+	}
+}
+
+// GetFeedHealth returns a copy of the health records of all remote feeds,
+// or only those that are failing or disabled, the least healthy first.
+func (cache *Cache) GetFeedHealth(unhealthyOnly bool) []FeedHealth {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	var res []FeedHealth
+	for _, h := range cache.Health {
+		if unhealthyOnly && h.Healthy() {
+			continue
+		}
+		res = append(res, *h)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Failures != res[j].Failures {
+			return res[i].Failures > res[j].Failures
+		}
+		return res[i].URL < res[j].URL
+	})
+
+	return res
+}
+
+// LookupFeedHealth returns a copy of the health record of the feed
+// identified by url
+func (cache *Cache) LookupFeedHealth(url string) (FeedHealth, bool) {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	h, ok := cache.Health[url]
+	if !ok {
+		return FeedHealth{}, false
+	}
+	return *h, true
+}
+
+// ResetFeedBackoff clears the backoff of the feed identified by url so it
+// is fetched again on the next update
+func (cache *Cache) ResetFeedBackoff(url string) bool {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	h, ok := cache.Health[url]
+	if ok {
+		h.NextFetch = time.Time{}
+	}
+	return ok
+}
+
+// DisableFeed stops (or resumes) fetching the feed identified by url
+func (cache *Cache) DisableFeed(url string, disabled bool) bool {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	h, ok := cache.Health[url]
+	if ok {
+		h.Disabled = disabled
+		h.NextFetch = time.Time{}
+	}
+	return ok
+}
+
+// pruneFeedHealth removes the health records of feeds no longer in feeds,
+// e.g: feeds that are no longer followed by anyone
+func (cache *Cache) pruneFeedHealth(feeds types.Feeds) {
+	urls := make(map[string]bool)
+	for feed := range feeds {
+		urls[feed.URL] = true
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for url := range cache.Health {
+		if !urls[url] {
+			delete(cache.Health, url)
+		}
+	}
+}
+
+// Response returns the representation of the feed's health used by the API
+func (h *FeedHealth) Response() types.FeedHealth {
+	return types.FeedHealth{
+		URL:         h.URL,
+		Nick:        h.Nick,
+		Healthy:     h.Healthy(),
+		LastFetch:   h.LastFetch,
+		LastSuccess: h.LastSuccess,
+		LastError:   h.LastError,
+		LastStatus:  h.LastStatus,
+		Bytes:       h.Bytes,
+		Failures:    h.Failures,
+		NextFetch:   h.NextFetch,
+		Disabled:    h.Disabled,
+	}
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+func TestFeedBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(time.Duration(0), feedBackoff(0))
+	assert.Equal(5*time.Minute, feedBackoff(1))
+	assert.Equal(10*time.Minute, feedBackoff(2))
+	assert.Equal(40*time.Minute, feedBackoff(4))
+	assert.Equal(feedBackoffMax, feedBackoff(20))
+	assert.Equal(feedBackoffMax, feedBackoff(1000))
+}
+
+func TestFeedHealth(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cache, err := LoadCache(t.TempDir())
+	require.NoError(err)
+
+	const (
+		good = "https://example.com/twtxt.txt"
+		bad  = "https://example.org/twtxt.txt"
+	)
+
+	cache.recordFetch(good, "good", 200, 1024, nil)
+	cache.recordFetch(bad, "bad", 404, 0, errors.New("unexpected status: 404 Not Found"))
+	cache.recordFetch(bad, "bad", 404, 0, errors.New("unexpected status: 404 Not Found"))
+
+	now := time.Now()
+	assert.True(cache.shouldFetch(good, now))
+	assert.False(cache.shouldFetch(bad, now))
+	assert.True(cache.shouldFetch(bad, now.Add(feedBackoff(2))))
+
+	unhealthy := cache.GetFeedHealth(true)
+	require.Len(unhealthy, 1)
+	assert.Equal(bad, unhealthy[0].URL)
+	assert.Equal(2, unhealthy[0].Failures)
+	assert.Equal(404, unhealthy[0].LastStatus)
+	assert.True(unhealthy[0].LastSuccess.IsZero())
+	assert.Len(cache.GetFeedHealth(false), 2)
+
+	assert.True(cache.ResetFeedBackoff(bad))
+	assert.True(cache.shouldFetch(bad, now))
+
+	assert.True(cache.DisableFeed(good, true))
+	assert.False(cache.shouldFetch(good, now))
+	assert.Len(cache.GetFeedHealth(true), 2)
+	assert.False(cache.DisableFeed("https://example.net/twtxt.txt", true))
+
+	cache.recordFetch(bad, "bad", 200, 512, nil)
+	health, ok := cache.LookupFeedHealth(bad)
+	require.True(ok)
+	assert.Equal(0, health.Failures)
+	assert.Equal(int64(512), health.Bytes)
+
+	cache.pruneFeedHealth(types.Feeds{types.Feed{Nick: "good", URL: good}: true})
+	_, ok = cache.LookupFeedHealth(bad)
+	assert.False(ok)
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vcraescu/go-paginator/adapter"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+// feedHistoryAdapter is a paginator adapter over the entire history of a
+// feed. Pages are served from the feed's cached twts first and then from
+// its archived twts that are older than the oldest cached twt, so paging
+// continues seamlessly past MaxCacheTTL/MaxCacheItems.
+type feedHistoryAdapter struct {
+	cached   types.Twts
+	archived *ArchiveIterator
+}
+
+// NewFeedHistoryAdapter returns a paginator adapter over the cached and
+// archived twts of the feed identified by url.
+func NewFeedHistoryAdapter(cache *Cache, archive Archiver, url string) adapter.Adapter {
+	cached := cache.GetByURL(url)
+
+	var before time.Time
+	if len(cached) > 0 {
+		before = cached[len(cached)-1].Created()
+	}
+
+	archived, err := archive.IterByURL(url, before)
+	if err != nil {
+		log.WithError(err).Errorf("error iterating archived twts for %s", url)
+		archived = NewArchiveIterator(archive, nil)
+	}
+
+	return &feedHistoryAdapter{cached: cached, archived: archived}
+}
+
+// Nums returns the total number of twts in the feed's history
+func (a *feedHistoryAdapter) Nums() int64 {
+	return int64(len(a.cached) + a.archived.Len())
+}
+
+// Slice stores into data the twts of the feed's history in
+// [offset, offset+length), data must be a pointer to types.Twts.
+func (a *feedHistoryAdapter) Slice(offset, length int, data interface{}) error {
+	res, ok := data.(*types.Twts)
+	if !ok {
+		return fmt.Errorf("expected *types.Twts but got %T", data)
+	}
+
+	var twts types.Twts
+
+	if offset < len(a.cached) {
+		end := offset + length
+		if end > len(a.cached) {
+			end = len(a.cached)
+		}
+		twts = append(twts, a.cached[offset:end]...)
+		offset = 0
+	} else {
+		offset -= len(a.cached)
+	}
+
+	a.archived.Seek(offset)
+	for len(twts) < length {
+		twt, ok := a.archived.Next()
+		if !ok {
+			break
+		}
+		twts = append(twts, twt)
+	}
+
+	*res = twts
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vcraescu/go-paginator"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/lextwt"
+)
+
+func TestFeedHistoryAdapter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	alice := types.Twter{Nick: "alice", URL: "https://example.com/alice/twtxt.txt"}
+
+	archive, err := NewIndexedArchiver(filepath.Join(t.TempDir(), indexedArchiveDir))
+	require.NoError(err)
+	defer archive.Close()
+
+	// 10 twts, newest first, all archived and the newest 3 cached
+	var twts types.Twts
+	for i := 10; i > 0; i-- {
+		created := time.Date(2020, 12, i, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		twt, err := lextwt.ParseLine(fmt.Sprintf("%s\tTwt %d", created, i), alice)
+		require.NoError(err)
+		require.NoError(archive.Archive(twt))
+		twts = append(twts, twt)
+	}
+
+	cache := &Cache{Twts: map[string]*Cached{alice.URL: {Twts: twts[:3]}}}
+
+	pager := paginator.New(NewFeedHistoryAdapter(cache, archive, alice.URL), 4)
+	assert.Equal(int64(10), pager.Nums())
+
+	var paged types.Twts
+
+	// Page spanning the cache and the archive
+	pager.SetPage(1)
+	require.NoError(pager.Results(&paged))
+	require.Len(paged, 4)
+	for i, twt := range paged {
+		assert.Equal(twts[i].Hash(), twt.Hash())
+	}
+
+	// Page entirely from the archive
+	pager.SetPage(3)
+	require.NoError(pager.Results(&paged))
+	require.Len(paged, 2)
+	assert.Equal(twts[8].Hash(), paged[0].Hash())
+	assert.Equal(twts[9].Hash(), paged[1].Hash())
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/lextwt"
+)
+
+// maxArchivedFeeds is the most archived feeds (`# prev = <hash> <url>`)
+// followed when fetching a feed
+const maxArchivedFeeds = 10
+
+// externalAvatar downloads the avatar declared by the external feed uri
+// (`# avatar = <url>`) unless it is the one last downloaded (declared) and
+// returns the avatar declared. Feeds that declare no avatar fall back to
+// looking for one alongside the feed.
+func externalAvatar(conf *Config, uri string, info types.Info, declared string) string {
+	v, ok := info.GetN("avatar", 0)
+	if !ok {
+		GetExternalAvatar(conf, "", uri)
+		return ""
+	}
+
+	source := lextwt.ResolveURL(uri, v.Value())
+	if source == declared && HasExternalAvatar(conf, uri) {
+		return declared
+	}
+
+	if err := DownloadExternalAvatar(conf, uri, source); err != nil {
+		log.WithError(err).Warnf("error downloading avatar %s of feed %s", source, uri)
+		return declared
+	}
+
+	return source
+}
+
+// fetchArchivedFeeds follows the `# prev = <hash> <url>` links of the feed
+// uri (with twter and metadata info) to its archived feeds and archives
+// their twts. Archived feeds never change so the links are followed only
+// as far as the archived feed followed last time (followed). The url of the
+// latest archived feed is returned, or followed if one could not be fetched.
+func (cache *Cache) fetchArchivedFeeds(conf *Config, archive Archiver, uri string, twter types.Twter, info types.Info, followed string) string {
+	var latest string
+
+	base := uri
+	for i := 0; ; i++ {
+		v, ok := info.GetN("prev", 0)
+		if !ok {
+			break
+		}
+
+		sp := strings.Fields(v.Value())
+		if len(sp) != 2 {
+			log.Warnf("invalid archived feed %q of %s", v.Value(), uri)
+			break
+		}
+		prev := lextwt.ResolveURL(base, sp[1])
+
+		if latest == "" {
+			latest = prev
+		}
+		if prev == followed {
+			break
+		}
+		if i == maxArchivedFeeds {
+			log.Warnf("not following more than %d archived feeds of %s", maxArchivedFeeds, uri)
+			break
+		}
+
+		twtFile, err := fetchArchivedFeed(conf, prev, twter)
+		if err != nil {
+			log.WithError(err).Errorf("error fetching archived feed %s of %s", prev, uri)
+			return followed
+		}
+
+		for _, twt := range twtFile.Twts() {
+			if archive.Has(twt.Hash()) {
+				continue
+			}
+			if err := archive.Archive(twt); err != nil {
+				log.WithError(err).Errorf("error archiving twt %s", twt.Hash())
+				metrics.Counter("archive", "error").Inc()
+				return followed
+			}
+			metrics.Counter("archive", "size").Inc()
+		}
+
+		base, info = prev, twtFile.Info()
+	}
+
+	if latest == "" {
+		return followed
+	}
+	return latest
+}
+
+// fetchArchivedFeed fetches and parses the archived feed at uri
+func fetchArchivedFeed(conf *Config, uri string, twter types.Twter) (types.TwtFile, error) {
+	res, err := Request(conf, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	return types.ParseFile(io.LimitReader(res.Body, conf.MaxFetchLimit), twter)
+}
@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// archivedFeedPrefix and archivedFeedExt make up the name of an archived
+	// feed (twtxt-<hash>.txt) as served alongside the feed it was rotated from
+	archivedFeedPrefix = "twtxt-"
+	archivedFeedExt    = ".txt"
+)
+
+var (
+	validArchivedFeedHash = regexp.MustCompile(`^[a-z0-9]+$`)
+
+	errNothingToRotate = errors.New("error: nothing to rotate")
+)
+
+// archivedFeedName returns the name of the archived feed whose last twt has
+// the given hash as served under /user/:nick/ and linked with `# prev`
+func archivedFeedName(hash string) string {
+	return archivedFeedPrefix + hash + archivedFeedExt
+}
+
+// archivedFeedPath returns the path of the archived feed of the feed file fn
+// whose last twt has the given hash, which is stored alongside the feed
+func archivedFeedPath(fn, hash string) string {
+	return fn + "." + archivedFeedName(hash)
+}
+
+// splitRotatedFeed returns the index of the first of lines (the twts of a
+// feed after its header) to keep in the feed when rotating it, all of the
+// lines before it being moved into an archived feed. The newest twts are kept
+// as long as they are younger than conf.MaxFeedAge and take up no more than
+// half of conf.MaxFeedSize, so the feed isn't rotated again right away.
+func splitRotatedFeed(conf *Config, lines []string, twter types.Twter, force bool) int {
+	if force {
+		return len(lines)
+	}
+
+	var cutoff time.Time
+	if conf.MaxFeedAge > 0 {
+		cutoff = time.Now().Add(-conf.MaxFeedAge)
+	}
+
+	var (
+		size int64
+		old  bool
+	)
+	for _, line := range lines {
+		size += int64(len(line)) + 1
+		if twt, err := types.ParseLine(line, twter); err == nil && !cutoff.IsZero() && twt.Created().Before(cutoff) {
+			old = true
+		}
+	}
+
+	if !old && (conf.MaxFeedSize <= 0 || size <= conf.MaxFeedSize) {
+		return 0
+	}
+
+	split, kept := len(lines), int64(0)
+	for i := len(lines) - 1; i >= 0; i-- {
+		twt, err := types.ParseLine(lines[i], twter)
+		if err == nil && !twt.IsZero() {
+			if !cutoff.IsZero() && twt.Created().Before(cutoff) {
+				break
+			}
+			if conf.MaxFeedSize > 0 && kept+int64(len(lines[i]))+1 > conf.MaxFeedSize/2 {
+				break
+			}
+		}
+		kept += int64(len(lines[i])) + 1
+		split = i
+	}
+
+	return split
+}
+
+// RotateFeed moves the older twts of the local feed name into an archived
+// feed stored alongside it and served as /user/<name>/twtxt-<hash>.txt (hash
+// being the hash of its last twt), and links to it from the feed with a
+// `# prev = <hash> twtxt-<hash>.txt` record. The feed's previous `# prev`
+// record (if any) moves into the archived feed so that all of the archived
+// feeds form a chain that clients can follow back in time.
+//
+// The feed is only rotated once it is larger than conf.MaxFeedSize or has
+// twts older than conf.MaxFeedAge, unless force is true in which case all of
+// its twts are archived (e.g: when archiving a feed). Returns the hash of the
+// archived feed's last twt or an empty string if nothing was rotated.
+func RotateFeed(conf *Config, name string, force bool) (string, error) {
+	fn := filepath.Join(conf.Data, feedsDir, name)
+	twter := types.Twter{Nick: name, URL: URLForUser(conf.BaseURL, name)}
+
+	hash := ""
+	err := rewriteFeed(conf, name, func(lines []string) ([]string, error) {
+		// The header is the feed's leading metadata (and blank lines) which
+		// stays in the feed, new records are added after its last comment
+		header, records := 0, 0
+		for header < len(lines) && (lines[header] == "" || strings.HasPrefix(lines[header], "#")) {
+			if lines[header] != "" {
+				records = header + 1
+			}
+			header++
+		}
+
+		body := lines[header:]
+		split := splitRotatedFeed(conf, body, twter, force)
+
+		var last types.Twt
+		for _, line := range body[:split] {
+			if twt, err := types.ParseLine(line, twter); err == nil && !twt.IsZero() {
+				last = twt
+			}
+		}
+		if last == nil {
+			return nil, errNothingToRotate
+		}
+		hash = last.Hash()
+
+		var res, prev []string
+		for i, line := range lines[:header] {
+			if i == records {
+				res = append(res, fmt.Sprintf("# prev = %s %s", hash, archivedFeedName(hash)))
+			}
+			if key, _, ok := feedRecord(line); ok && key == "prev" {
+				prev = append(prev, line)
+				continue
+			}
+			res = append(res, line)
+		}
+		if records == header {
+			res = append(res, fmt.Sprintf("# prev = %s %s", hash, archivedFeedName(hash)))
+		}
+		res = append(res, body[split:]...)
+
+		if err := writeFileAtomic(archivedFeedPath(fn, hash), func(w io.Writer) error {
+			if _, err := fmt.Fprintf(w, "# nick = %s\n# url = %s\n", twter.Nick, twter.URL); err != nil {
+				return err
+			}
+			for _, line := range prev {
+				if _, err := fmt.Fprintln(w, line); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+			for _, line := range body[:split] {
+				if strings.TrimSpace(line) == "" {
+					continue
+				}
+				if _, err := fmt.Fprintln(w, line); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+
+		return res, nil
+	})
+	if err == errNothingToRotate {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return hash, nil
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/lextwt"
+)
+
+func TestRotateFeed(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lextwt.DefaultTwtManager()
+
+	conf := &Config{Data: t.TempDir(), BaseURL: "http://0.0.0.0:8000", MaxFeedSize: 100}
+	user := &User{Username: "alice", URL: URLForUser(conf.BaseURL, "alice")}
+	fn := filepath.Join(conf.Data, feedsDir, user.Username)
+
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	var twts []types.Twt
+	appendTwts := func(n int) {
+		for i := 0; i < n; i++ {
+			twt, err := AppendTwt(conf, nil, user, fmt.Sprintf("Hello %d", len(twts)), created.Add(time.Duration(len(twts))*time.Hour))
+			require.NoError(err)
+			twts = append(twts, twt)
+		}
+	}
+
+	readFeed := func(fn string) types.TwtFile {
+		data, err := ioutil.ReadFile(fn)
+		require.NoError(err)
+		twtFile, err := types.ParseFile(strings.NewReader(string(data)), user.Twter())
+		require.NoError(err)
+		return twtFile
+	}
+
+	hashes := func(twtFile types.TwtFile) (res []string) {
+		for _, twt := range twtFile.Twts() {
+			res = append(res, twt.Hash())
+		}
+		return
+	}
+
+	prev := func(twtFile types.TwtFile) string {
+		v, ok := twtFile.Info().GetN("prev", 0)
+		if !ok {
+			return ""
+		}
+		return v.Value()
+	}
+
+	// Under the size limit
+	appendTwts(2)
+	hash, err := RotateFeed(conf, user.Username, false)
+	require.NoError(err)
+	assert.Empty(hash)
+
+	// Over the size limit only the newest twt is kept
+	appendTwts(2)
+	hash, err = RotateFeed(conf, user.Username, false)
+	require.NoError(err)
+	assert.Equal(twts[2].Hash(), hash)
+
+	feed := readFeed(fn)
+	assert.Equal([]string{twts[3].Hash()}, hashes(feed))
+	assert.Equal(fmt.Sprintf("%s twtxt-%s.txt", hash, hash), prev(feed))
+
+	archived := readFeed(archivedFeedPath(fn, hash))
+	assert.Equal([]string{twts[0].Hash(), twts[1].Hash(), twts[2].Hash()}, hashes(archived))
+	assert.Empty(prev(archived))
+
+	// Forced rotation archives all twts and chains the archived feeds
+	appendTwts(1)
+	last, err := RotateFeed(conf, user.Username, true)
+	require.NoError(err)
+	assert.Equal(twts[4].Hash(), last)
+
+	feed = readFeed(fn)
+	assert.Empty(hashes(feed))
+	assert.Equal(fmt.Sprintf("%s twtxt-%s.txt", last, last), prev(feed))
+
+	archived = readFeed(archivedFeedPath(fn, last))
+	assert.Equal([]string{twts[3].Hash(), twts[4].Hash()}, hashes(archived))
+	assert.Equal(fmt.Sprintf("%s twtxt-%s.txt", hash, hash), prev(archived))
+
+	// Nothing left to rotate and the `# prev` record is never truncated
+	last, err = RotateFeed(conf, user.Username, true)
+	require.NoError(err)
+	assert.Empty(last)
+	assert.Equal(ErrTwtNotFound, DeleteLastTwt(conf, user))
+}
+
+func TestIsPreambleTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isPreambleTemplate("# nick = {{ .Profile.Username }}\n# prev = abc twtxt-abc.txt"))
+	assert.False(isPreambleTemplate("# prev = abc twtxt-abc.txt\n# edit = abc def"))
+	assert.False(isPreambleTemplate("# prev = abc twtxt-abc.txt\n2021-01-01T00:00:00Z\tHello"))
+	assert.False(isPreambleTemplate(""))
+}
+
+func TestEditArchivedTwt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lextwt.DefaultTwtManager()
+
+	conf := &Config{Data: t.TempDir(), BaseURL: "http://0.0.0.0:8000"}
+	user := &User{Username: "alice", URL: URLForUser(conf.BaseURL, "alice")}
+	fn := filepath.Join(conf.Data, feedsDir, user.Username)
+
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	var twts []types.Twt
+	for i := 0; i < 3; i++ {
+		twt, err := AppendTwt(conf, nil, user, fmt.Sprintf("Hello %d", i), created.Add(time.Duration(i)*time.Hour))
+		require.NoError(err)
+		twts = append(twts, twt)
+	}
+
+	hash, err := RotateFeed(conf, user.Username, true)
+	require.NoError(err)
+	require.Equal(twts[2].Hash(), hash)
+
+	all, err := GetAllTwts(conf, user.Username)
+	require.NoError(err)
+	assert.Len(all, 3)
+
+	edited, err := EditTwt(conf, nil, user, twts[1].Hash(), "Hello edited")
+	require.NoError(err)
+	require.NoError(DeleteTwt(conf, user, twts[0].Hash()))
+	assert.Equal(ErrTwtNotFound, DeleteTwt(conf, user, twts[0].Hash()))
+
+	// The archived feed is edited in place and keeps its name
+	data, err := ioutil.ReadFile(archivedFeedPath(fn, hash))
+	require.NoError(err)
+	archived, err := types.ParseFile(strings.NewReader(string(data)), user.Twter())
+	require.NoError(err)
+
+	var hashes []string
+	for _, twt := range archived.Twts() {
+		hashes = append(hashes, twt.Hash())
+	}
+	assert.Equal([]string{edited.Hash(), twts[2].Hash()}, hashes)
+
+	// Whilst the records are added to the feed itself
+	data, err = ioutil.ReadFile(fn)
+	require.NoError(err)
+	feed, err := types.ParseFile(strings.NewReader(string(data)), user.Twter())
+	require.NoError(err)
+	assert.Equal([]types.Edit{
+		{Hash: twts[1].Hash(), Replacement: edited.Hash()},
+		{Hash: twts[0].Hash()},
+	}, feed.Info().Edits())
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/jointwt/twtxt"
 	"github.com/julienschmidt/httprouter"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/internal/activitypub"
 )
 
 // FollowHandler ...
@@ -27,6 +29,21 @@ func (s *Server) FollowHandler() httprouter.Handle {
 			return
 		}
 
+		// Handles (nick@domain) are resolved to their twtxt feed through
+		// WebFinger or the /user/:nick/twtxt.txt convention of twtxt pods
+		handle := strings.TrimSpace(r.FormValue("url"))
+		if activitypub.IsHandle(handle) {
+			handleNick, feed, err := ResolveHandleFallback(s.config, handle)
+			if err == nil {
+				url = feed
+				if nick == "" {
+					nick = handleNick
+				}
+			}
+		} else {
+			handle = ""
+		}
+
 		if nick == "" || url == "" {
 			ctx.Error = true
 			ctx.Message = s.tr(ctx, "ErrorNickOrURLEmpty")
@@ -43,6 +60,13 @@ func (s *Server) FollowHandler() httprouter.Handle {
 		trdata["Nick"] = nick
 		trdata["URL"] = url
 		if err := user.FollowAndValidate(s.config, nick, url); err != nil {
+			// Fediverse accounts without a twtxt feed are followed over
+			// ActivityPub instead
+			if handle != "" && err != ErrAlreadyFollows {
+				s.followHandle(ctx, w, handle)
+				return
+			}
+
 			ctx.Error = true
 			trdata["Error"] = err.Error()
 			ctx.Message = s.tr(ctx, "ErrorFollowAndValidate", trdata)
@@ -139,6 +163,51 @@ func (s *Server) FollowHandler() httprouter.Handle {
 	}
 }
 
+// followHandle follows the fediverse account of the given handle on behalf of
+// the user in the context
+func (s *Server) followHandle(ctx *Context, w http.ResponseWriter, handle string) {
+	user := ctx.User
+	if user == nil {
+		log.Fatalf("user not found in context")
+		return
+	}
+
+	trdata := map[string]interface{}{}
+	trdata["URL"] = handle
+
+	if federation == nil {
+		ctx.Error = true
+		trdata["Error"] = "ActivityPub is not enabled on this pod"
+		ctx.Message = s.tr(ctx, "ErrorFollowAndValidate", trdata)
+		s.render("error", w, ctx)
+		return
+	}
+
+	nick, err := federation.Follow(s.cache, user, handle)
+	if err != nil {
+		log.WithError(err).Warnf("error following %s", handle)
+		ctx.Error = true
+		trdata["Nick"] = handle
+		trdata["Error"] = err.Error()
+		ctx.Message = s.tr(ctx, "ErrorFollowAndValidate", trdata)
+		s.render("error", w, ctx)
+		return
+	}
+	trdata["Nick"] = nick
+
+	if err := s.db.SetUser(ctx.Username, user); err != nil {
+		ctx.Error = true
+		trdata["Error"] = err.Error()
+		ctx.Message = s.tr(ctx, "ErrorSetUser", trdata)
+		s.render("error", w, ctx)
+		return
+	}
+
+	ctx.Error = false
+	ctx.Message = s.tr(ctx, "MsgFollowUserSuccess", trdata)
+	s.render("error", w, ctx)
+}
+
 // ImportHandler ...
 func (s *Server) ImportHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -240,6 +309,12 @@ func (s *Server) UnfollowHandler() httprouter.Handle {
 			return
 		}
 
+		if s.cache.IsSynthetic(url) {
+			if err := federation.Unfollow(user, url); err != nil {
+				log.WithError(err).Warnf("error undoing follow of %s", url)
+			}
+		}
+
 		if strings.HasPrefix(url, s.config.BaseURL) {
 			url = UserURL(url)
 			nick := NormalizeUsername(filepath.Base(url))
@@ -32,6 +32,7 @@ import (
 	"github.com/vcraescu/go-paginator/adapter"
 	"gopkg.in/yaml.v2"
 
+	"github.com/jointwt/twtxt/internal/activitypub"
 	"github.com/jointwt/twtxt/internal/session"
 	"github.com/jointwt/twtxt/types"
 )
@@ -45,6 +46,7 @@ const (
 
 var (
 	ErrFeedImposter = errors.New("error: imposter detected, you do not own this feed")
+	ErrTwtNotFound  = errors.New("error: twt not found")
 )
 
 //go:embed pages/*.md
@@ -269,12 +271,13 @@ func (s *Server) ProfileHandler() httprouter.Handle {
 			},
 		}...)
 
-		twts := s.cache.GetByURL(profile.URL)
-
 		var pagedTwts types.Twts
 
 		page := SafeParseInt(r.FormValue("p"), 1)
-		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
+		pager := paginator.New(
+			NewFeedHistoryAdapter(s.cache, s.archive, profile.URL),
+			s.config.TwtsPerPage,
+		)
 		pager.SetPage(page)
 
 		if err := pager.Results(&pagedTwts); err != nil {
@@ -419,6 +422,16 @@ func (s *Server) ArchiveFeedHandler() httprouter.Handle {
 			return
 		}
 
+		// Archive all of the feed's twts so that the feed is left with
+		// only a `# prev` link to them (just as if it was rotated)
+		if _, err := RotateFeed(s.config, feed.Name, true); err != nil {
+			log.WithError(err).Errorf("error rotating feed %s", feed.Name)
+			ctx.Error = true
+			ctx.Message = "Error archiving feed"
+			s.render("error", w, ctx)
+			return
+		}
+
 		if err := DetachFeedFromOwner(s.db, ctx.User, feed); err != nil {
 			log.WithError(err).Warnf("Error detaching feed owner %s from feed %s", ctx.User.Username, feed.Name)
 			ctx.Error = true
@@ -575,50 +588,65 @@ func (s *Server) AvatarHandler() httprouter.Handle {
 
 // PostHandler ...
 func (s *Server) PostHandler() httprouter.Handle {
-	isLocalURL := IsLocalURLFactory(s.config)
-	isExternalFeed := IsExternalFeedFactory(s.config)
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		ctx := NewContext(s.config, s.db, r)
 
 		postas := strings.ToLower(strings.TrimSpace(r.FormValue("postas")))
+		hash := strings.TrimSpace(r.FormValue("hash"))
 
-		// TODO: Support deleting/patching last feed (`postas`) twt too.
-		if r.Method == http.MethodDelete || r.Method == http.MethodPatch {
-			if err := DeleteLastTwt(s.config, ctx.User); err != nil {
+		// Older clients DELETE/PATCH without a hash meaning the last twt
+		if hash == "" && (r.Method == http.MethodDelete || r.Method == http.MethodPatch) {
+			lastTwt, _, err := GetLastTwt(s.config, ctx.User)
+			if err != nil || lastTwt.IsZero() {
 				ctx.Error = true
 				ctx.Message = "Error deleting last twt"
 				s.render("error", w, ctx)
+				return
 			}
+			hash = lastTwt.Hash()
+		}
 
-			// Update user's own timeline with their own new post.
-			s.cache.FetchTwts(s.config, s.archive, ctx.User.Source(), nil)
-
-			// Re-populate/Warm cache with local twts for this pod
-			s.cache.GetByPrefix(s.config.BaseURL, true)
-
-			if r.Method != http.MethodDelete {
+		// Editing or deleting a twt requires it was posted by the user
+		// or one of the feeds they own.
+		var feed *User
+		if hash != "" {
+			twt, ok := s.cache.Lookup(hash)
+			if !ok && s.archive.Has(hash) {
+				twt, _ = s.archive.Get(hash)
+			}
+			if twt.IsZero() {
+				ctx.Error = true
+				ctx.Message = "No matching twt found!"
+				s.render("404", w, ctx)
 				return
 			}
-		}
 
-		hash := r.FormValue("hash")
-		lastTwt, _, err := GetLastTwt(s.config, ctx.User)
-		// log.Debugf("form.hash=%v,lastTwt.hash=%v", hash, lastTwt.Hash())
-		if err != nil {
-			ctx.Error = true
-			ctx.Message = "Error deleting last twt"
-			s.render("error", w, ctx)
-			return
+			var err error
+			if feed, err = TwtFeed(s.config, ctx.User, twt); err != nil {
+				log.WithError(err).Warnf("%s cannot edit or delete twt %s", ctx.Username, hash)
+				ctx.Error = true
+				ctx.Message = "You can only edit or delete your own twts"
+				s.render("error", w, ctx)
+				return
+			}
 		}
 
-		if hash != "" && lastTwt.Hash() == hash {
-			if err := DeleteLastTwt(s.config, ctx.User); err != nil {
+		if r.Method == http.MethodDelete {
+			if err := DeleteTwt(s.config, feed, hash); err != nil {
+				log.WithError(err).Errorf("error deleting twt %s", hash)
 				ctx.Error = true
-				ctx.Message = "Error deleting last twt"
+				ctx.Message = "Error deleting twt"
 				s.render("error", w, ctx)
+				return
 			}
-		} else {
-			log.Warnf("hash mismatch %s != %s", lastTwt.Hash(), hash)
+
+			// Update user's own timeline with the deletion.
+			s.cache.FetchTwts(s.config, s.archive, feed.Source(), nil)
+
+			// Re-populate/Warm cache with local twts for this pod
+			s.cache.GetByPrefix(s.config.BaseURL, true)
+
+			return
 		}
 
 		text := CleanTwt(r.FormValue("text"))
@@ -648,22 +676,42 @@ func (s *Server) PostHandler() httprouter.Handle {
 			return
 		}
 
-		var twt types.Twt = types.NilTwt
+		postAt, err := ParsePostAt(r.FormValue("postat"), user.DisplayDatesInTimezone)
+		if err != nil {
+			log.WithError(err).Warnf("error parsing scheduled time for %s", ctx.Username)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorInvalidPostAt")
+			s.render("error", w, ctx)
+			return
+		}
 
-		switch postas {
-		case "", user.Username:
-			if hash != "" && lastTwt.Hash() == hash {
-				twt, err = AppendTwt(s.config, s.db, user, text, lastTwt.Created())
-			} else {
-				twt, err = AppendTwt(s.config, s.db, user, text)
+		if !postAt.IsZero() && feed == nil {
+			if _, err := ScheduleTwt(s.db, user, postas, text, postAt); err != nil {
+				log.WithError(err).Errorf("error scheduling twt for %s", ctx.Username)
+				ctx.Error = true
+				if err == ErrInvalidPostAt {
+					ctx.Message = s.tr(ctx, "ErrorInvalidPostAt")
+				} else {
+					ctx.Message = s.tr(ctx, "ErrorScheduleTwt")
+				}
+				s.render("error", w, ctx)
+				return
 			}
+
+			http.Redirect(w, r, "/scheduled", http.StatusFound)
+			return
+		}
+
+		var twt types.Twt = types.NilTwt
+
+		switch {
+		case feed != nil:
+			twt, err = EditTwt(s.config, s.db, feed, hash, text)
+		case postas == "" || postas == user.Username:
+			twt, err = AppendTwt(s.config, s.db, user, text)
 		default:
 			if user.OwnsFeed(postas) {
-				if hash != "" && lastTwt.Hash() == hash {
-					twt, err = AppendSpecial(s.config, s.db, postas, text, lastTwt.Created)
-				} else {
-					twt, err = AppendSpecial(s.config, s.db, postas, text)
-				}
+				twt, err = AppendSpecial(s.config, s.db, postas, text)
 			} else {
 				err = ErrFeedImposter
 			}
@@ -677,21 +725,23 @@ func (s *Server) PostHandler() httprouter.Handle {
 			return
 		}
 
+		source := user.Source()
+		if feed != nil {
+			source = feed.Source()
+		}
+
 		// Update user's own timeline with their own new post.
-		s.cache.FetchTwts(s.config, s.archive, user.Source(), nil)
+		s.cache.FetchTwts(s.config, s.archive, source, nil)
 
 		// Re-populate/Warm cache with local twts for this pod
 		s.cache.GetByPrefix(s.config.BaseURL, true)
 
-		// WebMentions ...
-		for _, m := range twt.Mentions() {
-			twter := m.Twter()
-			if !isLocalURL(twter.URL) || isExternalFeed(twter.URL) {
-				if err := WebMention(twter.URL, URLForTwt(s.config.BaseURL, twt.Hash())); err != nil {
-					log.WithError(err).Warnf("error sending webmention to %s", twter.URL)
-				}
-			}
+		// WebMentions and ActivityPub (of twts posted as the user) ...
+		var federated *User
+		if feed == nil && (postas == "" || postas == user.Username) {
+			federated = user
 		}
+		publishSideEffects(s.config, s.cache, federated, twt)
 
 		http.Redirect(w, r, RedirectRefererURL(r, s.config, "/"), http.StatusFound)
 	}
@@ -788,6 +838,18 @@ func (s *Server) PermalinkHandler() httprouter.Handle {
 			return
 		}
 
+		// Redirect edited twts to their latest version or show a tombstone
+		if latest, deleted, ok := s.cache.Redirect(hash); ok {
+			if deleted {
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorTwtDeleted")
+				s.render("error", w, ctx)
+				return
+			}
+			http.Redirect(w, r, URLForTwt(s.config.BaseURL, latest), http.StatusMovedPermanently)
+			return
+		}
+
 		var err error
 
 		twt, ok := s.cache.Lookup(hash)
@@ -969,32 +1031,23 @@ func (s *Server) SearchHandler() httprouter.Handle {
 		ctx := NewContext(s.config, s.db, r)
 		ctx.Translate(s.translator)
 
-		var twts types.Twts
-
-		tag := r.URL.Query().Get("tag")
+		q := strings.TrimSpace(r.FormValue("q"))
 
-		if tag == "" {
-			ctx.Error = true
-			ctx.Message = "At least search query is required"
-			s.render("error", w, ctx)
+		// Support the older ?tag= form used by tag links
+		if tag := strings.TrimSpace(r.FormValue("tag")); tag != "" && q == "" {
+			q = fmt.Sprintf("#%s", strings.TrimPrefix(tag, "#"))
 		}
 
-		getTweetsByTag := func() types.Twts {
-			var result types.Twts
-			seen := make(map[string]bool)
-			// TODO: Improve this by making this an O(1) lookup on the tag
-			for _, twt := range s.cache.GetAll() {
-				var tags types.TagList = twt.Tags()
-				if HasString(UniqStrings(tags.Tags()), tag) && !seen[twt.Hash()] {
-					result = append(result, twt)
-					seen[twt.Hash()] = true
-				}
-			}
-			return result
+		ctx.Title = s.tr(ctx, "PageSearchTitle")
+		ctx.SearchQuery = q
+
+		query := ParseSearchQuery(q)
+		if query.IsZero() {
+			s.render("search", w, ctx)
+			return
 		}
 
-		twts = getTweetsByTag()
-		sort.Sort(twts)
+		twts := s.cache.Search(s.archive, query)
 
 		var pagedTwts types.Twts
 
@@ -1012,7 +1065,7 @@ func (s *Server) SearchHandler() httprouter.Handle {
 		ctx.Twts = FilterTwts(ctx.User, pagedTwts)
 		ctx.Pager = &pager
 
-		s.render("timeline", w, ctx)
+		s.render("search", w, ctx)
 	}
 }
 
@@ -1107,6 +1160,9 @@ func (s *Server) LoginHandler() httprouter.Handle {
 		ctx := NewContext(s.config, s.db, r)
 
 		if r.Method == "GET" {
+			if next := r.FormValue("next"); IsLocalPath(next) {
+				ctx.Next = next
+			}
 			s.render("login", w, ctx)
 			return
 		}
@@ -1174,6 +1230,11 @@ func (s *Server) LoginHandler() httprouter.Handle {
 			_ = sess.(*session.Session).Set("persist", "1")
 		}
 
+		if next := r.FormValue("next"); IsLocalPath(next) {
+			http.Redirect(w, r, next, http.StatusFound)
+			return
+		}
+
 		http.Redirect(w, r, RedirectRefererURL(r, s.config, "/"), http.StatusFound)
 	}
 }
@@ -1306,6 +1367,15 @@ func (s *Server) LookupHandler() httprouter.Handle {
 		matches = append(matches, feeds...)
 		matches = append(matches, following...)
 
+		// Handles (nick@domain) of feeds on other pods
+		if activitypub.IsHandle(prefix) {
+			if nick, feed, err := ResolveHandleFallback(s.config, prefix); err == nil {
+				if err := ValidateFeed(s.config, nick, feed); err == nil {
+					matches = append(matches, strings.TrimPrefix(prefix, "@"))
+				}
+			}
+		}
+
 		matches = UniqStrings(matches)
 
 		data, err := json.Marshal(matches)
@@ -1327,6 +1397,7 @@ func (s *Server) SettingsHandler() httprouter.Handle {
 
 		if r.Method == "GET" {
 			ctx.Title = s.tr(ctx, "PageSettingsTitle")
+			ctx.Scopes = Scopes
 			s.render("settings", w, ctx)
 			return
 		}
@@ -1413,6 +1484,51 @@ func (s *Server) SettingsHandler() httprouter.Handle {
 	}
 }
 
+// CreateTokenHandler creates a personal access token and shows its value
+// once
+func (s *Server) CreateTokenHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		name := strings.TrimSpace(r.FormValue("name"))
+		days := SafeParseInt(r.FormValue("expiry"), 0)
+		if name == "" || days < 0 {
+			ctx.Error = true
+			ctx.Message = "Invalid token name or expiry"
+			s.render("error", w, ctx)
+			return
+		}
+
+		var expiresAt time.Time
+		if days > 0 {
+			expiresAt = time.Now().AddDate(0, 0, days)
+		}
+
+		// r.Form was parsed by FormValue above
+		token, err := NewToken(s.config, ctx.User, r.Form["scope"], expiresAt)
+		if err != nil {
+			log.WithError(err).Error("error creating token")
+			ctx.Error = true
+			ctx.Message = "Error creating token, select at least one scope"
+			s.render("error", w, ctx)
+			return
+		}
+		token.Name = name
+		token.UserAgent = r.UserAgent()
+
+		if err := SaveToken(s.db, ctx.User, token); err != nil {
+			ctx.Error = true
+			ctx.Message = "Error creating token"
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = fmt.Sprintf("Copy your new token now, it will not be shown again: %s", token.Value)
+		s.render("error", w, ctx)
+	}
+}
+
 // DeleteTokenHandler ...
 func (s *Server) DeleteTokenHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -1420,7 +1536,7 @@ func (s *Server) DeleteTokenHandler() httprouter.Handle {
 
 		signature := p.ByName("signature")
 
-		if err := s.db.DelToken(signature); err != nil {
+		if err := RevokeToken(s.db, ctx.User, signature); err != nil {
 			ctx.Error = true
 			ctx.Message = "Error deleting token"
 			s.render("error", w, ctx)
@@ -1599,10 +1715,15 @@ func (s *Server) ExternalHandler() httprouter.Handle {
 			}
 		}
 
+		// Metadata declared by the feed
+		twter, _ := s.cache.GetTwter(uri)
+
 		ctx.Profile = types.Profile{
 			Username: nick,
+			Tagline:  twter.Tagline,
 			TwtURL:   uri,
 			URL:      URLForExternalProfile(s.config, nick, uri),
+			Links:    twter.Links,
 
 			Follows:    ctx.User.Follows(uri),
 			FollowedBy: ctx.User.FollowedBy(uri),
@@ -2009,6 +2130,7 @@ func (s *Server) SyndicationHandler() httprouter.Handle {
 		feed.Items = items
 
 		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		websubs.Advertise(w, URLForAtom(s.config.BaseURL, nick))
 		data, err := feed.ToAtom()
 		if err != nil {
 			log.WithError(err).Error("error serializing feed")
@@ -2198,6 +2320,7 @@ func (s *Server) DeleteAllHandler() httprouter.Handle {
 						s.render("error", w, ctx)
 					}
 				}
+				removeServedFeed(fn)
 
 				// Delete feed from cache
 				s.cache.Delete(feed.Source())
@@ -2269,6 +2392,7 @@ func (s *Server) DeleteAllHandler() httprouter.Handle {
 				s.render("error", w, ctx)
 			}
 		}
+		removeServedFeed(fn)
 
 		// Delete user
 		if err := s.db.DelUser(ctx.Username); err != nil {
@@ -2278,6 +2402,14 @@ func (s *Server) DeleteAllHandler() httprouter.Handle {
 			return
 		}
 
+		// Delete user's ActivityPub key
+		federation.DeleteKey(ctx.Username)
+
+		// Delete user's notifications
+		if err := DeleteNotifications(s.db, ctx.Username); err != nil {
+			log.WithError(err).Warnf("error deleting notifications for %s", ctx.Username)
+		}
+
 		// Delete user's feed from cache
 		s.cache.Delete(ctx.User.Source())
 
@@ -0,0 +1,607 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prologic/bitcask"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	indexedArchiveDir = "archive.db"
+
+	archiveTwtsDir  = "twts"
+	archiveIndexDir = "index"
+
+	archiveMaxKeySize = 256
+
+	// archiveThreadsKey marks an archive whose replies have been indexed,
+	// archives created before replies were indexed are indexed when opened
+	archiveThreadsKey = "!threads"
+
+	// archiveSearchKey marks an archive whose twts have been indexed for
+	// search, archives created before that are indexed when opened
+	archiveSearchKey = "!search"
+
+	// maxArchiveSearchResults is the maximum number of archived twts
+	// returned by a search, the best ranked ones are returned
+	maxArchiveSearchResults = 1000
+)
+
+// IndexedArchiver implements Archiver using two embedded bitcask key/value
+// stores. One holds the JSON encoded twts keyed by hash which gives an O(1)
+// Count() and the other holds a secondary index of the form:
+//
+//	/<FastHash(feed url)>/<created unix nano in hex>/<hash>
+//
+// which allows the archived twts of a feed to be queried in chronological
+// order and by time range without decoding every twt in the archive, as well
+// as a thread index of the form:
+//
+//	#<subject hash>/<hash>
+//
+// which allows the replies to a twt to be found without a full scan, as well
+// as a search index of the form:
+//
+//	$<kind>/<escaped term, tag, mention or author>/<hash>
+//
+// which allows archived twts to be searched without keeping an index of the
+// entire archive in memory.
+type IndexedArchiver struct {
+	twts  *bitcask.Bitcask
+	index *bitcask.Bitcask
+}
+
+func NewIndexedArchiver(p string) (*IndexedArchiver, error) {
+	twts, err := bitcask.Open(
+		filepath.Join(p, archiveTwtsDir),
+		bitcask.WithMaxKeySize(archiveMaxKeySize),
+	)
+	if err != nil {
+		log.WithError(err).Error("error opening archive")
+		return nil, err
+	}
+
+	index, err := bitcask.Open(
+		filepath.Join(p, archiveIndexDir),
+		bitcask.WithMaxKeySize(archiveMaxKeySize),
+	)
+	if err != nil {
+		log.WithError(err).Error("error opening archive index")
+		twts.Close()
+		return nil, err
+	}
+
+	archive := &IndexedArchiver{twts: twts, index: index}
+
+	if !index.Has([]byte(archiveThreadsKey)) {
+		if err := archive.indexThreads(); err != nil {
+			log.WithError(err).Error("error indexing archived replies")
+			archive.Close()
+			return nil, err
+		}
+	}
+
+	if !index.Has([]byte(archiveSearchKey)) {
+		if err := archive.indexSearch(); err != nil {
+			log.WithError(err).Error("error indexing archived twts for search")
+			archive.Close()
+			return nil, err
+		}
+	}
+
+	return archive, nil
+}
+
+// indexThreads adds all archived replies to the thread index
+func (a *IndexedArchiver) indexThreads() error {
+	n, err := a.Walk(func(twt types.Twt) error {
+		if subject := threadSubject(twt); subject != "" {
+			return a.index.Put(archiveThreadKey(subject, twt.Hash()), []byte(twt.Hash()))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("indexed replies of %d archived twts", n)
+
+	return a.index.Put([]byte(archiveThreadsKey), []byte(time.Now().Format(time.RFC3339)))
+}
+
+// indexSearch adds all archived twts to the search index
+func (a *IndexedArchiver) indexSearch() error {
+	n, err := a.Walk(func(twt types.Twt) error {
+		return a.putSearchKeys(twt)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("indexed %d archived twts for search", n)
+
+	return a.index.Put([]byte(archiveSearchKey), []byte(time.Now().Format(time.RFC3339)))
+}
+
+func archiveIndexPrefix(url string) string {
+	return fmt.Sprintf("/%s/", FastHash(url))
+}
+
+func archiveIndexKey(twt types.Twt) []byte {
+	return []byte(fmt.Sprintf(
+		"%s%016x/%s",
+		archiveIndexPrefix(twt.Twter().URL), twt.Created().UnixNano(), twt.Hash(),
+	))
+}
+
+func archiveThreadPrefix(subject string) string {
+	return fmt.Sprintf("#%s/", subject)
+}
+
+func archiveThreadKey(subject, hash string) []byte {
+	return []byte(archiveThreadPrefix(subject) + hash)
+}
+
+// Kinds of search index keys
+const (
+	archiveSearchTerm    = "term"
+	archiveSearchTag     = "tag"
+	archiveSearchMention = "mention"
+	archiveSearchAuthor  = "author"
+)
+
+func archiveSearchPrefix(kind, key string) string {
+	return fmt.Sprintf("$%s/%s/", kind, url.PathEscape(key))
+}
+
+// archiveSearchKeys returns the search index keys of twt and their values,
+// the term frequency for terms. Keys too long to be stored are skipped.
+func archiveSearchKeys(twt types.Twt) map[string]string {
+	doc := newSearchDoc(twt)
+	hash := twt.Hash()
+
+	keys := make(map[string]string)
+	add := func(kind, key, value string) {
+		if k := archiveSearchPrefix(kind, key) + hash; len(k) <= archiveMaxKeySize {
+			keys[k] = value
+		}
+	}
+
+	for term, n := range doc.terms {
+		add(archiveSearchTerm, term, strconv.Itoa(n))
+	}
+	for _, tag := range doc.tags {
+		add(archiveSearchTag, tag, hash)
+	}
+	for _, key := range doc.mentions {
+		add(archiveSearchMention, key, hash)
+	}
+	for _, key := range doc.authors {
+		add(archiveSearchAuthor, key, hash)
+	}
+
+	return keys
+}
+
+func (a *IndexedArchiver) putSearchKeys(twt types.Twt) error {
+	for key, value := range archiveSearchKeys(twt) {
+		if err := a.index.Put([]byte(key), []byte(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *IndexedArchiver) delSearchKeys(twt types.Twt) error {
+	for key := range archiveSearchKeys(twt) {
+		if err := a.index.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseArchiveIndexKey returns the created time and hash encoded in an index key
+func parseArchiveIndexKey(key []byte) (time.Time, string, error) {
+	parts := strings.Split(strings.TrimPrefix(string(key), "/"), "/")
+	if len(parts) != 3 {
+		return time.Time{}, "", fmt.Errorf("invalid archive index key: %s", key)
+	}
+
+	var ns int64
+	if _, err := fmt.Sscanf(parts[1], "%x", &ns); err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid archive index key: %s", key)
+	}
+
+	return time.Unix(0, ns), parts[2], nil
+}
+
+func (a *IndexedArchiver) Del(hash string) error {
+	twt, err := a.Get(hash)
+	if err == ErrTwtNotArchived {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := a.index.Delete(archiveIndexKey(twt)); err != nil {
+		log.WithError(err).Errorf("error deleting archive index for twt %s", hash)
+		return err
+	}
+
+	if subject := threadSubject(twt); subject != "" {
+		if err := a.index.Delete(archiveThreadKey(subject, hash)); err != nil {
+			log.WithError(err).Errorf("error deleting thread index for twt %s", hash)
+			return err
+		}
+	}
+
+	if err := a.delSearchKeys(twt); err != nil {
+		log.WithError(err).Errorf("error deleting search index for twt %s", hash)
+		return err
+	}
+
+	return a.twts.Delete([]byte(hash))
+}
+
+func (a *IndexedArchiver) Has(hash string) bool {
+	return a.twts.Has([]byte(hash))
+}
+
+func (a *IndexedArchiver) Get(hash string) (types.Twt, error) {
+	data, err := a.twts.Get([]byte(hash))
+	if err == bitcask.ErrKeyNotFound {
+		log.Warnf("twt %s not found in archive", hash)
+		return types.NilTwt, ErrTwtNotArchived
+	} else if err != nil {
+		log.WithError(err).Errorf("error reading archived twt %s", hash)
+		return types.NilTwt, err
+	}
+
+	twt, err := types.DecodeJSON(data)
+	if err != nil {
+		log.WithError(err).Errorf("error decoding archived twt %s", hash)
+		return types.NilTwt, err
+	}
+
+	return twt, nil
+}
+
+func (a *IndexedArchiver) Archive(twt types.Twt) error {
+	hash := twt.Hash()
+
+	if a.Has(hash) {
+		log.Warnf("archived twt %s already exists", hash)
+		return ErrTwtAlreadyArchived
+	}
+
+	data, err := json.Marshal(&twt)
+	if err != nil {
+		log.WithError(err).Errorf("error encoding twt %s", hash)
+		return err
+	}
+
+	// Write the index first so a twt is never archived without being indexed
+	if err := a.index.Put(archiveIndexKey(twt), []byte(hash)); err != nil {
+		log.WithError(err).Errorf("error indexing twt %s", hash)
+		return err
+	}
+
+	if subject := threadSubject(twt); subject != "" {
+		if err := a.index.Put(archiveThreadKey(subject, hash), []byte(hash)); err != nil {
+			log.WithError(err).Errorf("error indexing reply %s", hash)
+			return err
+		}
+	}
+
+	if err := a.putSearchKeys(twt); err != nil {
+		log.WithError(err).Errorf("error indexing twt %s for search", hash)
+		return err
+	}
+
+	if err := a.twts.Put([]byte(hash), data); err != nil {
+		log.WithError(err).Errorf("error writing twt %s to archive", hash)
+		return err
+	}
+
+	return nil
+}
+
+// Walk calls fn with every archived twt (in no particular order) and returns
+// the number of twts walked, twts that cannot be decoded are skipped
+func (a *IndexedArchiver) Walk(fn func(twt types.Twt) error) (int, error) {
+	// Keys are collected first as twts cannot be read while folding
+	var hashes []string
+	if err := a.twts.Fold(func(key []byte) error {
+		hashes = append(hashes, string(key))
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, hash := range hashes {
+		twt, err := a.Get(hash)
+		if err != nil {
+			continue
+		}
+		if err := fn(twt); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+func (a *IndexedArchiver) Count() (int, error) {
+	return a.twts.Len(), nil
+}
+
+// entries returns the index entries of the feed identified by url created
+// within [after, before). Zero times are unbounded.
+func (a *IndexedArchiver) entries(url string, after, before time.Time) ([]ArchiveEntry, error) {
+	var entries []ArchiveEntry
+
+	err := a.index.Scan([]byte(archiveIndexPrefix(url)), func(key []byte) error {
+		created, hash, err := parseArchiveIndexKey(key)
+		if err != nil {
+			log.WithError(err).Warn("skipping invalid archive index key")
+			return nil
+		}
+		if !after.IsZero() && created.Before(after) {
+			return nil
+		}
+		if !before.IsZero() && !created.Before(before) {
+			return nil
+		}
+		entries = append(entries, ArchiveEntry{Created: created, Hash: hash})
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Errorf("error scanning archive index for %s", url)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetByURL returns the archived twts of the feed identified by url created
+// within [after, before), newest first. Zero times are unbounded.
+func (a *IndexedArchiver) GetByURL(url string, after, before time.Time) (types.Twts, error) {
+	entries, err := a.entries(url, after, before)
+	if err != nil {
+		return nil, err
+	}
+
+	it := NewArchiveIterator(a, entries)
+
+	twts := make(types.Twts, 0, it.Len())
+	for twt, ok := it.Next(); ok; twt, ok = it.Next() {
+		twts = append(twts, twt)
+	}
+
+	return twts, nil
+}
+
+// IterByURL returns an iterator over the archived twts of the feed
+// identified by url created before `before`, newest first.
+func (a *IndexedArchiver) IterByURL(url string, before time.Time) (*ArchiveIterator, error) {
+	entries, err := a.entries(url, time.Time{}, before)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewArchiveIterator(a, entries), nil
+}
+
+// Replies returns the hashes of the archived twts that reply to the twt
+// identified by hash
+func (a *IndexedArchiver) Replies(hash string) ([]string, error) {
+	var replies []string
+
+	prefix := archiveThreadPrefix(hash)
+	err := a.index.Scan([]byte(prefix), func(key []byte) error {
+		replies = append(replies, strings.TrimPrefix(string(key), prefix))
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Errorf("error scanning thread index for %s", hash)
+		return nil, err
+	}
+
+	return replies, nil
+}
+
+// searchPostings returns the hashes of the archived twts indexed under the
+// given kind and key and their values
+func (a *IndexedArchiver) searchPostings(kind, key string) (map[string]string, error) {
+	// Keys are collected first as values cannot be read while scanning
+	var keys []string
+
+	prefix := archiveSearchPrefix(kind, key)
+	err := a.index.Scan([]byte(prefix), func(k []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Errorf("error scanning search index for %s", prefix)
+		return nil, err
+	}
+
+	postings := make(map[string]string, len(keys))
+	for _, k := range keys {
+		value, err := a.index.Get([]byte(k))
+		if err != nil {
+			continue
+		}
+		postings[strings.TrimPrefix(k, prefix)] = string(value)
+	}
+
+	return postings, nil
+}
+
+// Search returns the archived twts matching the query ranked like
+// SearchIndex.Search, at most maxArchiveSearchResults of them. Queries
+// without terms, tags, mentions or authors (only dates) match nothing as
+// that would mean reading the entire archive.
+func (a *IndexedArchiver) Search(q SearchQuery) (types.Twts, error) {
+	var (
+		lists []map[string]string
+		tfs   = make(map[string]map[string]string)
+	)
+
+	for _, term := range q.Terms {
+		list, err := a.searchPostings(archiveSearchTerm, term)
+		if err != nil {
+			return nil, err
+		}
+		tfs[term] = list
+		lists = append(lists, list)
+	}
+	for _, tag := range q.Tags {
+		list, err := a.searchPostings(archiveSearchTag, tag)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	for _, mention := range q.Mentions {
+		list, err := a.searchPostings(archiveSearchMention, mention)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	// Multiple from: conditions are OR'ed as a twt only has one author
+	if len(q.From) > 0 {
+		from := make(map[string]string)
+		for _, nick := range q.From {
+			list, err := a.searchPostings(archiveSearchAuthor, nick)
+			if err != nil {
+				return nil, err
+			}
+			for hash, value := range list {
+				from[hash] = value
+			}
+		}
+		lists = append(lists, from)
+	}
+
+	if len(lists) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+
+	n := float64(a.twts.Len())
+
+	type candidate struct {
+		hash  string
+		score float64
+	}
+
+	var candidates []candidate
+outer:
+	for hash := range lists[0] {
+		for _, list := range lists[1:] {
+			if _, ok := list[hash]; !ok {
+				continue outer
+			}
+		}
+
+		var score float64
+		for _, term := range q.Terms {
+			tf, _ := strconv.Atoi(tfs[term][hash])
+			score += float64(tf) * math.Log(1+n/float64(len(tfs[term])))
+		}
+		candidates = append(candidates, candidate{hash, score})
+	}
+
+	// Only the best ranked candidates are read from the archive
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	var results []searchResult
+	for _, c := range candidates {
+		if len(results) >= maxArchiveSearchResults {
+			break
+		}
+
+		twt, err := a.Get(c.hash)
+		if err != nil {
+			continue
+		}
+
+		created := twt.Created()
+		if !q.Before.IsZero() && !created.Before(q.Before) {
+			continue
+		}
+		if !q.After.IsZero() && created.Before(q.After) {
+			continue
+		}
+
+		results = append(results, searchResult{twt, c.score})
+	}
+
+	return sortSearchResults(results), nil
+}
+
+func (a *IndexedArchiver) Close() error {
+	if err := a.index.Close(); err != nil {
+		log.WithError(err).Error("error closing archive index")
+		return err
+	}
+
+	if err := a.twts.Close(); err != nil {
+		log.WithError(err).Error("error closing archive")
+		return err
+	}
+
+	return nil
+}
+
+// ImportDiskArchive imports all twts from a legacy DiskArchiver at path p
+// into the archive. Twts already archived are skipped so an import can be
+// safely resumed. Once successful the legacy archive is renamed so it is
+// not imported again.
+func ImportDiskArchive(p string, archive Archiver) error {
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		return nil
+	}
+
+	legacy := &DiskArchiver{path: p}
+
+	log.Infof("importing legacy archive %s ...", p)
+
+	var n int
+	err := legacy.walk(func(twt types.Twt) error {
+		if archive.Has(twt.Hash()) {
+			return nil
+		}
+		if err := archive.Archive(twt); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Errorf("error importing legacy archive %s", p)
+		return err
+	}
+
+	log.Infof("imported %d twts from legacy archive %s", n, p)
+
+	return os.Rename(p, fmt.Sprintf("%s.imported", p))
+}
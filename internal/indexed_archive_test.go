@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/lextwt"
+)
+
+func TestIndexedArchiver(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+
+	alice := types.Twter{Nick: "alice", URL: "https://example.com/alice/twtxt.txt"}
+	bob := types.Twter{Nick: "bob", URL: "https://example.org/bob/twtxt.txt"}
+
+	parse := func(line string, twter types.Twter) types.Twt {
+		twt, err := lextwt.ParseLine(line, twter)
+		require.NoError(err)
+		return twt
+	}
+
+	t1 := parse("2020-12-01T10:00:00Z\tFirst", alice)
+	t2 := parse("2020-12-15T10:00:00Z\tSecond", alice)
+	t3 := parse("2021-01-10T10:00:00Z\tThird", alice)
+	t4 := parse("2020-12-20T10:00:00Z\tHello", bob)
+
+	// Legacy archive is imported and renamed
+	legacy, err := NewDiskArchiver(filepath.Join(dir, archiveDir))
+	require.NoError(err)
+	require.NoError(legacy.Archive(t1))
+
+	archive, err := NewIndexedArchiver(filepath.Join(dir, indexedArchiveDir))
+	require.NoError(err)
+	defer archive.Close()
+
+	require.NoError(ImportDiskArchive(filepath.Join(dir, archiveDir), archive))
+	_, err = os.Stat(filepath.Join(dir, archiveDir))
+	assert.True(os.IsNotExist(err))
+
+	for _, twt := range []types.Twt{t2, t3, t4} {
+		require.NoError(archive.Archive(twt))
+	}
+	assert.Equal(ErrTwtAlreadyArchived, archive.Archive(t1))
+
+	count, err := archive.Count()
+	require.NoError(err)
+	assert.Equal(4, count)
+
+	twt, err := archive.Get(t1.Hash())
+	require.NoError(err)
+	assert.Equal(t1.Hash(), twt.Hash())
+
+	// Newest first
+	twts, err := archive.GetByURL(alice.URL, time.Time{}, time.Time{})
+	require.NoError(err)
+	require.Len(twts, 3)
+	assert.Equal(t3.Hash(), twts[0].Hash())
+	assert.Equal(t1.Hash(), twts[2].Hash())
+
+	// Time range
+	twts, err = archive.GetByURL(alice.URL, t2.Created(), t3.Created())
+	require.NoError(err)
+	require.Len(twts, 1)
+	assert.Equal(t2.Hash(), twts[0].Hash())
+
+	// Deletion removes the twt and its index entry
+	require.NoError(archive.Del(t3.Hash()))
+	assert.False(archive.Has(t3.Hash()))
+	twts, err = archive.GetByURL(alice.URL, time.Time{}, time.Time{})
+	require.NoError(err)
+	assert.Len(twts, 2)
+}
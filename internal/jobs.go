@@ -2,6 +2,8 @@ package internal
 
 import (
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/jointwt/twtxt/types"
 	"github.com/robfig/cron"
@@ -29,9 +31,16 @@ func init() {
 		"UpdateFeeds":       NewJobSpec("@every 5m", NewUpdateFeedsJob),
 		"UpdateFeedSources": NewJobSpec("@every 15m", NewUpdateFeedSourcesJob),
 
+		"PublishScheduledTwts": NewJobSpec("@every 1m", NewPublishScheduledTwtsJob),
+
+		"UpdateNotifications": NewJobSpec("@every 5m", NewUpdateNotificationsJob),
+
+		"RotateFeeds": NewJobSpec("@hourly", NewRotateFeedsJob),
+
 		"DeleteOldSessions": NewJobSpec("@hourly", NewDeleteOldSessionsJob),
 
-		"Stats": NewJobSpec("@daily", NewStatsJob),
+		"Stats":       NewJobSpec("@daily", NewStatsJob),
+		"UpdateStats": NewJobSpec("@hourly", NewUpdateStatsJob),
 
 		"CreateBots":       NewJobSpec("", NewCreateBotsJob),
 		"CreateAdminFeeds": NewJobSpec("", NewCreateAdminFeedsJob),
@@ -45,6 +54,9 @@ func init() {
 		"CreateAdminFeeds":  Jobs["CreateAdminFeeds"],
 		"DeleteOldSessions": Jobs["DeleteOldSessions"],
 		"RemoveEmails":      Jobs["RemoveEmails"],
+		"UpdateStats":       Jobs["UpdateStats"],
+
+		"UpdateNotifications": Jobs["UpdateNotifications"],
 	}
 }
 
@@ -82,29 +94,62 @@ func NewStatsJob(conf *Config, blogs *BlogsCache, cache *Cache, archive Archiver
 }
 
 func (job *StatsJob) Run() {
+	log.Infof("updating stats")
+
+	if err := updateStats(job.conf, job.blogs, job.cache, job.archive, job.db); err != nil {
+		log.WithError(err).Warn("error updating stats")
+		return
+	}
+
+	text := fmt.Sprintf(
+		"🧮 USERS:%d FEEDS:%d TWTS:%d BLOGS:%d ARCHIVED:%d CACHE:%d FOLLOWERS:%d FOLLOWING:%d",
+		getStat("users"), getStat("feeds"), getStat("twts"), getStat("blogs"),
+		getStat("archived"), getStat("cache"), getStat("followers"), getStat("following"),
+	)
+
+	if _, err := AppendSpecial(job.conf, job.db, "stats", text); err != nil {
+		log.WithError(err).Warn("error updating stats feed")
+	}
+}
+
+type UpdateStatsJob struct {
+	conf    *Config
+	blogs   *BlogsCache
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewUpdateStatsJob(conf *Config, blogs *BlogsCache, cache *Cache, archive Archiver, db Store) cron.Job {
+	return &UpdateStatsJob{conf: conf, blogs: blogs, cache: cache, archive: archive, db: db}
+}
+
+func (job *UpdateStatsJob) Run() {
+	if err := updateStats(job.conf, job.blogs, job.cache, job.archive, job.db); err != nil {
+		log.WithError(err).Warn("error updating stats")
+	}
+}
+
+// updateStats counts the users, feeds, twts, etc of the pod into stats
+func updateStats(conf *Config, blogs *BlogsCache, cache *Cache, archive Archiver, db Store) error {
 	var (
 		followers []string
 		following []string
 	)
 
-	log.Infof("updating stats")
-
-	archiveSize, err := job.archive.Count()
+	archiveSize, err := archive.Count()
 	if err != nil {
-		log.WithError(err).Warn("unable to get archive size")
-		return
+		return fmt.Errorf("error getting archive size: %w", err)
 	}
 
-	feeds, err := job.db.GetAllFeeds()
+	feeds, err := db.GetAllFeeds()
 	if err != nil {
-		log.WithError(err).Warn("unable to get all feeds from database")
-		return
+		return fmt.Errorf("error getting all feeds from database: %w", err)
 	}
 
-	users, err := job.db.GetAllUsers()
+	users, err := db.GetAllUsers()
 	if err != nil {
-		log.WithError(err).Warn("unable to get all users from database")
-		return
+		return fmt.Errorf("error getting all users from database: %w", err)
 	}
 
 	for _, feed := range feeds {
@@ -121,29 +166,28 @@ func (job *StatsJob) Run() {
 
 	var twts int
 
-	allFeeds, err := GetAllFeeds(job.conf)
+	allFeeds, err := GetAllFeeds(conf)
 	if err != nil {
-		log.WithError(err).Warn("unable to get all local feeds")
-		return
+		return fmt.Errorf("error getting all local feeds: %w", err)
 	}
 	for _, feed := range allFeeds {
-		count, err := GetFeedCount(job.conf, feed)
+		count, err := GetFeedCount(conf, feed)
 		if err != nil {
-			log.WithError(err).Warnf("error getting feed count for %s", feed)
-			return
+			return fmt.Errorf("error getting feed count for %s: %w", feed, err)
 		}
 		twts += count
 	}
 
-	text := fmt.Sprintf(
-		"🧮 USERS:%d FEEDS:%d TWTS:%d BLOGS:%d ARCHIVED:%d CACHE:%d FOLLOWERS:%d FOLLOWING:%d",
-		len(users), len(feeds), twts, job.blogs.Count(),
-		archiveSize, job.cache.Count(), len(followers), len(following),
-	)
+	setStat("users", len(users))
+	setStat("feeds", len(feeds))
+	setStat("twts", twts)
+	setStat("blogs", blogs.Count())
+	setStat("archived", archiveSize)
+	setStat("cache", cache.Count())
+	setStat("followers", len(followers))
+	setStat("following", len(following))
 
-	if _, err := AppendSpecial(job.conf, job.db, "stats", text); err != nil {
-		log.WithError(err).Warn("error updating stats feed")
-	}
+	return nil
 }
 
 type UpdateFeedsJob struct {
@@ -200,8 +244,21 @@ func (job *UpdateFeedsJob) Run() {
 		}
 	}
 
-	log.Infof("updating %d sources", len(sources))
-	job.cache.FetchTwts(job.conf, job.archive, sources, publicFollowers)
+	// Feeds pushed over WebSub are only polled for occasionally as a fallback
+	fetch := make(types.Feeds)
+	since := time.Now().Add(-pushedFeedPollInterval)
+	for feed := range sources {
+		if websubs.Pushed(feed.URL) && job.cache.fetchedSince(feed.URL, since) {
+			continue
+		}
+		fetch[feed] = true
+	}
+
+	log.Infof("updating %d sources (%d pushed)", len(fetch), len(sources)-len(fetch))
+	job.cache.FetchTwts(job.conf, job.archive, fetch, publicFollowers)
+
+	// Forget the health of feeds no longer followed by anyone
+	job.cache.pruneFeedHealth(sources)
 
 	log.Infof("warming cache with local twts for %s", job.conf.BaseURL)
 	job.cache.GetByPrefix(job.conf.BaseURL, true)
@@ -219,6 +276,113 @@ func (job *UpdateFeedsJob) Run() {
 
 }
 
+type UpdateNotificationsJob struct {
+	conf    *Config
+	blogs   *BlogsCache
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewUpdateNotificationsJob(conf *Config, blogs *BlogsCache, cache *Cache, archive Archiver, db Store) cron.Job {
+	return &UpdateNotificationsJob{conf: conf, blogs: blogs, cache: cache, archive: archive, db: db}
+}
+
+func (job *UpdateNotificationsJob) Run() {
+	if err := NotifyMentions(job.conf, job.cache, job.db); err != nil {
+		log.WithError(err).Warn("error notifying mentions")
+	}
+
+	if err := PruneNotifications(job.db); err != nil {
+		log.WithError(err).Warn("error pruning old notifications")
+	}
+}
+
+type PublishScheduledTwtsJob struct {
+	conf    *Config
+	blogs   *BlogsCache
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewPublishScheduledTwtsJob(conf *Config, blogs *BlogsCache, cache *Cache, archive Archiver, db Store) cron.Job {
+	return &PublishScheduledTwtsJob{conf: conf, blogs: blogs, cache: cache, archive: archive, db: db}
+}
+
+func (job *PublishScheduledTwtsJob) Run() {
+	scheduledTwtsMu.Lock()
+	defer scheduledTwtsMu.Unlock()
+
+	all, err := job.db.GetAllScheduledTwts()
+	if err != nil {
+		log.WithError(err).Warn("unable to get scheduled twts from database")
+		return
+	}
+
+	now := time.Now()
+
+	var due []*ScheduledTwt
+	for _, st := range all {
+		if !st.PostAt.After(now) {
+			due = append(due, st)
+		}
+	}
+
+	if len(due) == 0 {
+		return
+	}
+
+	// Publish in order so feeds remain in chronological order
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].PostAt.Before(due[j].PostAt)
+	})
+
+	log.Infof("publishing %d scheduled twts", len(due))
+
+	sources := make(types.Feeds)
+
+	for _, st := range due {
+		// Removed before publishing so that it is never published twice
+		if err := job.db.DelScheduledTwt(st.ID); err != nil {
+			log.WithError(err).Errorf("error removing scheduled twt %s", st.ID)
+			continue
+		}
+
+		twt, feed, err := PublishScheduledTwt(job.conf, job.db, st)
+		switch err {
+		case nil:
+		case ErrUserNotFound, ErrFeedImposter:
+			// The user or their ownership of the feed has since gone away
+			log.WithError(err).Warnf("discarding scheduled twt %s for %s", st.ID, st.Feed)
+		default:
+			// Queue it again so publishing is retried on the next run
+			log.WithError(err).Errorf("error publishing scheduled twt %s for %s", st.ID, st.Feed)
+			if err := job.db.SetScheduledTwt(st.ID, st); err != nil {
+				log.WithError(err).Errorf("error requeueing scheduled twt %s", st.ID)
+			}
+			continue
+		}
+
+		if feed == nil {
+			continue
+		}
+
+		for source := range feed.Source() {
+			sources[source] = true
+		}
+
+		var federated *User
+		if st.Feed == st.Username {
+			federated = feed
+		}
+		publishSideEffects(job.conf, job.cache, federated, twt)
+	}
+
+	job.cache.FetchTwts(job.conf, job.archive, sources, nil)
+	job.cache.GetByPrefix(job.conf.BaseURL, true)
+}
+
 type UpdateFeedSourcesJob struct {
 	conf    *Config
 	blogs   *BlogsCache
@@ -386,3 +550,38 @@ func (job *RemoveEmailsJob) Run() {
 
 	log.Info("finished removing emails from user accounts")
 }
+
+type RotateFeedsJob struct {
+	conf    *Config
+	blogs   *BlogsCache
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewRotateFeedsJob(conf *Config, blogs *BlogsCache, cache *Cache, archive Archiver, db Store) cron.Job {
+	return &RotateFeedsJob{conf: conf, blogs: blogs, cache: cache, archive: archive, db: db}
+}
+
+func (job *RotateFeedsJob) Run() {
+	if job.conf.MaxFeedSize <= 0 && job.conf.MaxFeedAge <= 0 {
+		return
+	}
+
+	feeds, err := GetAllFeeds(job.conf)
+	if err != nil {
+		log.WithError(err).Warn("unable to get all local feeds")
+		return
+	}
+
+	for _, feed := range feeds {
+		hash, err := RotateFeed(job.conf, feed, false)
+		if err != nil {
+			log.WithError(err).Warnf("error rotating feed %s", feed)
+			continue
+		}
+		if hash != "" {
+			log.Infof("rotated feed %s into %s", feed, archivedFeedName(hash))
+		}
+	}
+}
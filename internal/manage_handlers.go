@@ -12,6 +12,9 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/renstrom/shortuuid"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/internal/webmention"
+	"github.com/jointwt/twtxt/types"
 )
 
 // ManagePodHandler ...
@@ -303,6 +306,7 @@ func (s *Server) DelUserHandler() httprouter.Handle {
 						s.render("error", w, ctx)
 					}
 				}
+				removeServedFeed(fn)
 
 				// Delete feed from cache
 				s.cache.Delete(feed.Source())
@@ -374,6 +378,7 @@ func (s *Server) DelUserHandler() httprouter.Handle {
 				s.render("error", w, ctx)
 			}
 		}
+		removeServedFeed(fn)
 
 		// Delete user
 		if err := s.db.DelUser(user.Username); err != nil {
@@ -383,6 +388,14 @@ func (s *Server) DelUserHandler() httprouter.Handle {
 			return
 		}
 
+		// Delete user's ActivityPub key
+		federation.DeleteKey(user.Username)
+
+		// Delete user's notifications
+		if err := DeleteNotifications(s.db, user.Username); err != nil {
+			log.WithError(err).Warnf("error deleting notifications for %s", user.Username)
+		}
+
 		// Delete user's feed from cache
 		s.cache.Delete(user.Source())
 
@@ -396,3 +409,182 @@ func (s *Server) DelUserHandler() httprouter.Handle {
 		s.render("error", w, ctx)
 	}
 }
+
+// ManageFeedsHandler ...
+func (s *Server) ManageFeedsHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		ctx.ShowAllFeeds = r.FormValue("all") != ""
+		ctx.FeedHealth = s.cache.GetFeedHealth(!ctx.ShowAllFeeds)
+
+		s.render("manageFeeds", w, ctx)
+	}
+}
+
+// RefreshFeedHandler ...
+func (s *Server) RefreshFeedHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		url := strings.TrimSpace(r.FormValue("url"))
+
+		health, ok := s.cache.LookupFeedHealth(url)
+		if !ok {
+			ctx.Error = true
+			ctx.Message = "Feed not found"
+			s.render("404", w, ctx)
+			return
+		}
+
+		if health.Disabled {
+			ctx.Error = true
+			ctx.Message = "Feed is disabled, enable it first"
+			s.render("error", w, ctx)
+			return
+		}
+
+		s.cache.ResetFeedBackoff(url)
+		s.cache.FetchTwts(s.config, s.archive, types.Feeds{types.Feed{Nick: health.Nick, URL: url}: true}, nil)
+
+		http.Redirect(w, r, RedirectRefererURL(r, s.config, "/manage/feeds"), http.StatusFound)
+	}
+}
+
+// DisableFeedHandler ...
+func (s *Server) DisableFeedHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		url := strings.TrimSpace(r.FormValue("url"))
+		disabled := r.FormValue("disabled") == "on"
+
+		if !s.cache.DisableFeed(url, disabled) {
+			ctx.Error = true
+			ctx.Message = "Feed not found"
+			s.render("404", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, RedirectRefererURL(r, s.config, "/manage/feeds"), http.StatusFound)
+	}
+}
+
+// ManageWebMentionsHandler ...
+func (s *Server) ManageWebMentionsHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		mentions, err := webmentions.Mentions()
+		if err != nil {
+			log.WithError(err).Error("error loading webmentions")
+			ctx.Error = true
+			ctx.Message = "Error loading webmentions"
+			s.render("error", w, ctx)
+			return
+		}
+		ctx.WebMentions = mentions
+
+		s.render("manageWebMentions", w, ctx)
+	}
+}
+
+// RetryWebMentionHandler ...
+func (s *Server) RetryWebMentionHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		if err := webmentions.Retry(strings.TrimSpace(r.FormValue("id"))); err != nil {
+			if err == webmention.ErrMentionNotFound || err == webmention.ErrInvalidMentionID {
+				ctx.Error = true
+				ctx.Message = "WebMention not found"
+				s.render("404", w, ctx)
+				return
+			}
+			log.WithError(err).Error("error retrying webmention")
+			ctx.Error = true
+			ctx.Message = "Error retrying webmention"
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, RedirectRefererURL(r, s.config, "/manage/webmentions"), http.StatusFound)
+	}
+}
+
+// RemoveWebMentionHandler ...
+func (s *Server) RemoveWebMentionHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		if err := webmentions.Remove(strings.TrimSpace(r.FormValue("id"))); err != nil {
+			if err == webmention.ErrInvalidMentionID {
+				ctx.Error = true
+				ctx.Message = "WebMention not found"
+				s.render("404", w, ctx)
+				return
+			}
+			log.WithError(err).Error("error removing webmention")
+			ctx.Error = true
+			ctx.Message = "Error removing webmention"
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, RedirectRefererURL(r, s.config, "/manage/webmentions"), http.StatusFound)
+	}
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MigrateStore copies all users, feeds, sessions, tokens, scheduled twts,
+// WebSub subscriptions and notifications from one Store to another through
+// the Store interface. Objects that already exist in the destination are
+// overwritten so that an interrupted migration can be resumed by simply
+// running it again, without keeping partially written or stale objects. Once
+// copied the number of objects in both stores are compared and an error is
+// returned if they differ.
+func MigrateStore(from, to Store) error {
+	users, err := from.GetAllUsers()
+	if err != nil {
+		return fmt.Errorf("error reading users: %w", err)
+	}
+	for _, user := range users {
+		if err := to.SetUser(user.Username, user); err != nil {
+			return fmt.Errorf("error migrating user %s: %w", user.Username, err)
+		}
+	}
+	log.Infof("migrated %d users", len(users))
+
+	feeds, err := from.GetAllFeeds()
+	if err != nil {
+		return fmt.Errorf("error reading feeds: %w", err)
+	}
+	for _, feed := range feeds {
+		if err := to.SetFeed(feed.Name, feed); err != nil {
+			return fmt.Errorf("error migrating feed %s: %w", feed.Name, err)
+		}
+	}
+	log.Infof("migrated %d feeds", len(feeds))
+
+	sessions, err := from.GetAllSessions()
+	if err != nil {
+		return fmt.Errorf("error reading sessions: %w", err)
+	}
+	for _, sess := range sessions {
+		if err := to.SetSession(sess.ID, sess); err != nil {
+			return fmt.Errorf("error migrating session %s: %w", sess.ID, err)
+		}
+	}
+	log.Infof("migrated %d sessions", len(sessions))
+
+	tokens, err := from.GetAllTokens()
+	if err != nil {
+		return fmt.Errorf("error reading tokens: %w", err)
+	}
+	for _, tkn := range tokens {
+		if err := to.SetToken(tkn.Signature, tkn); err != nil {
+			return fmt.Errorf("error migrating token %s: %w", tkn.Signature, err)
+		}
+	}
+	log.Infof("migrated %d tokens", len(tokens))
+
+	scheduled, err := from.GetAllScheduledTwts()
+	if err != nil {
+		return fmt.Errorf("error reading scheduled twts: %w", err)
+	}
+	for _, st := range scheduled {
+		if err := to.SetScheduledTwt(st.ID, st); err != nil {
+			return fmt.Errorf("error migrating scheduled twt %s: %w", st.ID, err)
+		}
+	}
+	log.Infof("migrated %d scheduled twts", len(scheduled))
+
+	subs, err := from.GetAllSubscriptions()
+	if err != nil {
+		return fmt.Errorf("error reading subscriptions: %w", err)
+	}
+	for _, sub := range subs {
+		if err := to.SetSubscription(sub.ID(), sub); err != nil {
+			return fmt.Errorf("error migrating subscription %s: %w", sub.ID(), err)
+		}
+	}
+	log.Infof("migrated %d subscriptions", len(subs))
+
+	notifications, err := from.GetAllNotifications()
+	if err != nil {
+		return fmt.Errorf("error reading notifications: %w", err)
+	}
+	for _, notification := range notifications {
+		if err := to.SetNotification(notification.ID, notification); err != nil {
+			return fmt.Errorf("error migrating notification %s: %w", notification.ID, err)
+		}
+	}
+	log.Infof("migrated %d notifications", len(notifications))
+
+	if err := to.Sync(); err != nil {
+		return fmt.Errorf("error syncing store: %w", err)
+	}
+
+	counts := []struct {
+		name     string
+		from, to int64
+	}{
+		{"users", from.LenUsers(), to.LenUsers()},
+		{"feeds", from.LenFeeds(), to.LenFeeds()},
+		{"sessions", from.LenSessions(), to.LenSessions()},
+		{"tokens", from.LenTokens(), to.LenTokens()},
+		{"scheduled twts", from.LenScheduledTwts(), to.LenScheduledTwts()},
+		{"subscriptions", from.LenSubscriptions(), to.LenSubscriptions()},
+		{"notifications", from.LenNotifications(), to.LenNotifications()},
+	}
+	for _, c := range counts {
+		if c.from != c.to {
+			return fmt.Errorf("error verifying %s: expected %d but found %d", c.name, c.from, c.to)
+		}
+	}
+
+	return nil
+}
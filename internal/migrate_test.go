@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/internal/session"
+)
+
+func TestMigrateStore(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+
+	from, err := NewStore("bitcask://" + filepath.Join(dir, "twtxt.db"))
+	require.NoError(err)
+	defer from.Close()
+
+	to, err := NewStore("sqlite://" + filepath.Join(dir, "twtxt.sqlite"))
+	require.NoError(err)
+	defer to.Close()
+
+	for _, username := range []string{"alice", "bob"} {
+		user := NewUser()
+		user.Username = username
+		require.NoError(from.SetUser(username, user))
+	}
+
+	feed := NewFeed()
+	feed.Name = "news"
+	require.NoError(from.SetFeed("news", feed))
+
+	sess := session.NewSession(from)
+	sess.ID = "sid"
+	sess.Data = session.Map{"username": "alice"}
+	require.NoError(from.SetSession(sess.ID, sess))
+
+	tkn := &Token{Signature: "sig", Value: "value", CreatedAt: time.Now()}
+	require.NoError(from.SetToken(tkn.Signature, tkn))
+
+	// Simulate a previously interrupted migration that left a stale user
+	require.NoError(to.SetUser("alice", NewUser()))
+
+	require.NoError(MigrateStore(from, to))
+
+	assert.Equal(int64(2), to.LenUsers())
+	alice, err := to.GetUser("alice")
+	require.NoError(err)
+	assert.Equal("alice", alice.Username)
+	assert.Equal(int64(1), to.LenFeeds())
+	assert.Equal(int64(1), to.LenSessions())
+	assert.Equal(int64(1), to.LenTokens())
+
+	// Running again is idempotent
+	require.NoError(MigrateStore(from, to))
+
+	// Verification fails if the destination has extra objects
+	require.NoError(to.SetFeed("extra", NewFeed()))
+	assert.Error(MigrateStore(from, to))
+}
@@ -12,7 +12,9 @@ import (
 	"time"
 
 	"github.com/creasty/defaults"
+	"github.com/jointwt/twtxt/internal/activitypub"
 	"github.com/jointwt/twtxt/types"
+	"github.com/renstrom/shortuuid"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -66,18 +68,36 @@ type User struct {
 	Following map[string]string `default:"{}"`
 	Muted     map[string]string `default:"{}"`
 
+	// Inboxes maps the ActivityPub actors following the user (who are also
+	// in Followers) to the inbox the user's twts are delivered to
+	Inboxes map[string]string `default:"{}"`
+
 	muted   map[string]string
 	remotes map[string]string
 	sources map[string]string
 }
 
-// Token ...
+// Token is an API token of a user, either created by logging in through
+// the API, as a personal access token or granted to a third-party app with
+// OAuth2. Tokens can only be used for the API routes of their Scopes
 type Token struct {
 	Signature string
 	Value     string
+	Username  string
 	UserAgent string
-	CreatedAt time.Time
-	ExpiresAt time.Time
+
+	// Name is the name given to a personal access token
+	Name string
+
+	// ClientID is the client_id of the app the token was granted to
+	ClientID string
+
+	// Tokens created before scopes were introduced have all scopes
+	Scopes []string `default:"[\"read\",\"post\",\"follow\",\"admin\"]"`
+
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
 }
 
 func LoadToken(data []byte) (token *Token, err error) {
@@ -93,6 +113,32 @@ func LoadToken(data []byte) (token *Token, err error) {
 	return
 }
 
+// HasScope returns true if the token was granted scope, the admin scope
+// grants every scope
+func (t *Token) HasScope(scope string) bool {
+	return HasString(t.Scopes, scope) || HasString(t.Scopes, ScopeAdmin)
+}
+
+// Expired returns true if the token has an expiry that has passed
+func (t *Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && now.After(t.ExpiresAt)
+}
+
+// Response returns the representation of the token used by the API, which
+// never includes its value
+func (t *Token) Response() types.Token {
+	return types.Token{
+		Signature:  t.Signature,
+		Name:       t.Name,
+		ClientID:   t.ClientID,
+		UserAgent:  t.UserAgent,
+		Scopes:     t.Scopes,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+	}
+}
+
 func (t *Token) Bytes() ([]byte, error) {
 	data, err := json.Marshal(t)
 	if err != nil {
@@ -101,6 +147,116 @@ func (t *Token) Bytes() ([]byte, error) {
 	return data, nil
 }
 
+// ScheduledTwt is a twt queued to be published to a user's feed, or one of
+// the feeds they own, at a later time
+type ScheduledTwt struct {
+	ID        string
+	Username  string
+	Feed      string
+	Text      string
+	PostAt    time.Time
+	CreatedAt time.Time
+}
+
+func NewScheduledTwt(username, feed, text string, postAt time.Time) *ScheduledTwt {
+	return &ScheduledTwt{
+		ID:        shortuuid.New(),
+		Username:  username,
+		Feed:      feed,
+		Text:      text,
+		PostAt:    postAt,
+		CreatedAt: time.Now(),
+	}
+}
+
+func LoadScheduledTwt(data []byte) (st *ScheduledTwt, err error) {
+	st = &ScheduledTwt{}
+	if err = json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Response returns the representation of the scheduled twt used by the API
+func (st *ScheduledTwt) Response() types.ScheduledTwt {
+	return types.ScheduledTwt{
+		ID:        st.ID,
+		Feed:      st.Feed,
+		Text:      st.Text,
+		PostAt:    st.PostAt,
+		CreatedAt: st.CreatedAt,
+	}
+}
+
+func (st *ScheduledTwt) Bytes() ([]byte, error) {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Notification is a notification to a user, e.g: that they were mentioned in
+// a twt or by a webmention
+type Notification struct {
+	ID       string
+	Username string
+	Kind     string
+
+	// From is who the notification is from, e.g: who mentioned the user
+	From types.Twter
+
+	// Text is an excerpt of what the notification is about
+	Text string
+
+	// URL is the url of what the notification is about
+	URL string
+
+	Read      bool
+	CreatedAt time.Time
+}
+
+// NewNotification returns a new notification to username of kind about key
+// (e.g: the hash of the twt the user was mentioned in). Notifications about
+// the same thing have the same id so that users are only ever notified once.
+func NewNotification(username, kind, key string) *Notification {
+	return &Notification{
+		ID:        fmt.Sprintf("%s-%s", kind, FastHash(username+" "+key)),
+		Username:  username,
+		Kind:      kind,
+		CreatedAt: time.Now(),
+	}
+}
+
+func LoadNotification(data []byte) (n *Notification, err error) {
+	n = &Notification{}
+	if err = json.Unmarshal(data, &n); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Response returns the representation of the notification used by the API
+func (n *Notification) Response() types.Notification {
+	return types.Notification{
+		ID:        n.ID,
+		Kind:      n.Kind,
+		From:      n.From,
+		Text:      n.Text,
+		URL:       n.URL,
+		Read:      n.Read,
+		CreatedAt: n.CreatedAt,
+	}
+}
+
+func (n *Notification) Bytes() ([]byte, error) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
 func CreateFeed(conf *Config, db Store, user *User, name string, force bool) error {
 	if user != nil {
 		if !force && len(user.Feeds) > maxUserFeeds {
@@ -254,6 +410,9 @@ func LoadUser(data []byte) (user *User, err error) {
 	if user.Following == nil {
 		user.Following = make(map[string]string)
 	}
+	if user.Inboxes == nil {
+		user.Inboxes = make(map[string]string)
+	}
 
 	user.muted = make(map[string]string)
 	for n, u := range user.Muted {
@@ -357,6 +516,17 @@ func (u *User) AddToken(token *Token) {
 	}
 }
 
+// RemoveToken removes a token from a user
+func (u *User) RemoveToken(signature string) {
+	tokens := u.Tokens[:0]
+	for _, t := range u.Tokens {
+		if t != signature {
+			tokens = append(tokens, t)
+		}
+	}
+	u.Tokens = tokens
+}
+
 // HasToken will compare a token value with stored tokens
 func (u *User) HasToken(token string) bool {
 	for _, t := range u.Tokens {
@@ -377,6 +547,12 @@ func (u *User) OwnsFeed(name string) bool {
 	return false
 }
 
+// CanPostAs returns true if the user can post to the named feed, that is
+// their own feed or one of the feeds they own
+func (u *User) CanPostAs(name string) bool {
+	return name == u.Username || u.OwnsFeed(name)
+}
+
 func (u *User) Is(url string) bool {
 	if NormalizeURL(url) == "" {
 		return false
@@ -431,6 +607,17 @@ func (u *User) Follow(nick, url string) {
 }
 
 func (u *User) FollowAndValidate(conf *Config, nick, url string) error {
+	if activitypub.IsHandle(url) {
+		handleNick, feed, err := ResolveHandleFallback(conf, url)
+		if err != nil {
+			return err
+		}
+		if nick == "" {
+			nick = handleNick
+		}
+		url = feed
+	}
+
 	if err := ValidateFeed(conf, nick, url); err != nil {
 		return err
 	}
@@ -521,6 +708,29 @@ func (u *User) Profile(baseURL string, viewer *User) types.Profile {
 	}
 }
 
+// Settings returns the user's settings as returned by the API, which never
+// include their password hash or tokens
+func (u *User) Settings() types.SettingsResponse {
+	return types.SettingsResponse{
+		Username:  u.Username,
+		Tagline:   u.Tagline,
+		URL:       u.URL,
+		CreatedAt: u.CreatedAt,
+
+		Theme:                      u.Theme,
+		Lang:                       u.Lang,
+		DisplayDatesInTimezone:     u.DisplayDatesInTimezone,
+		IsFollowersPubliclyVisible: u.IsFollowersPubliclyVisible,
+		IsFollowingPubliclyVisible: u.IsFollowingPubliclyVisible,
+		IsBookmarksPubliclyVisible: u.IsBookmarksPubliclyVisible,
+
+		Feeds:     u.Feeds,
+		Followers: u.Followers,
+		Following: u.Following,
+		Muted:     u.Muted,
+	}
+}
+
 func (u *User) Twter() types.Twter {
 	return types.Twter{Nick: u.Username, URL: u.URL}
 }
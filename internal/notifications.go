@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// MentionNotification notifies a user they were @mentioned in a twt
+	MentionNotification = "mention"
+
+	// WebMentionNotification notifies a user they received a webmention
+	WebMentionNotification = "webmention"
+
+	// notificationsMaxAge is how long notifications are kept for, twts older
+	// than this are never notified
+	notificationsMaxAge = 30 * 24 * time.Hour
+
+	// notificationExcerptLength is the maximum length of the excerpt of the
+	// twt a user is notified about
+	notificationExcerptLength = 140
+)
+
+// Notify stores the notification n unless the user was already notified
+// about the same thing (whether they read it or not)
+func Notify(db Store, n *Notification) error {
+	if _, err := db.GetNotification(n.Username, n.ID); err == nil {
+		return nil
+	}
+
+	if err := db.SetNotification(n.ID, n); err != nil {
+		log.WithError(err).Errorf("error storing notification %s for %s", n.ID, n.Username)
+		return err
+	}
+
+	return nil
+}
+
+// GetNotifications returns the notifications of the user, newest first
+func GetNotifications(db Store, username string) ([]*Notification, error) {
+	ns, err := db.GetUserNotifications(username)
+	if err != nil {
+		log.WithError(err).Errorf("error loading notifications for %s", username)
+		return nil, err
+	}
+
+	sort.SliceStable(ns, func(i, j int) bool {
+		return ns[i].CreatedAt.After(ns[j].CreatedAt)
+	})
+
+	return ns, nil
+}
+
+// CountUnreadNotifications returns the number of unread notifications of the
+// user
+func CountUnreadNotifications(db Store, username string) int {
+	ns, err := db.GetUserNotifications(username)
+	if err != nil {
+		log.WithError(err).Errorf("error loading notifications for %s", username)
+		return 0
+	}
+
+	unread := 0
+	for _, n := range ns {
+		if !n.Read {
+			unread++
+		}
+	}
+	return unread
+}
+
+// ReadNotifications marks the notifications of the user with the given ids
+// as read, or all of their notifications if no ids are given
+func ReadNotifications(db Store, username string, ids ...string) error {
+	ns, err := db.GetUserNotifications(username)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range ns {
+		if n.Read || (len(ids) > 0 && !HasString(ids, n.ID)) {
+			continue
+		}
+
+		n.Read = true
+		if err := db.SetNotification(n.ID, n); err != nil {
+			log.WithError(err).Errorf("error updating notification %s", n.ID)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteNotifications removes all notifications of the user
+func DeleteNotifications(db Store, username string) error {
+	ns, err := db.GetUserNotifications(username)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range ns {
+		if err := db.DelNotification(n.Username, n.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NotifyMentions notifies local users of twts @mentioning them (found by
+// Cache.GetMentions) they were not notified of yet
+func NotifyMentions(conf *Config, cache *Cache, db Store) error {
+	users, err := db.GetAllUsers()
+	if err != nil {
+		return err
+	}
+
+	since := time.Now().Add(-notificationsMaxAge)
+
+	for _, user := range users {
+		for _, twt := range cache.GetMentions(user) {
+			twter := twt.Twter()
+			if user.Is(twter.URL) || twt.Created().Before(since) {
+				continue
+			}
+
+			n := NewNotification(user.Username, MentionNotification, twt.Hash())
+			n.From = types.Twter{Nick: twter.Nick, URL: twter.URL, Avatar: twter.Avatar}
+			n.Text = notificationExcerpt(twt.FormatText(types.TextFmt, conf))
+			n.URL = URLForTwt(conf.BaseURL, twt.Hash())
+			n.CreatedAt = twt.Created()
+
+			if err := Notify(db, n); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// PruneNotifications removes notifications older than notificationsMaxAge
+func PruneNotifications(db Store) error {
+	ns, err := db.GetAllNotifications()
+	if err != nil {
+		return err
+	}
+
+	since := time.Now().Add(-notificationsMaxAge)
+	for _, n := range ns {
+		if n.CreatedAt.Before(since) {
+			if err := db.DelNotification(n.Username, n.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// notificationExcerpt returns text shortened to notificationExcerptLength
+func notificationExcerpt(text string) string {
+	runes := []rune(text)
+	if len(runes) <= notificationExcerptLength {
+		return text
+	}
+	return string(runes[:notificationExcerptLength-1]) + "…"
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// NotificationsHandler lists the user's notifications, newest first
+func (s *Server) NotificationsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+		ctx.Translate(s.translator)
+
+		ns, err := GetNotifications(s.db, ctx.User.Username)
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorGetNotifications")
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Title = s.tr(ctx, "PageNotificationsTitle")
+		ctx.Notifications = ns
+		s.render("notifications", w, ctx)
+	}
+}
+
+// ReadNotificationsHandler marks the user's notification given by id (or all
+// of their notifications if none is given) as read
+func (s *Server) ReadNotificationsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+		ctx.Translate(s.translator)
+
+		var ids []string
+		if id := r.FormValue("id"); id != "" {
+			ids = append(ids, id)
+		}
+
+		if err := ReadNotifications(s.db, ctx.User.Username, ids...); err != nil {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorReadNotifications")
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, RedirectRefererURL(r, s.config, "/notifications"), http.StatusFound)
+	}
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifications(t *testing.T) {
+	for typ, file := range map[string]string{"bitcask": "twtxt.db", "sqlite": "twtxt.sqlite"} {
+		typ, file := typ, file
+		t.Run(typ, func(t *testing.T) {
+			testNotifications(t, typ, file)
+		})
+	}
+}
+
+func testNotifications(t *testing.T, typ, file string) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conf := &Config{Data: t.TempDir(), BaseURL: "http://0.0.0.0:8000"}
+
+	db, err := NewStore(typ + "://" + filepath.Join(conf.Data, file))
+	require.NoError(err)
+	defer db.Close()
+
+	older := NewNotification("alice", MentionNotification, "abcdefg")
+	older.CreatedAt = time.Now().Add(-time.Hour)
+	require.NoError(Notify(db, older))
+
+	newer := NewNotification("alice", WebMentionNotification, "https://example.com/post")
+	require.NoError(Notify(db, newer))
+
+	require.NoError(Notify(db, NewNotification("bob", MentionNotification, "abcdefg")))
+
+	ns, err := GetNotifications(db, "alice")
+	require.NoError(err)
+	require.Len(ns, 2)
+	assert.Equal(newer.ID, ns[0].ID)
+	assert.Equal(older.ID, ns[1].ID)
+	assert.Equal(2, CountUnreadNotifications(db, "alice"))
+
+	require.NoError(ReadNotifications(db, "alice", older.ID))
+	assert.Equal(1, CountUnreadNotifications(db, "alice"))
+
+	// Users are only ever notified once about the same thing
+	require.NoError(Notify(db, NewNotification("alice", MentionNotification, "abcdefg")))
+	assert.Equal(1, CountUnreadNotifications(db, "alice"))
+
+	require.NoError(ReadNotifications(db, "alice"))
+	assert.Equal(0, CountUnreadNotifications(db, "alice"))
+	assert.Equal(1, CountUnreadNotifications(db, "bob"))
+
+	expired := NewNotification("bob", MentionNotification, "hijklmn")
+	expired.CreatedAt = time.Now().Add(-notificationsMaxAge - time.Hour)
+	require.NoError(Notify(db, expired))
+	require.NoError(PruneNotifications(db))
+	_, err = db.GetNotification("bob", expired.ID)
+	assert.Equal(ErrNotificationNotFound, err)
+
+	require.NoError(DeleteNotifications(db, "alice"))
+	assert.Equal(int64(1), db.LenNotifications())
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// oauthCodeTTL is how long an authorization code can be exchanged for
+	// a token for
+	oauthCodeTTL = 10 * time.Minute
+)
+
+var (
+	// ErrInvalidClient is returned for authorization requests without a
+	// valid client_id
+	ErrInvalidClient = errors.New("error: invalid client_id")
+
+	// ErrInvalidRedirectURI is returned for authorization requests whose
+	// redirect_uri is not on the same host as their client_id
+	ErrInvalidRedirectURI = errors.New("error: invalid redirect_uri")
+)
+
+// OAuthError is an OAuth2 error code returned to apps (RFC 6749 sections
+// 4.1.2.1 and 5.2)
+type OAuthError string
+
+func (e OAuthError) Error() string { return string(e) }
+
+const (
+	ErrOAuthInvalidRequest          OAuthError = "invalid_request"
+	ErrOAuthInvalidScope            OAuthError = "invalid_scope"
+	ErrOAuthInvalidGrant            OAuthError = "invalid_grant"
+	ErrOAuthAccessDenied            OAuthError = "access_denied"
+	ErrOAuthUnsupportedResponseType OAuthError = "unsupported_response_type"
+	ErrOAuthUnsupportedGrantType    OAuthError = "unsupported_grant_type"
+)
+
+// AuthRequest is an OAuth2 authorization request (RFC 6749 section 4.1.1) of
+// a third-party app. Like IndieAuth apps are identified by the URL of their
+// homepage as their client_id so they need not be registered with the pod,
+// their redirect_uri must be on the same host and as they have no secret
+// they must use PKCE (RFC 7636)
+type AuthRequest struct {
+	ClientID      string
+	RedirectURI   string
+	State         string
+	Scopes        []string
+	CodeChallenge string
+}
+
+// ParseAuthRequest parses the authorization request in the query (or form)
+// of r. A nil request is returned for an invalid client_id or redirect_uri,
+// which must not be redirected to, otherwise the OAuthError is for the app
+func ParseAuthRequest(r *http.Request) (*AuthRequest, error) {
+	client, err := url.Parse(r.FormValue("client_id"))
+	if err != nil || (client.Scheme != "http" && client.Scheme != "https") || client.Host == "" {
+		return nil, ErrInvalidClient
+	}
+
+	redirect, err := url.Parse(r.FormValue("redirect_uri"))
+	if err != nil || redirect.Scheme != client.Scheme || redirect.Host != client.Host || redirect.Fragment != "" {
+		return nil, ErrInvalidRedirectURI
+	}
+
+	req := &AuthRequest{
+		ClientID:      r.FormValue("client_id"),
+		RedirectURI:   r.FormValue("redirect_uri"),
+		State:         r.FormValue("state"),
+		CodeChallenge: r.FormValue("code_challenge"),
+	}
+
+	if r.FormValue("response_type") != "code" {
+		return req, ErrOAuthUnsupportedResponseType
+	}
+
+	if req.CodeChallenge == "" || r.FormValue("code_challenge_method") != "S256" {
+		return req, ErrOAuthInvalidRequest
+	}
+
+	scope := r.FormValue("scope")
+	if scope == "" {
+		scope = ScopeRead
+	}
+	if req.Scopes, err = ParseScopes(scope); err != nil {
+		return req, ErrOAuthInvalidScope
+	}
+
+	return req, nil
+}
+
+// ClientName returns the name of the app shown to users
+func (req *AuthRequest) ClientName() string {
+	return HostnameFromURL(req.ClientID)
+}
+
+// Redirect returns the redirect_uri of the request with params and its state
+func (req *AuthRequest) Redirect(params url.Values) string {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return req.RedirectURI
+	}
+
+	query := u.Query()
+	for k, vs := range params {
+		query[k] = vs
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// authCode is an authorization code a user granted an app
+type authCode struct {
+	*AuthRequest
+
+	Username  string
+	ExpiresAt time.Time
+}
+
+// AuthCodes are the authorization codes granted to apps that were not yet
+// exchanged for a token
+type AuthCodes struct {
+	cache *TTLCache
+}
+
+// NewAuthCodes ...
+func NewAuthCodes() *AuthCodes {
+	return &AuthCodes{cache: NewTTLCache(oauthCodeTTL)}
+}
+
+// Grant returns a new authorization code for the request the user approved
+func (c *AuthCodes) Grant(req *AuthRequest, username string) string {
+	code := GenerateRandomToken()
+	c.cache.set(code, &authCode{
+		AuthRequest: req,
+		Username:    username,
+		ExpiresAt:   time.Now().Add(oauthCodeTTL),
+	})
+	return code
+}
+
+// Exchange returns the request and the user an authorization code was
+// granted for. A code can only be exchanged once by the app it was granted
+// to with the code_verifier of its code_challenge
+func (c *AuthCodes) Exchange(code, clientID, redirectURI, verifier string) (*AuthRequest, string, error) {
+	c.cache.Lock()
+	item := c.cache.items[code]
+	delete(c.cache.items, code)
+	c.cache.Unlock()
+
+	ac, ok := item.value.(*authCode)
+	if !ok {
+		return nil, "", ErrOAuthInvalidGrant
+	}
+
+	if time.Now().After(ac.ExpiresAt) || ac.ClientID != clientID || ac.RedirectURI != redirectURI {
+		return nil, "", ErrOAuthInvalidGrant
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(challenge[:])
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(ac.CodeChallenge)) != 1 {
+		return nil, "", ErrOAuthInvalidGrant
+	}
+
+	return ac.AuthRequest, ac.Username, nil
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// OAuthMetadataHandler describes the pod's OAuth2 endpoints (RFC 8414)
+func (s *Server) OAuthMetadataHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		data, err := json.Marshal(map[string]interface{}{
+			"issuer":                                s.config.BaseURL,
+			"authorization_endpoint":                s.config.BaseURL + "/oauth/authorize",
+			"token_endpoint":                        s.config.BaseURL + "/api/v1/oauth/token",
+			"scopes_supported":                      Scopes,
+			"response_types_supported":              []string{"code"},
+			"grant_types_supported":                 []string{"authorization_code"},
+			"code_challenge_methods_supported":      []string{"S256"},
+			"token_endpoint_auth_methods_supported": []string{"none"},
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// AuthorizeHandler asks the user to approve the OAuth2 authorization request
+// of a third-party app and redirects back to the app with an authorization
+// code it exchanges for a token at /api/v1/oauth/token
+func (s *Server) AuthorizeHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+
+		if !ctx.Authenticated {
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+
+		req, err := ParseAuthRequest(r)
+		if req == nil {
+			log.WithError(err).Warn("invalid authorization request")
+			ctx.Error = true
+			ctx.Message = "Invalid authorization request, the app's client_id or redirect_uri is invalid"
+			s.render("error", w, ctx)
+			return
+		}
+		if err != nil {
+			http.Redirect(w, r, req.Redirect(url.Values{"error": {err.Error()}}), http.StatusFound)
+			return
+		}
+
+		if r.Method == "GET" {
+			ctx.Title = s.tr(ctx, "AuthorizeTitle")
+			ctx.AuthRequest = req
+			s.render("authorize", w, ctx)
+			return
+		}
+
+		if r.FormValue("approve") == "" {
+			http.Redirect(w, r, req.Redirect(url.Values{"error": {ErrOAuthAccessDenied.Error()}}), http.StatusFound)
+			return
+		}
+
+		code := s.api.codes.Grant(req, ctx.Username)
+		log.Infof("%s authorized %s with scopes %v", ctx.Username, req.ClientID, req.Scopes)
+
+		http.Redirect(w, r, req.Redirect(url.Values{"code": {code}}), http.StatusFound)
+	}
+}
@@ -108,6 +108,14 @@ const (
 	// DefaultMaxFetchLimit is the maximum fetch fetch limit in bytes
 	DefaultMaxFetchLimit = 1 << 21 // ~2MB (or more than enough for a year)
 
+	// DefaultMaxFeedSize is the size in bytes past which local feeds are
+	// rotated into archived feeds (well under the fetch limit of most pods)
+	DefaultMaxFeedSize = 1 << 20 // ~1MB
+
+	// DefaultMaxFeedAge is the age of the oldest twt past which local feeds
+	// are rotated into archived feeds (zero disables rotating by age)
+	DefaultMaxFeedAge = 0
+
 	// DefaultAPISessionTime is the server's default session time for API tokens
 	DefaultAPISessionTime = 240 * time.Hour // 10 days
 
@@ -436,6 +444,22 @@ func WithMaxFetchLimit(limit int64) Option {
 	}
 }
 
+// WithMaxFeedSize sets the size in bytes past which local feeds are rotated
+func WithMaxFeedSize(size int64) Option {
+	return func(cfg *Config) error {
+		cfg.MaxFeedSize = size
+		return nil
+	}
+}
+
+// WithMaxFeedAge sets the age of the oldest twt past which local feeds are rotated
+func WithMaxFeedAge(age time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.MaxFeedAge = age
+		return nil
+	}
+}
+
 // WithAPISessionTime sets the API session time for tokens
 func WithAPISessionTime(duration time.Duration) Option {
 	return func(cfg *Config) error {
@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// postAtLayout is the layout of a `datetime-local` form input
+	postAtLayout = "2006-01-02T15:04"
+)
+
+var (
+	ErrInvalidPostAt = errors.New("error: scheduled time must be in the future")
+
+	// scheduledTwtsMu serializes changes to scheduled twts with publishing
+	// them so a twt cannot be edited or cancelled whilst it is published.
+	scheduledTwtsMu sync.Mutex
+)
+
+// ParsePostAt parses the value of a `datetime-local` form input in the given
+// timezone, an empty value returns the zero time (post now).
+func ParsePostAt(value, tz string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	return time.ParseInLocation(postAtLayout, value, loc)
+}
+
+// ScheduleTwt queues text to be published to feed (the user's own feed or one
+// of the feeds they own) at postAt.
+func ScheduleTwt(db Store, user *User, feed, text string, postAt time.Time) (*ScheduledTwt, error) {
+	if feed == "" {
+		feed = user.Username
+	}
+	if !user.CanPostAs(feed) {
+		return nil, ErrFeedImposter
+	}
+	if !postAt.After(time.Now()) {
+		return nil, ErrInvalidPostAt
+	}
+
+	st := NewScheduledTwt(user.Username, feed, text, postAt)
+	if err := db.SetScheduledTwt(st.ID, st); err != nil {
+		log.WithError(err).Errorf("error storing scheduled twt for %s", feed)
+		return nil, err
+	}
+
+	return st, nil
+}
+
+// GetScheduledTwts returns the pending twts of the user and the feeds they
+// own, optionally only those of feed, in the order they will be published.
+func GetScheduledTwts(db Store, user *User, feed string) ([]*ScheduledTwt, error) {
+	all, err := db.GetAllScheduledTwts()
+	if err != nil {
+		log.WithError(err).Error("error loading scheduled twts")
+		return nil, err
+	}
+
+	var sts []*ScheduledTwt
+	for _, st := range all {
+		if !user.CanPostAs(st.Feed) || (feed != "" && st.Feed != feed) {
+			continue
+		}
+		sts = append(sts, st)
+	}
+
+	sort.SliceStable(sts, func(i, j int) bool {
+		return sts[i].PostAt.Before(sts[j].PostAt)
+	})
+
+	return sts, nil
+}
+
+// GetScheduledTwt returns the pending twt identified by id if it is to be
+// published to the user's feed or one of the feeds they own.
+func GetScheduledTwt(db Store, user *User, id string) (*ScheduledTwt, error) {
+	st, err := db.GetScheduledTwt(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't leak the existence of other users' scheduled twts
+	if !user.CanPostAs(st.Feed) {
+		return nil, ErrScheduledTwtNotFound
+	}
+
+	return st, nil
+}
+
+// UpdateScheduledTwt replaces the text and time of a pending twt
+func UpdateScheduledTwt(db Store, user *User, id, text string, postAt time.Time) (*ScheduledTwt, error) {
+	scheduledTwtsMu.Lock()
+	defer scheduledTwtsMu.Unlock()
+
+	st, err := GetScheduledTwt(db, user, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !postAt.After(time.Now()) {
+		return nil, ErrInvalidPostAt
+	}
+
+	st.Text = text
+	st.PostAt = postAt
+
+	if err := db.SetScheduledTwt(st.ID, st); err != nil {
+		log.WithError(err).Errorf("error updating scheduled twt %s", id)
+		return nil, err
+	}
+
+	return st, nil
+}
+
+// CancelScheduledTwt removes a pending twt so it is never published
+func CancelScheduledTwt(db Store, user *User, id string) error {
+	scheduledTwtsMu.Lock()
+	defer scheduledTwtsMu.Unlock()
+
+	st, err := GetScheduledTwt(db, user, id)
+	if err != nil {
+		return err
+	}
+
+	return db.DelScheduledTwt(st.ID)
+}
+
+// PublishScheduledTwt appends a scheduled twt to its feed timestamped with
+// the time it was scheduled for and returns the feed it was published to.
+// The twt is only published if the user that scheduled it still owns the
+// feed.
+func PublishScheduledTwt(conf *Config, db Store, st *ScheduledTwt) (types.Twt, *User, error) {
+	user, err := db.GetUser(st.Username)
+	if err != nil {
+		return types.NilTwt, nil, err
+	}
+
+	if st.Feed == user.Username {
+		twt, err := AppendTwt(conf, db, user, st.Text, st.PostAt)
+		return twt, user, err
+	}
+
+	if !user.OwnsFeed(st.Feed) {
+		return types.NilTwt, nil, ErrFeedImposter
+	}
+
+	feed := &User{Username: st.Feed, URL: URLForUser(conf.BaseURL, st.Feed)}
+	twt, err := AppendSpecial(conf, db, st.Feed, st.Text, st.PostAt)
+	return twt, feed, err
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// ScheduledHandler lists the pending twts of the user and the feeds they own
+func (s *Server) ScheduledHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+		ctx.Translate(s.translator)
+
+		feed := NormalizeFeedName(r.FormValue("feed"))
+		if feed != "" && !ctx.User.CanPostAs(feed) {
+			ctx.Error = true
+			s.render("401", w, ctx)
+			return
+		}
+
+		sts, err := GetScheduledTwts(s.db, ctx.User, feed)
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorGetScheduledTwts")
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Title = s.tr(ctx, "PageScheduledTitle")
+		ctx.ScheduledFeed = feed
+		ctx.ScheduledTwts = sts
+		s.render("scheduled", w, ctx)
+	}
+}
+
+// EditScheduledHandler shows and updates a pending twt
+func (s *Server) EditScheduledHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+		ctx.Translate(s.translator)
+
+		id := p.ByName("id")
+
+		st, err := GetScheduledTwt(s.db, ctx.User, id)
+		if err != nil {
+			log.WithError(err).Warnf("error loading scheduled twt %s", id)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorScheduledTwtNotFound")
+			s.render("404", w, ctx)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			ctx.Title = s.tr(ctx, "PageEditScheduledTitle")
+			ctx.ScheduledTwt = st
+			s.render("editScheduled", w, ctx)
+			return
+		}
+
+		text := CleanTwt(r.FormValue("text"))
+		if text == "" {
+			ctx.Error = true
+			ctx.Message = "No post content provided!"
+			s.render("error", w, ctx)
+			return
+		}
+
+		postAt, err := ParsePostAt(r.FormValue("postat"), ctx.User.DisplayDatesInTimezone)
+		if err != nil || postAt.IsZero() {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorInvalidPostAt")
+			s.render("error", w, ctx)
+			return
+		}
+
+		if _, err := UpdateScheduledTwt(s.db, ctx.User, id, text, postAt); err != nil {
+			log.WithError(err).Errorf("error updating scheduled twt %s", id)
+			ctx.Error = true
+			switch err {
+			case ErrInvalidPostAt:
+				ctx.Message = s.tr(ctx, "ErrorInvalidPostAt")
+			case ErrScheduledTwtNotFound:
+				// Published or cancelled in the meantime
+				ctx.Message = s.tr(ctx, "ErrorScheduledTwtNotFound")
+			default:
+				ctx.Message = s.tr(ctx, "ErrorScheduleTwt")
+			}
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/scheduled", http.StatusFound)
+	}
+}
+
+// CancelScheduledHandler cancels a pending twt
+func (s *Server) CancelScheduledHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s.config, s.db, r)
+		ctx.Translate(s.translator)
+
+		id := p.ByName("id")
+
+		if err := CancelScheduledTwt(s.db, ctx.User, id); err != nil {
+			log.WithError(err).Errorf("error cancelling scheduled twt %s", id)
+			ctx.Error = true
+			if err == ErrScheduledTwtNotFound {
+				ctx.Message = s.tr(ctx, "ErrorScheduledTwtNotFound")
+				s.render("404", w, ctx)
+				return
+			}
+			ctx.Message = s.tr(ctx, "ErrorCancelScheduledTwt")
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/scheduled", http.StatusFound)
+	}
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/lextwt"
+)
+
+func TestScheduledTwts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lextwt.DefaultTwtManager()
+
+	conf := &Config{Data: t.TempDir(), BaseURL: "http://0.0.0.0:8000"}
+
+	db, err := NewStore("sqlite://" + filepath.Join(conf.Data, "twtxt.sqlite"))
+	require.NoError(err)
+	defer db.Close()
+
+	alice := NewUser()
+	alice.Username = "alice"
+	alice.URL = URLForUser(conf.BaseURL, "alice")
+	alice.Feeds = []string{"alice_news"}
+	require.NoError(db.SetUser("alice", alice))
+
+	bob := NewUser()
+	bob.Username = "bob"
+	require.NoError(db.SetUser("bob", bob))
+
+	postAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	_, err = ScheduleTwt(db, alice, "", "Hello", time.Now().Add(-time.Minute))
+	assert.Equal(ErrInvalidPostAt, err)
+
+	_, err = ScheduleTwt(db, bob, "alice_news", "Hello", postAt)
+	assert.Equal(ErrFeedImposter, err)
+
+	later, err := ScheduleTwt(db, alice, "", "Later", postAt.Add(time.Hour))
+	require.NoError(err)
+	news, err := ScheduleTwt(db, alice, "alice_news", "News", postAt)
+	require.NoError(err)
+
+	sts, err := GetScheduledTwts(db, alice, "")
+	require.NoError(err)
+	require.Len(sts, 2)
+	assert.Equal(news.ID, sts[0].ID)
+	assert.Equal(later.ID, sts[1].ID)
+
+	sts, err = GetScheduledTwts(db, alice, "alice_news")
+	require.NoError(err)
+	require.Len(sts, 1)
+	assert.Equal(news.ID, sts[0].ID)
+
+	sts, err = GetScheduledTwts(db, bob, "")
+	require.NoError(err)
+	assert.Empty(sts)
+
+	_, err = UpdateScheduledTwt(db, bob, later.ID, "Hijacked", postAt)
+	assert.Equal(ErrScheduledTwtNotFound, err)
+	assert.Equal(ErrScheduledTwtNotFound, CancelScheduledTwt(db, bob, later.ID))
+
+	updated, err := UpdateScheduledTwt(db, alice, later.ID, "Sooner", postAt)
+	require.NoError(err)
+	assert.Equal("Sooner", updated.Text)
+
+	require.NoError(CancelScheduledTwt(db, alice, news.ID))
+	assert.Equal(int64(1), db.LenScheduledTwts())
+
+	twt, feed, err := PublishScheduledTwt(conf, db, updated)
+	require.NoError(err)
+	assert.Equal(alice.URL, feed.URL)
+	assert.True(postAt.Equal(twt.Created()))
+
+	f, err := os.Open(filepath.Join(conf.Data, feedsDir, "alice"))
+	require.NoError(err)
+	defer f.Close()
+
+	twtFile, err := types.ParseFile(f, alice.Twter())
+	require.NoError(err)
+	require.Len(twtFile.Twts(), 1)
+	assert.Equal(twt.Hash(), twtFile.Twts()[0].Hash())
+}
@@ -0,0 +1,389 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	searchDateFormat = "2006-01-02"
+	minSearchTermLen = 2
+)
+
+// SearchQuery is a parsed search query. Free text is split into Terms and
+// the special forms `#tag`, `@mention`, `from:nick`, `before:date` and
+// `after:date` are extracted into their own fields. All conditions must
+// match for a twt to be returned.
+type SearchQuery struct {
+	Terms    []string
+	Tags     []string
+	Mentions []string
+	From     []string
+	Before   time.Time
+	After    time.Time
+}
+
+// ParseSearchQuery parses a search query string such as
+// `go #twtxt from:prologic after:2020-12-01`
+func ParseSearchQuery(q string) SearchQuery {
+	var query SearchQuery
+
+	for _, field := range strings.Fields(q) {
+		lower := strings.ToLower(field)
+		switch {
+		case strings.HasPrefix(lower, "#") && len(lower) > 1:
+			query.Tags = append(query.Tags, strings.TrimPrefix(lower, "#"))
+		case strings.HasPrefix(lower, "@") && len(lower) > 1:
+			query.Mentions = append(query.Mentions, strings.TrimPrefix(lower, "@"))
+		case strings.HasPrefix(lower, "from:") && len(lower) > 5:
+			query.From = append(query.From, strings.TrimPrefix(strings.TrimPrefix(lower, "from:"), "@"))
+		case strings.HasPrefix(lower, "before:"):
+			if t, ok := parseSearchDate(strings.TrimPrefix(lower, "before:")); ok {
+				query.Before = t
+			}
+		case strings.HasPrefix(lower, "after:"):
+			if t, ok := parseSearchDate(strings.TrimPrefix(lower, "after:")); ok {
+				query.After = t
+			}
+		default:
+			query.Terms = append(query.Terms, tokenize(field)...)
+		}
+	}
+
+	query.Terms = UniqStrings(query.Terms)
+
+	return query
+}
+
+func parseSearchDate(s string) (time.Time, bool) {
+	if t, err := time.Parse(searchDateFormat, s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.RFC3339, strings.ToUpper(s)); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// IsZero returns true if the query has no conditions at all
+func (q SearchQuery) IsZero() bool {
+	return len(q.Terms) == 0 && len(q.Tags) == 0 && len(q.Mentions) == 0 &&
+		len(q.From) == 0 && q.Before.IsZero() && q.After.IsZero()
+}
+
+// tokenize splits text into lowercase terms on anything that is not a
+// letter or a digit, dropping terms that are too short to be useful.
+func tokenize(text string) []string {
+	var terms []string
+
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, field := range fields {
+		if len([]rune(field)) >= minSearchTermLen {
+			terms = append(terms, field)
+		}
+	}
+
+	return terms
+}
+
+type searchDoc struct {
+	twt      types.Twt
+	terms    map[string]int
+	tags     []string
+	mentions []string
+	authors  []string
+}
+
+// newSearchDoc returns the terms, tags, mentions and authors twt is indexed
+// under, see SearchIndex and IndexedArchiver.Search
+func newSearchDoc(twt types.Twt) *searchDoc {
+	doc := &searchDoc{twt: twt, terms: make(map[string]int)}
+
+	for _, term := range tokenize(fmt.Sprintf("%c", twt)) {
+		doc.terms[term]++
+	}
+
+	for _, tag := range twt.Tags() {
+		text := tag.Text()
+		if text == "" {
+			text = tag.Target()
+		}
+		if text = strings.ToLower(text); text != "" && !HasString(doc.tags, text) {
+			doc.tags = append(doc.tags, text)
+		}
+	}
+
+	for _, m := range twt.Mentions() {
+		for _, key := range twterKeys(m.Twter()) {
+			if !HasString(doc.mentions, key) {
+				doc.mentions = append(doc.mentions, key)
+			}
+		}
+	}
+
+	for _, key := range twterKeys(twt.Twter()) {
+		if !HasString(doc.authors, key) {
+			doc.authors = append(doc.authors, key)
+		}
+	}
+
+	return doc
+}
+
+// searchResult is a twt matching a search query and its tf-idf score
+type searchResult struct {
+	twt   types.Twt
+	score float64
+}
+
+// sortSearchResults orders results by score, ties (and queries without
+// terms) newest first, and returns their twts
+func sortSearchResults(results []searchResult) types.Twts {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].twt.Created().After(results[j].twt.Created())
+	})
+
+	twts := make(types.Twts, len(results))
+	for i, r := range results {
+		twts[i] = r.twt
+	}
+
+	return twts
+}
+
+type postings map[string]map[string]bool
+
+func (p postings) add(key, hash string) {
+	if _, ok := p[key]; !ok {
+		p[key] = make(map[string]bool)
+	}
+	p[key][hash] = true
+}
+
+func (p postings) del(key, hash string) {
+	delete(p[key], hash)
+	if len(p[key]) == 0 {
+		delete(p, key)
+	}
+}
+
+// SearchIndex is an in-memory inverted index of the cached twts keyed by
+// free-text terms, tags, mentions and authors. Only the latest version of
+// edited twts is indexed and deleted and evicted twts are removed, archived
+// twts are searched through the archive's own index (see Cache.Search).
+type SearchIndex struct {
+	mu sync.RWMutex
+
+	docs     map[string]*searchDoc
+	terms    postings
+	tags     postings
+	mentions postings
+	authors  postings
+}
+
+// NewSearchIndex ...
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		docs:     make(map[string]*searchDoc),
+		terms:    make(postings),
+		tags:     make(postings),
+		mentions: make(postings),
+		authors:  make(postings),
+	}
+}
+
+// Count returns the number of twts in the index
+func (idx *SearchIndex) Count() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.docs)
+}
+
+// Has returns true if the twt identified by hash is indexed
+func (idx *SearchIndex) Has(hash string) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	_, ok := idx.docs[hash]
+	return ok
+}
+
+// Index adds twts to the index, twts already indexed are skipped.
+func (idx *SearchIndex) Index(twts ...types.Twt) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, twt := range twts {
+		if twt.IsZero() {
+			continue
+		}
+		hash := twt.Hash()
+		if _, ok := idx.docs[hash]; ok {
+			continue
+		}
+
+		doc := newSearchDoc(twt)
+		for term := range doc.terms {
+			idx.terms.add(term, hash)
+		}
+		for _, tag := range doc.tags {
+			idx.tags.add(tag, hash)
+		}
+		for _, key := range doc.mentions {
+			idx.mentions.add(key, hash)
+		}
+		for _, key := range doc.authors {
+			idx.authors.add(key, hash)
+		}
+
+		idx.docs[hash] = doc
+	}
+}
+
+// Remove removes the twts identified by hashes from the index
+func (idx *SearchIndex) Remove(hashes ...string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, hash := range hashes {
+		doc, ok := idx.docs[hash]
+		if !ok {
+			continue
+		}
+
+		for term := range doc.terms {
+			idx.terms.del(term, hash)
+		}
+		for _, tag := range doc.tags {
+			idx.tags.del(tag, hash)
+		}
+		for _, key := range doc.mentions {
+			idx.mentions.del(key, hash)
+		}
+		for _, key := range doc.authors {
+			idx.authors.del(key, hash)
+		}
+
+		delete(idx.docs, hash)
+	}
+}
+
+// Search returns all twts matching the query. Results with free-text terms
+// are ranked by a simple tf-idf score, ties (and queries without terms) are
+// ordered newest first.
+func (idx *SearchIndex) Search(q SearchQuery) types.Twts {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if q.IsZero() {
+		return nil
+	}
+
+	var lists []map[string]bool
+	for _, term := range q.Terms {
+		lists = append(lists, idx.terms[term])
+	}
+	for _, tag := range q.Tags {
+		lists = append(lists, idx.tags[tag])
+	}
+	for _, mention := range q.Mentions {
+		lists = append(lists, idx.mentions[mention])
+	}
+	// Multiple from: conditions are OR'ed as a twt only has one author
+	if len(q.From) > 0 {
+		from := make(map[string]bool)
+		for _, nick := range q.From {
+			for hash := range idx.authors[nick] {
+				from[hash] = true
+			}
+		}
+		lists = append(lists, from)
+	}
+
+	var candidates []string
+	if len(lists) == 0 {
+		for hash := range idx.docs {
+			candidates = append(candidates, hash)
+		}
+	} else {
+		sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	outer:
+		for hash := range lists[0] {
+			for _, list := range lists[1:] {
+				if !list[hash] {
+					continue outer
+				}
+			}
+			candidates = append(candidates, hash)
+		}
+	}
+
+	var results []searchResult
+	n := float64(len(idx.docs))
+
+	for _, hash := range candidates {
+		doc := idx.docs[hash]
+		created := doc.twt.Created()
+		if !q.Before.IsZero() && !created.Before(q.Before) {
+			continue
+		}
+		if !q.After.IsZero() && created.Before(q.After) {
+			continue
+		}
+
+		var score float64
+		for _, term := range q.Terms {
+			idf := math.Log(1 + n/float64(len(idx.terms[term])))
+			score += float64(doc.terms[term]) * idf
+		}
+		results = append(results, searchResult{doc.twt, score})
+	}
+
+	return sortSearchResults(results)
+}
+
+// twterKeys returns the lowercased keys a Twter is indexed under, the bare
+// nick and the nick@domain form.
+func twterKeys(twter types.Twter) []string {
+	var keys []string
+	if nick := strings.ToLower(twter.Nick); nick != "" {
+		keys = append(keys, nick)
+		if domainNick := strings.ToLower(twter.DomainNick()); domainNick != nick && !strings.HasSuffix(domainNick, "@") {
+			keys = append(keys, domainNick)
+		}
+	}
+	return keys
+}
+
+// searchArchiver wraps an Archiver and removes twts deleted from the archive
+// from a SearchIndex, archived twts are searched through the archive itself.
+type searchArchiver struct {
+	Archiver
+	index *SearchIndex
+}
+
+// NewSearchArchiver returns an Archiver that removes deleted twts from index
+func NewSearchArchiver(archive Archiver, index *SearchIndex) Archiver {
+	return &searchArchiver{Archiver: archive, index: index}
+}
+
+func (a *searchArchiver) Del(hash string) error {
+	if err := a.Archiver.Del(hash); err != nil {
+		return err
+	}
+	a.index.Remove(hash)
+	return nil
+}
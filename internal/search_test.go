@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/lextwt"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	q := ParseSearchQuery("Hello, World! #Twtxt @prologic from:@James after:2020-12-01 before:2021-01-01")
+
+	assert.Equal([]string{"hello", "world"}, q.Terms)
+	assert.Equal([]string{"twtxt"}, q.Tags)
+	assert.Equal([]string{"prologic"}, q.Mentions)
+	assert.Equal([]string{"james"}, q.From)
+	assert.Equal(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC), q.After)
+	assert.Equal(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), q.Before)
+	assert.False(q.IsZero())
+
+	assert.True(ParseSearchQuery("  ").IsZero())
+	assert.True(ParseSearchQuery("a").IsZero())
+}
+
+func TestSearchIndex(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	alice := types.Twter{Nick: "alice", URL: "https://example.com/alice/twtxt.txt"}
+	bob := types.Twter{Nick: "bob", URL: "https://example.org/bob/twtxt.txt"}
+
+	parse := func(line string, twter types.Twter) types.Twt {
+		twt, err := lextwt.ParseLine(line, twter)
+		require.NoError(err)
+		return twt
+	}
+
+	t1 := parse("2020-12-01T10:00:00Z\tGo is great, go go go! #golang", alice)
+	t2 := parse("2020-12-15T10:00:00Z\tLearning go with @<alice https://example.com/alice/twtxt.txt>", bob)
+	t3 := parse("2021-01-10T10:00:00Z\tNothing to see here #golang", bob)
+
+	idx := NewSearchIndex()
+	idx.Index(t1, t2, t3)
+	idx.Index(t1) // already indexed
+	assert.Equal(3, idx.Count())
+
+	// Ranked by term frequency
+	twts := idx.Search(ParseSearchQuery("go"))
+	require.Len(twts, 2)
+	assert.Equal(t1.Hash(), twts[0].Hash())
+	assert.Equal(t2.Hash(), twts[1].Hash())
+
+	// Tags, newest first
+	twts = idx.Search(ParseSearchQuery("#golang"))
+	require.Len(twts, 2)
+	assert.Equal(t3.Hash(), twts[0].Hash())
+
+	// Mentions and authors
+	twts = idx.Search(ParseSearchQuery("@alice"))
+	require.Len(twts, 1)
+	assert.Equal(t2.Hash(), twts[0].Hash())
+
+	twts = idx.Search(ParseSearchQuery("from:bob #golang"))
+	require.Len(twts, 1)
+	assert.Equal(t3.Hash(), twts[0].Hash())
+
+	twts = idx.Search(ParseSearchQuery("from:bob@example.org"))
+	assert.Len(twts, 2)
+
+	// Dates
+	twts = idx.Search(ParseSearchQuery("after:2020-12-10 before:2021-01-01"))
+	require.Len(twts, 1)
+	assert.Equal(t2.Hash(), twts[0].Hash())
+
+	// Removal
+	idx.Remove(t1.Hash())
+	assert.False(idx.Has(t1.Hash()))
+	assert.Len(idx.Search(ParseSearchQuery("#golang")), 1)
+	assert.Empty(idx.Search(ParseSearchQuery("great")))
+}
+
+func TestCacheSearchArchive(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+
+	alice := types.Twter{Nick: "alice", URL: "https://example.com/alice/twtxt.txt"}
+
+	parse := func(line string) types.Twt {
+		twt, err := lextwt.ParseLine(line, alice)
+		require.NoError(err)
+		return twt
+	}
+
+	t1 := parse("2020-12-01T10:00:00Z\tHello World #twtxt")
+	t2 := parse("2020-12-15T10:00:00Z\tHello Mars")
+	t3 := parse("2020-12-15T10:00:00Z\tHello Venus")
+
+	archive, err := NewIndexedArchiver(filepath.Join(dir, indexedArchiveDir))
+	require.NoError(err)
+	defer archive.Close()
+
+	for _, twt := range []types.Twt{t1, t2, t3} {
+		require.NoError(archive.Archive(twt))
+	}
+
+	// Archived twts are searched through the archive's index
+	twts, err := archive.Search(ParseSearchQuery("#twtxt from:alice"))
+	require.NoError(err)
+	require.Len(twts, 1)
+	assert.Equal(t1.Hash(), twts[0].Hash())
+
+	cache, err := LoadCache(dir)
+	require.NoError(err)
+	assert.Equal(0, cache.Index().Count())
+
+	// t2 was edited (to t3) so only its latest version is searchable
+	cache.recordEdit(t2.Hash(), t3.Hash())
+
+	twts = cache.Search(archive, ParseSearchQuery("hello"))
+	require.Len(twts, 2)
+	for _, twt := range twts {
+		assert.NotEqual(t2.Hash(), twt.Hash())
+	}
+
+	// Deleted twts are no longer searchable
+	require.NoError(archive.Del(t1.Hash()))
+	twts, err = archive.Search(ParseSearchQuery("hello"))
+	require.NoError(err)
+	assert.Len(twts, 2)
+}
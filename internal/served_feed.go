@@ -0,0 +1,328 @@
+package internal
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	log "github.com/sirupsen/logrus"
+)
+
+// servedFeedExt is appended to the name of a feed file for the feed as
+// served (with its preamble rendered), precompressed variants of which are
+// cached alongside it with their own extension appended.
+const servedFeedExt = ".txt"
+
+// servedFeedStampExt is appended to the name of a served feed for the stamp
+// (size and mtime) of the feed file it was written from, see loadServedFeed
+const servedFeedStampExt = ".src"
+
+// servedFeedsMu serializes (re)writing served feeds and their precompressed
+// variants so that a variant is never written from an outdated served feed
+var servedFeedsMu sync.Mutex
+
+// feedEncoding is a content encoding a served feed is precompressed with
+type feedEncoding struct {
+	Name string
+	Ext  string
+
+	NewWriter func(w io.Writer) io.WriteCloser
+}
+
+// feedEncodings are the supported content encodings in order of preference
+var feedEncodings = []feedEncoding{
+	{
+		Name: "br",
+		Ext:  ".br",
+		NewWriter: func(w io.Writer) io.WriteCloser {
+			return brotli.NewWriterLevel(w, brotli.BestCompression)
+		},
+	},
+	{
+		Name: "gzip",
+		Ext:  ".gz",
+		NewWriter: func(w io.Writer) io.WriteCloser {
+			zw, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+			return zw
+		},
+	},
+}
+
+// servedFeed is a local feed as served, that is its rendered preamble
+// followed by its twts. It is only rewritten when the feed or its preamble
+// change so it has a strong ETag and can be served with Range requests.
+type servedFeed struct {
+	path string
+	info os.FileInfo
+}
+
+// writeFileAtomic writes a file by writing to a temporary file alongside it
+// and renaming it, so readers never see a partially written file
+func writeFileAtomic(fn string, write func(w io.Writer) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(fn), filepath.Base(fn)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), fn)
+}
+
+// fileHasPrefix returns true if the contents of the file fn start with prefix
+func fileHasPrefix(fn, prefix string) bool {
+	f, err := os.Open(fn)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	buf := make([]byte, len(prefix))
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return false
+	}
+	return string(buf) == prefix
+}
+
+// servedFeedStamp returns the stamp of a feed file given its stat info
+func servedFeedStamp(info os.FileInfo) string {
+	return fmt.Sprintf("%d %d\n", info.Size(), info.ModTime().UnixNano())
+}
+
+// loadServedFeed returns the served feed of the feed file fn (with stat
+// info), writing it from preamble and body (the feed without its own
+// preamble if any) if it is missing, was written from a different version
+// of the feed or was served with a different preamble (e.g: the user's
+// profile changed). info must be taken before body is read, so that a feed
+// written to concurrently is at worst written again on the next request.
+func loadServedFeed(fn string, info os.FileInfo, preamble string, body io.Reader) (*servedFeed, error) {
+	sfn := fn + servedFeedExt
+	stamp := servedFeedStamp(info)
+
+	servedFeedsMu.Lock()
+	defer servedFeedsMu.Unlock()
+
+	if si, err := os.Stat(sfn); err == nil && fileHasPrefix(sfn+servedFeedStampExt, stamp) && fileHasPrefix(sfn, preamble) {
+		return &servedFeed{path: sfn, info: si}, nil
+	}
+
+	removeFeedVariants(sfn)
+
+	if err := writeFileAtomic(sfn, func(w io.Writer) error {
+		if _, err := io.WriteString(w, preamble); err != nil {
+			return err
+		}
+		_, err := io.Copy(w, body)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := writeFileAtomic(sfn+servedFeedStampExt, func(w io.Writer) error {
+		_, err := io.WriteString(w, stamp)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	si, err := os.Stat(sfn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &servedFeed{path: sfn, info: si}, nil
+}
+
+// removeFeedVariants removes the precompressed variants of the served (or
+// archived) feed fn so they are written again from its current contents
+func removeFeedVariants(fn string) {
+	for _, enc := range feedEncodings {
+		os.Remove(fn + enc.Ext)
+	}
+}
+
+// ETag returns the strong ETag of the served feed in the given content
+// encoding ("" is the identity encoding)
+func (sf *servedFeed) ETag(encoding string) string {
+	etag := fmt.Sprintf("%x-%x", sf.info.ModTime().UnixNano(), sf.info.Size())
+	if encoding != "" {
+		etag += "-" + encoding
+	}
+	return strconv.Quote(etag)
+}
+
+// Variant returns the path of the served feed precompressed with enc,
+// writing it if it is missing. Variants are removed whenever the served feed
+// is rewritten (see loadServedFeed and removeFeedVariants).
+func (sf *servedFeed) Variant(enc feedEncoding) (string, error) {
+	vfn := sf.path + enc.Ext
+
+	servedFeedsMu.Lock()
+	defer servedFeedsMu.Unlock()
+
+	if FileExists(vfn) {
+		return vfn, nil
+	}
+
+	f, err := os.Open(sf.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := writeFileAtomic(vfn, func(w io.Writer) error {
+		cw := enc.NewWriter(w)
+		if _, err := io.Copy(cw, f); err != nil {
+			cw.Close()
+			return err
+		}
+		return cw.Close()
+	}); err != nil {
+		return "", err
+	}
+
+	return vfn, nil
+}
+
+// matchesETag returns true if the If-None-Match header inm matches the
+// served feed in any content encoding, since they all have the same content
+func (sf *servedFeed) matchesETag(inm string) bool {
+	etag, _ := strconv.Unquote(sf.ETag(""))
+
+	for _, tag := range strings.Split(inm, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" {
+			return true
+		}
+
+		tag, err := strconv.Unquote(tag)
+		if err != nil {
+			continue
+		}
+
+		if tag == etag {
+			return true
+		}
+		for _, enc := range feedEncodings {
+			if tag == etag+"-"+enc.Name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// acceptsEncoding returns true if the request accepts the given content
+// encoding, i.e: it is listed in Accept-Encoding without a q-value of zero
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(accept, ";")
+		if !strings.EqualFold(strings.TrimSpace(parts[0]), encoding) {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// Serve serves the served feed honouring conditional and Range requests. A
+// precompressed variant is served if the client accepts one, except for
+// Range requests which are always served from the feed as is so that the
+// offsets can be used to fetch only what was appended to the feed.
+func (sf *servedFeed) Serve(w http.ResponseWriter, r *http.Request) {
+	var enc *feedEncoding
+	if r.Header.Get("Range") == "" {
+		for i := range feedEncodings {
+			if acceptsEncoding(r, feedEncodings[i].Name) {
+				enc = &feedEncodings[i]
+				break
+			}
+		}
+	}
+
+	if w.Header().Get("Vary") == "" {
+		w.Header().Set("Vary", "Accept-Encoding")
+	}
+
+	if enc != nil {
+		w.Header().Set("ETag", sf.ETag(enc.Name))
+	} else {
+		w.Header().Set("ETag", sf.ETag(""))
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && sf.matchesETag(inm) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	fn := sf.path
+	if enc != nil {
+		vfn, err := sf.Variant(*enc)
+		if err != nil {
+			log.WithError(err).Warnf("error writing %s variant of %s", enc.Name, sf.path)
+			w.Header().Set("ETag", sf.ETag(""))
+		} else {
+			w.Header().Set("Content-Encoding", enc.Name)
+			fn = vfn
+		}
+	}
+
+	f, err := os.Open(fn)
+	if err != nil {
+		log.WithError(err).Errorf("error opening served feed %s", fn)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeContent(w, r, "", sf.info.ModTime(), f)
+}
+
+// removeServedFeed removes the served feed of the feed file fn, its archived
+// feeds and their precompressed variants, e.g: when the feed is deleted
+func removeServedFeed(fn string) {
+	sfn := fn + servedFeedExt
+	removeFeedVariants(sfn)
+	os.Remove(sfn + servedFeedStampExt)
+	os.Remove(sfn)
+
+	archives, _ := filepath.Glob(archivedFeedPath(fn, "*"))
+	for _, archive := range archives {
+		os.Remove(archive)
+	}
+	for _, enc := range feedEncodings {
+		variants, _ := filepath.Glob(archivedFeedPath(fn, "*") + enc.Ext)
+		for _, variant := range variants {
+			os.Remove(variant)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServedFeed(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fn := filepath.Join(t.TempDir(), "alice")
+	preamble := "# nick = alice\n"
+
+	write := func(data string) {
+		require.NoError(ioutil.WriteFile(fn, []byte(data), 0644))
+	}
+
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		info, err := os.Stat(fn)
+		require.NoError(err)
+		f, err := os.Open(fn)
+		require.NoError(err)
+		defer f.Close()
+
+		sf, err := loadServedFeed(fn, info, preamble, f)
+		require.NoError(err)
+
+		r := httptest.NewRequest(http.MethodGet, "/user/alice/twtxt.txt", nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		sf.Serve(w, r)
+		return w
+	}
+
+	twts := "2020-12-01T00:00:00Z\tHello\n"
+	write(twts)
+
+	// Identity
+	res := serve(nil)
+	assert.Equal(http.StatusOK, res.Code)
+	assert.Equal(preamble+twts, res.Body.String())
+	etag := res.Header().Get("ETag")
+	assert.NotEmpty(etag)
+
+	assert.Equal(http.StatusNotModified, serve(map[string]string{"If-None-Match": etag}).Code)
+
+	// Precompressed variants
+	res = serve(map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(http.StatusOK, res.Code)
+	assert.Equal("gzip", res.Header().Get("Content-Encoding"))
+	assert.NotEqual(etag, res.Header().Get("ETag"))
+	zr, err := gzip.NewReader(res.Body)
+	require.NoError(err)
+	data, err := ioutil.ReadAll(zr)
+	require.NoError(err)
+	assert.Equal(preamble+twts, string(data))
+	assert.FileExists(fn + servedFeedExt + ".gz")
+
+	gzipETag := res.Header().Get("ETag")
+	assert.Equal(http.StatusNotModified, serve(map[string]string{"If-None-Match": gzipETag}).Code)
+
+	res = serve(map[string]string{"Accept-Encoding": "gzip, br"})
+	assert.Equal("br", res.Header().Get("Content-Encoding"))
+	data, err = ioutil.ReadAll(brotli.NewReader(res.Body))
+	require.NoError(err)
+	assert.Equal(preamble+twts, string(data))
+
+	res = serve(map[string]string{"Accept-Encoding": "gzip, br;q=0"})
+	assert.Equal("gzip", res.Header().Get("Content-Encoding"))
+
+	// Range requests are always of the identity encoding
+	res = serve(map[string]string{"Accept-Encoding": "gzip", "Range": "bytes=15-"})
+	assert.Equal(http.StatusPartialContent, res.Code)
+	assert.Empty(res.Header().Get("Content-Encoding"))
+	assert.Equal(twts, res.Body.String())
+
+	// Appending to the feed changes the ETag and variants
+	more := "2020-12-02T00:00:00Z\tWorld\n"
+	write(twts + more)
+
+	res = serve(map[string]string{"If-None-Match": etag, "Range": "bytes=15-"})
+	assert.Equal(http.StatusPartialContent, res.Code)
+	assert.Equal(twts+more, res.Body.String())
+	assert.NotEqual(etag, res.Header().Get("ETag"))
+
+	res = serve(map[string]string{"Accept-Encoding": "gzip"})
+	zr, err = gzip.NewReader(res.Body)
+	require.NoError(err)
+	data, err = ioutil.ReadAll(zr)
+	require.NoError(err)
+	assert.Equal(preamble+twts+more, string(data))
+
+	// Changing the preamble rewrites the served feed
+	preamble = "# nick = alice\n# description = Hi!\n"
+	assert.Equal(preamble+twts+more, serve(nil).Body.String())
+
+	// The served feed is rewritten whenever the feed changes even if the
+	// served feed is newer (e.g: it was written whilst the feed was written)
+	edited := "2020-12-02T00:00:00Z\tWorld!\n"
+	write(twts + edited)
+	past := time.Now().Add(-time.Hour)
+	require.NoError(os.Chtimes(fn, past, past))
+	assert.Equal(preamble+twts+edited, serve(nil).Body.String())
+
+	res = serve(map[string]string{"Accept-Encoding": "gzip"})
+	zr, err = gzip.NewReader(res.Body)
+	require.NoError(err)
+	data, err = ioutil.ReadAll(zr)
+	require.NoError(err)
+	assert.Equal(preamble+twts+edited, string(data))
+}
@@ -26,15 +26,19 @@ import (
 	"github.com/unrolled/logger"
 
 	"github.com/jointwt/twtxt"
+	"github.com/jointwt/twtxt/internal/activitypub"
 	"github.com/jointwt/twtxt/internal/auth"
 	"github.com/jointwt/twtxt/internal/passwords"
 	"github.com/jointwt/twtxt/internal/session"
 	"github.com/jointwt/twtxt/internal/webmention"
+	"github.com/jointwt/twtxt/types"
 )
 
 var (
 	metrics     *observe.Metrics
 	webmentions *webmention.WebMention
+	federation  *Federation
+	websubs     *WebSub
 
 	//go:embed static/css
 	staticCSS embed.FS
@@ -105,6 +109,7 @@ type Server struct {
 func (s *Server) render(name string, w http.ResponseWriter, ctx *Context) {
 	if ctx.Authenticated && ctx.Username != "" {
 		ctx.NewMessages = s.msgs.Get(ctx.User.Username)
+		ctx.NewNotifications = CountUnreadNotifications(s.db, ctx.User.Username)
 	}
 
 	buf, err := s.tmplman.Exec(name, ctx)
@@ -145,6 +150,11 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		return err
 	}
 
+	if err := s.archive.Close(); err != nil {
+		log.WithError(err).Error("error closing archive")
+		return err
+	}
+
 	return nil
 }
 
@@ -392,40 +402,35 @@ func (s *Server) processWebMention(source, target *url.URL, sourceData *microfor
 		log.WithError(err).Warnf("error parsing mf2 source data from %s", source)
 	}
 
-	if authorName != "" && sourceFeed != "" {
-		if _, err := AppendSpecial(
-			s.config, s.db,
-			twtxtBot,
-			fmt.Sprintf(
-				"MENTION: @<%s %s> from @<%s %s> on %s",
-				user.Username, user.URL, authorName, sourceFeed,
-				source.String(),
-			),
-		); err != nil {
-			log.WithError(err).Warnf("error appending special MENTION post")
-			return err
-		}
-	} else {
-		if _, err := AppendSpecial(
-			s.config, s.db,
-			twtxtBot,
-			fmt.Sprintf(
-				"WEBMENTION: @<%s %s> on %s",
-				user.Username, user.URL,
-				source.String(),
-			),
-		); err != nil {
-			log.WithError(err).Warnf("error appending special MENTION post")
-			return err
-		}
+	n := NewNotification(user.Username, WebMentionNotification, source.String())
+	n.From = types.Twter{Nick: authorName, URL: sourceFeed}
+	n.URL = source.String()
+	if err := Notify(s.db, n); err != nil {
+		log.WithError(err).Warnf("error notifying %s of webmention from %s", user.Username, source)
+		return err
 	}
 
 	return nil
 }
 
-func (s *Server) setupWebMentions() {
-	webmentions = webmention.New()
+func (s *Server) setupWebMentions() error {
+	wm, err := webmention.New(filepath.Join(s.config.Data, webmentionsDir))
+	if err != nil {
+		return err
+	}
+
+	webmentions = wm
 	webmentions.Mention = s.processWebMention
+
+	return nil
+}
+
+func (s *Server) setupActivityPub() {
+	federation = NewFederation(s.config)
+}
+
+func (s *Server) setupWebSub() {
+	websubs = NewWebSub(s.config, s.db, s.cache, s.archive, s.router)
 }
 
 func (s *Server) setupCronJobs() error {
@@ -501,6 +506,8 @@ func (s *Server) initRoutes() {
 
 	s.router.GET("/discover", s.am.MustAuth(s.DiscoverHandler()))
 	s.router.GET("/mentions", s.am.MustAuth(s.MentionsHandler()))
+	s.router.GET("/notifications", s.am.MustAuth(s.NotificationsHandler()))
+	s.router.POST("/notifications/read", s.am.MustAuth(s.ReadNotificationsHandler()))
 	s.router.GET("/search", s.SearchHandler())
 
 	s.router.HEAD("/twt/:hash", s.PermalinkHandler())
@@ -519,6 +526,12 @@ func (s *Server) initRoutes() {
 	s.router.PATCH("/post", s.am.MustAuth(s.PostHandler()))
 	s.router.DELETE("/post", s.am.MustAuth(s.PostHandler()))
 
+	// Scheduled Twts
+	s.router.GET("/scheduled", s.am.MustAuth(s.ScheduledHandler()))
+	s.router.GET("/scheduled/:id", s.am.MustAuth(s.EditScheduledHandler()))
+	s.router.POST("/scheduled/:id", s.am.MustAuth(s.EditScheduledHandler()))
+	s.router.POST("/scheduled/:id/cancel", s.am.MustAuth(s.CancelScheduledHandler()))
+
 	// Private Messages
 	s.router.GET("/messages", s.am.MustAuth(s.ListMessagesHandler()))
 	s.router.GET("/messages/:msgid", s.am.MustAuth(s.ViewMessageHandler()))
@@ -554,6 +567,8 @@ func (s *Server) initRoutes() {
 	s.router.HEAD("/user/:nick/avatar", s.AvatarHandler())
 	s.router.HEAD("/user/:nick/twtxt.txt", s.TwtxtHandler())
 	s.router.GET("/user/:nick/twtxt.txt", s.TwtxtHandler())
+	s.router.HEAD("/user/:nick/twtxt-:archive", s.ArchivedFeedHandler())
+	s.router.GET("/user/:nick/twtxt-:archive", s.ArchivedFeedHandler())
 	s.router.GET("/user/:nick/followers", s.FollowersHandler())
 	s.router.GET("/user/:nick/following", s.FollowingHandler())
 	s.router.GET("/user/:nick/bookmarks", s.BookmarksHandler())
@@ -561,6 +576,21 @@ func (s *Server) initRoutes() {
 	// WebMentions
 	s.router.POST("/user/:nick/webmention", s.WebMentionHandler())
 
+	// Discovery
+	s.router.GET(activitypub.WebFingerPath, s.WebFingerHandler())
+	s.router.GET(nodeInfoPath, s.NodeInfoDiscoveryHandler())
+	s.router.GET("/nodeinfo/:version", s.NodeInfoHandler())
+
+	// ActivityPub
+	s.router.GET("/user/:nick/actor", s.ActorHandler())
+	s.router.GET("/user/:nick/outbox", s.OutboxHandler())
+	s.router.POST("/user/:nick/inbox", s.InboxHandler())
+
+	// WebSub
+	s.router.POST(webSubHubPath, s.WebSubHubHandler())
+	s.router.GET(webSubCallbackPath, s.WebSubCallbackHandler())
+	s.router.POST(webSubCallbackPath, s.WebSubCallbackHandler())
+
 	// External Feeds
 	s.router.GET("/external", s.ExternalHandler())
 	s.router.GET("/externalAvatar", s.ExternalAvatarHandler())
@@ -624,8 +654,14 @@ func (s *Server) initRoutes() {
 
 	s.router.GET("/settings", s.am.MustAuth(s.SettingsHandler()))
 	s.router.POST("/settings", s.am.MustAuth(s.SettingsHandler()))
+	s.router.POST("/token/new", s.am.MustAuth(s.CreateTokenHandler()))
 	s.router.POST("/token/delete/:signature", s.am.MustAuth(s.DeleteTokenHandler()))
 
+	// OAuth2 (AuthorizeHandler redirects to /login itself to come back after)
+	s.router.GET("/.well-known/oauth-authorization-server", s.OAuthMetadataHandler())
+	s.router.GET("/oauth/authorize", s.AuthorizeHandler())
+	s.router.POST("/oauth/authorize", s.AuthorizeHandler())
+
 	s.router.GET("/config", s.am.MustAuth(s.PodConfigHandler()))
 	s.router.GET("/manage/pod", s.ManagePodHandler())
 	s.router.POST("/manage/pod", s.ManagePodHandler())
@@ -634,6 +670,14 @@ func (s *Server) initRoutes() {
 	s.router.POST("/manage/adduser", s.AddUserHandler())
 	s.router.POST("/manage/deluser", s.DelUserHandler())
 
+	s.router.GET("/manage/feeds", s.ManageFeedsHandler())
+	s.router.POST("/manage/feeds/refresh", s.RefreshFeedHandler())
+	s.router.POST("/manage/feeds/disable", s.DisableFeedHandler())
+
+	s.router.GET("/manage/webmentions", s.ManageWebMentionsHandler())
+	s.router.POST("/manage/webmentions/retry", s.RetryWebMentionHandler())
+	s.router.POST("/manage/webmentions/remove", s.RemoveWebMentionHandler())
+
 	s.router.GET("/deleteFeeds", s.DeleteAccountHandler())
 	s.router.POST("/delete", s.am.MustAuth(s.DeleteAllHandler()))
 
@@ -698,12 +742,24 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 		return nil, err
 	}
 
-	archive, err := NewDiskArchiver(filepath.Join(config.Data, archiveDir))
+	indexedArchive, err := NewIndexedArchiver(filepath.Join(config.Data, indexedArchiveDir))
 	if err != nil {
 		log.WithError(err).Error("error creating feed archiver")
 		return nil, err
 	}
 
+	// Import any legacy one-file-per-twt archive into the indexed archive
+	if err := ImportDiskArchive(filepath.Join(config.Data, archiveDir), indexedArchive); err != nil {
+		log.WithError(err).Error("error importing legacy feed archive")
+		return nil, err
+	}
+
+	var archive Archiver = indexedArchive
+
+	// Remove twts deleted from the archive from the search index of cached
+	// twts, archived twts are searched through the archive's own index
+	archive = NewSearchArchiver(archive, cache.Index())
+
 	db, err := NewStore(config.Store)
 	if err != nil {
 		log.WithError(err).Error("error creating store")
@@ -756,6 +812,8 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 
 	csrfHandler := nosurf.New(router)
 	csrfHandler.ExemptGlob("/api/v1/*")
+	csrfHandler.ExemptGlob("/user/*/inbox")
+	csrfHandler.ExemptGlob("/websub/*")
 
 	server := &Server{
 		bind:    bind,
@@ -769,7 +827,7 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 				Prefix:               "twtxt",
 				RemoteAddressHeaders: []string{"X-Forwarded-For"},
 			}).Handler(
-				gziphandler.GzipHandler(
+				gzipUnlessRange(
 					sm.Handler(csrfHandler),
 				),
 			),
@@ -835,9 +893,18 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 	server.smtpService.Start()
 	log.Info("started SMTP service")
 
-	server.setupWebMentions()
+	if err := server.setupWebMentions(); err != nil {
+		log.WithError(err).Error("error setting up webmentions processor")
+		return nil, err
+	}
 	log.Infof("started webmentions processor")
 
+	server.setupActivityPub()
+	log.Infof("started activitypub delivery")
+
+	server.setupWebSub()
+	log.Infof("started websub hub at %s", websubs.Hub())
+
 	server.setupMetrics()
 	log.Infof("serving metrics endpoint at %s/metrics", server.config.BaseURL)
 
@@ -860,6 +927,8 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 	log.Infof("SMTP User: %s", server.config.SMTPUser)
 	log.Infof("SMTP From: %s", server.config.SMTPFrom)
 	log.Infof("Max Fetch Limit: %s", humanize.Bytes(uint64(server.config.MaxFetchLimit)))
+	log.Infof("Max Feed Size: %s", humanize.Bytes(uint64(server.config.MaxFeedSize)))
+	log.Infof("Max Feed Age: %s", server.config.MaxFeedAge)
 	log.Infof("Max Upload Size: %s", humanize.Bytes(uint64(server.config.MaxUploadSize)))
 	log.Infof("API Session Time: %s", server.config.APISessionTime)
 
@@ -879,3 +948,16 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 func (s *Server) tr(ctx *Context, msgID string, data ...interface{}) string {
 	return s.translator.Translate(ctx, msgID, data...)
 }
+
+// gzipUnlessRange compresses responses with gzip except for Range requests,
+// as the ranges requested are of the uncompressed content (e.g: feeds)
+func gzipUnlessRange(h http.Handler) http.Handler {
+	gz := gziphandler.GzipHandler(h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		gz.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,8 @@
+//go:build cgo
+// +build cgo
+
+package internal
+
+// sqliteSupported is true as the SQLite driver (github.com/mattn/go-sqlite3)
+// was compiled in with cgo
+const sqliteSupported = true
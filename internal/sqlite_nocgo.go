@@ -0,0 +1,9 @@
+//go:build !cgo
+// +build !cgo
+
+package internal
+
+// sqliteSupported is false as the SQLite driver (github.com/mattn/go-sqlite3)
+// requires cgo, without it the driver is only a stub that fails to open any
+// database
+const sqliteSupported = false
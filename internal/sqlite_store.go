@@ -0,0 +1,718 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	// Register the sqlite3 database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/internal/session"
+	"github.com/jointwt/twtxt/internal/websub"
+)
+
+// sqliteMigrations are the schema migrations applied in order to a SQLite
+// store. Migrations MUST only ever be appended to, never modified, as the
+// index of each migration (+1) is its schema version.
+//
+// Objects are stored as JSON documents alongside a few indexed columns so
+// that the data can be inspected with ordinary SQL tooling, for example:
+//
+//	SELECT username, json_extract(data, '$.Tagline') FROM users;
+var sqliteMigrations = []string{
+	// 1: Initial schema
+	`
+	CREATE TABLE users (
+		username   TEXT PRIMARY KEY,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		data       TEXT NOT NULL
+	);
+
+	CREATE TABLE feeds (
+		name       TEXT PRIMARY KEY,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		data       TEXT NOT NULL
+	);
+
+	CREATE TABLE sessions (
+		sid        TEXT PRIMARY KEY,
+		updated_at TIMESTAMP NOT NULL,
+		data       TEXT NOT NULL
+	);
+
+	CREATE TABLE tokens (
+		signature  TEXT PRIMARY KEY,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		data       TEXT NOT NULL
+	);
+	`,
+
+	// 2: Scheduled twts
+	`
+	CREATE TABLE scheduled_twts (
+		id         TEXT PRIMARY KEY,
+		username   TEXT NOT NULL,
+		post_at    TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		data       TEXT NOT NULL
+	);
+
+	CREATE INDEX scheduled_twts_post_at ON scheduled_twts (post_at);
+	`,
+
+	// 3: WebSub subscriptions
+	`
+	CREATE TABLE websub_subscriptions (
+		id         TEXT PRIMARY KEY,
+		topic      TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		data       TEXT NOT NULL
+	);
+	`,
+
+	// 4: Notifications
+	`
+	CREATE TABLE notifications (
+		id         TEXT PRIMARY KEY,
+		username   TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		data       TEXT NOT NULL
+	);
+
+	CREATE INDEX notifications_username ON notifications (username);
+	`,
+}
+
+// SQLiteStore implements Store using a SQLite database
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func newSQLiteStore(path string) (*SQLiteStore, error) {
+	dsn := fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=1", path)
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only supports a single writer
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	store := &SQLiteStore{db: db}
+
+	if err := store.Migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error migrating store: %w", err)
+	}
+
+	return store, nil
+}
+
+// Version returns the current schema version of the store
+func (ss *SQLiteStore) Version() (int, error) {
+	var version int
+	row := ss.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+	if err := row.Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Migrate applies any pending schema migrations, each in its own transaction
+func (ss *SQLiteStore) Migrate() error {
+	if _, err := ss.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL
+		)`,
+	); err != nil {
+		return err
+	}
+
+	version, err := ss.Version()
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		log.Infof("migrating store to schema version %d", i+1)
+
+		tx, err := ss.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error applying migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(
+			`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+			i+1, time.Now(),
+		); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Sync ...
+func (ss *SQLiteStore) Sync() error {
+	_, err := ss.db.Exec(`PRAGMA wal_checkpoint(PASSIVE)`)
+	return err
+}
+
+// Close ...
+func (ss *SQLiteStore) Close() error {
+	log.Info("syncing store ...")
+	if err := ss.Sync(); err != nil {
+		log.WithError(err).Error("error syncing store")
+		return err
+	}
+
+	log.Info("closing store ...")
+	if err := ss.db.Close(); err != nil {
+		log.WithError(err).Error("error closing store")
+		return err
+	}
+
+	return nil
+}
+
+// Merge ...
+func (ss *SQLiteStore) Merge() error {
+	log.Info("merging store ...")
+	if _, err := ss.db.Exec(`PRAGMA optimize`); err != nil {
+		log.WithError(err).Error("error merging store")
+		return err
+	}
+
+	return nil
+}
+
+func (ss *SQLiteStore) has(table, column, key string) bool {
+	var n int
+	row := ss.db.QueryRow(
+		fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s = ?`, table, column),
+		key,
+	)
+	if err := row.Scan(&n); err != nil {
+		log.WithError(err).Errorf("error querying %s", table)
+		return false
+	}
+	return n > 0
+}
+
+func (ss *SQLiteStore) get(table, column, key string) ([]byte, error) {
+	var data []byte
+	row := ss.db.QueryRow(
+		fmt.Sprintf(`SELECT data FROM %s WHERE %s = ?`, table, column),
+		key,
+	)
+	if err := row.Scan(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (ss *SQLiteStore) del(table, column, key string) error {
+	_, err := ss.db.Exec(
+		fmt.Sprintf(`DELETE FROM %s WHERE %s = ?`, table, column),
+		key,
+	)
+	return err
+}
+
+func (ss *SQLiteStore) count(table string) int64 {
+	var n int64
+	row := ss.db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s`, table))
+	if err := row.Scan(&n); err != nil {
+		log.WithError(err).Errorf("error counting %s", table)
+	}
+	return n
+}
+
+func (ss *SQLiteStore) search(table, column, prefix string) []string {
+	var keys []string
+
+	// Escape LIKE wildcards so the prefix is matched literally
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(prefix))
+
+	rows, err := ss.db.Query(
+		fmt.Sprintf(`SELECT %[2]s FROM %[1]s WHERE LOWER(%[2]s) LIKE ? ESCAPE '\' ORDER BY %[2]s`, table, column),
+		escaped+"%",
+	)
+	if err != nil {
+		log.WithError(err).Errorf("error searching %s", table)
+		return nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			log.WithError(err).Errorf("error searching %s", table)
+			return keys
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func (ss *SQLiteStore) all(table string, f func(data []byte) error) error {
+	rows, err := ss.db.Query(fmt.Sprintf(`SELECT data FROM %s`, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if err := f(data); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (ss *SQLiteStore) HasFeed(name string) bool {
+	return ss.has("feeds", "name", name)
+}
+
+func (ss *SQLiteStore) DelFeed(name string) error {
+	return ss.del("feeds", "name", name)
+}
+
+func (ss *SQLiteStore) GetFeed(name string) (*Feed, error) {
+	data, err := ss.get("feeds", "name", name)
+	if err == sql.ErrNoRows {
+		return nil, ErrFeedNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return LoadFeed(data)
+}
+
+func (ss *SQLiteStore) SetFeed(name string, feed *Feed) error {
+	data, err := feed.Bytes()
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.db.Exec(
+		`INSERT INTO feeds (name, created_at, updated_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET updated_at = excluded.updated_at, data = excluded.data`,
+		name, feed.CreatedAt, time.Now(), string(data),
+	)
+	return err
+}
+
+func (ss *SQLiteStore) LenFeeds() int64 {
+	return ss.count("feeds")
+}
+
+func (ss *SQLiteStore) SearchFeeds(prefix string) []string {
+	return ss.search("feeds", "name", prefix)
+}
+
+func (ss *SQLiteStore) GetAllFeeds() ([]*Feed, error) {
+	var feeds []*Feed
+
+	err := ss.all("feeds", func(data []byte) error {
+		feed, err := LoadFeed(data)
+		if err != nil {
+			return err
+		}
+		feeds = append(feeds, feed)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return feeds, nil
+}
+
+func (ss *SQLiteStore) HasUser(username string) bool {
+	return ss.has("users", "username", username)
+}
+
+func (ss *SQLiteStore) DelUser(username string) error {
+	return ss.del("users", "username", username)
+}
+
+func (ss *SQLiteStore) GetUser(username string) (*User, error) {
+	data, err := ss.get("users", "username", username)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return LoadUser(data)
+}
+
+func (ss *SQLiteStore) SetUser(username string, user *User) error {
+	data, err := user.Bytes()
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.db.Exec(
+		`INSERT INTO users (username, created_at, updated_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT(username) DO UPDATE SET updated_at = excluded.updated_at, data = excluded.data`,
+		username, user.CreatedAt, time.Now(), string(data),
+	)
+	return err
+}
+
+func (ss *SQLiteStore) LenUsers() int64 {
+	return ss.count("users")
+}
+
+func (ss *SQLiteStore) SearchUsers(prefix string) []string {
+	return ss.search("users", "username", prefix)
+}
+
+func (ss *SQLiteStore) GetAllUsers() ([]*User, error) {
+	var users []*User
+
+	err := ss.all("users", func(data []byte) error {
+		user, err := LoadUser(data)
+		if err != nil {
+			return err
+		}
+		users = append(users, user)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (ss *SQLiteStore) GetSession(sid string) (*session.Session, error) {
+	data, err := ss.get("sessions", "sid", sid)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, session.ErrSessionNotFound
+		}
+		return nil, err
+	}
+	sess := session.NewSession(ss)
+	if err := session.LoadSession(data, sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (ss *SQLiteStore) SetSession(sid string, sess *session.Session) error {
+	data, err := sess.Bytes()
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.db.Exec(
+		`INSERT INTO sessions (sid, updated_at, data) VALUES (?, ?, ?)
+		ON CONFLICT(sid) DO UPDATE SET updated_at = excluded.updated_at, data = excluded.data`,
+		sid, time.Now(), string(data),
+	)
+	return err
+}
+
+func (ss *SQLiteStore) HasSession(sid string) bool {
+	return ss.has("sessions", "sid", sid)
+}
+
+func (ss *SQLiteStore) DelSession(sid string) error {
+	return ss.del("sessions", "sid", sid)
+}
+
+func (ss *SQLiteStore) SyncSession(sess *session.Session) error {
+	// Only persist sessions with a logged in user associated with an account
+	// This saves resources as we don't need to keep session keys around for
+	// sessions we may never load from the store again.
+	if sess.Has("username") {
+		return ss.SetSession(sess.ID, sess)
+	}
+	return nil
+}
+
+func (ss *SQLiteStore) LenSessions() int64 {
+	return ss.count("sessions")
+}
+
+func (ss *SQLiteStore) GetAllSessions() ([]*session.Session, error) {
+	var sessions []*session.Session
+
+	err := ss.all("sessions", func(data []byte) error {
+		sess := session.NewSession(ss)
+		if err := session.LoadSession(data, sess); err != nil {
+			return err
+		}
+		sessions = append(sessions, sess)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (ss *SQLiteStore) GetUserTokens(user *User) ([]*Token, error) {
+	tokens := []*Token{}
+	for _, signature := range user.Tokens {
+		tkn, err := ss.GetToken(signature)
+		if err != nil {
+			return tokens, err
+		}
+
+		tokens = append(tokens, tkn)
+	}
+
+	return tokens, nil
+}
+
+func (ss *SQLiteStore) GetToken(signature string) (*Token, error) {
+	data, err := ss.get("tokens", "signature", signature)
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return LoadToken(data)
+}
+
+func (ss *SQLiteStore) GetAllTokens() ([]*Token, error) {
+	var tokens []*Token
+
+	err := ss.all("tokens", func(data []byte) error {
+		tkn, err := LoadToken(data)
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, tkn)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (ss *SQLiteStore) SetToken(signature string, tkn *Token) error {
+	data, err := tkn.Bytes()
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.db.Exec(
+		`INSERT INTO tokens (signature, created_at, updated_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT(signature) DO UPDATE SET updated_at = excluded.updated_at, data = excluded.data`,
+		signature, tkn.CreatedAt, time.Now(), string(data),
+	)
+	return err
+}
+
+func (ss *SQLiteStore) DelToken(signature string) error {
+	return ss.del("tokens", "signature", signature)
+}
+
+func (ss *SQLiteStore) LenTokens() int64 {
+	return ss.count("tokens")
+}
+
+func (ss *SQLiteStore) DelScheduledTwt(id string) error {
+	return ss.del("scheduled_twts", "id", id)
+}
+
+func (ss *SQLiteStore) GetScheduledTwt(id string) (*ScheduledTwt, error) {
+	data, err := ss.get("scheduled_twts", "id", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrScheduledTwtNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return LoadScheduledTwt(data)
+}
+
+func (ss *SQLiteStore) SetScheduledTwt(id string, st *ScheduledTwt) error {
+	data, err := st.Bytes()
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.db.Exec(
+		`INSERT INTO scheduled_twts (id, username, post_at, created_at, updated_at, data) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET post_at = excluded.post_at, updated_at = excluded.updated_at, data = excluded.data`,
+		id, st.Username, st.PostAt, st.CreatedAt, time.Now(), string(data),
+	)
+	return err
+}
+
+func (ss *SQLiteStore) LenScheduledTwts() int64 {
+	return ss.count("scheduled_twts")
+}
+
+func (ss *SQLiteStore) GetAllScheduledTwts() ([]*ScheduledTwt, error) {
+	var sts []*ScheduledTwt
+
+	err := ss.all("scheduled_twts", func(data []byte) error {
+		st, err := LoadScheduledTwt(data)
+		if err != nil {
+			return err
+		}
+		sts = append(sts, st)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sts, nil
+}
+
+func (ss *SQLiteStore) DelSubscription(id string) error {
+	return ss.del("websub_subscriptions", "id", id)
+}
+
+func (ss *SQLiteStore) SetSubscription(id string, sub *websub.Subscription) error {
+	data, err := sub.Bytes()
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.db.Exec(
+		`INSERT INTO websub_subscriptions (id, topic, created_at, updated_at, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET updated_at = excluded.updated_at, data = excluded.data`,
+		id, sub.Topic, sub.CreatedAt, time.Now(), string(data),
+	)
+	return err
+}
+
+func (ss *SQLiteStore) LenSubscriptions() int64 {
+	return ss.count("websub_subscriptions")
+}
+
+func (ss *SQLiteStore) GetAllSubscriptions() ([]*websub.Subscription, error) {
+	var subs []*websub.Subscription
+
+	err := ss.all("websub_subscriptions", func(data []byte) error {
+		sub, err := websub.LoadSubscription(data)
+		if err != nil {
+			return err
+		}
+		subs = append(subs, sub)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+// DelNotification deletes the notification with the given id, notification
+// ids are unique across users (see NewNotification) so they alone are the key
+func (ss *SQLiteStore) DelNotification(_, id string) error {
+	return ss.del("notifications", "id", id)
+}
+
+func (ss *SQLiteStore) GetNotification(_, id string) (*Notification, error) {
+	data, err := ss.get("notifications", "id", id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotificationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return LoadNotification(data)
+}
+
+func (ss *SQLiteStore) SetNotification(id string, n *Notification) error {
+	data, err := n.Bytes()
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.db.Exec(
+		`INSERT INTO notifications (id, username, created_at, updated_at, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET updated_at = excluded.updated_at, data = excluded.data`,
+		id, n.Username, n.CreatedAt, time.Now(), string(data),
+	)
+	return err
+}
+
+func (ss *SQLiteStore) LenNotifications() int64 {
+	return ss.count("notifications")
+}
+
+func (ss *SQLiteStore) GetUserNotifications(username string) ([]*Notification, error) {
+	rows, err := ss.db.Query(`SELECT data FROM notifications WHERE username = ?`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ns []*Notification
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		n, err := LoadNotification(data)
+		if err != nil {
+			return nil, err
+		}
+		ns = append(ns, n)
+	}
+
+	return ns, rows.Err()
+}
+
+func (ss *SQLiteStore) GetAllNotifications() ([]*Notification, error) {
+	var ns []*Notification
+
+	err := ss.all("notifications", func(data []byte) error {
+		n, err := LoadNotification(data)
+		if err != nil {
+			return err
+		}
+		ns = append(ns, n)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ns, nil
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "twtxt.sqlite")
+
+	db, err := NewStore("sqlite://" + path)
+	require.NoError(err)
+
+	user := NewUser()
+	user.Username = "alice"
+	user.CreatedAt = time.Now()
+	require.NoError(db.SetUser("alice", user))
+	require.NoError(db.SetUser("alice", user)) // upsert
+
+	feed := NewFeed()
+	feed.Name = "alice_news"
+	require.NoError(db.SetFeed("alice_news", feed))
+
+	assert.True(db.HasUser("alice"))
+	assert.False(db.HasUser("bob"))
+	assert.Equal(int64(1), db.LenUsers())
+	assert.Equal([]string{"alice"}, db.SearchUsers("AL"))
+	assert.Empty(db.SearchUsers("%"))
+	assert.Equal([]string{"alice_news"}, db.SearchFeeds("alice"))
+
+	_, err = db.GetUser("bob")
+	assert.Equal(ErrUserNotFound, err)
+
+	tkn := &Token{Signature: "sig", Value: "value", CreatedAt: time.Now()}
+	require.NoError(db.SetToken(tkn.Signature, tkn))
+	user.AddToken(tkn)
+	tokens, err := db.GetUserTokens(user)
+	require.NoError(err)
+	require.Len(tokens, 1)
+	assert.Equal("value", tokens[0].Value)
+
+	require.NoError(db.DelToken("sig"))
+	assert.Equal(int64(0), db.LenTokens())
+
+	require.NoError(db.Close())
+
+	// Re-opening an existing store must not re-apply migrations
+	db, err = NewStore("sqlite://" + path)
+	require.NoError(err)
+	defer db.Close()
+
+	version, err := db.(*SQLiteStore).Version()
+	require.NoError(err)
+	assert.Equal(len(sqliteMigrations), version)
+
+	users, err := db.GetAllUsers()
+	require.NoError(err)
+	require.Len(users, 1)
+	assert.Equal("alice", users[0].Username)
+}
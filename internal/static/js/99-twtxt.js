@@ -173,12 +173,15 @@ function deleteTwt(e) {
   if (
     confirm("Are you sure you want to delete this twt? This cannot be undone!")
   ) {
+    var hash = u(e.target).data("hash");
+    var data = new FormData(u("#form").first());
+    data.set("hash", hash);
+
     Twix.ajax({
       type: "DELETE",
       url: u("#form").attr("action"),
-      data: new FormData(u("#form").first()),
+      data: data,
       success: function(data) {
-        var hash = u(e.target).data("hash");
         u("#" + hash).remove();
       },
     });
@@ -6,13 +6,15 @@ import (
 	"time"
 )
 
-// var (
-//   stats *expvar.Map
-// )
+var (
+	// stats are the runtime and pod stats (e.g: users, twts) updated by the
+	// UpdateStats job and published by expvar
+	stats *expvar.Map
+)
 
-// func init() {
-// 	stats = NewStats("stats")
-// }
+func init() {
+	stats = NewStats("stats")
+}
 
 // TimeVar ...
 type TimeVar struct{ v time.Time }
@@ -42,3 +44,18 @@ func NewStats(name string) *expvar.Map {
 
 	return stats
 }
+
+// setStat sets the integer stat name to value
+func setStat(name string, value int) {
+	v := new(expvar.Int)
+	v.Set(int64(value))
+	stats.Set(name, v)
+}
+
+// getStat returns the value of the integer stat name or 0 if not yet set
+func getStat(name string) int {
+	if v, ok := stats.Get(name).(*expvar.Int); ok {
+		return int(v.Value())
+	}
+	return 0
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/jointwt/twtxt/internal/session"
+	"github.com/jointwt/twtxt/internal/websub"
 )
 
 var (
@@ -13,6 +14,11 @@ var (
 	ErrTokenNotFound  = errors.New("error: token not found")
 	ErrFeedNotFound   = errors.New("error: feed not found")
 	ErrInvalidSession = errors.New("error: invalid session")
+
+	ErrSQLiteUnsupported = errors.New("error: sqlite store requires twtd to be built with cgo (CGO_ENABLED=1)")
+
+	ErrScheduledTwtNotFound = errors.New("error: scheduled twt not found")
+	ErrNotificationNotFound = errors.New("error: notification not found")
 )
 
 type Store interface {
@@ -45,9 +51,29 @@ type Store interface {
 	GetAllSessions() ([]*session.Session, error)
 
 	GetUserTokens(user *User) ([]*Token, error)
+	GetToken(signature string) (*Token, error)
+	GetAllTokens() ([]*Token, error)
 	SetToken(signature string, token *Token) error
 	DelToken(signature string) error
 	LenTokens() int64
+
+	DelScheduledTwt(id string) error
+	GetScheduledTwt(id string) (*ScheduledTwt, error)
+	SetScheduledTwt(id string, st *ScheduledTwt) error
+	LenScheduledTwts() int64
+	GetAllScheduledTwts() ([]*ScheduledTwt, error)
+
+	DelSubscription(id string) error
+	SetSubscription(id string, sub *websub.Subscription) error
+	LenSubscriptions() int64
+	GetAllSubscriptions() ([]*websub.Subscription, error)
+
+	DelNotification(username, id string) error
+	GetNotification(username, id string) (*Notification, error)
+	SetNotification(id string, n *Notification) error
+	LenNotifications() int64
+	GetUserNotifications(username string) ([]*Notification, error)
+	GetAllNotifications() ([]*Notification, error)
 }
 
 func NewStore(store string) (Store, error) {
@@ -59,6 +85,11 @@ func NewStore(store string) (Store, error) {
 	switch u.Type {
 	case "bitcask":
 		return newBitcaskStore(u.Path)
+	case "sqlite":
+		if !sqliteSupported {
+			return nil, ErrSQLiteUnsupported
+		}
+		return newSQLiteStore(u.Path)
 	default:
 		return nil, ErrInvalidStore
 	}
@@ -57,6 +57,7 @@ func NewTemplateManager(conf *Config, translator *Translator, blogs *BlogsCache,
 	funcMap["formatForDateTime"] = FormatForDateTime
 	funcMap["urlForBlog"] = URLForBlogFactory(conf, blogs)
 	funcMap["urlForConv"] = URLForConvFactory(conf, cache, archive)
+	funcMap["canEditTwt"] = CanEditTwtFactory(conf)
 	funcMap["isAdminUser"] = IsAdminUserFactory(conf)
 	funcMap["twtType"] = func(twt types.Twt) string { return fmt.Sprintf("%T", twt) }
 
@@ -0,0 +1,320 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/types"
+)
+
+// minQuoteLen is the minimum length of quoted text for a reply to be nested
+// under the twt it quotes, so that short quotes don't match any twt
+const minQuoteLen = 8
+
+var (
+	subjectHashRe = regexp.MustCompile(`\(#([a-z0-9]+)\)`)
+	subjectTagRe  = regexp.MustCompile(`(@|#)<([^ ]+) *([^>]+)>`)
+
+	// forkRe matches the fork convention `(#root) (#parent)` of replies to a
+	// reply in a conversation that keep the conversation's subject
+	forkRe = regexp.MustCompile(`^\(#[a-z0-9]+\)\s*\(#([a-z0-9]+)\)`)
+
+	quotedRe    = regexp.MustCompile(`"([^"]+)"|“([^”]+)”`)
+	quoteLineRe = regexp.MustCompile(`(?:^|\s)>\s*(.+)$`)
+)
+
+// subjectHash returns the hash in the subject of a twt, or an empty string if
+// it has no subject or its subject has no hash
+func subjectHash(twt types.Twt) string {
+	subject := twt.Subject().String()
+	if subject == "" {
+		return ""
+	}
+
+	if match := subjectHashRe.FindStringSubmatch(subject); match != nil {
+		return match[1]
+	}
+	if match := subjectTagRe.FindStringSubmatch(subject); match != nil {
+		return match[2]
+	}
+
+	return ""
+}
+
+// threadSubject returns the hash of the twt a twt replies to, or an empty
+// string if it is not a reply
+func threadSubject(twt types.Twt) string {
+	if twt.IsZero() || twt.Subject() == nil {
+		return ""
+	}
+
+	if hash := subjectHash(twt); hash != twt.Hash() {
+		return hash
+	}
+	return ""
+}
+
+// normalizeText lowercases text and collapses whitespace for matching quotes
+func normalizeText(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// threadText returns the normalized text of a twt without its subject
+func threadText(twt types.Twt) string {
+	text := fmt.Sprintf("%c", twt)
+	if subject := twt.Subject(); subject != nil {
+		text = strings.TrimPrefix(text, subject.String())
+	}
+	return normalizeText(text)
+}
+
+// twtQuotes returns the text a twt quotes, either in quotation marks or on a
+// line starting with `>`
+func twtQuotes(twt types.Twt) []string {
+	var quotes []string
+
+	add := func(quote string) {
+		if quote = normalizeText(quote); len([]rune(quote)) >= minQuoteLen {
+			quotes = append(quotes, quote)
+		}
+	}
+
+	text := fmt.Sprintf("%c", twt)
+	for _, match := range quotedRe.FindAllStringSubmatch(text, -1) {
+		add(match[1] + match[2])
+	}
+	for _, line := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == '\u2028' }) {
+		if match := quoteLineRe.FindStringSubmatch(line); match != nil {
+			add(strings.Trim(match[1], `"“” `))
+		}
+	}
+
+	return quotes
+}
+
+// replyParent returns the hash of the twt among twts (the rest of the thread
+// of root) that reply replies to, or an empty string if it only replies to
+// root. In order of precedence a reply replies to:
+//
+//   - the twt `(#parent)` following its subject (the fork convention)
+//   - the latest earlier twt whose text it quotes
+//   - the latest earlier twt by a twter it mentions other than the author
+//     of root, who replies mention by default
+func replyParent(root, reply types.Twt, twts types.Twts) string {
+	if match := forkRe.FindStringSubmatch(fmt.Sprintf("%c", reply)); match != nil {
+		for _, twt := range twts {
+			if twt.Hash() == match[1] {
+				return match[1]
+			}
+		}
+	}
+
+	var earlier types.Twts
+	for _, twt := range twts {
+		if twt.Hash() != reply.Hash() && twt.Created().Before(reply.Created()) {
+			earlier = append(earlier, twt)
+		}
+	}
+	sort.Sort(earlier)
+
+	if quotes := twtQuotes(reply); len(quotes) > 0 {
+		for _, twt := range earlier {
+			text := threadText(twt)
+			for _, quote := range quotes {
+				if strings.Contains(text, quote) {
+					return twt.Hash()
+				}
+			}
+		}
+	}
+
+	for _, twt := range earlier {
+		if twt.Twter().URL == reply.Twter().URL || twt.Twter().URL == root.Twter().URL {
+			continue
+		}
+		for _, mention := range reply.Mentions() {
+			if mention.Twter().URL == twt.Twter().URL {
+				return twt.Hash()
+			}
+		}
+	}
+
+	return ""
+}
+
+// nestThread moves the direct replies of a thread that reply to another twt
+// in the thread (see replyParent) under that twt, as replies keep the subject
+// of the conversation when replying to one of its replies.
+func nestThread(thread *types.Thread) {
+	nodes := make(map[string]*types.Thread)
+	var index func(node *types.Thread)
+	index = func(node *types.Thread) {
+		nodes[node.Twt.Hash()] = node
+		for _, reply := range node.Replies {
+			index(reply)
+		}
+	}
+
+	replies := thread.Replies
+	thread.Replies = nil
+	index(thread)
+
+	// Replies are only nested under twts already placed so there are no cycles
+	twts := types.Twts{thread.Twt}
+	for _, reply := range replies {
+		parent := thread
+		if hash := replyParent(thread.Twt, reply.Twt, twts); hash != "" {
+			parent = nodes[hash]
+		}
+		parent.Replies = append(parent.Replies, reply)
+
+		twts = append(twts, reply.Twts()...)
+		index(reply)
+	}
+
+	for _, node := range nodes {
+		sort.SliceStable(node.Replies, func(i, j int) bool {
+			return node.Replies[i].Twt.Created().Before(node.Replies[j].Twt.Created())
+		})
+	}
+}
+
+// ThreadIndex is an in-memory index of the cached replies keyed by the hash of
+// the twt they reply to (their subject). Replies no longer cached are found
+// through the archive (see Archiver.Replies).
+type ThreadIndex struct {
+	mu      sync.RWMutex
+	replies postings
+}
+
+// NewThreadIndex ...
+func NewThreadIndex() *ThreadIndex {
+	return &ThreadIndex{replies: make(postings)}
+}
+
+// Index adds the twts that are replies to the index
+func (idx *ThreadIndex) Index(twts ...types.Twt) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, twt := range twts {
+		if subject := threadSubject(twt); subject != "" {
+			idx.replies.add(subject, twt.Hash())
+		}
+	}
+}
+
+// Remove removes the twts that are replies from the index
+func (idx *ThreadIndex) Remove(twts ...types.Twt) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, twt := range twts {
+		if subject := threadSubject(twt); subject != "" {
+			idx.replies.del(subject, twt.Hash())
+		}
+	}
+}
+
+// Replies returns the hashes of the replies to the twt identified by hash
+func (idx *ThreadIndex) Replies(hash string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var hashes []string
+	for reply := range idx.replies[hash] {
+		hashes = append(hashes, reply)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+// GetThread returns the thread of the twt root, that is the replies to it (or
+// any previous version of it if edited) and their replies in turn, whether
+// they are still in the cache or have since been archived. Replies that were
+// edited are replaced by their latest version and deleted ones are omitted.
+// Replies to the root that reply to one of its replies are nested under it.
+func GetThread(cache *Cache, archive Archiver, root types.Twt) *types.Thread {
+	seen := make(map[string]bool)
+
+	lookup := func(hash string) (types.Twt, bool) {
+		if latest, deleted, ok := cache.Redirect(hash); ok {
+			if deleted {
+				return types.NilTwt, false
+			}
+			hash = latest
+		}
+		if seen[hash] {
+			return types.NilTwt, false
+		}
+
+		if twt, ok := cache.Lookup(hash); ok {
+			return twt, true
+		}
+		if archive.Has(hash) {
+			twt, err := archive.Get(hash)
+			if err != nil {
+				log.WithError(err).Warnf("error loading reply %s from archive", hash)
+				return types.NilTwt, false
+			}
+			return twt, !twt.IsZero()
+		}
+		return types.NilTwt, false
+	}
+
+	var build func(twt types.Twt) *types.Thread
+	build = func(twt types.Twt) *types.Thread {
+		thread := &types.Thread{Twt: twt}
+		seen[twt.Hash()] = true
+
+		var hashes []string
+		for _, version := range cache.Versions(twt.Hash()) {
+			hashes = append(hashes, cache.Threads().Replies(version)...)
+
+			archived, err := archive.Replies(version)
+			if err != nil {
+				log.WithError(err).Warnf("error loading archived replies to %s", version)
+			}
+			hashes = append(hashes, archived...)
+		}
+
+		for _, hash := range UniqStrings(hashes) {
+			if reply, ok := lookup(hash); ok {
+				thread.Replies = append(thread.Replies, build(reply))
+			}
+		}
+
+		sort.SliceStable(thread.Replies, func(i, j int) bool {
+			return thread.Replies[i].Twt.Created().Before(thread.Replies[j].Twt.Created())
+		})
+
+		return thread
+	}
+
+	thread := build(root)
+	nestThread(thread)
+
+	return thread
+}
+
+// FilterThread removes the replies (and their replies) the user has filtered
+// out (e.g: muted) from the thread
+func FilterThread(user *User, thread *types.Thread) *types.Thread {
+	if user == nil || thread == nil {
+		return thread
+	}
+
+	filtered := &types.Thread{Twt: thread.Twt}
+	for _, reply := range thread.Replies {
+		if len(user.Filter(types.Twts{reply.Twt})) == 0 {
+			continue
+		}
+		filtered.Replies = append(filtered.Replies, FilterThread(user, reply))
+	}
+	return filtered
+}
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/lextwt"
+)
+
+func TestGetThread(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lextwt.DefaultTwtManager()
+
+	alice := types.Twter{Nick: "alice", URL: "https://example.com/alice/twtxt.txt"}
+	bob := types.Twter{Nick: "bob", URL: "https://example.org/bob/twtxt.txt"}
+
+	parse := func(line string, twter types.Twter) types.Twt {
+		twt, err := lextwt.ParseLine(line, twter)
+		require.NoError(err)
+		return twt
+	}
+
+	root := parse("2020-12-01T10:00:00Z\tWhat's up?", alice)
+	r1 := parse(fmt.Sprintf("2020-12-02T10:00:00Z\t(#%s) Not much", root.Hash()), bob)
+	r2 := parse(fmt.Sprintf("2020-12-03T10:00:00Z\t(#%s) Same here", root.Hash()), alice)
+	r3 := parse(fmt.Sprintf("2020-12-04T10:00:00Z\t(#%s) Really?", r1.Hash()), alice)
+	other := parse("2020-12-05T10:00:00Z\tSomething else", bob)
+
+	assert.Equal("", threadSubject(root))
+	assert.Equal(root.Hash(), threadSubject(r1))
+
+	dir := t.TempDir()
+
+	// The first reply is only archived
+	archive, err := NewIndexedArchiver(filepath.Join(dir, indexedArchiveDir))
+	require.NoError(err)
+	require.NoError(archive.Archive(root))
+	require.NoError(archive.Archive(r1))
+
+	// Archives without a thread index are indexed when opened
+	require.NoError(archive.index.Delete(archiveThreadKey(root.Hash(), r1.Hash())))
+	require.NoError(archive.index.Delete([]byte(archiveThreadsKey)))
+	require.NoError(archive.Close())
+
+	archive, err = NewIndexedArchiver(filepath.Join(dir, indexedArchiveDir))
+	require.NoError(err)
+	defer archive.Close()
+
+	replies, err := archive.Replies(root.Hash())
+	require.NoError(err)
+	assert.Equal([]string{r1.Hash()}, replies)
+
+	cache, err := LoadCache(dir)
+	require.NoError(err)
+	cached := types.Twts{r3, r2, other}
+	cache.Twts[alice.URL] = &Cached{Twts: cached}
+	cache.Threads().Index(cached...)
+
+	thread := GetThread(cache, archive, root)
+	require.Len(thread.Replies, 2)
+	assert.Equal(r1.Hash(), thread.Replies[0].Twt.Hash())
+	assert.Equal(r2.Hash(), thread.Replies[1].Twt.Hash())
+	require.Len(thread.Replies[0].Replies, 1)
+	assert.Equal(r3.Hash(), thread.Replies[0].Replies[0].Twt.Hash())
+	assert.Equal(4, thread.Len())
+
+	hashes := func(twts types.Twts) (res []string) {
+		for _, twt := range twts {
+			res = append(res, twt.Hash())
+		}
+		return
+	}
+	expected := []string{root.Hash(), r1.Hash(), r3.Hash(), r2.Hash()}
+	assert.Equal(expected, hashes(thread.Twts()))
+
+	data, err := json.Marshal(types.ThreadResponse{Thread: thread, Count: thread.Len()})
+	require.NoError(err)
+
+	var res types.ThreadResponse
+	require.NoError(json.Unmarshal(data, &res))
+	assert.Equal(expected, hashes(res.Thread.Twts()))
+
+	// Replies no longer cached are removed from the in-memory index
+	cache.unindex(types.Twts{other}, cached)
+	assert.Empty(cache.Threads().Replies(root.Hash()))
+	assert.Len(GetThread(cache, archive, root).Replies, 1)
+
+	// Deleted replies are removed from the thread index
+	require.NoError(archive.Del(r1.Hash()))
+	replies, err = archive.Replies(root.Hash())
+	require.NoError(err)
+	assert.Empty(replies)
+}
+
+func TestNestThread(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lextwt.DefaultTwtManager()
+
+	alice := types.Twter{Nick: "alice", URL: "https://example.com/alice/twtxt.txt"}
+	bob := types.Twter{Nick: "bob", URL: "https://example.org/bob/twtxt.txt"}
+	carol := types.Twter{Nick: "carol", URL: "https://example.net/carol/twtxt.txt"}
+
+	parse := func(line string, twter types.Twter) types.Twt {
+		twt, err := lextwt.ParseLine(line, twter)
+		require.NoError(err)
+		return twt
+	}
+
+	root := parse("2020-12-01T10:00:00Z\tWhat's everyone reading?", alice)
+	subject := fmt.Sprintf("(#%s)", root.Hash())
+
+	r1 := parse(fmt.Sprintf("2020-12-02T10:00:00Z\t%s @<alice %s> The Left Hand of Darkness", subject, alice.URL), bob)
+	r2 := parse(fmt.Sprintf("2020-12-03T10:00:00Z\t%s @<bob %s> Great book!", subject, bob.URL), carol)
+	r3 := parse(fmt.Sprintf("2020-12-04T10:00:00Z\t%s @<alice %s> Nothing at the moment", subject, alice.URL), carol)
+	r4 := parse(fmt.Sprintf("2020-12-05T10:00:00Z\t%s (#%s) Why not?", subject, r3.Hash()), alice)
+	r5 := parse(fmt.Sprintf("2020-12-06T10:00:00Z\t%s \"left hand of darkness\" is on my list too", subject), alice)
+
+	thread := &types.Thread{Twt: root}
+	for _, reply := range []types.Twt{r1, r2, r3, r4, r5} {
+		thread.Replies = append(thread.Replies, &types.Thread{Twt: reply})
+	}
+
+	nestThread(thread)
+
+	// Mentioning only the author of the root stays at the root
+	require.Len(thread.Replies, 2)
+	assert.Equal(r1.Hash(), thread.Replies[0].Twt.Hash())
+	assert.Equal(r3.Hash(), thread.Replies[1].Twt.Hash())
+
+	// Mentions and quotes nest under the latest earlier twt of the mentioned
+	// twter or with the quoted text, oldest first
+	require.Len(thread.Replies[0].Replies, 2)
+	assert.Equal(r2.Hash(), thread.Replies[0].Replies[0].Twt.Hash())
+	assert.Equal(r5.Hash(), thread.Replies[0].Replies[1].Twt.Hash())
+
+	// Forks `(#root) (#parent)` nest under the parent
+	require.Len(thread.Replies[1].Replies, 1)
+	assert.Equal(r4.Hash(), thread.Replies[1].Replies[0].Twt.Hash())
+
+	assert.Equal(6, thread.Len())
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ScopeRead allows reading the timeline, mentions, notifications,
+	// settings and scheduled twts of a user
+	ScopeRead = "read"
+
+	// ScopePost allows posting, editing, deleting and scheduling twts,
+	// uploading media and marking notifications as read
+	ScopePost = "post"
+
+	// ScopeFollow allows following, unfollowing, muting and unmuting feeds
+	ScopeFollow = "follow"
+
+	// ScopeAdmin allows everything including changing the user's settings,
+	// managing their tokens and managing the pod (for the pod's admin)
+	ScopeAdmin = "admin"
+
+	// tokenTouchInterval is how often the last use of a token is recorded
+	tokenTouchInterval = time.Minute
+)
+
+var (
+	// Scopes are all the scopes tokens can be granted
+	Scopes = []string{ScopeRead, ScopePost, ScopeFollow, ScopeAdmin}
+
+	// ErrInvalidScope is returned for unknown scopes
+	ErrInvalidScope = errors.New("error: invalid scope")
+)
+
+// ParseScopes parses a space or comma separated list of scopes
+func ParseScopes(s string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		if err := ValidateScopes([]string{scope}); err != nil {
+			return nil, err
+		}
+		if !HasString(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes, nil
+}
+
+// ValidateScopes returns ErrInvalidScope if any of scopes is unknown or no
+// scopes are given
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !HasString(Scopes, scope) {
+			return fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	return nil
+}
+
+// NewToken returns a new token of the user signed with the pod's API signing
+// key limited to scopes and expiring at expiresAt (if non-zero), the token
+// still has to be added to the user and stored
+func NewToken(conf *Config, user *User, scopes []string, expiresAt time.Time) (*Token, error) {
+	if err := ValidateScopes(scopes); err != nil {
+		return nil, err
+	}
+
+	createdAt := time.Now()
+
+	claims := jwt.MapClaims{}
+	claims["username"] = user.Username
+	claims["jti"] = GenerateRandomToken()
+	claims["iat"] = createdAt.Unix()
+	if !expiresAt.IsZero() {
+		claims["exp"] = expiresAt.Unix()
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(conf.APISigningKey))
+	if err != nil {
+		log.WithError(err).Error("error creating signed token")
+		return nil, err
+	}
+
+	// The signature is the last part of the signed token
+	signature := tokenString[strings.LastIndex(tokenString, ".")+1:]
+
+	return &Token{
+		Signature: signature,
+		Value:     tokenString,
+		Username:  user.Username,
+		Scopes:    scopes,
+		CreatedAt: createdAt,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// SaveToken adds token to its user and stores both
+func SaveToken(db Store, user *User, token *Token) error {
+	user.AddToken(token)
+	if err := db.SetToken(token.Signature, token); err != nil {
+		log.WithError(err).Error("error saving token object")
+		return err
+	}
+	if err := db.SetUser(user.Username, user); err != nil {
+		log.WithError(err).Error("error saving user object")
+		return err
+	}
+	return nil
+}
+
+// RevokeToken deletes the token of the user with the given signature
+func RevokeToken(db Store, user *User, signature string) error {
+	if !user.HasToken(signature) {
+		return ErrTokenNotFound
+	}
+
+	if err := db.DelToken(signature); err != nil && err != ErrTokenNotFound {
+		return err
+	}
+
+	user.RemoveToken(signature)
+	return db.SetUser(user.Username, user)
+}
+
+// TouchToken records the use of token at most every tokenTouchInterval
+func TouchToken(db Store, token *Token, now time.Time) {
+	if now.Sub(token.LastUsedAt) < tokenTouchInterval {
+		return
+	}
+
+	token.LastUsedAt = now
+	if err := db.SetToken(token.Signature, token); err != nil {
+		log.WithError(err).Warnf("error updating last use of token %s", token.Signature)
+	}
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	scopes, err := ParseScopes("read post,read")
+	assert.NoError(err)
+	assert.Equal([]string{ScopeRead, ScopePost}, scopes)
+
+	_, err = ParseScopes("read delete")
+	assert.True(errors.Is(err, ErrInvalidScope))
+
+	assert.Equal(ErrInvalidScope, ValidateScopes(nil))
+}
+
+func TestTokenScopes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Tokens stored before scopes were introduced keep working for everything
+	legacy, err := LoadToken([]byte(`{"Signature":"sig","Value":"value"}`))
+	require.NoError(err)
+	assert.Equal(Scopes, legacy.Scopes)
+
+	token, err := LoadToken([]byte(`{"Signature":"sig","Scopes":["read"]}`))
+	require.NoError(err)
+	assert.True(token.HasScope(ScopeRead))
+	assert.False(token.HasScope(ScopePost))
+
+	token.Scopes = []string{ScopeAdmin}
+	assert.True(token.HasScope(ScopeFollow))
+
+	now := time.Now()
+	assert.False(token.Expired(now))
+	token.ExpiresAt = now.Add(-time.Minute)
+	assert.True(token.Expired(now))
+}
+
+func TestAuthCodes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	verifier := GenerateRandomToken()
+	challenge := sha256.Sum256([]byte(verifier))
+
+	query := url.Values{
+		"client_id":             {"https://app.example.com/"},
+		"redirect_uri":          {"https://app.example.com/callback"},
+		"response_type":         {"code"},
+		"state":                 {"xyz"},
+		"scope":                 {"read post"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	req, err := ParseAuthRequest(httptest.NewRequest("GET", "/oauth/authorize?"+query.Encode(), nil))
+	require.NoError(err)
+	assert.Equal("app.example.com", req.ClientName())
+	assert.Equal([]string{ScopeRead, ScopePost}, req.Scopes)
+
+	codes := NewAuthCodes()
+
+	code := codes.Grant(req, "alice")
+	redirect, err := url.Parse(req.Redirect(url.Values{"code": {code}}))
+	require.NoError(err)
+	assert.Equal(code, redirect.Query().Get("code"))
+	assert.Equal("xyz", redirect.Query().Get("state"))
+
+	_, _, err = codes.Exchange(code, "https://app.example.com/", "https://app.example.com/callback", "wrong")
+	assert.Equal(ErrOAuthInvalidGrant, err)
+
+	// Codes can only be exchanged once, even after a failed attempt
+	_, _, err = codes.Exchange(code, "https://app.example.com/", "https://app.example.com/callback", verifier)
+	assert.Equal(ErrOAuthInvalidGrant, err)
+
+	code = codes.Grant(req, "alice")
+	granted, username, err := codes.Exchange(code, "https://app.example.com/", "https://app.example.com/callback", verifier)
+	require.NoError(err)
+	assert.Equal("alice", username)
+	assert.Equal(req, granted)
+
+	// The redirect_uri must be on the client's host
+	query.Set("redirect_uri", "https://evil.example.com/callback")
+	req, err = ParseAuthRequest(httptest.NewRequest("GET", "/oauth/authorize?"+query.Encode(), nil))
+	assert.Nil(req)
+	assert.Equal(ErrInvalidRedirectURI, err)
+
+	// PKCE is required
+	query.Set("redirect_uri", "https://app.example.com/callback")
+	query.Del("code_challenge")
+	req, err = ParseAuthRequest(httptest.NewRequest("GET", "/oauth/authorize?"+query.Encode(), nil))
+	require.NotNil(req)
+	assert.Equal(ErrOAuthInvalidRequest, err)
+}
@@ -4,10 +4,12 @@ package internal
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	read_file_last_line "github.com/prologic/read-file-last-line"
@@ -20,6 +22,10 @@ const (
 	feedsDir = "feeds"
 )
 
+// feedsMu serializes writes to local feed files so that twts appended whilst
+// a feed is rewritten (edited, deleted or rotated) are not lost
+var feedsMu sync.Mutex
+
 func DeleteLastTwt(conf *Config, user *User) error {
 	p := filepath.Join(conf.Data, feedsDir)
 	if err := os.MkdirAll(p, 0755); err != nil {
@@ -29,24 +35,38 @@ func DeleteLastTwt(conf *Config, user *User) error {
 
 	fn := filepath.Join(p, user.Username)
 
-	_, n, err := GetLastTwt(conf, user)
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+
+	twt, n, err := GetLastTwt(conf, user)
 	if err != nil {
 		return err
 	}
 
+	// Never truncate metadata (e.g: the `# prev` record of a rotated feed)
+	if twt.IsZero() {
+		return ErrTwtNotFound
+	}
+
 	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	return f.Truncate(int64(n))
+	if err := f.Truncate(int64(n)); err != nil {
+		return err
+	}
+
+	websubs.Publish(user.Username)
+
+	return nil
 }
 
 func AppendSpecial(conf *Config, db Store, specialUsername, text string, args ...interface{}) (types.Twt, error) {
 	user := &User{Username: specialUsername}
 	user.Following = make(map[string]string)
-	return AppendTwt(conf, db, user, text, args)
+	return AppendTwt(conf, db, user, text, args...)
 }
 
 func AppendTwt(conf *Config, db Store, user *User, text string, args ...interface{}) (types.Twt, error) {
@@ -63,12 +83,6 @@ func AppendTwt(conf *Config, db Store, user *User, text string, args ...interfac
 
 	fn := filepath.Join(p, user.Username)
 
-	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		return types.NilTwt, err
-	}
-	defer f.Close()
-
 	// Support replacing/editing an existing Twt whilst preserving Created Timestamp
 	now := time.Now()
 	if len(args) == 1 {
@@ -80,13 +94,338 @@ func AppendTwt(conf *Config, db Store, user *User, text string, args ...interfac
 	twt := types.MakeTwt(user.Twter(), now, strings.TrimSpace(text))
 
 	twt.ExpandLinks(conf, NewFeedLookup(conf, db, user))
+
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return types.NilTwt, err
+	}
+	defer f.Close()
+
 	if _, err = fmt.Fprintf(f, "%+l\n", twt); err != nil {
 		return types.NilTwt, err
 	}
 
+	websubs.Publish(user.Username)
+
+	return twt, nil
+}
+
+// publishSideEffects sends webmentions to the remote feeds mentioned by a
+// newly posted twt and delivers it to the user's followers on the fediverse.
+// user is nil if the twt was posted as one of the user's feeds, which are
+// not federated.
+func publishSideEffects(conf *Config, cache *Cache, user *User, twt types.Twt) {
+	isLocalURL := IsLocalURLFactory(conf)
+	isExternalFeed := IsExternalFeedFactory(conf)
+
+	for _, m := range twt.Mentions() {
+		twter := m.Twter()
+		if !isLocalURL(twter.URL) || isExternalFeed(twter.URL) {
+			if err := WebMention(twter.URL, URLForTwt(conf.BaseURL, twt.Hash())); err != nil {
+				log.WithError(err).Warnf("error sending webmention to %s", twter.URL)
+			}
+		}
+	}
+
+	if user != nil {
+		federation.Federate(cache, user, twt)
+	}
+}
+
+// rewriteFeed atomically rewrites the feed file of the given feed by passing
+// its lines (without line endings) to fn and writing back the lines it returns.
+func rewriteFeed(conf *Config, name string, fn func(lines []string) ([]string, error)) error {
+	fn0 := filepath.Join(conf.Data, feedsDir, name)
+
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+
+	data, err := ioutil.ReadFile(fn0)
+	if err != nil {
+		log.WithError(err).Errorf("error reading feed %s", name)
+		return err
+	}
+
+	lines, err := fn(strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"))
+	if err != nil {
+		return err
+	}
+
+	tmp := fmt.Sprintf("%s.tmp", fn0)
+	if err := ioutil.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0666); err != nil {
+		log.WithError(err).Errorf("error writing feed %s", name)
+		return err
+	}
+
+	if err := os.Rename(tmp, fn0); err != nil {
+		return err
+	}
+
+	websubs.Publish(name)
+
+	return nil
+}
+
+// feedRecords are the metadata records the pod itself writes to local feeds
+var feedRecords = map[string]bool{"edit": true, "delete": true, "prev": true}
+
+// feedRecord returns the key and value of a `# <key> = <value>` metadata line
+func feedRecord(line string) (key, value string, ok bool) {
+	if !strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(line, "#"), "=", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), true
+}
+
+// isPreambleTemplate returns true if pre (the leading comments of a local
+// feed up to the first blank line) is a custom preamble template rather than
+// only records written by the pod (see feedRecords) and possibly twts, as is
+// the case for feeds without a custom preamble that were edited or rotated.
+func isPreambleTemplate(pre string) bool {
+	custom := false
+	for _, line := range strings.Split(pre, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			return false
+		}
+		if key, _, ok := feedRecord(line); !ok || !feedRecords[key] {
+			custom = true
+		}
+	}
+	return custom
+}
+
+// findTwtLine returns the index of the line of the twt identified by hash in
+// the lines of a feed, or -1 if the feed has no such twt.
+func findTwtLine(lines []string, twter types.Twter, hash string) int {
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		twt, err := types.ParseLine(line, twter)
+		if err != nil {
+			continue
+		}
+		if twt.Hash() == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// replaceTwtLine replaces the line at index i of the lines of a feed with
+// replacement, or removes it if replacement is empty.
+func replaceTwtLine(lines []string, i int, replacement string) []string {
+	var res []string
+	res = append(res, lines[:i]...)
+	if replacement != "" {
+		res = append(res, replacement)
+	}
+	return append(res, lines[i+1:]...)
+}
+
+// addFeedRecord adds a `# <key> = <value>` metadata line at the end of the
+// header (leading comments) of the lines of a feed.
+func addFeedRecord(lines []string, key, value string) []string {
+	header := 0
+	for header < len(lines) && strings.HasPrefix(lines[header], "#") {
+		header++
+	}
+
+	var res []string
+	res = append(res, lines[:header]...)
+	res = append(res, fmt.Sprintf("# %s = %s", key, value))
+	return append(res, lines[header:]...)
+}
+
+// editTwtLines finds the twt identified by hash in the lines of a feed and
+// replaces it with replacement (or removes it if replacement is empty) and
+// records the edit as a `# <key> = <value>` metadata line at the end of the
+// feed's header (leading comments).
+func editTwtLines(lines []string, twter types.Twter, hash, replacement, key, value string) ([]string, error) {
+	found := findTwtLine(lines, twter, hash)
+	if found == -1 {
+		return nil, ErrTwtNotFound
+	}
+
+	return addFeedRecord(replaceTwtLine(lines, found, replacement), key, value), nil
+}
+
+// archivedFeedPaths returns the paths of the archived feeds of the feed file
+// fn whose lines are given (see RotateFeed), newest first, by following the
+// chain of `# prev` records that link them.
+func archivedFeedPaths(fn string, lines []string) []string {
+	var paths []string
+
+	seen := make(map[string]bool)
+	for {
+		hash := ""
+		for _, line := range lines {
+			if !strings.HasPrefix(line, "#") {
+				break
+			}
+			if key, value, ok := feedRecord(line); ok && key == "prev" {
+				if fields := strings.Fields(value); len(fields) > 0 {
+					hash = fields[0]
+				}
+			}
+		}
+		if !validArchivedFeedHash.MatchString(hash) || seen[hash] {
+			return paths
+		}
+		seen[hash] = true
+
+		path := archivedFeedPath(fn, hash)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.WithError(err).Warnf("error reading archived feed %s", path)
+			return paths
+		}
+		paths = append(paths, path)
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+}
+
+// editFeedTwt replaces the twt identified by hash in the given feed with
+// replacement (or removes it if replacement is empty) and records the edit as
+// a `# <key> = <value>` record in the feed. Twts that were rotated into one
+// of the feed's archived feeds are replaced there in place, the archived
+// feed keeping its name so that the `# prev` records linking it stay valid,
+// whilst the record is always added to the feed itself so that clients
+// which only fetch the feed learn about the edit.
+func editFeedTwt(conf *Config, name string, twter types.Twter, hash, replacement, key, value string) error {
+	fn := filepath.Join(conf.Data, feedsDir, name)
+
+	return rewriteFeed(conf, name, func(lines []string) ([]string, error) {
+		if findTwtLine(lines, twter, hash) != -1 {
+			return editTwtLines(lines, twter, hash, replacement, key, value)
+		}
+
+		for _, path := range archivedFeedPaths(fn, lines) {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+
+			archived := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			found := findTwtLine(archived, twter, hash)
+			if found == -1 {
+				continue
+			}
+
+			archived = replaceTwtLine(archived, found, replacement)
+			if err := writeFileAtomic(path, func(w io.Writer) error {
+				_, err := io.WriteString(w, strings.Join(archived, "\n")+"\n")
+				return err
+			}); err != nil {
+				log.WithError(err).Errorf("error writing archived feed %s", path)
+				return nil, err
+			}
+
+			servedFeedsMu.Lock()
+			removeFeedVariants(path)
+			servedFeedsMu.Unlock()
+
+			return addFeedRecord(lines, key, value), nil
+		}
+
+		return nil, ErrTwtNotFound
+	})
+}
+
+// EditTwt replaces the twt identified by hash in the user's (or feed's) feed
+// (or one of its archived feeds) with text whilst preserving its Created timestamp and position in the feed.
+// An `# edit = <hash> <new hash>` record is added to the feed so that
+// references to the old hash (replies, bookmarks, permalinks) can be
+// redirected to the new version.
+func EditTwt(conf *Config, db Store, user *User, hash, text string) (types.Twt, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return types.NilTwt, fmt.Errorf("cowardly refusing to twt empty text, or only spaces")
+	}
+
+	twter := types.Twter{Nick: user.Username, URL: URLForUser(conf.BaseURL, user.Username)}
+
+	twts, err := GetAllTwts(conf, user.Username)
+	if err != nil {
+		return types.NilTwt, err
+	}
+
+	var old types.Twt
+	for _, t := range twts {
+		if t.Hash() == hash {
+			old = t
+			break
+		}
+	}
+	if old == nil {
+		return types.NilTwt, ErrTwtNotFound
+	}
+
+	// The replacement is built (and its links expanded, which may look up
+	// feeds) before locking the feed, the lock is only held to swap the line
+	twt := types.MakeTwt(twter, old.Created(), text)
+	twt.ExpandLinks(conf, NewFeedLookup(conf, db, user))
+
+	if twt.Hash() == hash {
+		// Nothing changed
+		return twt, nil
+	}
+
+	if err := editFeedTwt(
+		conf, user.Username, twter, hash, fmt.Sprintf("%+l", twt),
+		"edit", fmt.Sprintf("%s %s", hash, twt.Hash()),
+	); err != nil {
+		return types.NilTwt, err
+	}
+
 	return twt, nil
 }
 
+// DeleteTwt removes the twt identified by hash from the user's (or feed's)
+// feed (or one of its archived feeds) and adds a `# delete = <hash>` record (tombstone) to the feed.
+func DeleteTwt(conf *Config, user *User, hash string) error {
+	twter := types.Twter{Nick: user.Username, URL: URLForUser(conf.BaseURL, user.Username)}
+
+	return editFeedTwt(conf, user.Username, twter, hash, "", "delete", hash)
+}
+
+// TwtFeed returns the local feed twt was posted to as a *User suitable for
+// EditTwt/DeleteTwt if the twt was posted by user or one of the feeds they
+// own, otherwise ErrFeedImposter is returned.
+func TwtFeed(conf *Config, user *User, twt types.Twt) (*User, error) {
+	twter := twt.Twter()
+	name := NormalizeUsername(twter.Nick)
+
+	if user == nil || twter.URL != URLForUser(conf.BaseURL, name) {
+		return nil, ErrFeedImposter
+	}
+
+	if name == user.Username {
+		return user, nil
+	}
+
+	if user.OwnsFeed(name) {
+		feed := &User{Username: name, URL: twter.URL}
+		feed.Following = make(map[string]string)
+		return feed, nil
+	}
+
+	return nil, ErrFeedImposter
+}
+
 func FeedExists(conf *Config, username string) bool {
 	fn := filepath.Join(conf.Data, feedsDir, NormalizeUsername(username))
 	if _, err := os.Stat(fn); err != nil {
@@ -115,6 +454,11 @@ func GetLastTwt(conf *Config, user *User) (twt types.Twt, offset int, err error)
 		return
 	}
 
+	// The feed may end with metadata (e.g: if all twts were deleted)
+	if strings.HasPrefix(string(data), "#") {
+		return
+	}
+
 	twt, err = types.ParseLine(string(data), user.Twter())
 
 	return
@@ -135,6 +479,10 @@ func GetAllFeeds(conf *Config) ([]string, error) {
 
 	fns := []string{}
 	for _, fileInfo := range files {
+		// Skip files alongside feeds (e.g: served feeds and preamble templates)
+		if fileInfo.IsDir() || !validFeedName.MatchString(fileInfo.Name()) {
+			continue
+		}
 		fns = append(fns, filepath.Base(fileInfo.Name()))
 	}
 	return fns, nil
@@ -159,6 +507,8 @@ func GetFeedCount(conf *Config, name string) (int, error) {
 	return LineCount(f)
 }
 
+// GetAllTwts returns all of the twts of the local feed name including those
+// that were rotated into its archived feeds (see RotateFeed).
 func GetAllTwts(conf *Config, name string) (types.Twts, error) {
 	p := filepath.Join(conf.Data, feedsDir)
 	if err := os.MkdirAll(p, 0755); err != nil {
@@ -173,19 +523,28 @@ func GetAllTwts(conf *Config, name string) (types.Twts, error) {
 		URL:  URLForUser(conf.BaseURL, name),
 	}
 	fn := filepath.Join(p, name)
-	f, err := os.Open(fn)
+	data, err := ioutil.ReadFile(fn)
 	if err != nil {
 		log.WithError(err).Warnf("error opening feed: %s", fn)
 		return nil, err
 	}
-	log.Debugf("twt: parsing %s for %s", name, twter)
-	t, err := types.ParseFile(f, twter)
-	if err != nil {
-		log.WithError(err).Errorf("error processing feed %s", fn)
-		return nil, err
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	for _, path := range append([]string{fn}, archivedFeedPaths(fn, lines)...) {
+		f, err := os.Open(path)
+		if err != nil {
+			log.WithError(err).Warnf("error opening feed: %s", path)
+			return nil, err
+		}
+		log.Debugf("twt: parsing %s for %s", path, twter)
+		t, err := types.ParseFile(f, twter)
+		f.Close()
+		if err != nil {
+			log.WithError(err).Errorf("error processing feed %s", path)
+			return nil, err
+		}
+		twts = append(twts, t.Twts()...)
 	}
-	twts = append(twts, t.Twts()...)
-	f.Close()
 
 	return twts, nil
 }
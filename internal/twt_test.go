@@ -2,10 +2,17 @@ package internal
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jointwt/twtxt/types"
+	"github.com/jointwt/twtxt/types/lextwt"
 )
 
 func TestExpandTag(t *testing.T) {
@@ -103,3 +110,76 @@ func ExpandTag(conf *Config, text string) string {
 		return fmt.Sprintf("%s#<%s %s>", prefix, tag, URLForTag(conf.BaseURL, tag))
 	})
 }
+
+func TestEditAndDeleteTwt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lextwt.DefaultTwtManager()
+
+	conf := &Config{Data: t.TempDir(), BaseURL: "http://0.0.0.0:8000"}
+	user := &User{Username: "alice", URL: URLForUser(conf.BaseURL, "alice")}
+
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	var twts []types.Twt
+	for i := 0; i < 3; i++ {
+		twt, err := AppendTwt(conf, nil, user, fmt.Sprintf("Hello %d", i), created.Add(time.Duration(i)*time.Hour))
+		require.NoError(err)
+		twts = append(twts, twt)
+	}
+
+	edited, err := EditTwt(conf, nil, user, twts[1].Hash(), "Hello edited")
+	require.NoError(err)
+	assert.Equal(twts[1].Created(), edited.Created())
+	assert.NotEqual(twts[1].Hash(), edited.Hash())
+
+	require.NoError(DeleteTwt(conf, user, twts[0].Hash()))
+	assert.Equal(ErrTwtNotFound, DeleteTwt(conf, user, twts[0].Hash()))
+
+	f, err := os.Open(filepath.Join(conf.Data, feedsDir, user.Username))
+	require.NoError(err)
+	defer f.Close()
+
+	twtFile, err := types.ParseFile(f, user.Twter())
+	require.NoError(err)
+
+	assert.Equal([]types.Edit{
+		{Hash: twts[1].Hash(), Replacement: edited.Hash()},
+		{Hash: twts[0].Hash()},
+	}, twtFile.Info().Edits())
+
+	var hashes []string
+	for _, twt := range twtFile.Twts() {
+		hashes = append(hashes, twt.Hash())
+	}
+	assert.Equal([]string{edited.Hash(), twts[2].Hash()}, hashes)
+
+	lastTwt, _, err := GetLastTwt(conf, user)
+	require.NoError(err)
+	assert.Equal(twts[2].Hash(), lastTwt.Hash())
+}
+
+func TestCacheRedirect(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := &Cache{}
+	cache.recordEdit("a", "b")
+	cache.recordEdit("b", "c")
+	cache.recordEdit("x", "")
+
+	latest, deleted, ok := cache.Redirect("a")
+	assert.True(ok)
+	assert.False(deleted)
+	assert.Equal("c", latest)
+
+	_, deleted, ok = cache.Redirect("x")
+	assert.True(ok)
+	assert.True(deleted)
+
+	_, _, ok = cache.Redirect("c")
+	assert.False(ok)
+
+	assert.ElementsMatch([]string{"a", "b", "c"}, cache.Versions("c"))
+	assert.Equal([]string{"b"}, cache.Versions("b"))
+	assert.Equal([]string{"x"}, cache.Versions("x"))
+}
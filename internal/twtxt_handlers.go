@@ -24,14 +24,16 @@ const defaultPreambleTemplate = `# Twtxt is an open, distributed microblogging p
 # nick        = {{ .Profile.Username }}
 # url         = {{ .Profile.URL }}
 # avatar      = {{ .Profile.AvatarURL }}
+{{- if .Profile.Tagline }}
 # description = {{ .Profile.Tagline }}
-#
+{{- end }}
 {{- if .Profile.ShowFollowing }}
-{{ range $nick, $url := .Profile.Following -}}
-# follow = {{ $nick }} {{ $url }}
-{{ end -}}
 #
-{{ end }}
+{{- range $nick, $url := .Profile.Following }}
+# follow      = {{ $nick }} {{ $url }}
+{{- end }}
+{{- end }}
+
 `
 
 // OldTwtxtHandler ...
@@ -60,8 +62,9 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		ctx := NewContext(s.config, s.db, r)
 
+		// Files alongside feeds (e.g: served feeds) are never feeds themselves
 		nick := NormalizeUsername(p.ByName("nick"))
-		if nick == "" {
+		if nick == "" || !validFeedName.MatchString(nick) {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
@@ -138,13 +141,17 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 		// XXX: This is stupid doing this twice
 		// TODO: Refactor all of this :/
 
+		// The feed is the same for everyone (so it can be cached and served
+		// with a strong ETag) so render the preamble as seen by anyone
 		if user, err := s.db.GetUser(nick); err == nil {
-			ctx.Profile = user.Profile(s.config.BaseURL, ctx.User)
+			ctx.Profile = user.Profile(s.config.BaseURL, &User{})
 		} else if feed, err := s.db.GetFeed(nick); err == nil {
-			ctx.Profile = feed.Profile(s.config.BaseURL, ctx.User)
+			ctx.Profile = feed.Profile(s.config.BaseURL, &User{})
 		} else {
 			log.WithError(err).Warnf("unable to load user or feed profile for %s", nick)
 		}
+		// Metadata values are a single line
+		ctx.Profile.Tagline = strings.Join(strings.Fields(ctx.Profile.Tagline), " ")
 
 		f, err := os.Open(fn)
 		if err != nil {
@@ -163,6 +170,13 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 
 		preampleTemplate := pr.Preamble()
 
+		// Records written by the pod (e.g: `# prev`) are part of the feed
+		var body io.Reader = pr
+		if !isPreambleTemplate(preampleTemplate) {
+			body = io.MultiReader(strings.NewReader(preampleTemplate), pr)
+			preampleTemplate = ""
+		}
+
 		if preampleTemplate == "" {
 			preampleCustomTemplateFn := filepath.Join(s.config.Data, feedsDir, fmt.Sprintf("%s.tpl", nick))
 			if FileExists(preampleCustomTemplateFn) {
@@ -184,18 +198,52 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 			log.WithError(err).Warn("error rendering twtxt preamble")
 		}
 
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", int64(len(preamble))+fileInfo.Size()))
+		sf, err := loadServedFeed(fn, fileInfo, preamble, body)
+		if err != nil {
+			log.WithError(err).Error("error writing served feed")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
 		w.Header().Set("Link", fmt.Sprintf(`<%s/user/%s/webmention>; rel="webmention"`, s.config.BaseURL, nick))
-		w.Header().Set("Last-Modified", fileInfo.ModTime().UTC().Format(http.TimeFormat))
+		websubs.Advertise(w, URLForUser(s.config.BaseURL, nick))
+		sf.Serve(w, r)
+	}
+}
 
-		if r.Method == http.MethodHead {
+// ArchivedFeedHandler serves the archived feeds (twtxt-<hash>.txt) a local
+// feed was rotated into, see RotateFeed
+func (s *Server) ArchivedFeedHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		nick := NormalizeUsername(p.ByName("nick"))
+		if nick == "" || !validFeedName.MatchString(nick) {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
-		if _, err = w.Write([]byte(preamble)); err != nil {
-			log.WithError(err).Warn("error writing twtxt preamble")
+		archive := p.ByName("archive")
+		hash := strings.TrimSuffix(archive, archivedFeedExt)
+		if hash == archive || !validArchivedFeedHash.MatchString(hash) {
+			http.Error(w, "Feed Not Found", http.StatusNotFound)
+			return
+		}
+
+		fn := archivedFeedPath(filepath.Join(s.config.Data, feedsDir, nick), hash)
+
+		fileInfo, err := os.Stat(fn)
+		if err != nil {
+			if os.IsNotExist(err) {
+				http.Error(w, "Feed Not Found", http.StatusNotFound)
+				return
+			}
+
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
-		_, _ = io.Copy(w, pr)
+
+		// Archived feeds only change when one of their twts is edited or
+		// deleted (see editFeedTwt) so are served as is
+		sf := &servedFeed{path: fn, info: fileInfo}
+		sf.Serve(w, r)
 	}
 }
@@ -44,6 +44,7 @@ import (
 	"github.com/goware/urlx"
 	"github.com/h2non/filetype"
 	"github.com/jointwt/twtxt"
+	"github.com/jointwt/twtxt/internal/activitypub"
 	"github.com/jointwt/twtxt/types"
 	shortuuid "github.com/lithammer/shortuuid/v3"
 	"github.com/microcosm-cc/bluemonday"
@@ -54,9 +55,10 @@ import (
 )
 
 const (
-	avatarsDir  = "avatars"
-	externalDir = "external"
-	mediaDir    = "media"
+	avatarsDir     = "avatars"
+	externalDir    = "external"
+	mediaDir       = "media"
+	webmentionsDir = "webmentions"
 
 	newsSpecialUser    = "news"
 	helpSpecialUser    = "help"
@@ -121,6 +123,8 @@ var (
 	ErrInvalidVideo     = errors.New("error: invalid video")
 	ErrInvalidVideoSize = errors.New("error: invalid video size")
 
+	ErrHandleNotResolved = errors.New("error: unable to resolve handle")
+
 	thumbnailerOpts = thumbnailer.Options{
 		ThumbDims: thumbnailer.Dims{
 			Width:  640,
@@ -213,19 +217,31 @@ func ImageToPng(fn string) error {
 	return nil
 }
 
-func GetExternalAvatar(conf *Config, nick, uri string) string {
-	slug := Slugify(uri)
+// HasExternalAvatar returns true if the avatar of the external feed uri has
+// been downloaded (and can be served by URLForExternalAvatar)
+func HasExternalAvatar(conf *Config, uri string) bool {
+	return FileExists(filepath.Join(conf.Data, externalDir, fmt.Sprintf("%s.webp", Slugify(uri))))
+}
 
-	fn := filepath.Join(conf.Data, externalDir, fmt.Sprintf("%s.webp", slug))
-	if FileExists(fn) {
+// DownloadExternalAvatar downloads the image source (e.g: declared by the
+// feed with `# avatar = <url>`) as the avatar of the external feed uri
+func DownloadExternalAvatar(conf *Config, uri, source string) error {
+	opts := &ImageOptions{Resize: true, Width: AvatarResolution, Height: AvatarResolution}
+	_, err := DownloadImage(conf, source, externalDir, Slugify(uri), opts)
+	return err
+}
+
+func GetExternalAvatar(conf *Config, nick, uri string) string {
+	if HasExternalAvatar(conf, uri) {
 		return URLForExternalAvatar(conf, uri)
 	}
 
-	if !strings.HasSuffix(uri, "/") {
-		uri += "/"
+	dir := uri
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
 	}
 
-	base, err := url.Parse(uri)
+	base, err := url.Parse(dir)
 	if err != nil {
 		log.WithError(err).Errorf("error parsing uri: %s", uri)
 		return ""
@@ -244,9 +260,7 @@ func GetExternalAvatar(conf *Config, nick, uri string) string {
 	for _, candidate := range candidates {
 		source, _ := base.Parse(candidate)
 		if ResourceExists(conf, source.String()) {
-			opts := &ImageOptions{Resize: true, Width: AvatarResolution, Height: AvatarResolution}
-			_, err := DownloadImage(conf, source.String(), externalDir, slug, opts)
-			if err != nil {
+			if err := DownloadExternalAvatar(conf, uri, source.String()); err != nil {
 				log.WithError(err).
 					WithField("base", base.String()).
 					WithField("source", source.String()).
@@ -485,6 +499,16 @@ func HasString(a []string, x string) bool {
 	return false
 }
 
+// HasAnyString returns true if any of xs is in a
+func HasAnyString(a []string, xs []string) bool {
+	for _, x := range xs {
+		if HasString(a, x) {
+			return true
+		}
+	}
+	return false
+}
+
 func UniqStrings(xs []string) []string {
 	set := make(map[string]bool)
 	for _, x := range xs {
@@ -1125,6 +1149,52 @@ func ValidateFeed(conf *Config, nick, url string) error {
 	return nil
 }
 
+// ResolveHandle resolves a handle of the form (@)nick@domain to the nick and
+// url of its twtxt feed. Handles of other pods are looked up through
+// WebFinger and ErrHandleNotResolved is returned if that isn't possible.
+func ResolveHandle(conf *Config, handle string) (string, string, error) {
+	nick, domain, err := activitypub.ParseHandle(handle)
+	if err != nil {
+		return "", "", err
+	}
+
+	local := conf.LocalURL()
+	if domain == strings.ToLower(local.Host) || domain == strings.ToLower(local.Hostname()) {
+		nick = NormalizeUsername(nick)
+		return nick, URLForUser(conf.BaseURL, nick), nil
+	}
+
+	if federation == nil {
+		return "", "", ErrHandleNotResolved
+	}
+
+	feed, err := federation.Client().LookupFeed(handle)
+	if err != nil {
+		log.WithError(err).Debugf("error looking up feed of %s", handle)
+		return "", "", fmt.Errorf("%w: %s", ErrHandleNotResolved, err)
+	}
+
+	return nick, feed, nil
+}
+
+// ResolveHandleFallback resolves a handle like ResolveHandle but falls back
+// to the /user/:nick/twtxt.txt convention of twtxt pods if the handle cannot
+// be looked up. The guessed url may not exist so callers must validate it
+// (see ValidateFeed) before using it.
+func ResolveHandleFallback(conf *Config, handle string) (string, string, error) {
+	nick, feed, err := ResolveHandle(conf, handle)
+	if err == nil || !errors.Is(err, ErrHandleNotResolved) {
+		return nick, feed, err
+	}
+
+	nick, domain, err := activitypub.ParseHandle(handle)
+	if err != nil {
+		return "", "", err
+	}
+
+	return nick, fmt.Sprintf("https://%s/user/%s/twtxt.txt", domain, nick), nil
+}
+
 func ValidateFeedName(path string, name string) error {
 	if !validFeedName.MatchString(name) {
 		return ErrInvalidFeedName
@@ -1254,6 +1324,12 @@ func RedirectRefererURL(r *http.Request, conf *Config, defaultURL string) string
 	return defaultURL
 }
 
+// IsLocalPath returns true if p is an absolute path on this pod (and not a
+// protocol relative url) that is safe to redirect to
+func IsLocalPath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") && !strings.HasPrefix(p, "/\\")
+}
+
 func HostnameFromURL(uri string) string {
 	u, err := url.Parse(uri)
 	if err != nil {
@@ -1329,6 +1405,42 @@ func URLForAvatar(baseURL string, username string) string {
 	)
 }
 
+func URLForActor(baseURL string, username string) string {
+	return fmt.Sprintf(
+		"%s/user/%s/actor",
+		strings.TrimSuffix(baseURL, "/"),
+		username,
+	)
+}
+
+func URLForInbox(baseURL string, username string) string {
+	return fmt.Sprintf(
+		"%s/user/%s/inbox",
+		strings.TrimSuffix(baseURL, "/"),
+		username,
+	)
+}
+
+func URLForOutbox(baseURL string, username string) string {
+	return fmt.Sprintf(
+		"%s/user/%s/outbox",
+		strings.TrimSuffix(baseURL, "/"),
+		username,
+	)
+}
+
+func URLForAtom(baseURL string, username string) string {
+	if username == "" {
+		return fmt.Sprintf("%s/atom.xml", strings.TrimSuffix(baseURL, "/"))
+	}
+
+	return fmt.Sprintf(
+		"%s/user/%s/atom.xml",
+		strings.TrimSuffix(baseURL, "/"),
+		username,
+	)
+}
+
 func URLForExternalProfile(conf *Config, nick, uri string) string {
 	return fmt.Sprintf(
 		"%s/external?uri=%s&nick=%s",
@@ -1347,25 +1459,11 @@ func URLForExternalAvatar(conf *Config, uri string) string {
 
 func URLForBlogFactory(conf *Config, blogs *BlogsCache) func(twt types.Twt) string {
 	return func(twt types.Twt) string {
-		subject := twt.Subject().String()
-		if subject == "" {
+		hash := subjectHash(twt)
+		if hash == "" {
 			return ""
 		}
 
-		var hash string
-
-		re := regexp.MustCompile(`\(#([a-z0-9]+)\)`)
-		match := re.FindStringSubmatch(subject)
-		if match != nil {
-			hash = match[1]
-		} else {
-			re = regexp.MustCompile(`(@|#)<([^ ]+) *([^>]+)>`)
-			match = re.FindStringSubmatch(subject)
-			if match != nil {
-				hash = match[2]
-			}
-		}
-
 		blogPost, ok := blogs.Get(hash)
 		if !ok {
 			return ""
@@ -1375,39 +1473,39 @@ func URLForBlogFactory(conf *Config, blogs *BlogsCache) func(twt types.Twt) stri
 	}
 }
 
+func CanEditTwtFactory(conf *Config) func(user *User, twt types.Twt) bool {
+	return func(user *User, twt types.Twt) bool {
+		_, err := TwtFeed(conf, user, twt)
+		return err == nil
+	}
+}
+
 func URLForConvFactory(conf *Config, cache *Cache, archive Archiver) func(twt types.Twt) string {
 	return func(twt types.Twt) string {
-		subject := twt.Subject().String()
-		if subject == "" {
+		hash := subjectHash(twt)
+		if hash == "" {
 			return ""
 		}
 
-		var hash string
-
-		re := regexp.MustCompile(`\(#([a-z0-9]+)\)`)
-		match := re.FindStringSubmatch(subject)
-		if match != nil {
-			hash = match[1]
-		} else {
-			re = regexp.MustCompile(`(@|#)<([^ ]+) *([^>]+)>`)
-			match = re.FindStringSubmatch(subject)
-			if match != nil {
-				hash = match[2]
+		// Edited (or deleted) twts are redirected (or shown as a tombstone)
+		if _, _, edited := cache.Redirect(hash); !edited {
+			if _, ok := cache.Lookup(hash); !ok && !archive.Has(hash) {
+				return ""
 			}
 		}
 
-		if _, ok := cache.Lookup(hash); !ok && !archive.Has(hash) {
-			return ""
-		}
-
-		return fmt.Sprintf(
-			"%s/conv/%s",
-			strings.TrimSuffix(conf.BaseURL, "/"),
-			hash,
-		)
+		return URLForConv(conf.BaseURL, hash)
 	}
 }
 
+func URLForConv(baseURL, hash string) string {
+	return fmt.Sprintf(
+		"%s/conv/%s",
+		strings.TrimSuffix(baseURL, "/"),
+		hash,
+	)
+}
+
 func URLForTag(baseURL, tag string) string {
 	return fmt.Sprintf(
 		"%s/search?tag=%s",
@@ -1818,6 +1916,12 @@ func NewFeedLookup(conf *Config, db Store, user *User) types.FeedLookup {
 			}
 		}
 
+		if activitypub.IsHandle(nick) {
+			if handleNick, feed, err := ResolveHandle(conf, nick); err == nil {
+				return &types.Twter{Nick: handleNick, URL: feed}
+			}
+		}
+
 		username := NormalizeUsername(nick)
 		if db.HasUser(username) || db.HasFeed(username) {
 			return &types.Twter{Nick: username, URL: URLForUser(conf.BaseURL, username)}
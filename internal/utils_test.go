@@ -2,6 +2,7 @@ package internal
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 	"testing"
 
@@ -118,3 +119,54 @@ func TestIsLocalURL(t *testing.T) {
 	}
 
 }
+
+func TestResolveHandle(t *testing.T) {
+	conf := &Config{BaseURL: "http://0.0.0.0:8000"}
+	conf.baseURL, _ = url.Parse(conf.BaseURL)
+
+	testCases := []struct {
+		handle   string
+		fallback bool
+		nick     string
+		url      string
+		err      bool
+	}{
+		{
+			handle: "@Alice@0.0.0.0:8000",
+			nick:   "alice",
+			url:    "http://0.0.0.0:8000/user/alice/twtxt.txt",
+		},
+		{
+			// Handles of other pods are never guessed without a fallback
+			handle: "bob@example.com",
+			err:    true,
+		},
+		{
+			handle:   "bob@example.com",
+			fallback: true,
+			nick:     "bob",
+			url:      "https://example.com/user/bob/twtxt.txt",
+		},
+		{
+			handle:   "https://example.com/user/bob/twtxt.txt",
+			fallback: true,
+			err:      true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		resolve := ResolveHandle
+		if testCase.fallback {
+			resolve = ResolveHandleFallback
+		}
+
+		nick, feed, err := resolve(conf, testCase.handle)
+		if testCase.err {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.nick, nick)
+		assert.Equal(t, testCase.url, feed)
+	}
+}
@@ -0,0 +1,316 @@
+package webmention
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/internal/backoff"
+)
+
+const (
+	// Inbox is the queue of received webmentions waiting to be verified
+	Inbox = "inbox"
+
+	// Outbox is the queue of webmentions waiting to be sent
+	Outbox = "outbox"
+
+	// MaxAttempts is the number of attempts made to process a webmention
+	// before it is marked as failed
+	MaxAttempts = 10
+
+	// MaxQueueSize is the maximum number of webmentions queued at once, the
+	// inbox accepts unauthenticated requests so the queue must be bounded
+	MaxQueueSize = 10000
+
+	// FailedMaxAge is how long failed webmentions are kept in the queue for
+	// inspection before they are pruned
+	FailedMaxAge = 7 * 24 * time.Hour
+
+	minBackoff = time.Minute
+	maxBackoff = 24 * time.Hour
+
+	// idLen is the length of the (hex encoded) ids of webmentions
+	idLen = 24
+)
+
+var (
+	// ErrMentionNotFound is returned for unknown webmentions
+	ErrMentionNotFound = errors.New("error: webmention not found")
+
+	// ErrQueueFull is returned when queueing a webmention whilst
+	// MaxQueueSize webmentions are already queued
+	ErrQueueFull = errors.New("error: webmention queue is full")
+
+	// ErrInvalidMentionID is returned for ids that cannot be the id of a
+	// webmention (see NewMention)
+	ErrInvalidMentionID = errors.New("error: invalid webmention id")
+)
+
+// Mention is a webmention queued for processing
+type Mention struct {
+	ID     string
+	Box    string
+	Source string
+	Target string
+
+	// Attempts is the number of failed attempts to process the webmention
+	Attempts  int
+	LastError string
+
+	// NextAttempt is when the webmention is next processed
+	NextAttempt time.Time
+
+	// Failed webmentions are no longer retried
+	Failed bool
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// NewMention returns a new webmention from source to target queued in box
+func NewMention(box, source, target string) *Mention {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s %s %s", box, source, target)))
+	now := time.Now()
+
+	return &Mention{
+		ID:          hex.EncodeToString(sum[:idLen/2]),
+		Box:         box,
+		Source:      source,
+		Target:      target,
+		NextAttempt: now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// Backoff records a failed attempt to process the webmention and schedules
+// the next attempt, backing off exponentially, or marks it as failed
+func (m *Mention) Backoff(err error, now time.Time) {
+	m.Attempts++
+	m.LastError = err.Error()
+	m.UpdatedAt = now
+
+	if m.Attempts >= MaxAttempts {
+		m.Failed = true
+		return
+	}
+
+	m.NextAttempt = now.Add(backoff.Exponential(m.Attempts, minBackoff, maxBackoff))
+}
+
+// Fail marks the webmention as failed, it is no longer retried
+func (m *Mention) Fail(err error, now time.Time) {
+	m.Attempts++
+	m.LastError = err.Error()
+	m.UpdatedAt = now
+	m.Failed = true
+}
+
+// Retry resets the webmention to be processed again as soon as possible
+func (m *Mention) Retry(now time.Time) {
+	m.Attempts = 0
+	m.LastError = ""
+	m.Failed = false
+	m.NextAttempt = now
+	m.UpdatedAt = now
+}
+
+// ValidID returns true if id is a valid webmention id, that is one returned by
+// NewMention, so that ids from requests cannot be used to access other files
+func ValidID(id string) bool {
+	if len(id) != idLen {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// Due returns true if the webmention is to be processed at now
+func (m *Mention) Due(now time.Time) bool {
+	return !m.Failed && !now.Before(m.NextAttempt)
+}
+
+// Queue is a durable queue of webmentions, each stored as a JSON document in
+// a directory so that pending webmentions survive restarts
+type Queue struct {
+	sync.Mutex
+
+	path string
+	size int
+}
+
+// NewQueue returns a new queue stored in the directory path
+func NewQueue(path string) (*Queue, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+
+	fns, err := filepath.Glob(filepath.Join(path, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Queue{path: path, size: len(fns)}, nil
+}
+
+// Len returns the number of queued webmentions
+func (q *Queue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.size
+}
+
+func (q *Queue) filename(id string) string {
+	return filepath.Join(q.path, fmt.Sprintf("%s.json", id))
+}
+
+// Put adds the webmention to the queue, replacing any with the same id, or
+// returns ErrQueueFull if the queue already holds MaxQueueSize webmentions
+func (q *Queue) Put(m *Mention) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	fn := q.filename(m.ID)
+
+	_, err = os.Stat(fn)
+	exists := err == nil
+	if !exists && q.size >= MaxQueueSize {
+		return ErrQueueFull
+	}
+
+	tmp := fmt.Sprintf("%s.tmp", fn)
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, fn); err != nil {
+		return err
+	}
+
+	if !exists {
+		q.size++
+	}
+	return nil
+}
+
+// Get returns the webmention with the given id
+func (q *Queue) Get(id string) (*Mention, error) {
+	if !ValidID(id) {
+		return nil, ErrInvalidMentionID
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	return q.load(q.filename(id))
+}
+
+func (q *Queue) load(fn string) (*Mention, error) {
+	data, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		return nil, ErrMentionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	m := &Mention{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Del removes the webmention with the given id from the queue
+func (q *Queue) Del(id string) error {
+	if !ValidID(id) {
+		return ErrInvalidMentionID
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	return q.remove(q.filename(id))
+}
+
+func (q *Queue) remove(fn string) error {
+	if err := os.Remove(fn); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	q.size--
+	return nil
+}
+
+// All returns all queued webmentions, oldest first. Webmentions that cannot be
+// loaded (e.g: corrupt files) are logged and skipped.
+func (q *Queue) All() ([]*Mention, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	fns, err := filepath.Glob(filepath.Join(q.path, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var ms []*Mention
+	for _, fn := range fns {
+		m, err := q.load(fn)
+		if err != nil {
+			log.WithError(err).Warnf("error loading webmention %s, skipping", strings.TrimSuffix(filepath.Base(fn), ".json"))
+			continue
+		}
+		ms = append(ms, m)
+	}
+
+	sort.Slice(ms, func(i, j int) bool { return ms[i].CreatedAt.Before(ms[j].CreatedAt) })
+
+	return ms, nil
+}
+
+// Prune removes failed webmentions last updated before the given time as
+// well as webmentions that cannot be loaded (e.g: corrupt files) and returns
+// the number of webmentions removed
+func (q *Queue) Prune(before time.Time) (int, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	fns, err := filepath.Glob(filepath.Join(q.path, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, fn := range fns {
+		m, err := q.load(fn)
+		if err == ErrMentionNotFound || (err == nil && !(m.Failed && m.UpdatedAt.Before(before))) {
+			continue
+		}
+		if err := q.remove(fn); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
@@ -0,0 +1,135 @@
+package webmention
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	require.NoError(t, err)
+
+	first := NewMention(Outbox, "https://example.com/twt/abc", "https://example.org/twtxt.txt")
+	second := NewMention(Inbox, "https://example.org/post", "https://example.com/user/alice/twtxt.txt")
+	second.CreatedAt = first.CreatedAt.Add(time.Second)
+
+	require.NoError(t, q.Put(second))
+	require.NoError(t, q.Put(first))
+
+	// The same mention is only ever queued once
+	require.NoError(t, q.Put(NewMention(Outbox, first.Source, first.Target)))
+
+	ms, err := q.All()
+	require.NoError(t, err)
+	require.Len(t, ms, 2)
+	assert.Equal(t, first.ID, ms[0].ID)
+	assert.Equal(t, second.ID, ms[1].ID)
+
+	require.NoError(t, q.Del(first.ID))
+	_, err = q.Get(first.ID)
+	assert.Equal(t, ErrMentionNotFound, err)
+
+	m, err := q.Get(second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, second.Source, m.Source)
+
+	// Only ids returned by NewMention are accepted
+	for _, id := range []string{"", "../../config", "../" + second.ID[3:], strings.ToUpper(second.ID) + "0"} {
+		_, err = q.Get(id)
+		assert.Equal(t, ErrInvalidMentionID, err, id)
+		assert.Equal(t, ErrInvalidMentionID, q.Del(id), id)
+	}
+	assert.Equal(t, 1, q.Len())
+}
+
+func TestMentionBackoff(t *testing.T) {
+	m := NewMention(Outbox, "https://example.com/twt/abc", "https://example.org/twtxt.txt")
+	now := time.Now()
+	assert.True(t, m.Due(now))
+
+	m.Backoff(errors.New("timeout"), now)
+	assert.Equal(t, now.Add(minBackoff), m.NextAttempt)
+	assert.False(t, m.Due(now))
+
+	m.Backoff(errors.New("timeout"), now)
+	assert.Equal(t, now.Add(2*minBackoff), m.NextAttempt)
+
+	for m.Attempts < MaxAttempts {
+		m.Backoff(errors.New("timeout"), now)
+	}
+	assert.True(t, m.Failed)
+	assert.False(t, m.Due(now.Add(maxBackoff)))
+
+	m.Retry(now)
+	assert.True(t, m.Due(now))
+	assert.Equal(t, 0, m.Attempts)
+
+	m.Fail(ErrNoLink, now)
+	assert.True(t, m.Failed)
+	assert.Equal(t, ErrNoLink.Error(), m.LastError)
+}
+
+func TestQueuePrune(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewQueue(dir)
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	pending := NewMention(Outbox, "https://example.com/twt/abc", "https://example.org/twtxt.txt")
+	require.NoError(t, q.Put(pending))
+
+	failed := NewMention(Inbox, "https://example.org/post", "https://example.com/user/alice/twtxt.txt")
+	failed.Fail(ErrNoLink, now.Add(-2*FailedMaxAge))
+	require.NoError(t, q.Put(failed))
+
+	recent := NewMention(Inbox, "https://example.org/other", "https://example.com/user/alice/twtxt.txt")
+	recent.Fail(ErrNoLink, now)
+	require.NoError(t, q.Put(recent))
+
+	// Corrupt webmentions are skipped instead of stalling the queue
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "corrupt.json"), []byte("{"), 0644))
+
+	q, err = NewQueue(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 4, q.Len())
+
+	ms, err := q.All()
+	require.NoError(t, err)
+	assert.Len(t, ms, 3)
+
+	n, err := q.Prune(now.Add(-FailedMaxAge))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, q.Len())
+
+	_, err = q.Get(failed.ID)
+	assert.Equal(t, ErrMentionNotFound, err)
+	_, err = q.Get(recent.ID)
+	assert.NoError(t, err)
+}
+
+func TestQueueFull(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	require.NoError(t, err)
+	q.size = MaxQueueSize
+
+	m := NewMention(Outbox, "https://example.com/twt/abc", "https://example.org/twtxt.txt")
+	assert.Equal(t, ErrQueueFull, q.Put(m))
+
+	q.size = MaxQueueSize - 1
+	require.NoError(t, q.Put(m))
+	assert.Equal(t, ErrQueueFull, q.Put(NewMention(Inbox, m.Source, m.Target)))
+
+	// Updating a queued webmention is always possible
+	require.NoError(t, q.Put(m))
+	require.NoError(t, q.Del(m.ID))
+	assert.Equal(t, MaxQueueSize-1, q.Len())
+}
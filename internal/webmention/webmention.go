@@ -2,6 +2,10 @@
 package webmention
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
@@ -13,41 +17,179 @@ import (
 	"golang.org/x/net/html/atom"
 )
 
+const (
+	// processInterval is how often the queue is checked for webmentions due
+	// to be (re)processed
+	processInterval = 30 * time.Second
+
+	// pruneInterval is how often failed and unreadable webmentions are
+	// pruned from the queue
+	pruneInterval = time.Hour
+
+	// maxSourceSize is the maximum size of sources read to verify them
+	maxSourceSize = 1 << 20
+)
+
+var (
+	// ErrNoLink is returned when the source of a webmention does not (or no
+	// longer) link to its target
+	ErrNoLink = errors.New("error: source does not link to target")
+
+	// ErrNoEndpoint is returned when the target of a webmention does not
+	// advertise a webmention endpoint
+	ErrNoEndpoint = errors.New("error: no webmention endpoint found")
+)
+
+// permanentError is an error processing a webmention that retrying would not
+// resolve (e.g: the source no longer links to the target)
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error { return e.error }
+
+func permanent(err error) error {
+	return permanentError{err}
+}
+
 type WebMention struct {
-	inbox       chan *mention
-	outbox      chan *mention
-	inboxTimer  *time.Timer
-	outboxTimer *time.Timer
-	Mention     func(source, target *url.URL, sourceData *microformats.Data) error
+	client  *http.Client
+	queue   *Queue
+	wake    chan struct{}
+	pruned  time.Time
+	Mention func(source, target *url.URL, sourceData *microformats.Data) error
 }
 
-func New() *WebMention {
+// New returns a new WebMention processor whose inbox and outbox are queued in
+// the directory path, pending webmentions are processed in the background
+// and failures retried with exponential backoff
+func New(path string) (*WebMention, error) {
+	queue, err := NewQueue(path)
+	if err != nil {
+		return nil, err
+	}
+
 	wm := &WebMention{
-		inbox:  make(chan *mention, 100),
-		outbox: make(chan *mention, 100),
-	}
-	wm.inboxTimer = time.NewTimer(5 * time.Second)
-	wm.outboxTimer = time.NewTimer(5 * time.Second)
-	go func() {
-		for range wm.inboxTimer.C {
-			wm.processInbox()
+		client: &http.Client{Timeout: 30 * time.Second},
+		queue:  queue,
+		wake:   make(chan struct{}, 1),
+	}
+	go wm.run()
+
+	return wm, nil
+}
+
+// Mentions returns all pending and failed webmentions, oldest first
+func (wm *WebMention) Mentions() ([]*Mention, error) {
+	return wm.queue.All()
+}
+
+// Retry resets the webmention with the given id to be processed again
+func (wm *WebMention) Retry(id string) error {
+	m, err := wm.queue.Get(id)
+	if err != nil {
+		return err
+	}
+
+	m.Retry(time.Now())
+	return wm.enqueue(m)
+}
+
+// Remove removes the webmention with the given id from the queue
+func (wm *WebMention) Remove(id string) error {
+	return wm.queue.Del(id)
+}
+
+func (wm *WebMention) enqueue(m *Mention) error {
+	if err := wm.queue.Put(m); err != nil {
+		return err
+	}
+
+	select {
+	case wm.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (wm *WebMention) run() {
+	ticker := time.NewTicker(processInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-wm.wake:
+		}
+
+		wm.processQueue()
+	}
+}
+
+func (wm *WebMention) processQueue() {
+	if time.Since(wm.pruned) >= pruneInterval {
+		wm.pruned = time.Now()
+		if n, err := wm.queue.Prune(wm.pruned.Add(-FailedMaxAge)); err != nil {
+			log.WithError(err).Error("error pruning webmentions queue")
+		} else if n > 0 {
+			log.Infof("pruned %d failed webmentions", n)
 		}
-	}()
-	go func() {
-		for range wm.outboxTimer.C {
-			wm.processOutbox()
+	}
+
+	ms, err := wm.queue.All()
+	if err != nil {
+		log.WithError(err).Error("error loading webmentions queue")
+		return
+	}
+
+	now := time.Now()
+	for _, m := range ms {
+		if m.Due(now) {
+			wm.process(m)
 		}
-	}()
-	return wm
+	}
 }
 
-type mention struct {
-	source *url.URL
-	target *url.URL
+func (wm *WebMention) process(m *Mention) {
+	var err error
+	if m.Box == Inbox {
+		err = wm.processInbox(m)
+	} else {
+		err = wm.processOutbox(m)
+	}
+
+	var perr permanentError
+	switch {
+	case err == nil:
+		log.Infof("processed %s webmention source=%s target=%s", m.Box, m.Source, m.Target)
+		if err := wm.queue.Del(m.ID); err != nil {
+			log.WithError(err).Errorf("error removing webmention %s", m.ID)
+		}
+		return
+	case errors.Is(err, ErrNoEndpoint):
+		// Most feeds do not accept webmentions, there is nothing to retry
+		log.Debugf("no webmention endpoint found for %s", m.Target)
+		if err := wm.queue.Del(m.ID); err != nil {
+			log.WithError(err).Errorf("error removing webmention %s", m.ID)
+		}
+		return
+	case errors.As(err, &perr):
+		m.Fail(err, time.Now())
+	default:
+		m.Backoff(err, time.Now())
+	}
+
+	log.WithError(err).Warnf(
+		"error processing %s webmention source=%s target=%s (attempt %d)",
+		m.Box, m.Source, m.Target, m.Attempts,
+	)
+	if err := wm.queue.Put(m); err != nil {
+		log.WithError(err).Errorf("error updating webmention %s", m.ID)
+	}
 }
 
 func (wm *WebMention) GetTargetEndpoint(target *url.URL) (*url.URL, error) {
-	res, err := http.Get(target.String())
+	res, err := wm.client.Get(target.String())
 	if err != nil {
 		log.WithError(err).Error("error getting target endpoint")
 		return nil, err
@@ -57,14 +199,14 @@ func (wm *WebMention) GetTargetEndpoint(target *url.URL) (*url.URL, error) {
 	links := GetHeaderLinks(res.Header["Link"])
 	for _, link := range links {
 		for _, rel := range link.Params["rel"] {
-			if rel == "webmention" || rel == "http://webmention.org" {
-				return link.URL, nil
+			if (rel == "webmention" || rel == "http://webmention.org") && link.URL != nil {
+				return target.ResolveReference(link.URL), nil
 			}
 		}
 	}
 
 	parser := microformats.New()
-	mf2data := parser.Parse(res.Body, target)
+	mf2data := parser.Parse(io.LimitReader(res.Body, maxSourceSize), target)
 
 	for _, link := range mf2data.Rels["webmention"] {
 		wmurl, err := url.Parse(link)
@@ -72,101 +214,170 @@ func (wm *WebMention) GetTargetEndpoint(target *url.URL) (*url.URL, error) {
 			log.WithError(err).Warn("error parsing webmention link")
 			continue
 		}
-		return wmurl, nil
+		return target.ResolveReference(wmurl), nil
 	}
 
 	return nil, nil
 }
 
 func (wm *WebMention) SendNotification(target *url.URL, source *url.URL) {
-	wm.outbox <- &mention{source, target}
+	m := NewMention(Outbox, source.String(), target.String())
+	if err := wm.enqueue(m); err != nil {
+		log.WithError(err).Errorf("error queueing webmention source=%s target=%s", source, target)
+	}
 }
 
 func (wm *WebMention) WebMentionEndpoint(w http.ResponseWriter, r *http.Request) {
-	source := r.FormValue("source")
-	target := r.FormValue("target")
-	if source != "" && target != "" {
-		sourceurl, _ := url.Parse(source)
-		targeturl, _ := url.Parse(target)
-		wm.inbox <- &mention{
-			sourceurl,
-			targeturl,
-		}
-		log.Infof("webmention source=%s target=%s enqueued for processing", source, target)
-		w.WriteHeader(http.StatusAccepted)
-	} else {
+	source, err := parseURL(r.FormValue("source"))
+	if err != nil {
+		log.Warn("invalid webmention recieved")
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	target, err := parseURL(r.FormValue("target"))
+	if err != nil || target.String() == source.String() {
 		log.Warn("invalid webmention recieved")
 		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
 	}
-}
-
-func (wm *WebMention) processInbox() {
-	mention := <-wm.inbox
 
-	res, err := http.Get(mention.source.String())
-	if err != nil || res.StatusCode/100 != 2 {
-		log.Errorf("Error getting source %s (%s): %s", mention.source, res.Status, err)
+	m := NewMention(Inbox, source.String(), target.String())
+	if err := wm.enqueue(m); err != nil {
+		log.WithError(err).Errorf("error queueing webmention source=%s target=%s", source, target)
+		if err == ErrQueueFull {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	defer res.Body.Close()
 
-	body, err := html.Parse(res.Body)
+	log.Infof("webmention source=%s target=%s enqueued for processing", source, target)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (wm *WebMention) processInbox(m *Mention) error {
+	source, err := parseURL(m.Source)
 	if err != nil {
-		log.Errorf("Error parsing source %s: %s", mention.source, err)
-		return
+		return permanent(err)
+	}
+	target, err := parseURL(m.Target)
+	if err != nil {
+		return permanent(err)
 	}
 
-	found := searchLinks(body, mention.target)
-	if found {
-		p := microformats.New()
-		data := p.ParseNode(body, mention.source)
-		if err := wm.Mention(mention.source, mention.target, data); err != nil {
-			log.WithError(err).Error("error processing webmention")
-		} else {
-			log.Infof("processed webmention with mf2 source=%s target=%s", mention.source, mention.target)
-		}
-		return
+	body, err := wm.verify(source, target)
+	if err != nil {
+		return err
 	}
 
-	links := GetHeaderLinks(res.Header.Values("Link"))
-	if len(links) > 0 {
-		if err := wm.Mention(mention.source, mention.target, nil); err != nil {
-			log.WithError(err).Error("error processing webmention")
-		} else {
-			log.Infof("processed webmention without mf2 source=%s target=%s", mention.source, mention.target)
-		}
-		return
+	var data *microformats.Data
+	if body != nil {
+		data = microformats.New().ParseNode(body, source)
 	}
 
-	log.Warnf("no links found on %s", mention.source.String())
+	return wm.Mention(source, target, data)
 }
 
-func (wm *WebMention) processOutbox() {
-	mention := <-wm.outbox
+func (wm *WebMention) processOutbox(m *Mention) error {
+	source, err := parseURL(m.Source)
+	if err != nil {
+		return permanent(err)
+	}
+	target, err := parseURL(m.Target)
+	if err != nil {
+		return permanent(err)
+	}
+
+	// Don't send webmentions for sources that were since edited or deleted
+	if _, err := wm.verify(source, target); err != nil {
+		return err
+	}
 
-	endpoint, err := wm.GetTargetEndpoint(mention.target)
+	endpoint, err := wm.GetTargetEndpoint(target)
 	if err != nil {
-		log.WithError(err).Error("error retrieving webmention endpoint")
-		return
+		return err
 	}
 	if endpoint == nil {
-		log.Warn("no webmention endpoint found")
-		return
+		return ErrNoEndpoint
 	}
+
 	values := make(url.Values)
-	values.Set("source", mention.source.String())
-	values.Set("target", mention.target.String())
-	if res, err := http.PostForm(endpoint.String(), values); err != nil || (res.StatusCode%100 != 2) {
-		log.WithError(err).Errorf(
-			"error sending webmention source=%s target=%s status=%s",
-			mention.source.String(), mention.target.String(), res.Status,
-		)
-		return
+	values.Set("source", source.String())
+	values.Set("target", target.String())
+	res, err := wm.client.PostForm(endpoint.String(), values)
+	if err != nil {
+		return err
 	}
-	log.Infof(
-		"successfully sent webmention to %s (source=%s target=%s)",
-		endpoint.String(), mention.source.String(), mention.target.String(),
-	)
+	res.Body.Close()
+
+	if err := checkStatus(res); err != nil {
+		return err
+	}
+
+	log.Infof("successfully sent webmention to %s (source=%s target=%s)", endpoint, source, target)
+	return nil
+}
+
+// verify fetches source and checks that it (still) links to target, the
+// parsed source is returned if it is an HTML document
+func (wm *WebMention) verify(source, target *url.URL) (*html.Node, error) {
+	res, err := wm.client.Get(source.String())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := checkStatus(res); err != nil {
+		return nil, err
+	}
+
+	body := io.LimitReader(res.Body, maxSourceSize)
+
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(string(data), target.String()) {
+			return nil, permanent(ErrNoLink)
+		}
+		return nil, nil
+	}
+
+	node, err := html.Parse(body)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("error parsing source: %w", err))
+	}
+	if !searchLinks(node, target) {
+		return nil, permanent(ErrNoLink)
+	}
+	return node, nil
+}
+
+// checkStatus returns an error for non-2xx responses, client errors (other
+// than rate limiting) are permanent
+func checkStatus(res *http.Response) error {
+	if res.StatusCode/100 == 2 {
+		return nil
+	}
+
+	err := fmt.Errorf("unexpected status: %s", res.Status)
+	if res.StatusCode/100 == 4 && res.StatusCode != http.StatusTooManyRequests {
+		return permanent(err)
+	}
+	return err
+}
+
+func parseURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("error: invalid url %q", s)
+	}
+	return u, nil
 }
 
 func searchLinks(node *html.Node, link *url.URL) bool {
@@ -177,7 +388,7 @@ func searchLinks(node *html.Node, link *url.URL) bool {
 				if err == nil {
 					// jointwt/twtxt pods have the form
 					// http://pod.domain.tld/external?uri=uri&nick=nick
-					if strings.HasPrefix(target.Path, "/external") && target.Query().Get("url") == link.String() {
+					if strings.HasPrefix(target.Path, "/external") && target.Query().Get("uri") == link.String() {
 						return true
 					}
 					if target.String() == link.String() {
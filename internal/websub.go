@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jointwt/twtxt/internal/websub"
+	"github.com/jointwt/twtxt/types"
+)
+
+const (
+	// webSubHubPath is the path of the pod's WebSub hub
+	webSubHubPath = "/websub/hub"
+
+	// webSubCallbackPath is the path remote hubs push content to
+	webSubCallbackPath = "/websub/callback"
+
+	// pushedFeedPollInterval is how often feeds pushed over WebSub are still
+	// polled for in case pushes are lost
+	pushedFeedPollInterval = time.Hour
+)
+
+// WebSub pushes updates of the pod's feeds to the subscribers of its hub and
+// subscribes to the hubs of remote feeds so that they are refreshed in the
+// cache as soon as they are updated rather than the next time they are polled.
+type WebSub struct {
+	conf       *Config
+	db         Store
+	hub        *websub.Hub
+	subscriber *websub.Subscriber
+}
+
+// NewWebSub returns a new WebSub hub and subscriber. The content of topics is
+// rendered by handler (the pod's router) so that subscribers are pushed exactly
+// what they would fetch.
+func NewWebSub(conf *Config, db Store, cache *Cache, archive Archiver, handler http.Handler) *WebSub {
+	client := &http.Client{Timeout: 30 * time.Second}
+	baseURL := strings.TrimSuffix(conf.BaseURL, "/")
+
+	ws := &WebSub{
+		conf:       conf,
+		db:         db,
+		hub:        websub.NewHub(baseURL+webSubHubPath, db, client),
+		subscriber: websub.NewSubscriber(baseURL+webSubCallbackPath, client),
+	}
+
+	ws.hub.Topics = ws.isTopic
+	ws.hub.Content = func(topic string) ([]byte, string, error) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, topic, nil))
+		if w.Code != http.StatusOK {
+			return nil, "", fmt.Errorf("unexpected status: %d", w.Code)
+		}
+		return w.Body.Bytes(), w.Header().Get("Content-Type"), nil
+	}
+
+	ws.subscriber.Notify = func(topic string) {
+		cache.mu.RLock()
+		cached, ok := cache.Twts[topic]
+		cache.mu.RUnlock()
+
+		// Pushes for feeds no longer followed are ignored
+		if !ok {
+			return
+		}
+
+		log.Debugf("feed %s was pushed, refreshing", topic)
+		feed := types.Feed{Nick: cached.Twter.Nick, URL: topic}
+		cache.FetchTwts(conf, archive, types.Feeds{feed: true}, nil)
+	}
+
+	return ws
+}
+
+// isTopic returns true if topic is the twtxt.txt or atom.xml feed of a local
+// user or feed, or the pod's atom.xml feed
+func (ws *WebSub) isTopic(topic string) bool {
+	if topic == URLForAtom(ws.conf.BaseURL, "") {
+		return true
+	}
+
+	prefix := strings.TrimSuffix(ws.conf.BaseURL, "/") + "/user/"
+	if !strings.HasPrefix(topic, prefix) {
+		return false
+	}
+
+	nick := strings.SplitN(strings.TrimPrefix(topic, prefix), "/", 2)[0]
+	if topic != URLForUser(ws.conf.BaseURL, nick) && topic != URLForAtom(ws.conf.BaseURL, nick) {
+		return false
+	}
+
+	return ws.db.HasUser(nick) || ws.db.HasFeed(nick)
+}
+
+// Hub returns the url of the pod's hub
+func (ws *WebSub) Hub() string {
+	return ws.hub.URL
+}
+
+// Advertise adds the Link header advertising the pod's hub for topic
+func (ws *WebSub) Advertise(w http.ResponseWriter, topic string) {
+	if ws == nil {
+		return
+	}
+
+	w.Header().Add("Link", websub.Links(ws.Hub(), topic))
+}
+
+// Publish notifies the subscribers of the local feed name (and of the pod's
+// atom.xml feed) that it was updated
+func (ws *WebSub) Publish(name string) {
+	if ws == nil {
+		return
+	}
+
+	ws.hub.Publish(URLForUser(ws.conf.BaseURL, name))
+	ws.hub.Publish(URLForAtom(ws.conf.BaseURL, name))
+	ws.hub.Publish(URLForAtom(ws.conf.BaseURL, ""))
+}
+
+// Discovered subscribes to the hub advertised by the headers of a response
+// fetching the remote feed url, if it advertises one
+func (ws *WebSub) Discovered(url string, header http.Header) {
+	if ws == nil || ws.subscriber.Subscribed(url) {
+		return
+	}
+
+	hub, self := websub.Discover(header)
+	if hub == "" || (self != "" && self != url) {
+		return
+	}
+
+	go func() {
+		if err := ws.subscriber.Subscribe(hub, url); err != nil {
+			log.WithError(err).Warnf("error subscribing to %s at %s", url, hub)
+		}
+	}()
+}
+
+// Pushed returns true if updates of the remote feed url are pushed to us
+func (ws *WebSub) Pushed(url string) bool {
+	if ws == nil {
+		return false
+	}
+
+	return ws.subscriber.Subscribed(url)
+}
@@ -0,0 +1,262 @@
+package websub
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// publishDelay is how long updates to topics are held back for, so that
+	// consecutive updates (e.g: a thread of twts) are delivered together
+	publishDelay = 5 * time.Second
+
+	// maxAttempts is the maximum number of attempts to deliver content
+	maxAttempts = 3
+)
+
+// Hub is a WebSub hub delivering the content of the topics it publishes to
+// their subscribers whenever they are updated
+type Hub struct {
+	// URL is the url of the hub's endpoint
+	URL string
+
+	// Topics returns true if the hub publishes topic
+	Topics func(topic string) bool
+
+	// Content returns the content of topic and its content type
+	Content func(topic string) ([]byte, string, error)
+
+	client *http.Client
+	store  Store
+
+	mu      sync.Mutex
+	pending map[string]bool
+	timer   *time.Timer
+}
+
+// NewHub returns a new hub at the given url, its subscriptions persisted in
+// store
+func NewHub(url string, store Store, client *http.Client) *Hub {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Hub{
+		URL:     url,
+		client:  client,
+		store:   store,
+		pending: make(map[string]bool),
+	}
+}
+
+// HubEndpoint handles (un)subscription requests, the intent of subscribers
+// is verified asynchronously
+func (h *Hub) HubEndpoint(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	mode := r.PostForm.Get("hub.mode")
+	if mode != "subscribe" && mode != "unsubscribe" {
+		http.Error(w, ErrInvalidMode.Error(), http.StatusBadRequest)
+		return
+	}
+
+	topic := r.PostForm.Get("hub.topic")
+	if topic == "" || h.Topics == nil || !h.Topics(topic) {
+		http.Error(w, ErrInvalidTopic.Error(), http.StatusBadRequest)
+		return
+	}
+
+	callback := r.PostForm.Get("hub.callback")
+	if u, err := url.Parse(callback); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		http.Error(w, ErrInvalidCallback.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lease := DefaultLease
+	if s := r.PostForm.Get("hub.lease_seconds"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 {
+			lease = time.Duration(n) * time.Second
+		}
+	}
+	if lease > MaxLease {
+		lease = MaxLease
+	}
+
+	sub := &Subscription{
+		Topic:     topic,
+		Hub:       h.URL,
+		Callback:  callback,
+		Secret:    r.PostForm.Get("hub.secret"),
+		CreatedAt: time.Now(),
+	}
+
+	go func() {
+		if err := h.verify(mode, sub, lease); err != nil {
+			log.WithError(err).Warnf("error verifying %s of %s to %s", mode, sub.Callback, sub.Topic)
+			return
+		}
+
+		var err error
+		if mode == "subscribe" {
+			sub.Expires = time.Now().Add(lease)
+			err = h.store.SetSubscription(sub.ID(), sub)
+		} else {
+			err = h.store.DelSubscription(sub.ID())
+		}
+		if err != nil {
+			log.WithError(err).Errorf("error storing %s of %s to %s", mode, sub.Callback, sub.Topic)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// verify verifies the intent of the subscriber of sub by requesting it echo
+// back a random challenge
+func (h *Hub) verify(mode string, sub *Subscription, lease time.Duration) error {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	challenge := hex.EncodeToString(buf)
+
+	u, err := url.Parse(sub.Callback)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("hub.mode", mode)
+	q.Set("hub.topic", sub.Topic)
+	q.Set("hub.challenge", challenge)
+	if mode == "subscribe" {
+		q.Set("hub.lease_seconds", strconv.Itoa(int(lease/time.Second)))
+	}
+	u.RawQuery = q.Encode()
+
+	res, err := h.client.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, int64(len(challenge))+1))
+	if err != nil || res.StatusCode/100 != 2 || string(bytes.TrimSpace(body)) != challenge {
+		return ErrVerificationFailed
+	}
+
+	return nil
+}
+
+// Publish notifies the hub that topic was updated, its content is delivered
+// to its subscribers shortly after
+func (h *Hub) Publish(topic string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.pending[topic] = true
+	if h.timer == nil {
+		h.timer = time.AfterFunc(publishDelay, h.flush)
+	}
+}
+
+// flush delivers the content of the topics updated since the last flush
+func (h *Hub) flush() {
+	h.mu.Lock()
+	pending := h.pending
+	h.pending = make(map[string]bool)
+	h.timer = nil
+	h.mu.Unlock()
+
+	subs, err := h.store.GetAllSubscriptions()
+	if err != nil {
+		log.WithError(err).Error("error loading subscriptions")
+		return
+	}
+
+	now := time.Now()
+	for topic := range pending {
+		var content []byte
+		var contentType string
+
+		for _, sub := range subs {
+			if sub.Topic != topic {
+				continue
+			}
+
+			if sub.Expired(now) {
+				if err := h.store.DelSubscription(sub.ID()); err != nil {
+					log.WithError(err).Warnf("error removing expired subscription %s", sub.ID())
+				}
+				continue
+			}
+
+			if content == nil {
+				if content, contentType, err = h.Content(topic); err != nil {
+					log.WithError(err).Errorf("error getting content of %s", topic)
+					break
+				}
+			}
+
+			go h.deliver(sub, content, contentType, 1)
+		}
+	}
+}
+
+// deliver delivers content to the subscriber of sub, failed deliveries are
+// retried (with backoff) up to maxAttempts times
+func (h *Hub) deliver(sub *Subscription, content []byte, contentType string, attempt int) {
+	req, err := http.NewRequest(http.MethodPost, sub.Callback, bytes.NewReader(content))
+	if err != nil {
+		log.WithError(err).Errorf("error creating request to %s", sub.Callback)
+		return
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Link", Links(h.URL, sub.Topic))
+	if sub.Secret != "" {
+		req.Header.Set("X-Hub-Signature", signature(sub.Secret, content))
+	}
+
+	res, err := h.client.Do(req)
+	if err == nil {
+		res.Body.Close()
+
+		switch {
+		case res.StatusCode/100 == 2:
+			return
+		case res.StatusCode == http.StatusGone:
+			// The subscriber is no longer interested
+			if err := h.store.DelSubscription(sub.ID()); err != nil {
+				log.WithError(err).Warnf("error removing subscription %s", sub.ID())
+			}
+			return
+		}
+		err = fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	if attempt >= maxAttempts {
+		log.WithError(err).Warnf("giving up delivering %s to %s", sub.Topic, sub.Callback)
+		return
+	}
+
+	time.AfterFunc(time.Duration(attempt*attempt)*time.Minute, func() {
+		h.deliver(sub, content, contentType, attempt+1)
+	})
+}
@@ -0,0 +1,281 @@
+package websub
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxContentSize is the maximum size of content pushed to subscribers
+	maxContentSize = 1 << 20
+
+	// pendingTimeout is how long subscriptions are left pending verification
+	// before they are requested again
+	pendingTimeout = 10 * time.Minute
+)
+
+// Subscriber subscribes to the hubs of remote topics and receives the
+// content they push to its callback
+type Subscriber struct {
+	// Callback is the url of the subscriber's callback endpoint, the topic
+	// of each subscription is added to it (as the `topic` query parameter)
+	Callback string
+
+	// Notify is called with the topic of verified pushes
+	Notify func(topic string)
+
+	client *http.Client
+
+	mu            sync.RWMutex
+	subscriptions map[string]*Subscription
+}
+
+// NewSubscriber returns a new subscriber receiving pushes at callback
+func NewSubscriber(callback string, client *http.Client) *Subscriber {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Subscriber{
+		Callback:      callback,
+		client:        client,
+		subscriptions: make(map[string]*Subscription),
+	}
+}
+
+// Subscribed returns true if the subscription to topic is verified and not
+// about to expire
+func (s *Subscriber) Subscribed(topic string) bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sub, ok := s.subscriptions[topic]
+	return ok && !sub.Expires.IsZero() && time.Now().Add(RenewBefore).Before(sub.Expires)
+}
+
+// Subscribe subscribes to topic at hub unless already subscribed (or about
+// to be), the subscription is active once verified by the hub
+func (s *Subscriber) Subscribe(hub, topic string) error {
+	if s == nil || s.Subscribed(topic) {
+		return nil
+	}
+
+	s.mu.Lock()
+	if sub, ok := s.subscriptions[topic]; ok && sub.pending && time.Since(sub.CreatedAt) < pendingTimeout {
+		s.mu.Unlock()
+		return nil
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	token, err := randomToken(16)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	old, renewal := s.subscriptions[topic]
+	if renewal {
+		// Renewals keep the callback the hub knows the subscription by
+		token = old.Token
+	}
+
+	sub := &Subscription{
+		Topic:     topic,
+		Hub:       hub,
+		Callback:  s.callbackFor(topic, token),
+		Secret:    secret,
+		Token:     token,
+		CreatedAt: time.Now(),
+		pending:   true,
+	}
+	if renewal && !old.Expires.IsZero() {
+		// Keep the subscription being renewed until the renewal is verified
+		sub.Expires = old.Expires
+	}
+	s.subscriptions[topic] = sub
+	s.mu.Unlock()
+
+	return s.request("subscribe", sub)
+}
+
+// Unsubscribe unsubscribes from topic if subscribed
+func (s *Subscriber) Unsubscribe(topic string) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	sub, ok := s.subscriptions[topic]
+	delete(s.subscriptions, topic)
+	s.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return s.request("unsubscribe", sub)
+}
+
+// callbackFor returns the callback of the subscription to topic identified
+// by token
+func (s *Subscriber) callbackFor(topic, token string) string {
+	sep := "?"
+	if strings.Contains(s.Callback, "?") {
+		sep = "&"
+	}
+	return s.Callback + sep + "topic=" + url.QueryEscape(topic) + "&token=" + url.QueryEscape(token)
+}
+
+// randomToken returns a random hex encoded token of n bytes
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// request makes a (un)subscription request for sub to its hub
+func (s *Subscriber) request(mode string, sub *Subscription) error {
+	form := url.Values{}
+	form.Set("hub.mode", mode)
+	form.Set("hub.topic", sub.Topic)
+	form.Set("hub.callback", sub.Callback)
+	if mode == "subscribe" {
+		form.Set("hub.secret", sub.Secret)
+		form.Set("hub.lease_seconds", strconv.Itoa(int(DefaultLease/time.Second)))
+	}
+
+	res, err := s.client.PostForm(sub.Hub, form)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status: %s", res.Status)
+	}
+	return nil
+}
+
+// CallbackEndpoint handles the verification of intent of (un)subscription
+// requests (GET) and the content pushed by hubs (POST). Requests without the
+// token of the subscription's callback are treated as for an unknown
+// subscription.
+func (s *Subscriber) CallbackEndpoint(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	topic := q.Get("topic")
+
+	s.mu.RLock()
+	sub, ok := s.subscriptions[topic]
+	s.mu.RUnlock()
+
+	if ok && !hmac.Equal([]byte(q.Get("token")), []byte(sub.Token)) {
+		sub, ok = nil, false
+	}
+
+	if r.Method == http.MethodGet {
+		s.verify(w, r, sub)
+		return
+	}
+
+	if !ok {
+		// Unknown (e.g: forgotten on restart) subscriptions are cancelled
+		http.Error(w, "Gone", http.StatusGone)
+		return
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(r.Body, maxContentSize))
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if !hmac.Equal([]byte(r.Header.Get("X-Hub-Signature")), []byte(signature(sub.Secret, content))) {
+		// Content with invalid signatures is acknowledged but ignored
+		log.WithError(ErrInvalidSignature).Warnf("ignoring content pushed for %s", topic)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if s.Notify != nil {
+		go s.Notify(topic)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// verify confirms the intent of (un)subscription requests we made
+func (s *Subscriber) verify(w http.ResponseWriter, r *http.Request, sub *Subscription) {
+	q := r.URL.Query()
+	mode, topic := q.Get("hub.mode"), q.Get("hub.topic")
+
+	switch {
+	case mode == "subscribe" && sub != nil && topic == sub.Topic:
+		lease := DefaultLease
+		if n, err := strconv.Atoi(q.Get("hub.lease_seconds")); err == nil && n > 0 {
+			lease = time.Duration(n) * time.Second
+		}
+		if lease > MaxLease {
+			lease = MaxLease
+		}
+
+		// Only (re)subscription requests we made can be verified, once
+		s.mu.Lock()
+		pending := sub.pending
+		if pending {
+			sub.pending = false
+			sub.Expires = time.Now().Add(lease)
+		}
+		s.mu.Unlock()
+
+		if !pending {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+	case mode == "unsubscribe" && sub == nil && topic == q.Get("topic"):
+	case mode == "denied" && sub != nil && topic == sub.Topic:
+		// Only subscriptions yet to be verified can be denied
+		s.mu.Lock()
+		pending := sub.pending && sub.Expires.IsZero() && s.subscriptions[sub.Topic] == sub
+		if pending {
+			delete(s.subscriptions, sub.Topic)
+		}
+		s.mu.Unlock()
+
+		if !pending {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		log.Warnf("subscription to %s denied: %s", topic, q.Get("hub.reason"))
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(q.Get("hub.challenge")))
+}
@@ -0,0 +1,135 @@
+// Package websub implements a WebSub (formerly PubSubHubbub) hub that pushes
+// updates of the pod's feeds to subscribers, and a subscriber to the hubs of
+// remote feeds, so that updates are delivered as they happen instead of being
+// polled for.
+package websub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jointwt/twtxt/internal/webmention"
+)
+
+const (
+	// DefaultLease is the lease of subscriptions that do not request one
+	DefaultLease = 10 * 24 * time.Hour
+
+	// MaxLease is the maximum lease of subscriptions
+	MaxLease = 30 * 24 * time.Hour
+
+	// RenewBefore is how long before their lease expires subscriptions to
+	// remote hubs are renewed
+	RenewBefore = time.Hour
+)
+
+var (
+	// ErrInvalidMode is returned for requests with a missing or unknown
+	// hub.mode
+	ErrInvalidMode = errors.New("error: invalid hub.mode")
+
+	// ErrInvalidTopic is returned for topics not published by the hub
+	ErrInvalidTopic = errors.New("error: invalid hub.topic")
+
+	// ErrInvalidCallback is returned for missing or non-http(s) callbacks
+	ErrInvalidCallback = errors.New("error: invalid hub.callback")
+
+	// ErrVerificationFailed is returned when the subscriber did not confirm
+	// the intent of a (un)subscription request
+	ErrVerificationFailed = errors.New("error: verification of intent failed")
+
+	// ErrInvalidSignature is returned for content pushed with a missing or
+	// invalid signature
+	ErrInvalidSignature = errors.New("error: invalid signature")
+)
+
+// Subscription is a subscription of a callback to a topic, either by a
+// subscriber of the pod's hub or by the pod to a remote hub
+type Subscription struct {
+	Topic    string
+	Hub      string
+	Callback string
+	Secret   string
+
+	// Token is part of the Callback of subscriptions to remote hubs so that
+	// only their hub can verify or push to them
+	Token string `json:",omitempty"`
+
+	// Expires is when the lease of the subscription expires, it is zero for
+	// subscriptions to remote hubs yet to be verified
+	Expires   time.Time
+	CreatedAt time.Time
+
+	// pending is true for subscriptions to remote hubs whose (re)subscription
+	// request is yet to be verified
+	pending bool
+}
+
+// ID returns the id of the subscription (of its topic and callback)
+func (s *Subscription) ID() string {
+	sum := sha256.Sum256([]byte(s.Topic + " " + s.Callback))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Expired returns true if the lease of the subscription expired before now
+func (s *Subscription) Expired(now time.Time) bool {
+	return !s.Expires.IsZero() && now.After(s.Expires)
+}
+
+// Bytes ...
+func (s *Subscription) Bytes() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+// LoadSubscription ...
+func LoadSubscription(data []byte) (*Subscription, error) {
+	sub := &Subscription{}
+	if err := json.Unmarshal(data, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Store persists the subscriptions to the hub
+type Store interface {
+	GetAllSubscriptions() ([]*Subscription, error)
+	SetSubscription(id string, sub *Subscription) error
+	DelSubscription(id string) error
+}
+
+// Discover returns the hub and self (topic) links advertised by the headers
+// of a response, either of which may be empty
+func Discover(header http.Header) (hub, self string) {
+	for _, link := range webmention.GetHeaderLinks(header["Link"]) {
+		if link.URL == nil {
+			continue
+		}
+		for _, rel := range link.Params["rel"] {
+			switch {
+			case rel == "hub" && hub == "":
+				hub = link.URL.String()
+			case rel == "self" && self == "":
+				self = link.URL.String()
+			}
+		}
+	}
+	return
+}
+
+// Links returns the value of the Link header advertising the hub of topic
+func Links(hub, topic string) string {
+	return fmt.Sprintf(`<%s>; rel="hub", <%s>; rel="self"`, hub, topic)
+}
+
+// signature returns the X-Hub-Signature of content signed with secret
+func signature(secret string, content []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(content)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,197 @@
+package websub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	subs map[string]*Subscription
+}
+
+func (m *memoryStore) GetAllSubscriptions() ([]*Subscription, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	var subs []*Subscription
+	for _, sub := range m.subs {
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+func (m *memoryStore) SetSubscription(id string, sub *Subscription) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.subs[id] = sub
+	return nil
+}
+
+func (m *memoryStore) DelSubscription(id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.subs, id)
+	return nil
+}
+
+func (m *memoryStore) len() int {
+	m.Lock()
+	defer m.Unlock()
+
+	return len(m.subs)
+}
+
+func TestDiscover(t *testing.T) {
+	header := http.Header{}
+	header.Set("Link", Links("https://example.com/websub/hub", "https://example.com/user/prologic/twtxt.txt"))
+
+	hub, self := Discover(header)
+	assert.Equal(t, "https://example.com/websub/hub", hub)
+	assert.Equal(t, "https://example.com/user/prologic/twtxt.txt", self)
+
+	hub, self = Discover(http.Header{})
+	assert.Empty(t, hub)
+	assert.Empty(t, self)
+}
+
+func TestSubscribeAndPublish(t *testing.T) {
+	store := &memoryStore{subs: make(map[string]*Subscription)}
+
+	pod := httptest.NewServer(nil)
+	defer pod.Close()
+
+	hub := NewHub(pod.URL+"/websub/hub", store, nil)
+	topic := pod.URL + "/user/prologic/twtxt.txt"
+	hub.Topics = func(t string) bool { return t == topic }
+	hub.Content = func(string) ([]byte, string, error) {
+		return []byte("2020-12-01T00:00:00Z\tHello World!\n"), "text/plain", nil
+	}
+	pod.Config.Handler = http.HandlerFunc(hub.HubEndpoint)
+
+	notified := make(chan string, 1)
+	remote := httptest.NewServer(nil)
+	defer remote.Close()
+
+	sub := NewSubscriber(remote.URL+"/websub/callback", nil)
+	sub.Notify = func(topic string) { notified <- topic }
+	remote.Config.Handler = http.HandlerFunc(sub.CallbackEndpoint)
+
+	require.NoError(t, sub.Subscribe(hub.URL, topic))
+	assert.Eventually(t, func() bool { return store.len() == 1 }, time.Second, 10*time.Millisecond)
+	assert.True(t, sub.Subscribed(topic))
+
+	// Topics the hub does not publish are rejected
+	assert.Error(t, sub.Subscribe(hub.URL, pod.URL+"/user/unknown/twtxt.txt"))
+
+	hub.pending[topic] = true
+	hub.flush()
+	select {
+	case got := <-notified:
+		assert.Equal(t, topic, got)
+	case <-time.After(time.Second):
+		t.Fatal("content was not delivered")
+	}
+
+	require.NoError(t, sub.Unsubscribe(topic))
+	assert.Eventually(t, func() bool { return store.len() == 0 }, time.Second, 10*time.Millisecond)
+	assert.False(t, sub.Subscribed(topic))
+}
+
+func TestCallbackSignature(t *testing.T) {
+	notified := make(chan string, 1)
+	sub := NewSubscriber("https://example.com/websub/callback", nil)
+	sub.Notify = func(topic string) { notified <- topic }
+
+	topic := "https://example.org/twtxt.txt"
+	sub.subscriptions[topic] = &Subscription{Topic: topic, Secret: "secret", Expires: time.Now().Add(DefaultLease)}
+
+	push := func(topic, sig string) int {
+		r := httptest.NewRequest(http.MethodPost, "/websub/callback?topic="+topic, nil)
+		r.Header.Set("X-Hub-Signature", sig)
+		w := httptest.NewRecorder()
+		sub.CallbackEndpoint(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusAccepted, push(topic, "sha256=invalid"))
+	assert.Len(t, notified, 0)
+
+	assert.Equal(t, http.StatusAccepted, push(topic, signature("secret", nil)))
+	assert.Equal(t, topic, <-notified)
+
+	assert.Equal(t, http.StatusGone, push("https://example.org/other.txt", signature("secret", nil)))
+}
+
+func TestCallbackDenied(t *testing.T) {
+	sub := NewSubscriber("https://example.com/websub/callback", nil)
+
+	verified := "https://example.org/twtxt.txt"
+	sub.subscriptions[verified] = &Subscription{Topic: verified, Expires: time.Now().Add(DefaultLease)}
+
+	pending := "https://example.org/pending.txt"
+	sub.subscriptions[pending] = &Subscription{Topic: pending, CreatedAt: time.Now(), pending: true}
+
+	deny := func(topic, hubTopic string) int {
+		q := url.Values{"topic": {topic}, "hub.mode": {"denied"}, "hub.topic": {hubTopic}}
+		r := httptest.NewRequest(http.MethodGet, "/websub/callback?"+q.Encode(), nil)
+		w := httptest.NewRecorder()
+		sub.CallbackEndpoint(w, r)
+		return w.Code
+	}
+
+	// Verified subscriptions cannot be cancelled by anyone who can make
+	// requests to the callback
+	assert.Equal(t, http.StatusNotFound, deny(verified, verified))
+	assert.True(t, sub.Subscribed(verified))
+
+	assert.Equal(t, http.StatusNotFound, deny(pending, verified))
+	assert.Contains(t, sub.subscriptions, pending)
+
+	assert.Equal(t, http.StatusOK, deny(pending, pending))
+	assert.NotContains(t, sub.subscriptions, pending)
+}
+
+func TestCallbackVerify(t *testing.T) {
+	sub := NewSubscriber("https://example.com/websub/callback", nil)
+
+	topic := "https://example.org/twtxt.txt"
+	sub.subscriptions[topic] = &Subscription{Topic: topic, Token: "token", CreatedAt: time.Now(), pending: true}
+
+	verify := func(token, lease string) int {
+		q := url.Values{
+			"topic":             {topic},
+			"token":             {token},
+			"hub.mode":          {"subscribe"},
+			"hub.topic":         {topic},
+			"hub.challenge":     {"challenge"},
+			"hub.lease_seconds": {lease},
+		}
+		r := httptest.NewRequest(http.MethodGet, "/websub/callback?"+q.Encode(), nil)
+		w := httptest.NewRecorder()
+		sub.CallbackEndpoint(w, r)
+		return w.Code
+	}
+
+	// Spoofed verifications without the callback's token are rejected
+	assert.Equal(t, http.StatusNotFound, verify("", "3600"))
+	assert.Equal(t, http.StatusNotFound, verify("guess", "3600"))
+	assert.False(t, sub.Subscribed(topic))
+
+	assert.Equal(t, http.StatusOK, verify("token", "86400"))
+	assert.True(t, sub.Subscribed(topic))
+	expires := sub.subscriptions[topic].Expires
+
+	// Unsolicited verifications cannot extend the lease
+	assert.Equal(t, http.StatusNotFound, verify("token", "999999999"))
+	assert.Equal(t, expires, sub.subscriptions[topic].Expires)
+}
@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxWebSubRequestSize is the maximum size of (un)subscription requests
+const maxWebSubRequestSize = 1 << 14
+
+// WebSubHubHandler handles (un)subscription requests to the pod's hub
+func (s *Server) WebSubHubHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxWebSubRequestSize)
+		defer r.Body.Close()
+		websubs.hub.HubEndpoint(w, r)
+	}
+}
+
+// WebSubCallbackHandler handles the verification of subscriptions to remote
+// hubs and the content they push
+func (s *Server) WebSubCallbackHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		defer r.Body.Close()
+		websubs.subscriber.CallbackEndpoint(w, r)
+	}
+}
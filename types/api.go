@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"time"
 )
 
 // AuthRequest ...
@@ -53,10 +54,28 @@ func NewRegisterRequest(r io.Reader) (req RegisterRequest, err error) {
 	return
 }
 
+// PodConfigResponse ...
+type PodConfigResponse struct {
+	Name        string `json:"Name"`
+	Logo        string `json:"Logo"`
+	Description string `json:"Description"`
+
+	MaxTwtLength int `json:"MaxTwtLength"`
+
+	OpenProfiles      bool `json:"OpenProfiles"`
+	OpenRegistrations bool `json:"OpenRegistrations"`
+}
+
 // PostRequest ...
 type PostRequest struct {
 	PostAs string `json:"post_as"`
 	Text   string `json:"text"`
+
+	// Hash, if set, is the hash of a twt to edit (replace) with Text
+	Hash string `json:"hash"`
+
+	// PostAt, if set, schedules the twt to be posted at a later time
+	PostAt *time.Time `json:"post_at,omitempty"`
 }
 
 // NewPostRequest ...
@@ -69,6 +88,218 @@ func NewPostRequest(r io.Reader) (req PostRequest, err error) {
 	return
 }
 
+// DeleteRequest ...
+type DeleteRequest struct {
+	Hash string `json:"hash"`
+}
+
+// NewDeleteRequest ...
+func NewDeleteRequest(r io.Reader) (req DeleteRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
+// ScheduledTwt ...
+type ScheduledTwt struct {
+	ID        string    `json:"id"`
+	Feed      string    `json:"feed"`
+	Text      string    `json:"text"`
+	PostAt    time.Time `json:"post_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ScheduledTwtsResponse ...
+type ScheduledTwtsResponse struct {
+	ScheduledTwts []ScheduledTwt `json:"scheduled_twts"`
+}
+
+// UpdateScheduledTwtRequest ...
+type UpdateScheduledTwtRequest struct {
+	Text   string    `json:"text"`
+	PostAt time.Time `json:"post_at"`
+}
+
+// NewUpdateScheduledTwtRequest ...
+func NewUpdateScheduledTwtRequest(r io.Reader) (req UpdateScheduledTwtRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
+// UploadMediaResponse is the location of uploaded media, if Type is
+// "taskURI" then Path is the url of the task still processing the media
+type UploadMediaResponse struct {
+	Type string `json:"Type"`
+	Path string `json:"Path"`
+}
+
+// TaskResponse is the state of a task processing uploaded media, once
+// complete Data["mediaURI"] is the url of the media
+type TaskResponse struct {
+	State string            `json:"state"`
+	Error string            `json:"error"`
+	Data  map[string]string `json:"data"`
+}
+
+// SettingsRequest is sent as a (multipart) form along with an optional
+// avatar_file
+type SettingsRequest struct {
+	Email    string
+	Tagline  string
+	Password string
+
+	IsFollowersPubliclyVisible bool
+	IsFollowingPubliclyVisible bool
+}
+
+// SettingsResponse ...
+type SettingsResponse struct {
+	Username  string    `json:"Username"`
+	Tagline   string    `json:"Tagline"`
+	URL       string    `json:"URL"`
+	CreatedAt time.Time `json:"CreatedAt"`
+
+	Theme                      string `json:"Theme"`
+	Lang                       string `json:"Lang"`
+	DisplayDatesInTimezone     string `json:"DisplayDatesInTimezone"`
+	IsFollowersPubliclyVisible bool   `json:"IsFollowersPubliclyVisible"`
+	IsFollowingPubliclyVisible bool   `json:"IsFollowingPubliclyVisible"`
+	IsBookmarksPubliclyVisible bool   `json:"IsBookmarksPubliclyVisible"`
+
+	Feeds     []string          `json:"Feeds"`
+	Followers map[string]string `json:"Followers"`
+	Following map[string]string `json:"Following"`
+	Muted     map[string]string `json:"Muted"`
+}
+
+// Notification ...
+type Notification struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	From      Twter     `json:"from"`
+	Text      string    `json:"text"`
+	URL       string    `json:"url"`
+	Read      bool      `json:"read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NotificationsResponse ...
+type NotificationsResponse struct {
+	Notifications []Notification `json:"notifications"`
+	Unread        int            `json:"unread"`
+}
+
+// ReadNotificationsRequest marks the notifications with the given ids (or all
+// notifications if none are given) as read
+type ReadNotificationsRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// NewReadNotificationsRequest ...
+func NewReadNotificationsRequest(r io.Reader) (req ReadNotificationsRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
+// Token is an API token of a user, its Value is only returned when the
+// token is created
+type Token struct {
+	Signature  string    `json:"signature"`
+	Value      string    `json:"value,omitempty"`
+	Name       string    `json:"name"`
+	ClientID   string    `json:"client_id"`
+	UserAgent  string    `json:"user_agent"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// TokensResponse ...
+type TokensResponse struct {
+	Tokens []Token `json:"tokens"`
+}
+
+// TokenRequest creates a personal access token limited to Scopes (read,
+// post, follow or admin) that expires at ExpiresAt unless it is zero
+type TokenRequest struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewTokenRequest ...
+func NewTokenRequest(r io.Reader) (req TokenRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
+// OAuthTokenResponse is the response of the OAuth2 token endpoint
+// (RFC 6749 section 5.1)
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	Scope       string `json:"scope"`
+}
+
+// OAuthErrorResponse is an error of the OAuth2 token endpoint (RFC 6749
+// section 5.2)
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// FeedHealth ...
+type FeedHealth struct {
+	URL         string    `json:"url"`
+	Nick        string    `json:"nick"`
+	Healthy     bool      `json:"healthy"`
+	LastFetch   time.Time `json:"last_fetch"`
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error"`
+	LastStatus  int       `json:"last_status"`
+	Bytes       int64     `json:"bytes"`
+	Failures    int       `json:"failures"`
+	NextFetch   time.Time `json:"next_fetch"`
+	Disabled    bool      `json:"disabled"`
+}
+
+// FeedHealthResponse ...
+type FeedHealthResponse struct {
+	Feeds []FeedHealth `json:"feeds"`
+}
+
+// ManageFeedRequest ...
+type ManageFeedRequest struct {
+	URL      string `json:"url"`
+	Disabled bool   `json:"disabled"`
+}
+
+// NewManageFeedRequest ...
+func NewManageFeedRequest(r io.Reader) (req ManageFeedRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
 // PagedRequest ...
 type PagedRequest struct {
 	Page int `json:"page"`
@@ -143,6 +374,10 @@ type ProfileResponse struct {
 	Links        Links        `json:"links"`
 	Alternatives Alternatives `json:"alternatives"`
 	Twter        Twter        `json:"twter"`
+
+	// Twts is the requested page (?p=) of the profile's twts
+	Twts  Twts          `json:"twts"`
+	Pager PagerResponse `json:"pager"`
 }
 
 // ConversationRequest ...
@@ -161,6 +396,51 @@ func NewConversationRequest(r io.Reader) (req ConversationRequest, err error) {
 	return
 }
 
+// ConversationResponse is the requested page of a conversation's twts (newest
+// first) along with the complete conversation as a tree of nested replies
+type ConversationResponse struct {
+	Twts   Twts          `json:"twts"`
+	Thread *Thread       `json:"thread"`
+	Pager  PagerResponse `json:"Pager"`
+}
+
+// ThreadRequest ...
+type ThreadRequest struct {
+	Hash string `json:"hash"`
+}
+
+// NewThreadRequest ...
+func NewThreadRequest(r io.Reader) (req ThreadRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
+// ThreadResponse is the complete thread (tree) of a conversation
+type ThreadResponse struct {
+	Thread *Thread `json:"thread"`
+	Count  int     `json:"count"`
+}
+
+// SearchRequest ...
+type SearchRequest struct {
+	Query string `json:"query"`
+	Page  int    `json:"page"`
+}
+
+// NewSearchRequest ...
+func NewSearchRequest(r io.Reader) (req SearchRequest, err error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
+
 // FetchTwtsRequest ...
 type FetchTwtsRequest struct {
 	URL  string `json:"url"`
@@ -105,11 +105,55 @@ func (lis Comments) GetAll(prefix string) []types.Value {
 	return nlis
 }
 
+// Edits returns the `# edit = <hash> <new hash>` and `# delete = <hash>`
+// records of the feed in the order they appear.
+func (lis Comments) Edits() []types.Edit {
+	var edits []types.Edit
+
+	for _, c := range lis {
+		sp := strings.Fields(c.value)
+		switch {
+		case c.key == "edit" && len(sp) == 2:
+			edits = append(edits, types.Edit{Hash: sp[0], Replacement: sp[1]})
+		case c.key == "delete" && len(sp) == 1:
+			edits = append(edits, types.Edit{Hash: sp[0]})
+		}
+	}
+
+	return edits
+}
+
+// Links returns the `# link = <title> <url>` records of the feed (the title
+// may have spaces), relative urls are resolved against the feed's url base.
+func (lis Comments) Links(base string) types.Links {
+	var links types.Links
+
+	for _, c := range lis {
+		sp := strings.Fields(c.value)
+		if c.key != "link" || len(sp) < 2 {
+			continue
+		}
+		links = append(links, types.Link{
+			Title: strings.Join(sp[:len(sp)-1], " "),
+			Href:  ResolveURL(base, sp[len(sp)-1]),
+		})
+	}
+
+	return links
+}
+
+// Followers returns the `# follow = <nick> <url>` records of the feed, that is
+// the feeds it follows
 func (lis Comments) Followers() []types.Twter {
 	flis := lis.GetAll("follow")
 	nlis := make([]types.Twter, 0, len(flis))
 
 	for _, o := range flis {
+		// Only `follow` itself and not keys it prefixes (e.g: `follower`)
+		if o.Key() != "follow" {
+			continue
+		}
+
 		sp := strings.Fields(o.Value())
 		if len(sp) < 2 {
 			continue
@@ -888,7 +932,12 @@ func (twt *Twt) ExpandLinks(opts types.FmtOpts, lookup types.FeedLookup) {
 
 	for i, m := range twt.mentions {
 		if lookup != nil && m.target == "" {
-			twter := lookup.FeedLookup(m.name)
+			nick := m.name
+			if m.domain != "" {
+				nick = fmt.Sprintf("%s@%s", m.name, m.domain)
+			}
+
+			twter := lookup.FeedLookup(nick)
 			m.name = twter.Nick
 			if sp := strings.SplitN(twter.Nick, "@", 2); len(sp) == 2 {
 				m.name = sp[0]
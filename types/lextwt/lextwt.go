@@ -3,6 +3,7 @@ package lextwt
 import (
 	"fmt"
 	"io"
+	"net/url"
 	"strings"
 	"time"
 
@@ -78,8 +79,41 @@ func ParseFile(r io.Reader, twter types.Twter) (types.TwtFile, error) {
 		f.twter.URL = v.Value()
 	}
 
+	// An avatar given by the caller (e.g: a local copy) takes precedence
+	if v, ok := f.Info().GetN("avatar", 0); ok && f.twter.Avatar == "" {
+		f.twter.Avatar = ResolveURL(f.twter.URL, v.Value())
+	}
+
+	if v, ok := f.Info().GetN("description", 0); ok {
+		f.twter.Tagline = v.Value()
+	}
+
+	f.twter.Links = f.comments.Links(f.twter.URL)
+
+	for _, follow := range f.comments.Followers() {
+		if f.twter.Follow == nil {
+			f.twter.Follow = make(map[string]types.Twter)
+		}
+		f.twter.Follow[follow.Nick] = follow
+	}
+
 	return f, nil
 }
+
+// ResolveURL resolves ref (e.g: a relative avatar url) against the url of
+// the feed base, ref is returned as is if either cannot be parsed
+func ResolveURL(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	u, err := b.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
 func ParseLine(line string, twter types.Twter) (twt types.Twt, err error) {
 	if line == "" {
 		return types.NilTwt, nil
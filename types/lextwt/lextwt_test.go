@@ -987,6 +987,66 @@ func TestParseFile(t *testing.T) {
 	}
 }
 
+func TestParseFileEdits(t *testing.T) {
+	is := is.New(t)
+
+	twter := types.Twter{Nick: "example", URL: "https://example.com/twtxt.txt"}
+
+	f, err := lextwt.ParseFile(strings.NewReader(`# nick = example
+# edit = abcdefg hijklmn
+# delete = opqrstu
+# delete = invalid record
+# editor = vim
+
+2020-12-02T01:04:00Z	Hello World!
+`), twter)
+	is.NoErr(err)
+
+	edits := f.Info().Edits()
+	is.Equal(len(edits), 2)
+	is.Equal(edits[0], types.Edit{Hash: "abcdefg", Replacement: "hijklmn"})
+	is.True(!edits[0].IsDelete())
+	is.Equal(edits[1], types.Edit{Hash: "opqrstu"})
+	is.True(edits[1].IsDelete())
+}
+
+func TestParseFileMetadata(t *testing.T) {
+	is := is.New(t)
+
+	twter := types.Twter{Nick: "example", URL: "https://example.com/twtxt.txt"}
+
+	f, err := lextwt.ParseFile(strings.NewReader(`# nick = override
+# avatar = /avatar.png
+# description = Just an example
+# link = My Website https://example.com/
+# link = Blog blog/
+# follow = xuu https://txt.sour.is/users/xuu.txt
+# follow = invalid
+
+2020-12-02T01:04:00Z	Hello World!
+`), twter)
+	is.NoErr(err)
+
+	override := f.Twter()
+	is.Equal(override.Nick, "override")
+	is.Equal(override.Avatar, "https://example.com/avatar.png")
+	is.Equal(override.Tagline, "Just an example")
+	is.Equal(override.Links, types.Links{
+		{Title: "My Website", Href: "https://example.com/"},
+		{Title: "Blog", Href: "https://example.com/blog/"},
+	})
+	is.Equal(len(override.Follow), 1)
+	is.Equal(override.Follow["xuu"], types.Twter{Nick: "xuu", URL: "https://txt.sour.is/users/xuu.txt"})
+
+	is.Equal(f.Twts()[0].Twter().Tagline, "Just an example")
+
+	// An avatar given by the caller takes precedence
+	twter.Avatar = "https://example.net/avatar.png"
+	f, err = lextwt.ParseFile(strings.NewReader("# avatar = /avatar.png\n"), twter)
+	is.NoErr(err)
+	is.Equal(f.Twter().Avatar, "https://example.net/avatar.png")
+}
+
 func parseTime(s string) time.Time {
 	if dt, err := time.Parse(time.RFC3339, s); err == nil {
 		return dt
@@ -996,6 +1056,7 @@ func parseTime(s string) time.Time {
 
 type testExpandLinksCase struct {
 	twt    types.Twt
+	nick   string
 	target *types.Twter
 }
 
@@ -1014,13 +1075,27 @@ func TestExpandLinks(t *testing.T) {
 			),
 			target: &types.Twter{Nick: "asdf", URL: "http://example.com/asdf.txt"},
 		},
+		{
+			twt: lextwt.NewTwt(
+				twter,
+				lextwt.NewDateTime(parseTime("2021-01-24T02:19:54Z"), "2021-01-24T02:19:54Z"),
+				lextwt.NewMention("xuu@sour.is", ""),
+			),
+			nick:   "xuu@sour.is",
+			target: &types.Twter{Nick: "xuu", URL: "https://sour.is/xuu/twtxt.txt"},
+		},
 	}
 
 	is := is.New(t)
 
 	for i, tt := range tests {
 		t.Logf("TestExpandLinks %d - %s", i, tt.target)
-		lookup := types.FeedLookupFn(func(s string) *types.Twter { return tt.target })
+		lookup := types.FeedLookupFn(func(s string) *types.Twter {
+			if tt.nick != "" {
+				is.Equal(s, tt.nick)
+			}
+			return tt.target
+		})
 		tt.twt.ExpandLinks(conf, lookup)
 		is.Equal(tt.twt.Mentions()[0].Twter().Nick, tt.target.Nick)
 		is.Equal(tt.twt.Mentions()[0].Twter().URL, tt.target.URL)
@@ -24,6 +24,9 @@ type Profile struct {
 	Followers map[string]string
 	Following map[string]string
 
+	// Links are the links declared by the feed (`# link = <title> <url>`)
+	Links Links
+
 	// `true` if the User viewing the Profile has permissions to show the
 	// bookmarks/followers/followings of this user/feed
 	ShowBookmarks bool
@@ -32,8 +35,9 @@ type Profile struct {
 }
 
 type Link struct {
-	Href string
-	Rel  string
+	Href  string
+	Rel   string
+	Title string
 }
 
 type Alternative struct {
@@ -478,7 +478,13 @@ func ExpandMentions(opts types.FmtOpts, lookup types.FeedLookup, text string) st
 		mentionedDomain := parts[2]
 
 		if mentionedNick != "" && mentionedDomain != "" {
-			// TODO: Validate the remote end for a valid Twtxt pod?
+			if lookup != nil {
+				handle := fmt.Sprintf("%s@%s", mentionedNick, mentionedDomain)
+				if twter := lookup.FeedLookup(handle); twter.URL != "" {
+					return fmt.Sprintf("@<%s %s>", twter.Nick, twter.URL)
+				}
+			}
+
 			// XXX: Should we always assume https:// ?
 			return fmt.Sprintf(
 				"@<%s https://%s/user/%s/twtxt.txt>",
@@ -0,0 +1,57 @@
+package types
+
+import (
+	"encoding/json"
+)
+
+// Thread is a twt and the replies to it, which are threads in turn, making up
+// a conversation. Replies are ordered oldest first.
+type Thread struct {
+	Twt     Twt       `json:"twt"`
+	Replies []*Thread `json:"replies"`
+}
+
+// Twts returns the twts of the thread depth first, every twt before its replies
+func (t *Thread) Twts() Twts {
+	if t == nil {
+		return nil
+	}
+
+	twts := Twts{t.Twt}
+	for _, reply := range t.Replies {
+		twts = append(twts, reply.Twts()...)
+	}
+	return twts
+}
+
+// Len returns the number of twts in the thread
+func (t *Thread) Len() int {
+	if t == nil {
+		return 0
+	}
+
+	n := 1
+	for _, reply := range t.Replies {
+		n += reply.Len()
+	}
+	return n
+}
+
+// UnmarshalJSON decodes a thread, its twts are decoded with DecodeJSON
+func (t *Thread) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Twt     json.RawMessage `json:"twt"`
+		Replies []*Thread       `json:"replies"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	twt, err := DecodeJSON(raw.Twt)
+	if err != nil {
+		return err
+	}
+
+	t.Twt, t.Replies = twt, raw.Replies
+	return nil
+}
@@ -23,6 +23,7 @@ type Twter struct {
 	URL     string
 	Avatar  string
 	Tagline string
+	Links   Links
 	Follow  map[string]Twter
 }
 
@@ -370,9 +371,22 @@ type TwtFile interface {
 
 type Info interface {
 	Followers() []Twter
+	Edits() []Edit
 
 	KV
 }
+
+// Edit is a `# edit = <hash> <new hash>` or `# delete = <hash>` feed
+// metadata record noting that the twt Hash was replaced by the twt
+// Replacement, or deleted if Replacement is empty.
+type Edit struct {
+	Hash        string
+	Replacement string
+}
+
+// IsDelete returns true if the record is a deletion (tombstone)
+func (e Edit) IsDelete() bool { return e.Replacement == "" }
+
 type KV interface {
 	GetN(string, int) (Value, bool)
 	GetAll(string) []Value